@@ -4,7 +4,9 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -17,11 +19,24 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 
+	"github.com/zlc_ai/uip-gateway/internal/adapter/bridge"
 	"github.com/zlc_ai/uip-gateway/internal/adapter/local"
+	"github.com/zlc_ai/uip-gateway/internal/adapter/matrix"
+	"github.com/zlc_ai/uip-gateway/internal/attachment"
 	"github.com/zlc_ai/uip-gateway/internal/clawdbot"
 	"github.com/zlc_ai/uip-gateway/internal/config"
+	"github.com/zlc_ai/uip-gateway/internal/cors"
 	"github.com/zlc_ai/uip-gateway/internal/gateway"
+	"github.com/zlc_ai/uip-gateway/internal/history"
+	"github.com/zlc_ai/uip-gateway/internal/httperr"
+	"github.com/zlc_ai/uip-gateway/internal/httplimit"
+	"github.com/zlc_ai/uip-gateway/internal/i18n"
 	"github.com/zlc_ai/uip-gateway/internal/imwebhook"
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+	"github.com/zlc_ai/uip-gateway/internal/openai"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+	"github.com/zlc_ai/uip-gateway/internal/security"
+	"github.com/zlc_ai/uip-gateway/internal/tlsconfig"
 	"github.com/zlc_ai/uip-gateway/internal/transport"
 )
 
@@ -35,6 +50,7 @@ func main() {
 	configPath := flag.String("config", "config.yaml", "Path to configuration file")
 	useMock := flag.Bool("mock", false, "Use mock Clawdbot client (for testing)")
 	showVersion := flag.Bool("version", false, "Show version information")
+	selfTest := flag.Bool("selftest", false, "Run the startup self-test (same as server.selftest)")
 	flag.Parse()
 
 	if *showVersion {
@@ -43,7 +59,7 @@ func main() {
 	}
 
 	// Load configuration
-	cfg, err := config.Load(*configPath)
+	cfg, warnings, err := config.Load(*configPath)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to load config: %v\n", err)
 		os.Exit(1)
@@ -56,10 +72,40 @@ func main() {
 	logger.Info("Starting UIP Gateway",
 		zap.String("version", version),
 		zap.String("config", *configPath))
+	for _, w := range warnings {
+		logger.Warn("Config warning: " + w)
+	}
+
+	// Load system message catalog
+	catalog := i18n.NewCatalog(cfg.Gateway.DefaultLocale)
+	if cfg.Gateway.CatalogPath != "" {
+		if err := catalog.LoadFile(cfg.Gateway.CatalogPath); err != nil {
+			logger.Fatal("Failed to load message catalog", zap.Error(err))
+		}
+	}
+	if cfg.Clawdbot.UniversalIM.PendingReply != "" {
+		catalog.Register(catalog.DefaultLocale(), map[string]string{
+			i18n.KeyPendingReply: cfg.Clawdbot.UniversalIM.PendingReply,
+		})
+	}
+
+	// Create attachment proxy if enabled
+	var attachmentProxy *attachment.Proxy
+	if cfg.Attachments.Enabled {
+		attachmentProxy = attachment.NewProxy(attachment.Config{
+			PublicURL:    cfg.Attachments.PublicURL,
+			MaxSize:      cfg.Attachments.MaxSize,
+			MaxTotalSize: cfg.Attachments.MaxTotalSize,
+			MaxItems:     cfg.Attachments.MaxItems,
+			AllowPrivate: cfg.Attachments.AllowPrivateHosts,
+			TTL:          cfg.Attachments.TTL,
+		}, logger)
+	}
 
 	// Create OpenClaw client
 	var clawdbotClient clawdbot.Client
 	var openclawClient *clawdbot.OpenclawClient
+	var conversations *history.History
 
 	if *useMock {
 		logger.Info("Using mock OpenClaw client")
@@ -71,42 +117,240 @@ func main() {
 			zap.String("accountId", cfg.Clawdbot.UniversalIM.AccountID),
 			zap.String("transport", cfg.Clawdbot.UniversalIM.Transport))
 		openclawClient, err = clawdbot.NewOpenclawClient(clawdbot.Config{
-			Endpoint:   cfg.Clawdbot.Endpoint,
-			Timeout:    cfg.Clawdbot.Timeout,
-			MaxRetries: cfg.Clawdbot.RetryPolicy.MaxRetries,
-			Insecure:   cfg.Clawdbot.Insecure,
+			Endpoint:            cfg.Clawdbot.Endpoint,
+			Timeout:             cfg.Clawdbot.Timeout,
+			MaxRetries:          cfg.Clawdbot.RetryPolicy.MaxRetries,
+			MaxInterval:         cfg.Clawdbot.RetryPolicy.MaxInterval,
+			Insecure:            cfg.Clawdbot.Insecure,
+			MaxIdleConns:        cfg.Clawdbot.MaxIdleConns,
+			MaxIdleConnsPerHost: cfg.Clawdbot.MaxIdleConnsPerHost,
+			IdleConnTimeout:     cfg.Clawdbot.IdleConnTimeout,
+			MaxConnLifetime:     cfg.Clawdbot.MaxConnLifetime,
 		}, clawdbot.OpenclawClientConfig{
 			Secret:      cfg.Clawdbot.UniversalIM.Secret,
 			AccountID:   cfg.Clawdbot.UniversalIM.AccountID,
 			WebhookPath: cfg.Clawdbot.UniversalIM.WebhookPath,
+			Accounts:    openclawAccounts(cfg.Clawdbot.UniversalIM.Accounts),
+
+			OutboundAuthHeader: cfg.Clawdbot.UniversalIM.OutboundAuthHeader,
+			OutboundSecret:     cfg.Clawdbot.UniversalIM.OutboundSecret,
+			SignatureTolerance: cfg.Clawdbot.UniversalIM.SignatureTolerance,
+			PendingReplyText:   cfg.Clawdbot.UniversalIM.PendingReply,
+			SessionContextTTL:  cfg.Clawdbot.UniversalIM.SessionContextTTL,
+			MaxPendingContexts: cfg.Clawdbot.UniversalIM.MaxPendingContexts,
+
+			Model:            cfg.Clawdbot.UniversalIM.Model,
+			Generation:       cfg.Clawdbot.UniversalIM.Generation,
+			SystemPrompts:    systemPrompts(cfg.Clawdbot.UniversalIM.SystemPrompt),
+			MaxContinuations: cfg.Clawdbot.UniversalIM.MaxContinuations,
+			ContinuePrompt:   cfg.Clawdbot.UniversalIM.ContinuePrompt,
+			TargetKinds:      cfg.Clawdbot.UniversalIM.TargetKinds,
 		}, logger)
+		if err == nil {
+			openclawClient.SetCatalog(catalog)
+			if cfg.Security.Replay.Enabled {
+				openclawClient.SetReplayGuard(security.NewReplayGuard(security.ReplayConfig{
+					Window:    cfg.Security.Replay.Window,
+					CacheSize: cfg.Security.Replay.CacheSize,
+				}))
+			}
+			if attachmentProxy != nil {
+				openclawClient.SetAttachmentRehoster(attachmentProxy)
+			}
+			openclawClient.SetAttachmentLimits(cfg.Attachments.SizeLimits())
+			if cfg.Session.History.Enabled {
+				pruner, err := history.NewPruner(cfg.Session.History.Strategy, cfg.Session.History.Limit)
+				if err != nil {
+					logger.Fatal("Invalid session history config", zap.Error(err))
+				}
+				conversations = history.New(history.Config{Pruner: pruner})
+				openclawClient.SetHistory(conversations)
+			}
+		}
 		if err != nil {
 			logger.Fatal("Failed to create OpenClaw client", zap.Error(err))
 		}
 		clawdbotClient = openclawClient
 	} else {
 		clawdbotClient, err = clawdbot.NewHTTPClient(clawdbot.Config{
-			Endpoint:   cfg.Clawdbot.Endpoint,
-			Timeout:    cfg.Clawdbot.Timeout,
-			MaxRetries: cfg.Clawdbot.RetryPolicy.MaxRetries,
-			Insecure:   cfg.Clawdbot.Insecure,
+			Endpoint:            cfg.Clawdbot.Endpoint,
+			Timeout:             cfg.Clawdbot.Timeout,
+			MaxRetries:          cfg.Clawdbot.RetryPolicy.MaxRetries,
+			MaxInterval:         cfg.Clawdbot.RetryPolicy.MaxInterval,
+			Insecure:            cfg.Clawdbot.Insecure,
+			MaxIdleConns:        cfg.Clawdbot.MaxIdleConns,
+			MaxIdleConnsPerHost: cfg.Clawdbot.MaxIdleConnsPerHost,
+			IdleConnTimeout:     cfg.Clawdbot.IdleConnTimeout,
+			MaxConnLifetime:     cfg.Clawdbot.MaxConnLifetime,
 		}, logger)
 		if err != nil {
 			logger.Fatal("Failed to create OpenClaw client", zap.Error(err))
 		}
 	}
+	if cfg.Clawdbot.MaxConcurrent > 0 {
+		logger.Info("Limiting concurrent OpenClaw requests",
+			zap.Int("maxConcurrent", cfg.Clawdbot.MaxConcurrent))
+		clawdbotClient = clawdbot.NewLimitedClient(clawdbotClient, cfg.Clawdbot.MaxConcurrent)
+	}
 
 	// Create gateway
-	gw := gateway.New(gateway.Config{
-		WorkerCount: 10,
-		QueueSize:   1000,
+	gwConfig := gateway.Config{
+		WorkerCount: cfg.Gateway.WorkerCount,
+		QueueSize:   cfg.Gateway.QueueSize,
 		SessionTTL:  cfg.Session.TTL,
-	}, clawdbotClient, logger)
+		AskTimeout:  cfg.Session.AskTimeout,
+		Mode:        cfg.Gateway.Mode,
+
+		SerializePerSession: cfg.Gateway.SerializePerSession,
+		WorkerAffinity:      cfg.Gateway.WorkerAffinity,
+		QueueFullPolicy:     cfg.Gateway.QueueFullPolicy,
+		EnqueueTimeout:      cfg.Gateway.EnqueueTimeout,
+		BusyReply:           cfg.Gateway.BusyReply.Enabled,
+		BusyReplyTemplate:   cfg.Gateway.BusyReply.Message,
+		BusyReplyInterval:   cfg.Gateway.BusyReply.Interval,
+
+		RespondOnlyWhenMentioned: cfg.Gateway.RespondOnlyWhenMentioned,
+		RespondToEdits:           cfg.Gateway.RespondToEdits,
+		ForwardReactions:         cfg.Gateway.ForwardReactions,
+		DedupWindow:              cfg.Gateway.DedupWindow,
+		DedupWindows:             cfg.Gateway.DedupWindows,
+		ConversationCapabilities: cfg.Gateway.ConversationCapabilities,
+		DryRun:                   cfg.Gateway.DryRun,
+		CrashOnPanic:             cfg.Gateway.CrashOnPanic,
+
+		SessionKeyStrategy: cfg.Session.KeyStrategy,
+
+		ErrorReplyTemplate:   cfg.Gateway.ErrorReply,
+		TimeoutReplyTemplate: cfg.Gateway.TimeoutReply,
+		DefaultLocale:        cfg.Gateway.DefaultLocale,
+		Catalog:              catalog,
+		RecentEventsSize:     cfg.Gateway.Debug.RecentEvents,
+	}
+	if openclawClient != nil {
+		// Drop OpenClaw routing context and history for conversations that went idle
+		gwConfig.OnSessionExpire = func(session protocol.Session) {
+			openclawClient.ClearSessionContext(session.RoutingKey())
+			if conversations != nil {
+				conversations.Clear(context.Background(), session.RoutingKey())
+			}
+		}
+	}
+	if cfg.Gateway.AutoScale.Enabled {
+		gwConfig.MinWorkers = cfg.Gateway.AutoScale.MinWorkers
+		gwConfig.MaxWorkers = cfg.Gateway.AutoScale.MaxWorkers
+		gwConfig.ScaleUpDepth = cfg.Gateway.AutoScale.ScaleUpDepth
+		gwConfig.ScaleDownDepth = cfg.Gateway.AutoScale.ScaleDownDepth
+		gwConfig.ScaleInterval = cfg.Gateway.AutoScale.Interval
+	}
+	gw := gateway.New(gwConfig, clawdbotClient, logger)
+	if gwConfig.DryRun {
+		logger.Warn("Gateway running in dry-run mode: replies are logged, not sent")
+	}
+	if cfg.Gateway.Sources.Enabled {
+		extractor, err := gateway.NewSourceExtractor(gateway.SourceExtractorConfig{
+			Patterns:  cfg.Gateway.Sources.Patterns,
+			JSONBlock: cfg.Gateway.Sources.JSONBlock,
+		})
+		if err != nil {
+			logger.Fatal("Invalid source extraction config", zap.Error(err))
+		}
+		gw.SetSourceExtractor(extractor)
+	}
+	filter, err := gateway.NewEventFilter(gateway.FilterConfig{
+		AllowChannels: cfg.Gateway.Filters.AllowChannels,
+		DenyChannels:  cfg.Gateway.Filters.DenyChannels,
+		AllowUsers:    cfg.Gateway.Filters.AllowUsers,
+		DenyUsers:     cfg.Gateway.Filters.DenyUsers,
+		DropBots:      cfg.Gateway.Filters.DropBots,
+		AllowBots:     cfg.Gateway.Filters.AllowBots,
+		LogDropped:    cfg.Gateway.Filters.LogDropped,
+	})
+	if err != nil {
+		logger.Fatal("Invalid gateway filter config", zap.Error(err))
+	}
+	gw.SetFilter(filter)
+	if pp := cfg.Gateway.Preprocess; pp.StripPrefix || len(pp.Commands) > 0 || pp.NormalizeUnicode || pp.Trim {
+		preprocessor, err := gateway.NewPreprocessor(gateway.PreprocessConfig{
+			StripPrefix:      pp.StripPrefix,
+			BotNames:         pp.BotNames,
+			Commands:         pp.Commands,
+			NormalizeUnicode: pp.NormalizeUnicode,
+			Trim:             pp.Trim,
+		})
+		if err != nil {
+			logger.Fatal("Invalid gateway preprocess config", zap.Error(err))
+		}
+		gw.SetPreprocessor(preprocessor)
+	}
+	if cf := cfg.Gateway.ContentFilter; len(cf.Redact) > 0 || len(cf.Block) > 0 {
+		rules := make([]gateway.RedactRule, 0, len(cf.Redact))
+		for _, r := range cf.Redact {
+			rules = append(rules, gateway.RedactRule{Name: r.Name, Pattern: r.Pattern, Replacement: r.Replacement})
+		}
+		contentFilter, err := gateway.NewContentFilter(gateway.ContentFilterConfig{
+			Redact:         rules,
+			Block:          cf.Block,
+			BlockedMessage: cf.BlockedMessage,
+		})
+		if err != nil {
+			logger.Fatal("Invalid gateway content filter config", zap.Error(err))
+		}
+		gw.SetContentFilter(contentFilter)
+	}
+	if len(cfg.Gateway.Ignore) > 0 {
+		rules := make([]gateway.IgnoreRule, 0, len(cfg.Gateway.Ignore))
+		for _, r := range cfg.Gateway.Ignore {
+			rules = append(rules, gateway.IgnoreRule{Pattern: r.Pattern, Match: r.Match, IgnoreCase: r.IgnoreCase})
+		}
+		ignoreList, err := gateway.NewIgnoreList(rules)
+		if err != nil {
+			logger.Fatal("Invalid gateway ignore config", zap.Error(err))
+		}
+		gw.SetIgnoreList(ignoreList)
+	}
+	var eventTap *gateway.EventTap
+	if dbg := cfg.Gateway.Debug; dbg.SampleRate > 0 {
+		eventTap, err = gateway.NewEventTap(gateway.TapConfig{
+			SampleRate: dbg.SampleRate,
+			URL:        dbg.TapURL,
+			File:       dbg.TapFile,
+		}, logger)
+		if err != nil {
+			logger.Fatal("Invalid gateway debug tap config", zap.Error(err))
+		}
+		gw.SetEventTap(eventTap)
+	}
+	gw.RegisterInboundMiddleware(gateway.LimitInboundAttachments(cfg.Attachments.SizeLimits(), cfg.Attachments.Oversized))
+	gw.RegisterOutboundMiddleware(gateway.LimitOutboundAttachments(cfg.Attachments.SizeLimits(), logger))
+
+	// Cross-origin access for browser clients, shared by the HTTP API and
+	// the local adapter's WebSocket
+	corsPolicy := cors.New(cors.Config{
+		AllowedOrigins:   cfg.Server.CORS.AllowedOrigins,
+		AllowedMethods:   cfg.Server.CORS.AllowedMethods,
+		AllowedHeaders:   cfg.Server.CORS.AllowedHeaders,
+		AllowCredentials: cfg.Server.CORS.AllowCredentials,
+		MaxAge:           cfg.Server.CORS.MaxAge,
+		Permissive:       cfg.Server.CORS.Permissive,
+	})
+	if cfg.Server.CORS.Permissive {
+		logger.Warn("CORS permissive mode enabled: any origin may call the gateway")
+	}
 
 	// Register local adapter if enabled
 	if cfg.Adapters.Local.Enabled {
 		localAdapter, err := local.NewLocalAdapter(map[string]interface{}{
-			"http_path": cfg.Adapters.Local.HTTPPath,
+			"http_path":   cfg.Adapters.Local.HTTPPath,
+			"formatter":   cfg.Adapters.Local.Formatter,
+			"bot_user_id": cfg.Adapters.Local.BotUserID,
+
+			"send_buffer_size": cfg.Adapters.Local.SendBufferSize,
+			"send_timeout":     cfg.Adapters.Local.SendTimeout,
+
+			"ws_read_buffer_size":   cfg.Adapters.Local.WebSocket.ReadBufferSize,
+			"ws_write_buffer_size":  cfg.Adapters.Local.WebSocket.WriteBufferSize,
+			"ws_enable_compression": cfg.Adapters.Local.WebSocket.EnableCompression,
+			"check_origin":          corsPolicy.CheckOrigin,
 		})
 		if err != nil {
 			logger.Fatal("Failed to create local adapter", zap.Error(err))
@@ -116,6 +360,34 @@ func main() {
 		}
 	}
 
+	// Register Matrix adapter if enabled
+	if cfg.Adapters.Matrix.Enabled {
+		matrixAdapter, err := matrix.NewMatrixAdapter(map[string]interface{}{
+			"homeserver_url": cfg.Adapters.Matrix.HomeserverURL,
+			"access_token":   cfg.Adapters.Matrix.AccessToken,
+			"user_id":        cfg.Adapters.Matrix.UserID,
+			"sync_timeout":   cfg.Adapters.Matrix.SyncTimeout,
+			"state_file":     cfg.Adapters.Matrix.StateFile,
+			"logger":         logger,
+		})
+		if err != nil {
+			logger.Fatal("Failed to create Matrix adapter", zap.Error(err))
+		}
+		if err := gw.RegisterAdapter(matrixAdapter); err != nil {
+			logger.Fatal("Failed to register Matrix adapter", zap.Error(err))
+		}
+	}
+
+	// Bridge messages arriving on the OpenClaw transports into the gateway
+	transportAdapter, err := bridge.NewTransportAdapter(map[string]interface{}{"logger": logger})
+	if err != nil {
+		logger.Fatal("Failed to create transport adapter", zap.Error(err))
+	}
+	if err := gw.RegisterAdapter(transportAdapter); err != nil {
+		logger.Fatal("Failed to register transport adapter", zap.Error(err))
+	}
+	handleTransportMessage := transportAdapter.(*bridge.TransportAdapter).HandleMessage
+
 	// Start gateway
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -124,29 +396,51 @@ func main() {
 		logger.Fatal("Failed to start gateway", zap.Error(err))
 	}
 
-	// Initialize IM webhook notifier if enabled
-	var imNotifier *imwebhook.Notifier
-	if cfg.IMWebhook.Enabled && cfg.IMWebhook.URL != "" {
-		imNotifier = imwebhook.NewNotifier(imwebhook.Config{
-			URL:        cfg.IMWebhook.URL,
-			AuthHeader: cfg.IMWebhook.AuthHeader,
-			Timeout:    cfg.IMWebhook.Timeout,
-			RetryCount: cfg.IMWebhook.RetryCount,
-		}, logger)
-		logger.Info("IM webhook notifier enabled",
-			zap.String("url", cfg.IMWebhook.URL))
+	// Start attachment proxy and serve re-hosted attachments
+	if attachmentProxy != nil {
+		if err := attachmentProxy.Start(ctx); err != nil {
+			logger.Fatal("Failed to start attachment proxy", zap.Error(err))
+		}
+	}
 
-		// Set callback on OpenClaw client to forward AI responses to external IM
-		if openclawClient != nil {
-			openclawClient.SetOutboundCallback(func(response *clawdbot.OutboundResponse) {
-				go func() {
-					if err := imNotifier.Notify(ctx, response); err != nil {
-						logger.Error("Failed to notify IM webhook",
-							zap.Error(err),
-							zap.String("channelId", response.ChannelID))
-					}
-				}()
-			})
+	// Initialize IM webhook notifier if enabled and route OpenClaw outbound
+	// callbacks through it to the external IM
+	var imNotifier *imwebhook.Notifier
+	if cfg.IMWebhook.Enabled {
+		switch {
+		case cfg.IMWebhook.URL == "":
+			// Reported as a config warning at startup
+		case openclawClient == nil:
+			logger.Warn("IM webhook requires the OpenClaw client; AI responses will not be forwarded")
+		default:
+			imNotifier = imwebhook.NewNotifier(imwebhook.Config{
+				URL:               cfg.IMWebhook.URL,
+				AuthHeader:        cfg.IMWebhook.AuthHeader,
+				Timeout:           cfg.IMWebhook.Timeout,
+				DeliveryTimeout:   cfg.IMWebhook.DeliveryTimeout,
+				RetryCount:        cfg.IMWebhook.RetryCount,
+				MaxInterval:       cfg.IMWebhook.MaxInterval,
+				TrackedDeliveries: cfg.IMWebhook.TrackedDeliveries,
+			}, logger)
+			imNotifier.SetSentHook(gw.RecordSent)
+			if cfg.IMWebhook.Queue.Enabled {
+				queue, err := imwebhook.OpenQueue(imwebhook.QueueConfig{
+					Dir:        cfg.IMWebhook.Queue.Dir,
+					MaxAge:     cfg.IMWebhook.Queue.MaxAge,
+					MaxBackoff: cfg.IMWebhook.Queue.MaxBackoff,
+				})
+				if err != nil {
+					logger.Fatal("Failed to open IM webhook queue", zap.Error(err))
+				}
+				imNotifier.SetQueue(queue)
+				imNotifier.Start(ctx)
+				logger.Info("IM webhook queue enabled",
+					zap.String("dir", cfg.IMWebhook.Queue.Dir),
+					zap.Int("pending", queue.Len()))
+			}
+			openclawClient.SetOutboundCallback(imNotifier.Callback(ctx))
+			logger.Info("IM webhook notifier enabled",
+				zap.String("url", cfg.IMWebhook.URL))
 		}
 	}
 
@@ -159,6 +453,18 @@ func main() {
 		w.Write([]byte(`{"status":"healthy","version":"` + version + `"}`))
 	})
 
+	// Readiness: checks OpenClaw and every adapter, 503 if any is unhealthy
+	mux.HandleFunc("/health/ready", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		report := gw.Health(ctx)
+		w.Header().Set("Content-Type", "application/json")
+		if !report.Healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+
 	// Local adapter endpoints
 	if cfg.Adapters.Local.Enabled {
 		if adapter, ok := gw.GetAdapter("local"); ok {
@@ -173,131 +479,119 @@ func main() {
 
 	// OpenClaw outbound endpoint - receives AI responses from OpenClaw Universal IM
 	// This endpoint handles the outbound payload from OpenClaw when AI generates a response
-	mux.HandleFunc("/api/v1/openclaw/outbound", func(w http.ResponseWriter, r *http.Request) {
+	mux.Handle("/api/v1/openclaw/outbound", openclawOutbound(openclawClient, logger))
+
+	// Legacy callback endpoint for backward compatibility
+	mux.HandleFunc("/api/v1/callback", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			httperr.MethodNotAllowed(w, http.MethodPost)
 			return
 		}
 
-		// Validate authorization header if configured
-		if cfg.Clawdbot.UniversalIM.OutboundAuthHeader != "" {
-			authHeader := r.Header.Get("Authorization")
-			if authHeader != cfg.Clawdbot.UniversalIM.OutboundAuthHeader {
-				logger.Warn("Invalid authorization header in outbound request")
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
-			}
-		}
-
 		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			logger.Error("Failed to read outbound body", zap.Error(err))
-			http.Error(w, "Bad request", http.StatusBadRequest)
+		if limit, ok := httplimit.TooLarge(err); ok {
+			logger.Warn("Rejected oversized callback body", zap.Int64("limit", limit))
+			httplimit.WriteTooLarge(w, limit)
 			return
 		}
-
-		var outbound clawdbot.OpenclawOutboundPayload
-		if err := json.Unmarshal(body, &outbound); err != nil {
-			logger.Error("Failed to parse outbound payload", zap.Error(err))
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		if err != nil {
+			logger.Error("Failed to read callback body", zap.Error(err))
+			httperr.WriteUIPError(w, protocol.ErrCodeProtocolError, "failed to read request body", "")
 			return
 		}
 
-		logger.Info("Received OpenClaw outbound",
-			zap.String("to", outbound.To),
-			zap.Int("textLen", len(outbound.Text)),
-			zap.String("replyToId", outbound.ReplyToId),
-			zap.String("text", outbound.Text))
-
-		// Forward to OpenClaw client and get routing information
-		var outboundResp *clawdbot.OutboundResponse
 		if openclawClient != nil {
-			outboundResp = openclawClient.HandleCallback(&outbound)
-		}
-
-		// Build response with routing information for external IM
-		response := map[string]interface{}{
-			"ok":        true,
-			"messageId": fmt.Sprintf("outbound-%d", time.Now().UnixMilli()),
-			"to":        outbound.To,
-			"text":      outbound.Text,
-		}
-
-		// Include routing information if available
-		if outboundResp != nil {
-			response["routing"] = map[string]interface{}{
-				"channelId": outboundResp.ChannelID,
-				"userId":    outboundResp.UserID,
-				"sessionId": outboundResp.SessionID,
+			if err := openclawClient.VerifyOutbound(r.Header, body); err != nil {
+				logger.Warn("Rejected callback request", zap.Error(err))
+				httperr.WriteUIPError(w, protocol.ErrCodeUnauthorized, "unauthorized", "")
+				return
 			}
-			logger.Info("Outbound with routing info",
-				zap.String("channelId", outboundResp.ChannelID),
-				zap.String("userId", outboundResp.UserID),
-				zap.String("sessionId", outboundResp.SessionID))
 		}
 
-		if outbound.MediaUrl != "" {
-			response["mediaUrl"] = outbound.MediaUrl
-		}
-		if outbound.ThreadId != "" {
-			response["threadId"] = outbound.ThreadId
-		}
-
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
-	})
-
-	// Legacy callback endpoint for backward compatibility
-	mux.HandleFunc("/api/v1/callback", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		body, err := io.ReadAll(r.Body)
+		// Older integrations post legacy Clawdbot or Chat Completions shapes
+		outbound, format, err := clawdbot.DecodeCallback(body, r.Header.Get("X-Session-ID"))
 		if err != nil {
-			logger.Error("Failed to read callback body", zap.Error(err))
-			http.Error(w, "Bad request", http.StatusBadRequest)
-			return
-		}
-
-		// Try to parse as new OpenClaw format first
-		var outbound clawdbot.OpenclawOutboundPayload
-		if err := json.Unmarshal(body, &outbound); err != nil {
-			logger.Error("Failed to parse callback", zap.Error(err))
-			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			logger.Warn("Failed to parse callback", zap.Error(err))
+			httperr.WriteUIPError(w, protocol.ErrCodeProtocolError, err.Error(), "")
 			return
 		}
 
 		logger.Info("Received callback (legacy endpoint)",
+			zap.String("format", format),
 			zap.String("to", outbound.To),
 			zap.Int("textLen", len(outbound.Text)))
 
 		// Forward to OpenClaw client if available
 		if openclawClient != nil {
-			openclawClient.HandleCallback(&outbound)
+			openclawClient.HandleCallback(outbound)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.Write([]byte(`{"ok": true}`))
 	})
 
+	if attachmentProxy != nil {
+		mux.Handle(attachmentProxy.Path()+"/", attachmentProxy.HTTPHandler())
+		logger.Info("Attachment proxy endpoint registered", zap.String("path", attachmentProxy.Path()))
+	}
+
 	// Initialize transport servers for OpenClaw connectivity
 	var wsServer *transport.WebSocketServer
 	var pollingServer *transport.PollingServer
 
 	// WebSocket server for OpenClaw WebSocket transport
-	wsServer = transport.NewWebSocketServer(logger)
+	wsServer = transport.NewWebSocketServer(transport.WebSocketConfig{
+		ReadBufferSize:    cfg.Clawdbot.UniversalIM.WebSocket.Server.ReadBufferSize,
+		WriteBufferSize:   cfg.Clawdbot.UniversalIM.WebSocket.Server.WriteBufferSize,
+		EnableCompression: cfg.Clawdbot.UniversalIM.WebSocket.Server.EnableCompression,
+	}, logger)
+	wsServer.SetAuthToken(cfg.Clawdbot.UniversalIM.WebSocket.AuthToken)
+	wsServer.SetHandler(handleTransportMessage)
 	if err := wsServer.Start(ctx); err != nil {
 		logger.Fatal("Failed to start WebSocket server", zap.Error(err))
 	}
 
 	// Polling server for OpenClaw Polling transport
 	pollingServer = transport.NewPollingServer(logger)
+	pollingServer.SetLimits(cfg.Clawdbot.UniversalIM.Polling.DefaultLimit, cfg.Clawdbot.UniversalIM.Polling.MaxLimit)
+	pollingServer.SetAuthToken(cfg.Clawdbot.UniversalIM.Polling.AuthToken)
+	pollingServer.SetHandler(handleTransportMessage)
+	if cfg.Clawdbot.UniversalIM.Polling.AuthToken == "" {
+		logger.Warn("Polling and inbound endpoints accept unauthenticated messages; set clawdbot.universal_im.polling.auth_token")
+	}
 	if err := pollingServer.Start(ctx); err != nil {
 		logger.Fatal("Failed to start Polling server", zap.Error(err))
 	}
 
+	// WebSocket client for deployments where OpenClaw runs the server
+	var wsClient *transport.WebSocketClient
+	if im := cfg.Clawdbot.UniversalIM; im.Transport == "websocket" && im.WebSocket.URL != "" {
+		wsClient = transport.NewWebSocketClient(transport.WebSocketClientConfig{
+			URL:               im.WebSocket.URL,
+			ReconnectInterval: time.Duration(im.WebSocket.ReconnectMs) * time.Millisecond,
+			AuthToken:         im.WebSocket.AuthToken,
+			EnableCompression: im.WebSocket.Server.EnableCompression,
+		}, logger)
+		wsClient.SetHandler(handleTransportMessage)
+		if err := wsClient.Start(ctx); err != nil {
+			logger.Fatal("Failed to start WebSocket client", zap.Error(err))
+		}
+	}
+
+	// Polling client for deployments where OpenClaw serves messages for polling
+	var pollingClient *transport.PollingClient
+	if im := cfg.Clawdbot.UniversalIM; im.Transport == "polling" && im.Polling.URL != "" {
+		pollingClient = transport.NewPollingClient(transport.PollingClientConfig{
+			URL:       im.Polling.URL,
+			Interval:  time.Duration(im.Polling.IntervalMs) * time.Millisecond,
+			AuthToken: im.Polling.AuthToken,
+		}, logger)
+		pollingClient.SetHandler(handleTransportMessage)
+		if err := pollingClient.Start(ctx); err != nil {
+			logger.Fatal("Failed to start polling client", zap.Error(err))
+		}
+	}
+
 	// WebSocket endpoint for OpenClaw to connect to (for websocket transport)
 	mux.Handle("/api/v1/openclaw/ws", wsServer.HTTPHandler())
 	logger.Info("WebSocket endpoint registered", zap.String("path", "/api/v1/openclaw/ws"))
@@ -310,6 +604,113 @@ func main() {
 	mux.Handle("/api/v1/openclaw/inbound", pollingServer.InboundHandler())
 	logger.Info("Inbound endpoint registered", zap.String("path", "/api/v1/openclaw/inbound"))
 
+	// Batch inbound endpoint for high-volume IM bridges
+	mux.Handle("/api/v1/openclaw/inbound/batch", pollingServer.BatchInboundHandler())
+	logger.Info("Batch inbound endpoint registered", zap.String("path", "/api/v1/openclaw/inbound/batch"))
+
+	// Delivery receipts from the external IM, correlated on the notifier's messageId
+	if imNotifier != nil {
+		mux.Handle("/api/v1/im/status", imNotifier.StatusHandler())
+		logger.Info("IM delivery status endpoint registered", zap.String("path", "/api/v1/im/status"))
+
+		mux.Handle("/api/v1/debug/deliveries", adminOnly(cfg.Server.AdminToken, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				httperr.MethodNotAllowed(w, http.MethodGet)
+				return
+			}
+			deliveries := imNotifier.Deliveries()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"count":      len(deliveries),
+				"deliveries": deliveries,
+			})
+		})))
+
+		if cfg.IMWebhook.Queue.Enabled {
+			mux.Handle("/api/v1/im/queue/flush", adminOnly(cfg.Server.AdminToken, imNotifier.FlushHandler()))
+			logger.Info("IM queue flush endpoint registered", zap.String("path", "/api/v1/im/queue/flush"))
+		}
+	}
+
+	// Debug endpoint exposing recently processed events (admin only)
+	if cfg.Gateway.Debug.RecentEvents > 0 {
+		mux.Handle("/api/v1/debug/recent", adminOnly(cfg.Server.AdminToken, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				httperr.MethodNotAllowed(w, http.MethodGet)
+				return
+			}
+			events := gw.RecentEvents(r.URL.Query().Get("full") == "true")
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"count":  len(events),
+				"events": events,
+			})
+		})))
+		logger.Info("Debug endpoint registered", zap.String("path", "/api/v1/debug/recent"))
+	}
+
+	// Runtime adapter control for maintenance windows (admin only)
+	mux.Handle("/api/v1/admin/adapters", adminOnly(cfg.Server.AdminToken, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httperr.MethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+		defer cancel()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"adapters": gw.AdapterStatuses(ctx),
+		})
+	})))
+	mux.Handle("/api/v1/admin/adapters/{name}/start", adminOnly(cfg.Server.AdminToken, adapterControl(gw, (*gateway.Gateway).StartAdapter)))
+	mux.Handle("/api/v1/admin/adapters/{name}/stop", adminOnly(cfg.Server.AdminToken, adapterControl(gw, (*gateway.Gateway).StopAdapter)))
+
+	// Bulk session operations for incidents and capacity planning (admin only)
+	mux.Handle("/api/v1/admin/sessions/stats", adminOnly(cfg.Server.AdminToken, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httperr.MethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(gw.Sessions().Stats())
+	})))
+	mux.Handle("/api/v1/admin/sessions", adminOnly(cfg.Server.AdminToken, sessionEviction(gw.Sessions(), logger)))
+
+	// OpenAI-compatible API for tools that only speak Chat Completions
+	if cfg.Server.OpenAI.Enabled {
+		openaiHandler := openai.NewHandler(openai.Config{
+			APIKeys:      cfg.Server.OpenAI.APIKeys,
+			Model:        cfg.Server.OpenAI.Model,
+			ForwardModel: cfg.Server.OpenAI.ForwardModel,
+		}, gw.ProcessSync, logger)
+		mux.HandleFunc("/v1/chat/completions", openaiHandler.ChatCompletions)
+		mux.HandleFunc("/v1/models", openaiHandler.Models)
+		logger.Info("OpenAI-compatible API enabled", zap.String("path", "/v1/chat/completions"))
+	}
+
+	// Plain-JSON stats for quick checks without Prometheus; ?reset=true starts a new interval
+	mux.HandleFunc("/api/v1/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			httperr.MethodNotAllowed(w, http.MethodGet)
+			return
+		}
+		localConns := 0
+		if a, ok := gw.GetAdapter("local"); ok {
+			if localAdapter, ok := a.(*local.LocalAdapter); ok {
+				localConns = localAdapter.ConnectionCount()
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"gateway": gw.Stats(r.URL.Query().Get("reset") == "true"),
+			"websocket": map[string]int{
+				"local":    localConns,
+				"openclaw": wsServer.ConnectionCount(),
+			},
+			"pollingQueueSize": pollingServer.QueueSize(),
+		})
+	})
+
 	// API info endpoint
 	mux.HandleFunc("/api/v1/info", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -318,6 +719,7 @@ func main() {
 			"version":  version,
 			"protocol": "UIP v1.0",
 			"mode":     cfg.Clawdbot.Mode,
+			"dryRun":   cfg.Gateway.DryRun,
 			"openclaw": map[string]interface{}{
 				"endpoint":  cfg.Clawdbot.Endpoint,
 				"accountId": cfg.Clawdbot.UniversalIM.AccountID,
@@ -330,15 +732,21 @@ func main() {
 				"openclaw_ws":       "/api/v1/openclaw/ws",
 				"openclaw_poll":     "/api/v1/openclaw/poll",
 				"openclaw_inbound":  "/api/v1/openclaw/inbound",
+				"openclaw_batch":    "/api/v1/openclaw/inbound/batch",
 				"callback_legacy":   "/api/v1/callback",
 				"health":            "/health",
+				"health_ready":      "/health/ready",
+				"stats":             "/api/v1/stats",
+				"admin_adapters":    "/api/v1/admin/adapters",
 			},
 			"transports": map[string]interface{}{
 				"websocket": map[string]interface{}{
 					"connections": wsServer.ConnectionCount(),
+					"client":      wsClientStatus(wsClient),
 				},
 				"polling": map[string]interface{}{
 					"queueSize": pollingServer.QueueSize(),
+					"client":    pollingClientStatus(pollingClient),
 				},
 			},
 		})
@@ -346,20 +754,78 @@ func main() {
 
 	server := &http.Server{
 		Addr:         fmt.Sprintf(":%d", cfg.Server.HTTPPort),
-		Handler:      mux,
+		Handler:      corsPolicy.Handler(limitRequests(cfg.Server, mux)),
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
 	}
 
+	// Configure TLS
+	var tlsReloader *tlsconfig.Reloader
+	if cfg.Server.TLS.Enabled() {
+		tlsReloader, err = tlsconfig.NewReloader(tlsconfig.Config{
+			CertFile:         cfg.Server.TLS.CertFile,
+			KeyFile:          cfg.Server.TLS.KeyFile,
+			ClientCAFile:     cfg.Server.TLS.ClientCAFile,
+			AllowedClientCNs: cfg.Server.TLS.AllowedClientCNs,
+		}, logger)
+		if err != nil {
+			logger.Fatal("Failed to configure TLS", zap.Error(err))
+		}
+		server.TLSConfig = tlsReloader.TLSConfig()
+
+		// Reload certificates on SIGHUP so rotations don't require a restart
+		hupCh := make(chan os.Signal, 1)
+		signal.Notify(hupCh, syscall.SIGHUP)
+		go func() {
+			for range hupCh {
+				if err := tlsReloader.Reload(); err != nil {
+					logger.Error("TLS reload failed, keeping previous certificates", zap.Error(err))
+				}
+			}
+		}()
+	}
+
 	// Start HTTP server
 	go func() {
 		logger.Info("HTTP server starting",
-			zap.Int("port", cfg.Server.HTTPPort))
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			zap.Int("port", cfg.Server.HTTPPort),
+			zap.Bool("tls", tlsReloader != nil),
+			zap.Bool("mtls", tlsReloader != nil && tlsReloader.MutualTLS()))
+		var err error
+		if tlsReloader != nil {
+			// Certificates come from TLSConfig
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Fatal("HTTP server error", zap.Error(err))
 		}
 	}()
 
+	// Start metrics server
+	var metricsServer *http.Server
+	if cfg.Observability.MetricsPort > 0 {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{
+			Addr:    fmt.Sprintf(":%d", cfg.Observability.MetricsPort),
+			Handler: metricsMux,
+		}
+		go func() {
+			logger.Info("Metrics server starting",
+				zap.Int("port", cfg.Observability.MetricsPort))
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Error("Metrics server error", zap.Error(err))
+			}
+		}()
+	}
+
+	// Exercise the wiring end to end before announcing startup
+	if *selfTest || cfg.Server.SelfTest {
+		runSelfTest(gw, imNotifier, cfg.Server.SelfTestTimeout, logger)
+	}
+
 	// Print startup banner
 	printBanner(cfg, logger)
 
@@ -380,6 +846,16 @@ func main() {
 	}
 
 	// Stop transport servers
+	if wsClient != nil {
+		if err := wsClient.Stop(shutdownCtx); err != nil {
+			logger.Error("WebSocket client shutdown error", zap.Error(err))
+		}
+	}
+	if pollingClient != nil {
+		if err := pollingClient.Stop(shutdownCtx); err != nil {
+			logger.Error("Polling client shutdown error", zap.Error(err))
+		}
+	}
 	if wsServer != nil {
 		if err := wsServer.Stop(shutdownCtx); err != nil {
 			logger.Error("WebSocket server shutdown error", zap.Error(err))
@@ -391,11 +867,45 @@ func main() {
 		}
 	}
 
+	// Let in-flight IM webhook deliveries finish, cancelling them at the deadline
+	if imNotifier != nil {
+		if err := imNotifier.Stop(shutdownCtx); err != nil {
+			logger.Warn("IM webhook deliveries cancelled at shutdown", zap.Error(err))
+		}
+	}
+
 	// Stop gateway
 	if err := gw.Stop(shutdownCtx); err != nil {
 		logger.Error("Gateway shutdown error", zap.Error(err))
 	}
 
+	// Flush tapped events left in the queue
+	if eventTap != nil {
+		if err := eventTap.Close(shutdownCtx); err != nil {
+			logger.Warn("Debug tap records lost at shutdown", zap.Error(err))
+		}
+	}
+
+	if attachmentProxy != nil {
+		if err := attachmentProxy.Stop(shutdownCtx); err != nil {
+			logger.Error("Attachment proxy shutdown error", zap.Error(err))
+		}
+	}
+
+	// Stop metrics server last so the final values remain scrapeable during shutdown
+	if metricsServer != nil {
+		if wait := cfg.Observability.FinalScrapeWait; wait > 0 {
+			scrapeCtx, cancel := context.WithTimeout(shutdownCtx, wait)
+			if err := metrics.WaitForScrape(scrapeCtx); err != nil {
+				logger.Warn("Final metrics not scraped before shutdown", zap.Error(err))
+			}
+			cancel()
+		}
+		if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("Metrics server shutdown error", zap.Error(err))
+		}
+	}
+
 	logger.Info("UIP Gateway stopped")
 }
 
@@ -471,6 +981,246 @@ func printBanner(cfg *config.Config, logger *zap.Logger) {
 	)
 }
 
+// openclawAccounts converts configured universal-im accounts for the client.
+func openclawAccounts(accounts []config.UniversalIMAccountConfig) []clawdbot.Account {
+	out := make([]clawdbot.Account, 0, len(accounts))
+	for _, a := range accounts {
+		out = append(out, clawdbot.Account{
+			ID:                a.ID,
+			Secret:            a.Secret,
+			WebhookPath:       a.WebhookPath,
+			ConversationTypes: a.ConversationTypes,
+			ChannelPrefixes:   a.ChannelPrefixes,
+		})
+	}
+	return out
+}
+
+// systemPrompts converts the system prompt config for the OpenClaw client.
+func systemPrompts(c config.SystemPromptConfig) clawdbot.SystemPrompts {
+	prompts := clawdbot.SystemPrompts{
+		Default:  c.Default,
+		Adapters: c.Adapters,
+	}
+	for _, ch := range c.Channels {
+		prompts.Channels = append(prompts.Channels, clawdbot.ChannelPrompt{Prefix: ch.Prefix, Prompt: ch.Prompt})
+	}
+	return prompts
+}
+
+// runSelfTest runs the gateway self-test, plus an IM webhook probe when the
+// notifier is enabled, logging each stage. Startup is aborted if any fails.
+func runSelfTest(gw *gateway.Gateway, notifier *imwebhook.Notifier, timeout time.Duration, logger *zap.Logger) {
+	var checks []gateway.SelfTestCheck
+	if notifier != nil {
+		checks = append(checks, gateway.SelfTestCheck{Name: "im_webhook", Check: notifier.Probe})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	report := gw.SelfTest(ctx, checks...)
+	for _, stage := range report.Stages {
+		fields := []zap.Field{zap.String("stage", stage.Name), zap.Duration("duration", stage.Duration)}
+		if stage.Passed {
+			logger.Info("Self-test stage passed", fields...)
+		} else {
+			logger.Error("Self-test stage failed", append(fields, zap.String("error", stage.Error))...)
+		}
+	}
+	if !report.Passed {
+		logger.Fatal("Startup self-test failed\n" + report.String())
+	}
+	logger.Info("Startup self-test passed")
+}
+
+// wsClientStatus describes the outbound WebSocket connection for /api/v1/info,
+// or returns nil when the gateway is not in WebSocket client mode.
+func wsClientStatus(c *transport.WebSocketClient) map[string]interface{} {
+	if c == nil {
+		return nil
+	}
+	return map[string]interface{}{"connected": c.Connected()}
+}
+
+// pollingClientStatus describes the polling client for /api/v1/info, or
+// returns nil when the gateway is not in polling client mode.
+func pollingClientStatus(c *transport.PollingClient) map[string]interface{} {
+	if c == nil {
+		return nil
+	}
+	return map[string]interface{}{"since": c.Since()}
+}
+
+// openclawOutbound serves POST /api/v1/openclaw/outbound, where OpenClaw
+// delivers AI responses. The reply is routed through openclawClient, whose
+// outbound callback forwards it to the external IM, and acknowledged with its
+// routing. openclawClient is nil when the OpenClaw backend is not in use.
+func openclawOutbound(openclawClient *clawdbot.OpenclawClient, logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httperr.MethodNotAllowed(w, http.MethodPost)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if limit, ok := httplimit.TooLarge(err); ok {
+			logger.Warn("Rejected oversized outbound body", zap.Int64("limit", limit))
+			httplimit.WriteTooLarge(w, limit)
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to read outbound body", zap.Error(err))
+			httperr.WriteUIPError(w, protocol.ErrCodeProtocolError, "failed to read request body", "")
+			return
+		}
+
+		// Verify authorization header and signature if configured
+		if openclawClient != nil {
+			if err := openclawClient.VerifyOutbound(r.Header, body); err != nil {
+				logger.Warn("Rejected outbound request", zap.Error(err))
+				httperr.WriteUIPError(w, protocol.ErrCodeUnauthorized, "unauthorized", "")
+				return
+			}
+		}
+
+		var outbound clawdbot.OpenclawOutboundPayload
+		if err := json.Unmarshal(body, &outbound); err != nil {
+			logger.Error("Failed to parse outbound payload", zap.Error(err))
+			httperr.WriteUIPError(w, protocol.ErrCodeProtocolError, "invalid JSON", "")
+			return
+		}
+
+		logger.Info("Received OpenClaw outbound",
+			zap.String("to", outbound.To),
+			zap.Int("textLen", len(outbound.Text)),
+			zap.String("replyToId", outbound.ReplyToId),
+			zap.String("text", outbound.Text))
+
+		// Forward to OpenClaw client and get routing information
+		var outboundResp *clawdbot.OutboundResponse
+		if openclawClient != nil {
+			outboundResp = openclawClient.HandleCallback(&outbound)
+		}
+
+		// Acknowledge with routing information for external IM
+		response := clawdbot.NewOutboundAck(&outbound, outboundResp)
+		if response.Routing.Matched {
+			logger.Info("Outbound with routing info",
+				zap.String("channelId", response.Routing.ChannelID),
+				zap.String("userId", response.Routing.UserID),
+				zap.String("sessionId", response.Routing.SessionID))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	})
+}
+
+// adminOnly protects a handler with the admin bearer token.
+// When no token is configured, admin endpoints are disabled entirely.
+func adminOnly(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			httperr.WriteUIPError(w, protocol.ErrCodeForbidden, "admin API disabled", "")
+			return
+		}
+		expected := "Bearer " + token
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(expected)) != 1 {
+			httperr.WriteUIPError(w, protocol.ErrCodeUnauthorized, "unauthorized", "")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adapterControl serves POST /api/v1/admin/adapters/{name}/start or /stop,
+// applying action to the named adapter and replying with its new status.
+func adapterControl(gw *gateway.Gateway, action func(*gateway.Gateway, context.Context, string) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httperr.MethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		name := r.PathValue("name")
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+		if err := action(gw, ctx, name); err != nil {
+			switch {
+			case errors.Is(err, gateway.ErrAdapterNotFound):
+				httperr.WriteUIPError(w, protocol.ErrCodeNotFound, err.Error(), "")
+			case errors.Is(err, gateway.ErrGatewayStopped):
+				httperr.WriteUIPError(w, protocol.ErrCodeUnavailable, err.Error(), "")
+			default:
+				httperr.WriteUIPError(w, protocol.ErrCodeRuntimeError, err.Error(), "")
+			}
+			return
+		}
+		for _, status := range gw.AdapterStatuses(ctx) {
+			if status.Name == name {
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(status)
+				return
+			}
+		}
+	})
+}
+
+// sessionEviction serves DELETE /api/v1/admin/sessions, evicting every
+// session of ?user= or every session idle for longer than ?older_than=
+// (a Go duration). Exactly one of the two must be given.
+func sessionEviction(sessions *gateway.SessionRegistry, logger *zap.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			httperr.MethodNotAllowed(w, http.MethodDelete)
+			return
+		}
+		user := r.URL.Query().Get("user")
+		olderThan := r.URL.Query().Get("older_than")
+		var evicted int
+		switch {
+		case user != "" && olderThan != "":
+			httperr.WriteUIPError(w, protocol.ErrCodeProtocolError, "specify either user or older_than, not both", "")
+			return
+		case user != "":
+			evicted = sessions.EvictByUser(user)
+		case olderThan != "":
+			age, err := time.ParseDuration(olderThan)
+			if err != nil || age < 0 {
+				httperr.WriteUIPError(w, protocol.ErrCodeProtocolError, "invalid older_than duration: "+olderThan, "")
+				return
+			}
+			evicted = sessions.EvictOlderThan(age)
+		default:
+			httperr.WriteUIPError(w, protocol.ErrCodeProtocolError, "user or older_than is required", "")
+			return
+		}
+		logger.Info("Sessions evicted by admin",
+			zap.String("user", user),
+			zap.String("older_than", olderThan),
+			zap.Int("evicted", evicted))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"evicted": evicted})
+	})
+}
+
+// limitRequests applies the server body limit to every request, plus the
+// per-path overrides and timeouts from server.endpoints (exact path match).
+func limitRequests(server config.ServerConfig, next http.Handler) http.Handler {
+	byPath := make(map[string]http.Handler, len(server.Endpoints))
+	for path := range server.Endpoints {
+		ep := server.Endpoint(path)
+		byPath[path] = httplimit.Limit(ep.MaxBodySize, ep.Timeout, next)
+	}
+	fallback := httplimit.Limit(server.MaxBodySize, 0, next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h, ok := byPath[r.URL.Path]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		fallback.ServeHTTP(w, r)
+	})
+}
+
 func padRight(s string, length int) string {
 	if len(s) >= length {
 		return s[:length]
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/clawdbot"
+	"github.com/zlc_ai/uip-gateway/internal/clawdbot/testserver"
+	"github.com/zlc_ai/uip-gateway/internal/imwebhook"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// TestOutboundReachesIMWebhook follows an AI reply from OpenClaw's POST to
+// /api/v1/openclaw/outbound through the notifier to the external IM, wired
+// as main does.
+func TestOutboundReachesIMWebhook(t *testing.T) {
+	logger := zap.NewNop()
+
+	received := make(chan imwebhook.OutboundMessage, 1)
+	im := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg imwebhook.OutboundMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("IM webhook: bad body: %v", err)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer im-token" {
+			t.Errorf("IM webhook: Authorization = %q", got)
+		}
+		received <- msg
+	}))
+	defer im.Close()
+
+	mux := http.NewServeMux()
+	gw := httptest.NewServer(mux)
+	defer gw.Close()
+
+	openclaw := testserver.New(testserver.Options{OutboundURL: gw.URL + "/api/v1/openclaw/outbound"})
+	defer openclaw.Close()
+
+	client, err := clawdbot.NewOpenclawClient(clawdbot.Config{Endpoint: openclaw.URL, Timeout: 5 * time.Second},
+		clawdbot.OpenclawClientConfig{}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notifier := imwebhook.NewNotifier(imwebhook.Config{URL: im.URL, AuthHeader: "Bearer im-token"}, logger)
+	defer notifier.Stop(context.Background())
+	client.SetOutboundCallback(notifier.Callback(ctx))
+	mux.Handle("/api/v1/openclaw/outbound", openclawOutbound(client, logger))
+
+	event := protocol.NewCanonicalInteractionEvent("s1", "u1", protocol.InputTypeText,
+		map[string]interface{}{"text": "hello"}, protocol.SurfaceCapabilities{}, "test")
+	if _, err := client.ProcessEvent(ctx, event); err != nil {
+		t.Fatalf("ProcessEvent: %v", err)
+	}
+
+	select {
+	case result := <-openclaw.Outbound():
+		if result.Err != nil || result.StatusCode != http.StatusOK {
+			t.Fatalf("outbound POST: status %d, err %v", result.StatusCode, result.Err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("OpenClaw never posted the outbound reply")
+	}
+
+	select {
+	case msg := <-received:
+		if msg.Text != "echo: hello" || msg.To != "user:u1" || msg.ReplyToId != event.InteractionID {
+			t.Errorf("IM message = to %q text %q replyTo %q", msg.To, msg.Text, msg.ReplyToId)
+		}
+		if msg.Routing.UserID != "u1" || msg.Routing.SessionID != "s1" {
+			t.Errorf("routing = %+v, want user u1 session s1", msg.Routing)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("notifier never posted to the IM webhook")
+	}
+
+	if n := client.SessionContextCount(); n != 0 {
+		t.Errorf("%d routing contexts left after the callback, want 0", n)
+	}
+}
+
+func TestOpenclawOutboundWithoutClient(t *testing.T) {
+	rec := httptest.NewRecorder()
+	body := `{"to":"user:u1","text":"hi"}`
+	openclawOutbound(nil, zap.NewNop()).ServeHTTP(rec,
+		httptest.NewRequest(http.MethodPost, "/api/v1/openclaw/outbound", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", rec.Code, rec.Body)
+	}
+	var ack clawdbot.OutboundAck
+	if err := json.Unmarshal(rec.Body.Bytes(), &ack); err != nil {
+		t.Fatal(err)
+	}
+	if ack.Routing.Matched {
+		t.Errorf("ack matched routing without a client: %+v", ack.Routing)
+	}
+
+	rec = httptest.NewRecorder()
+	openclawOutbound(nil, zap.NewNop()).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/openclaw/outbound", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status %d, want 405", rec.Code)
+	}
+}
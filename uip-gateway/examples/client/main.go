@@ -35,6 +35,21 @@ type InteractionIntent struct {
 	} `json:"content"`
 }
 
+// Frame is the local adapter's WebSocket envelope.
+type Frame struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type TypingPayload struct {
+	Active bool `json:"active"`
+}
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
 func main() {
 	// Parse flags
 	gatewayURL := flag.String("url", "http://localhost:8080", "Gateway URL")
@@ -129,17 +144,23 @@ func runWebSocket(gatewayURL, sessionID, userID string) {
 		wsScheme = "wss"
 	}
 
-	wsURL := fmt.Sprintf("%s://%s/api/v1/local/ws?sessionId=%s&userId=%s",
+	wsURL := fmt.Sprintf("%s://%s/api/v1/local/ws?protocol=frames&sessionId=%s&userId=%s",
 		wsScheme, u.Host, url.QueryEscape(sessionID), url.QueryEscape(userID))
 
 	fmt.Printf("Connecting to %s...\n", wsURL)
 
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	// Offer permessage-deflate; the gateway compresses replies when it agrees
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = true
+	conn, resp, err := dialer.Dial(wsURL, nil)
 	if err != nil {
 		fmt.Printf("WebSocket connection failed: %v\n", err)
 		return
 	}
 	defer conn.Close()
+	if strings.Contains(resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate") {
+		fmt.Println("Compression: permessage-deflate")
+	}
 
 	fmt.Println("Connected! Type your message and press Enter. Type 'quit' to exit.")
 	fmt.Println()
@@ -194,11 +215,11 @@ func runWebSocket(gatewayURL, sessionID, userID string) {
 			}
 
 			// Send message
-			req := MessageRequest{
+			payload, _ := json.Marshal(MessageRequest{
 				Text: text,
 				Type: "text",
-			}
-			if err := conn.WriteJSON(req); err != nil {
+			})
+			if err := conn.WriteJSON(Frame{Type: "message", Payload: payload}); err != nil {
 				fmt.Printf("\nSend error: %v\n", err)
 				fmt.Print("You: ")
 				continue
@@ -208,11 +229,32 @@ func runWebSocket(gatewayURL, sessionID, userID string) {
 			if !ok {
 				return
 			}
-			var intent InteractionIntent
-			if err := json.Unmarshal(message, &intent); err != nil {
+			var frame Frame
+			if err := json.Unmarshal(message, &frame); err != nil || frame.Payload == nil {
 				fmt.Printf("\nReceived: %s\n", string(message))
-			} else {
+				fmt.Print("You: ")
+				continue
+			}
+			switch frame.Type {
+			case "ack":
+				// Message accepted by the gateway; the reply follows
+				continue
+			case "typing":
+				var typing TypingPayload
+				if json.Unmarshal(frame.Payload, &typing) == nil && typing.Active {
+					fmt.Print("\r(Clawdbot is typing...)")
+				}
+				continue
+			case "reply":
+				var intent InteractionIntent
+				json.Unmarshal(frame.Payload, &intent)
 				fmt.Printf("\nClawdbot: %s\n", intent.Content.Text)
+			case "error":
+				var uipErr ErrorPayload
+				json.Unmarshal(frame.Payload, &uipErr)
+				fmt.Printf("\nError: %s (%s)\n", uipErr.Message, uipErr.Code)
+			default:
+				fmt.Printf("\nReceived %s: %s\n", frame.Type, string(frame.Payload))
 			}
 			fmt.Print("You: ")
 
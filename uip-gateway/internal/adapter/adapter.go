@@ -37,6 +37,61 @@ type IMAdapter interface {
 	// Capabilities returns the capabilities of this IM platform.
 	// Used for capability negotiation and graceful degradation.
 	Capabilities() *protocol.SurfaceCapabilities
+
+	// Health reports whether the adapter can currently receive events and
+	// deliver intents; nil means healthy. Adapters backed by a network
+	// connection should check it for real (token valid, connection up), so
+	// one that silently stopped receiving events is detected.
+	Health(ctx context.Context) error
+}
+
+// SyncProcessor processes an event and returns the reply intent instead of
+// delivering it through SendIntent.
+type SyncProcessor func(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error)
+
+// SyncAdapter is implemented by adapters that can answer an inbound request
+// with its reply directly. In the gateway's sync mode, the gateway hands such
+// adapters a SyncProcessor; adapters keep using OnEvent when none is set.
+type SyncAdapter interface {
+	IMAdapter
+	SetSyncProcessor(processor SyncProcessor)
+}
+
+// Formatter turns intent content into platform-native markup just before it
+// is handed to SendIntent, after capability-based degradation.
+type Formatter interface {
+	Format(content *protocol.IntentContent)
+}
+
+// FormatterFunc adapts a function to the Formatter interface.
+type FormatterFunc func(content *protocol.IntentContent)
+
+func (f FormatterFunc) Format(content *protocol.IntentContent) { f(content) }
+
+// FormattingAdapter is implemented by adapters that ship their own Formatter.
+// The gateway registers it when the adapter is registered; a nil Formatter
+// means no formatting.
+type FormattingAdapter interface {
+	IMAdapter
+	Formatter() Formatter
+}
+
+// ConversationCapabilityAdapter is implemented by adapters whose platform
+// behaves differently by conversation type, e.g. threads only in channels.
+// The gateway asks for the capabilities of each event's conversation type
+// (protocol.ConversationType); nil means Capabilities applies.
+type ConversationCapabilityAdapter interface {
+	IMAdapter
+	ConversationCapabilities(conversationType string) *protocol.SurfaceCapabilities
+}
+
+// DedupAdapter is implemented by adapters whose platform has its own
+// idempotency key for inbound events, such as a Slack event_id or a
+// Telegram update_id. Redeliveries of an event must return the same key;
+// "" falls back to the event's InteractionID.
+type DedupAdapter interface {
+	IMAdapter
+	DedupKey(event *protocol.CanonicalInteractionEvent) string
 }
 
 // AdapterFactory creates an adapter instance from configuration.
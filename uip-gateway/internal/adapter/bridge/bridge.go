@@ -0,0 +1,234 @@
+// Package bridge implements an adapter that feeds messages received by the
+// OpenClaw transports (WebSocket and polling inbound endpoints) into the
+// gateway, the same way IM adapters deliver their events.
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+	"github.com/zlc_ai/uip-gateway/internal/transport"
+)
+
+// Name is the adapter name used in logs and metrics.
+const Name = "transport"
+
+func init() {
+	adapter.RegisterAdapter(Name, NewTransportAdapter)
+}
+
+// TransportAdapter translates transport.Message values into canonical
+// interaction events. Install HandleMessage as the transports' handler.
+//
+// Replies to these messages reach the external IM through OpenClaw's
+// outbound callback (see imwebhook), so SendIntent does not deliver them.
+type TransportAdapter struct {
+	logger log.Logger
+
+	mu           sync.RWMutex
+	started      bool
+	eventHandler adapter.EventHandler
+	capabilities *protocol.SurfaceCapabilities
+}
+
+// NewTransportAdapter creates the transport bridge adapter.
+func NewTransportAdapter(config map[string]interface{}) (adapter.IMAdapter, error) {
+	// Embedders can pass their own logger in the factory config
+	logger, _ := config["logger"].(log.Logger)
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return &TransportAdapter{
+		logger: logger,
+		capabilities: &protocol.SurfaceCapabilities{
+			SupportsReply:      true,
+			SupportsThread:     true,
+			SupportsAttachment: true,
+			SupportsMarkdown:   true,
+		},
+	}, nil
+}
+
+func (a *TransportAdapter) Name() string {
+	return Name
+}
+
+func (a *TransportAdapter) Start(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.started {
+		return fmt.Errorf("adapter already started")
+	}
+	a.started = true
+	a.logger.Info("Transport bridge adapter started")
+	return nil
+}
+
+func (a *TransportAdapter) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.started = false
+	return nil
+}
+
+func (a *TransportAdapter) OnEvent(handler adapter.EventHandler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.eventHandler = handler
+}
+
+// SendIntent only logs the intent; see TransportAdapter.
+func (a *TransportAdapter) SendIntent(ctx context.Context, intent *protocol.InteractionIntent) error {
+	log.ForIntent(ctx, a.logger, intent).Debug("Transport intent not delivered; replies go through the outbound callback")
+	return nil
+}
+
+func (a *TransportAdapter) Capabilities() *protocol.SurfaceCapabilities {
+	return a.capabilities
+}
+
+// Health reports an adapter that is not started; transport health is
+// tracked by the transports themselves.
+func (a *TransportAdapter) Health(ctx context.Context) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if !a.started {
+		return fmt.Errorf("adapter not started")
+	}
+	return nil
+}
+
+// DedupKey returns the source platform's idempotency key from the message
+// meta "dedupKey" (e.g. a Slack event_id) if the transport set one, else
+// the message ID.
+func (a *TransportAdapter) DedupKey(event *protocol.CanonicalInteractionEvent) string {
+	if key, _ := event.Input.Payload[protocol.PayloadDedupKey].(string); key != "" {
+		return key
+	}
+	key, _ := event.Input.Payload["messageId"].(string)
+	return key
+}
+
+// HandleMessage is a transport.MessageHandler that emits msg to the gateway.
+func (a *TransportAdapter) HandleMessage(msg *transport.Message) error {
+	a.mu.RLock()
+	started, handler := a.started, a.eventHandler
+	a.mu.RUnlock()
+	if !started || handler == nil {
+		return fmt.Errorf("transport adapter not started")
+	}
+	if msg.Sender.ID == "" {
+		return fmt.Errorf("sender.id is required")
+	}
+
+	event := NewEvent(msg, *a.capabilities)
+	log.With(a.logger, log.EventFields(event)...).Debug("Received transport message",
+		zap.String("messageId", msg.ID),
+		zap.String("senderId", msg.Sender.ID),
+		zap.String("conversationId", msg.Conversation.ID))
+
+	handler(event)
+	return nil
+}
+
+// NewEvent translates a transport message into a canonical interaction event.
+//
+// Direct conversations use the sender ID as the session when the
+// conversation has no ID. Group and channel conversation IDs become the
+// event's channelId, so replies are routed back to the conversation.
+func NewEvent(msg *transport.Message, capabilities protocol.SurfaceCapabilities) *protocol.CanonicalInteractionEvent {
+	sessionID := msg.Conversation.ID
+	if sessionID == "" {
+		sessionID = msg.Sender.ID
+	}
+
+	convType := msg.Conversation.Type
+	channelID := ""
+	if convType != "" && convType != protocol.ConversationDirect {
+		channelID = msg.Conversation.ID
+	}
+
+	payload := map[string]interface{}{
+		"text":             msg.Text,
+		"messageId":        msg.ID,
+		"channelId":        channelID,
+		"threadId":         msg.Conversation.ThreadID,
+		"conversationType": convType,
+	}
+	if len(msg.Attachments) > 0 {
+		attachments := make([]interface{}, 0, len(msg.Attachments))
+		for _, att := range msg.Attachments {
+			m := map[string]interface{}{
+				"kind":        att.Kind,
+				"url":         att.URL,
+				"contentType": att.ContentType,
+				"fileName":    att.FileName,
+			}
+			if att.Size > 0 {
+				m["size"] = att.Size
+			}
+			attachments = append(attachments, m)
+		}
+		payload["attachments"] = attachments
+	}
+	if mentions, ok := msg.Meta[protocol.PayloadMentions]; ok {
+		payload[protocol.PayloadMentions] = mentions
+	}
+	if mentionsBot, ok := msg.Meta[protocol.PayloadMentionsBot].(bool); ok {
+		payload[protocol.PayloadMentionsBot] = mentionsBot
+	}
+	inputType := protocol.InputTypeText
+	if loc, ok := msg.Meta[protocol.PayloadLocation]; ok {
+		payload[protocol.PayloadLocation] = loc
+		inputType = protocol.InputTypeLocation
+	}
+	if value, ok := msg.Meta[protocol.PayloadQuickReply].(string); ok && value != "" {
+		payload[protocol.PayloadQuickReply] = value
+		if msg.Text == "" {
+			payload["text"] = value
+		}
+		inputType = protocol.InputTypeQuickReply
+	}
+	if reaction, ok := msg.Meta[protocol.PayloadReaction]; ok {
+		payload[protocol.PayloadReaction] = reaction
+		inputType = protocol.InputTypeReaction
+	}
+	if key, ok := msg.Meta[protocol.PayloadDedupKey].(string); ok && key != "" {
+		payload[protocol.PayloadDedupKey] = key
+	}
+
+	event := protocol.NewCanonicalInteractionEvent(
+		sessionID,
+		msg.Sender.ID,
+		inputType,
+		payload,
+		capabilities,
+		"openclaw-transport",
+	)
+	event.Meta.AdapterName = Name
+	if msg.Timestamp > 0 {
+		event.Meta.Timestamp = msg.Timestamp
+	}
+	event.Meta.Locale, _ = msg.Meta["locale"].(string)
+	event.Meta.Model, _ = msg.Meta["model"].(string)
+	event.Session.UserName = msg.Sender.Name
+	if event.Session.UserName == "" {
+		event.Session.UserName = msg.Sender.Username
+	}
+	if msg.Sender.IsBot {
+		event.Session.ParticipantType = protocol.ParticipantTypeSystem
+	}
+
+	// Normalize the conversation type (inferred from channelId/threadId if unset)
+	event.Input.Payload["conversationType"] = protocol.ConversationType(event)
+	return event
+}
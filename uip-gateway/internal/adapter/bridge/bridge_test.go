@@ -0,0 +1,153 @@
+package bridge_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter/bridge"
+	"github.com/zlc_ai/uip-gateway/internal/gateway"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+	"github.com/zlc_ai/uip-gateway/internal/transport"
+)
+
+// recordingClient is a clawdbot.Client that hands each event to a channel.
+type recordingClient chan *protocol.CanonicalInteractionEvent
+
+func (c recordingClient) ProcessEvent(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+	c <- event
+	return protocol.NewInteractionIntent(protocol.IntentTypeReply, "ok", event.Session.ExternalSessionID, event.InteractionID), nil
+}
+
+func (recordingClient) Close() error                     { return nil }
+func (recordingClient) Health(ctx context.Context) error { return nil }
+
+func startBridge(t *testing.T) (*bridge.TransportAdapter, recordingClient) {
+	t.Helper()
+	client := make(recordingClient, 4)
+	cfg := gateway.DefaultConfig()
+	cfg.WorkerCount, cfg.QueueSize = 2, 10
+	gw := gateway.New(cfg, client, zap.NewNop())
+	a, err := bridge.NewTransportAdapter(map[string]interface{}{"logger": zap.NewNop()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.RegisterAdapter(a); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		gw.Stop(ctx)
+	})
+	return a.(*bridge.TransportAdapter), client
+}
+
+var inbound = &transport.Message{
+	ID:           "m1",
+	Sender:       transport.Sender{ID: "u1", Name: "Ann"},
+	Conversation: transport.Conversation{Type: "group", ID: "g1", ThreadID: "t1"},
+	Text:         "hello",
+	Meta:         map[string]interface{}{"locale": "fr"},
+}
+
+// TestInboundReachesClawdbot feeds a message through each polling transport
+// and checks that it reaches the Clawdbot client as an event.
+func TestInboundReachesClawdbot(t *testing.T) {
+	tests := []struct {
+		name    string
+		deliver func(t *testing.T, handler transport.MessageHandler)
+	}{
+		{"polling server inbound POST", func(t *testing.T, handler transport.MessageHandler) {
+			ps := transport.NewPollingServer(zap.NewNop())
+			ps.SetHandler(handler)
+			body, _ := json.Marshal(inbound)
+			w := httptest.NewRecorder()
+			ps.InboundHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/inbound", bytes.NewReader(body)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("inbound POST: status %d: %s", w.Code, w.Body)
+			}
+		}},
+		{"polling client", func(t *testing.T, handler transport.MessageHandler) {
+			var served atomic.Bool
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				resp := transport.PollResponse{NextSince: 1}
+				if !served.Swap(true) {
+					resp.Messages = []*transport.Message{inbound}
+				}
+				json.NewEncoder(w).Encode(resp)
+			}))
+			t.Cleanup(srv.Close)
+			pc := transport.NewPollingClient(transport.PollingClientConfig{URL: srv.URL, Interval: 10 * time.Millisecond}, zap.NewNop())
+			pc.SetHandler(handler)
+			if err := pc.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { pc.Stop(context.Background()) })
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, client := startBridge(t)
+			tt.deliver(t, a.HandleMessage)
+
+			var event *protocol.CanonicalInteractionEvent
+			select {
+			case event = <-client:
+			case <-time.After(5 * time.Second):
+				t.Fatal("message never reached the Clawdbot client")
+			}
+			if event.Meta.AdapterName != bridge.Name || event.Session.UserID != "u1" || event.Session.UserName != "Ann" {
+				t.Errorf("event from adapter %q user %q (%q)", event.Meta.AdapterName, event.Session.UserID, event.Session.UserName)
+			}
+			payload := event.Input.Payload
+			if payload["text"] != "hello" || payload["messageId"] != "m1" || payload["channelId"] != "g1" ||
+				payload["threadId"] != "t1" || payload["conversationType"] != protocol.ConversationGroup {
+				t.Errorf("payload = %v", payload)
+			}
+			if event.Meta.Locale != "fr" {
+				t.Errorf("locale = %q, want fr", event.Meta.Locale)
+			}
+		})
+	}
+}
+
+func TestHandleMessageRejects(t *testing.T) {
+	a, err := bridge.NewTransportAdapter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ta := a.(*bridge.TransportAdapter)
+	if err := ta.HandleMessage(inbound); err == nil {
+		t.Error("HandleMessage succeeded before Start")
+	}
+
+	ta, _ = startBridge(t)
+	if err := ta.HandleMessage(&transport.Message{ID: "m2", Text: "no sender"}); err == nil {
+		t.Error("HandleMessage accepted a message without sender.id")
+	}
+}
+
+func TestNewEventDirectConversation(t *testing.T) {
+	event := bridge.NewEvent(&transport.Message{ID: "m1", Sender: transport.Sender{ID: "u1", IsBot: true}, Text: "hi"},
+		protocol.SurfaceCapabilities{})
+	if event.Session.ExternalSessionID != "u1" {
+		t.Errorf("session = %q, want the sender ID", event.Session.ExternalSessionID)
+	}
+	if event.Input.Payload["channelId"] != "" || event.Input.Payload["conversationType"] != protocol.ConversationDirect {
+		t.Errorf("payload = %v, want a direct conversation", event.Input.Payload)
+	}
+	if !event.Session.IsBot() {
+		t.Error("bot sender not marked as a system participant")
+	}
+}
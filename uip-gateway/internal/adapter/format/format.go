@@ -0,0 +1,33 @@
+// Package format provides adapter.Formatter implementations that turn intent
+// Markdown into IM-native markup.
+package format
+
+import (
+	"fmt"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter"
+)
+
+// Formatter names accepted by ByName.
+const (
+	NameNone        = ""
+	NameMarkdownV2  = "telegram_markdownv2"
+	NameSlack       = "slack"
+	NameSlackBlocks = "slack_blocks"
+)
+
+// ByName returns the formatter configured by name, or nil for NameNone.
+func ByName(name string) (adapter.Formatter, error) {
+	switch name {
+	case NameNone:
+		return nil, nil
+	case NameMarkdownV2:
+		return TelegramMarkdownV2{}, nil
+	case NameSlack:
+		return Slack{}, nil
+	case NameSlackBlocks:
+		return Slack{Blocks: true}, nil
+	default:
+		return nil, fmt.Errorf("unknown formatter %q", name)
+	}
+}
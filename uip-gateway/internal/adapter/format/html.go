@@ -0,0 +1,33 @@
+package format
+
+import (
+	"html"
+	"strings"
+)
+
+// MarkdownToHTML converts common Markdown into the HTML subset Matrix
+// clients render for org.matrix.custom.html formatted bodies. Line breaks
+// become <br>; code blocks keep theirs inside <pre>.
+func MarkdownToHTML(md string) string {
+	return convert(md, &htmlDialect)
+}
+
+// EscapeHTML escapes plain text for an HTML body, turning newlines into <br>.
+func EscapeHTML(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>")
+}
+
+var htmlDialect = dialect{
+	escape: EscapeHTML,
+	code:   html.EscapeString,
+	link: func(text, url string) string {
+		return `<a href="` + html.EscapeString(url) + `">` + text + "</a>"
+	},
+	bold:   "strong",
+	italic: "em",
+	strike: "del",
+
+	codeSpan:  "code",
+	codeBlock: "pre",
+	html:      true,
+}
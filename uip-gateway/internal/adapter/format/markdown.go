@@ -0,0 +1,189 @@
+package format
+
+import "strings"
+
+// dialect describes a target markup for convert.
+type dialect struct {
+	// escape escapes plain text.
+	escape func(s string) string
+	// code escapes the body of inline code and code blocks.
+	code func(s string) string
+	// link renders a link; text is already converted.
+	link func(text, url string) string
+
+	// Span markers, written on both sides of the span; with html set they
+	// are tag names instead.
+	bold, italic, strike string
+	codeSpan, codeBlock  string
+	html                 bool
+}
+
+// wrap encloses converted text in the dialect's markup for marker.
+func (d *dialect) wrap(marker, inner string) string {
+	if d.html {
+		return "<" + marker + ">" + inner + "</" + marker + ">"
+	}
+	return marker + inner + marker
+}
+
+// convert rewrites common Markdown (headings, **bold**, *italic*/_italic_,
+// ~~strike~~, `code`, ```blocks``` and [links](url)) into the dialect.
+// Markers without a closing counterpart are treated as literal text.
+func convert(md string, d *dialect) string {
+	var b strings.Builder
+	lines := strings.SplitAfter(md, "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		// Fenced code blocks span lines and are copied verbatim (escaped)
+		if strings.HasPrefix(line, "```") {
+			end := -1
+			for j := i + 1; j < len(lines); j++ {
+				if strings.HasPrefix(lines[j], "```") {
+					end = j
+					break
+				}
+			}
+			if end >= 0 {
+				b.WriteString(d.wrap(d.codeBlock, d.code(strings.TrimPrefix(line, "```")+strings.Join(lines[i+1:end], ""))))
+				b.WriteString(d.escape(strings.TrimPrefix(strings.TrimRight(lines[end], "\n"), "```")) + trailingNewline(lines[end]))
+				i = end
+				continue
+			}
+		}
+
+		if title, ok := heading(line); ok {
+			b.WriteString(d.wrap(d.bold, inline(title, d)) + d.escape(trailingNewline(line)))
+			continue
+		}
+		b.WriteString(inline(line, d))
+	}
+	return b.String()
+}
+
+// heading returns the title of an ATX heading line ("# Title").
+func heading(line string) (string, bool) {
+	text := strings.TrimRight(line, "\n")
+	level := 0
+	for level < len(text) && level < 6 && text[level] == '#' {
+		level++
+	}
+	if level == 0 || level >= len(text) || text[level] != ' ' {
+		return "", false
+	}
+	return strings.TrimSpace(text[level:]), true
+}
+
+func trailingNewline(line string) string {
+	if strings.HasSuffix(line, "\n") {
+		return "\n"
+	}
+	return ""
+}
+
+// inline converts span-level markup within one line.
+func inline(s string, d *dialect) string {
+	var b strings.Builder
+	plain := 0 // start of pending plain text
+	flush := func(end int) {
+		b.WriteString(d.escape(s[plain:end]))
+	}
+
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		var out string
+		var n int
+
+		switch {
+		case rest[0] == '`':
+			if j := strings.IndexByte(rest[1:], '`'); j > 0 {
+				out, n = d.wrap(d.codeSpan, d.code(rest[1:1+j])), j+2
+			}
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__"):
+			if inner, ok := span(rest, rest[:2]); ok {
+				out, n = d.wrap(d.bold, inline(inner, d)), len(inner)+4
+			}
+		case strings.HasPrefix(rest, "~~"):
+			if inner, ok := span(rest, "~~"); ok {
+				out, n = d.wrap(d.strike, inline(inner, d)), len(inner)+4
+			}
+		case rest[0] == '*':
+			if inner, ok := span(rest, "*"); ok {
+				out, n = d.wrap(d.italic, inline(inner, d)), len(inner)+2
+			}
+		case rest[0] == '_':
+			// Only at word boundaries, so snake_case identifiers stay literal
+			if i == 0 || !isWordByte(s[i-1]) {
+				if inner, ok := span(rest, "_"); ok {
+					after := i + len(inner) + 2
+					if after >= len(s) || !isWordByte(s[after]) {
+						out, n = d.wrap(d.italic, inline(inner, d)), len(inner)+2
+					}
+				}
+			}
+		case rest[0] == '[':
+			if text, url, ok := link(rest); ok {
+				out, n = d.link(inline(text, d), url), len(text)+len(url)+4
+			}
+		}
+
+		if n == 0 {
+			i++
+			continue
+		}
+		flush(i)
+		b.WriteString(out)
+		i += n
+		plain = i
+	}
+	flush(len(s))
+	return b.String()
+}
+
+// span returns the text between an opening marker at the start of s and the
+// next closing marker. Empty spans and spans starting or ending with a space
+// do not count.
+func span(s, marker string) (string, bool) {
+	j := strings.Index(s[len(marker):], marker)
+	if j <= 0 {
+		return "", false
+	}
+	inner := s[len(marker) : len(marker)+j]
+	if strings.TrimSpace(inner) != inner || strings.Contains(inner, "\n") {
+		return "", false
+	}
+	return inner, true
+}
+
+// link parses "[text](url)" at the start of s. The URL may contain balanced
+// parentheses, as in Wikipedia links.
+func link(s string) (text, url string, ok bool) {
+	close := strings.Index(s, "](")
+	if close <= 1 {
+		return "", "", false
+	}
+	end, depth := -1, 0
+	for j := close + 2; j < len(s) && end < 0; j++ {
+		switch s[j] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				end = j - (close + 2)
+			}
+			depth--
+		}
+	}
+	if end <= 0 {
+		return "", "", false
+	}
+	text, url = s[1:close], s[close+2:close+2+end]
+	if strings.ContainsAny(text, "[]\n") || strings.ContainsAny(url, " \n") {
+		return "", "", false
+	}
+	return text, url, true
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,225 @@
+package format
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Slack Block Kit limits.
+const (
+	slackSectionLimit     = 3000
+	slackHeaderLimit      = 150
+	slackButtonLimit      = 75
+	slackButtonValueLimit = 2000
+	slackActionsLimit     = 25
+)
+
+// Slack rewrites the intent's Markdown into Slack mrkdwn. With Blocks set it
+// also builds Block Kit blocks (headings become header blocks, paragraphs
+// become mrkdwn sections, sources become a trailing context block, quick
+// replies a trailing actions block) into Native["blocks"]. Mentions are
+// prefixed to the text as "<@id>" tokens.
+type Slack struct {
+	Blocks bool
+}
+
+func (f Slack) Format(content *protocol.IntentContent) {
+	mentions := SlackMentions(content.Mentions)
+	text := content.Text
+	if mentions != "" {
+		content.Text = mentions + " " + content.Text
+	}
+	if content.Markdown == "" {
+		// Buttons need blocks, which then carry the plain text too
+		if f.Blocks && len(content.QuickReplies) > 0 {
+			section := strings.TrimSpace(mentions + " " + EscapeSlack(text))
+			var blocks []map[string]interface{}
+			if section != "" {
+				blocks = prependSection(nil, section)
+			}
+			setBlocks(content, append(blocks, SlackActionsBlock(content.QuickReplies)))
+		}
+		return
+	}
+	if f.Blocks {
+		blocks := SlackBlocks(content.Markdown)
+		if mentions != "" {
+			blocks = prependSection(blocks, mentions)
+		}
+		if len(content.Sources) > 0 {
+			blocks = append(blocks, SlackSourcesBlock(content.Sources))
+		}
+		if len(content.QuickReplies) > 0 {
+			blocks = append(blocks, SlackActionsBlock(content.QuickReplies))
+		}
+		setBlocks(content, blocks)
+	}
+	content.Markdown = MarkdownToSlack(content.Markdown)
+	if mentions != "" {
+		content.Markdown = mentions + " " + content.Markdown
+	}
+}
+
+// setBlocks stores blocks in Native["blocks"], unless there are none.
+func setBlocks(content *protocol.IntentContent, blocks []map[string]interface{}) {
+	if len(blocks) == 0 {
+		return
+	}
+	if content.Native == nil {
+		content.Native = make(map[string]interface{})
+	}
+	content.Native["blocks"] = blocks
+}
+
+// SlackMentions renders mentions as space-separated "<@id>" tokens.
+func SlackMentions(mentions []protocol.Mention) string {
+	tokens := make([]string, 0, len(mentions))
+	for _, m := range mentions {
+		if m.UserID != "" {
+			tokens = append(tokens, "<@"+m.UserID+">")
+		}
+	}
+	return strings.Join(tokens, " ")
+}
+
+// prependSection puts text at the start of the first section block, or in a
+// new leading section when the blocks start with something else.
+func prependSection(blocks []map[string]interface{}, text string) []map[string]interface{} {
+	if len(blocks) > 0 && blocks[0]["type"] == "section" {
+		if t, ok := blocks[0]["text"].(map[string]interface{}); ok {
+			t["text"] = text + " " + t["text"].(string)
+			return blocks
+		}
+	}
+	section := map[string]interface{}{
+		"type": "section",
+		"text": map[string]interface{}{"type": "mrkdwn", "text": text},
+	}
+	return append([]map[string]interface{}{section}, blocks...)
+}
+
+// EscapeSlack escapes the characters Slack treats as control sequences.
+func EscapeSlack(s string) string {
+	return slackEscaper.Replace(s)
+}
+
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// MarkdownToSlack converts common Markdown into Slack mrkdwn.
+func MarkdownToSlack(md string) string {
+	return convert(md, &slackDialect)
+}
+
+var slackDialect = dialect{
+	escape: EscapeSlack,
+	code:   EscapeSlack,
+	link: func(text, url string) string {
+		return "<" + url + "|" + text + ">"
+	},
+	bold:   "*",
+	italic: "_",
+	strike: "~",
+
+	codeSpan:  "`",
+	codeBlock: "```",
+}
+
+// SlackBlocks splits Markdown into Block Kit blocks.
+func SlackBlocks(md string) []map[string]interface{} {
+	var blocks []map[string]interface{}
+	var para []string
+	inFence := false
+
+	flush := func() {
+		text := strings.TrimSpace(MarkdownToSlack(strings.Join(para, "")))
+		para = para[:0]
+		for text != "" {
+			chunk := text
+			if len(chunk) > slackSectionLimit {
+				chunk = truncate(chunk, slackSectionLimit)
+			}
+			blocks = append(blocks, map[string]interface{}{
+				"type": "section",
+				"text": map[string]interface{}{"type": "mrkdwn", "text": chunk},
+			})
+			text = text[len(chunk):]
+		}
+	}
+
+	for _, line := range strings.SplitAfter(md, "\n") {
+		if strings.HasPrefix(line, "```") {
+			inFence = !inFence
+		}
+		if !inFence {
+			if title, ok := heading(line); ok {
+				flush()
+				blocks = append(blocks, map[string]interface{}{
+					"type": "header",
+					"text": map[string]interface{}{"type": "plain_text", "text": truncate(title, slackHeaderLimit)},
+				})
+				continue
+			}
+			if strings.TrimSpace(line) == "" {
+				flush()
+				continue
+			}
+		}
+		para = append(para, line)
+	}
+	flush()
+	return blocks
+}
+
+// slackContextLimit is the maximum number of elements in a context block.
+const slackContextLimit = 10
+
+// SlackSourcesBlock renders sources as a context block of links.
+func SlackSourcesBlock(sources []protocol.Source) map[string]interface{} {
+	var elements []map[string]interface{}
+	for i, s := range sources {
+		if i == slackContextLimit {
+			break
+		}
+		title := s.Title
+		if title == "" {
+			title = s.URL
+		}
+		elements = append(elements, map[string]interface{}{
+			"type": "mrkdwn",
+			"text": "<" + s.URL + "|" + EscapeSlack(title) + ">",
+		})
+	}
+	return map[string]interface{}{"type": "context", "elements": elements}
+}
+
+// SlackActionsBlock renders quick replies as an actions block of buttons.
+// A tap reaches the app with the button's value and an action_id of
+// "quick_reply_<n>".
+func SlackActionsBlock(qrs []protocol.QuickReply) map[string]interface{} {
+	var elements []map[string]interface{}
+	for i, q := range qrs {
+		if i == slackActionsLimit {
+			break
+		}
+		elements = append(elements, map[string]interface{}{
+			"type":      "button",
+			"text":      map[string]interface{}{"type": "plain_text", "text": truncate(q.Label, slackButtonLimit)},
+			"value":     truncate(q.ReplyValue(), slackButtonValueLimit),
+			"action_id": "quick_reply_" + strconv.Itoa(i),
+		})
+	}
+	return map[string]interface{}{"type": "actions", "block_id": "quick_replies", "elements": elements}
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && s[n]&0xC0 == 0x80 {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,138 @@
+package format
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// telegramCallbackDataLimit is the most bytes an inline button's
+// callback_data may hold.
+const telegramCallbackDataLimit = 64
+
+// markdownV2Special lists the characters Telegram requires to be escaped in
+// MarkdownV2 text outside of entities.
+const markdownV2Special = "_*[]()~`>#+-=|{}.!\\"
+
+// TelegramMarkdownV2 rewrites the intent's Markdown into Telegram MarkdownV2
+// (send it with parse_mode=MarkdownV2), with mentions prefixed as user links
+// and sources appended as inline links. A reply with mentions but no
+// Markdown gets a Markdown version of its text. Text is left as plain text.
+// Quick replies become an inline keyboard in Native["reply_markup"].
+type TelegramMarkdownV2 struct{}
+
+func (TelegramMarkdownV2) Format(content *protocol.IntentContent) {
+	if keyboard := TelegramInlineKeyboard(content.QuickReplies); keyboard != nil {
+		if content.Native == nil {
+			content.Native = make(map[string]interface{})
+		}
+		content.Native["reply_markup"] = keyboard
+	}
+	switch {
+	case content.Markdown != "":
+		content.Markdown = MarkdownToMarkdownV2(content.Markdown)
+	case len(content.Mentions) > 0:
+		content.Markdown = EscapeMarkdownV2(content.Text)
+	default:
+		return
+	}
+	if len(content.Mentions) > 0 {
+		content.Markdown = MarkdownV2Mentions(content.Mentions) + " " + content.Markdown
+	}
+	if len(content.Sources) > 0 {
+		content.Markdown += "\n\n" + MarkdownV2Sources(content.Sources)
+	}
+}
+
+// MarkdownV2Mentions renders mentions as tg://user links, named by the
+// mention's Name (or user ID).
+func MarkdownV2Mentions(mentions []protocol.Mention) string {
+	links := make([]string, 0, len(mentions))
+	for _, m := range mentions {
+		if m.UserID == "" {
+			continue
+		}
+		name := m.Name
+		if name == "" {
+			name = m.UserID
+		}
+		links = append(links, telegramDialect.link(EscapeMarkdownV2(name), "tg://user?id="+m.UserID))
+	}
+	return strings.Join(links, " ")
+}
+
+// MarkdownV2Sources renders sources as a line of numbered inline links.
+func MarkdownV2Sources(sources []protocol.Source) string {
+	links := make([]string, len(sources))
+	for i, s := range sources {
+		title := s.Title
+		if title == "" {
+			title = strconv.Itoa(i + 1)
+		}
+		links[i] = telegramDialect.link(EscapeMarkdownV2(title), s.URL)
+	}
+	return EscapeMarkdownV2("Sources: ") + strings.Join(links, " · ")
+}
+
+// TelegramInlineKeyboard renders quick replies as an inline keyboard, one
+// button per row, whose callback_data is the reply value. Buttons with a
+// value over Telegram's 64-byte limit are left out; nil means no buttons.
+func TelegramInlineKeyboard(qrs []protocol.QuickReply) map[string]interface{} {
+	var rows [][]map[string]interface{}
+	for _, q := range qrs {
+		value := q.ReplyValue()
+		if len(value) > telegramCallbackDataLimit {
+			continue
+		}
+		rows = append(rows, []map[string]interface{}{{"text": q.Label, "callback_data": value}})
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	return map[string]interface{}{"inline_keyboard": rows}
+}
+
+// EscapeMarkdownV2 escapes every MarkdownV2 special character in s, so that
+// it renders literally.
+func EscapeMarkdownV2(s string) string {
+	return escapeWith(s, markdownV2Special)
+}
+
+// MarkdownToMarkdownV2 converts common Markdown into Telegram MarkdownV2.
+// Everything that is not recognised markup is escaped.
+func MarkdownToMarkdownV2(md string) string {
+	return convert(md, &telegramDialect)
+}
+
+var telegramDialect = dialect{
+	escape: EscapeMarkdownV2,
+	// Inside code entities only ` and \ must be escaped
+	code: func(s string) string { return escapeWith(s, "`\\") },
+	// Inside the URL part only ) and \ must be escaped
+	link: func(text, url string) string {
+		return "[" + text + "](" + escapeWith(url, ")\\") + ")"
+	},
+	bold:   "*",
+	italic: "_",
+	strike: "~",
+
+	codeSpan:  "`",
+	codeBlock: "```",
+}
+
+// escapeWith prefixes each character of s found in special with a backslash.
+func escapeWith(s, special string) string {
+	if !strings.ContainsAny(s, special) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package format
+
+import "testing"
+
+func TestMarkdownToMarkdownV2(t *testing.T) {
+	tests := []struct {
+		name string
+		md   string
+		want string
+	}{
+		{"plain punctuation", "Costs 1.5! (approx)", `Costs 1\.5\! \(approx\)`},
+		{"snake_case stays literal", "call snake_case_name now", `call snake\_case\_name now`},
+		{"underscore italic", "_italic_ text", "_italic_ text"},
+		{"underscore inside a word", "a_b_ c", `a\_b\_ c`},
+		{"unclosed underscore", "_open", `\_open`},
+		{"bold", "**bold** and __bold__", "*bold* and *bold*"},
+		{"star italic", "*it*", "_it_"},
+		{"strike", "~~gone~~", "~gone~"},
+		{"inline code keeps specials", "use `a_b*c[d]`", "use `a_b*c[d]`"},
+		{"inline code escapes backslash", "`C:\\dir`", "`C:\\\\dir`"},
+		{"unclosed backtick", "unclosed `tick", "unclosed \\`tick"},
+		{"empty backticks", "``", "\\`\\`"},
+		{"code block", "```go\nx := a_b * 2\n```", "```go\nx := a_b * 2\n```"},
+		{"unclosed code block", "```\nx_y", "\\`\\`\\`\nx\\_y"},
+		{"heading", "# Title.\nbody", "*Title\\.*\nbody"},
+		{"link", "[docs](https://example.com/a_b)", "[docs](https://example.com/a_b)"},
+		{"link with parentheses", "[Go](https://en.wikipedia.org/wiki/Go_(language))", `[Go](https://en.wikipedia.org/wiki/Go_(language\))`},
+		{"link text escaped", "[a_b.c](http://x)", `[a\_b\.c](http://x)`},
+		{"link with unbalanced parenthesis", "[x](http://y(z)", `\[x\]\(http://y\(z\)`},
+		{"brackets without url", "[not a link] (x)", `\[not a link\] \(x\)`},
+		{"nested brackets stay literal", "[[a]](u)", `\[\[a\]\]\(u\)`},
+		{"bold link", "**[b](u)**", "*[b](u)*"},
+		{"spaced markers", "2 * 3 * 4", `2 \* 3 \* 4`},
+	}
+	for _, tt := range tests {
+		if got := MarkdownToMarkdownV2(tt.md); got != tt.want {
+			t.Errorf("%s: MarkdownToMarkdownV2(%q) = %q, want %q", tt.name, tt.md, got, tt.want)
+		}
+	}
+}
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	in := "_*[]()~`>#+-=|{}.!\\ ok"
+	want := `\_\*\[\]\(\)\~\` + "`" + `\>\#\+\-\=\|\{\}\.\!\\ ok`
+	if got := EscapeMarkdownV2(in); got != want {
+		t.Errorf("EscapeMarkdownV2(%q) = %q, want %q", in, got, want)
+	}
+	if got := EscapeMarkdownV2("héllo wörld"); got != "héllo wörld" {
+		t.Errorf("text without specials changed: %q", got)
+	}
+}
@@ -0,0 +1,82 @@
+package local
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// FrameType discriminates WebSocket frames.
+type FrameType string
+
+const (
+	// FrameMessage is sent by the client; its payload is a MessageRequest.
+	FrameMessage FrameType = "message"
+	// FrameReply carries an InteractionIntent for the client.
+	FrameReply FrameType = "reply"
+	// FrameTyping carries a TypingPayload while a reply is being prepared.
+	FrameTyping FrameType = "typing"
+	// FrameAck acknowledges a client message with an AckPayload.
+	FrameAck FrameType = "ack"
+	// FrameError carries a protocol.UIPError.
+	FrameError FrameType = "error"
+)
+
+// Frame is the WebSocket envelope: {"type": "...", "payload": {...}}.
+//
+// Clients that send a legacy unwrapped MessageRequest keep receiving bare
+// InteractionIntent JSON. A connection switches to framed output as soon as
+// the client sends its first Frame, or up front with ?protocol=frames.
+type Frame struct {
+	Type    FrameType       `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// AckPayload confirms that a client message was accepted by the gateway.
+type AckPayload struct {
+	// MessageID echoes the client-supplied message ID, if any.
+	MessageID string `json:"messageId,omitempty"`
+	// InteractionID is the gateway-assigned ID; replies carry it in inReplyTo.
+	InteractionID string `json:"interactionId"`
+	TraceID       string `json:"traceId,omitempty"`
+}
+
+// TypingPayload signals that a reply is (or is no longer) being prepared.
+type TypingPayload struct {
+	SessionID string `json:"sessionId"`
+	Active    bool   `json:"active"`
+}
+
+// newFrame marshals payload into a frame.
+func newFrame(frameType FrameType, payload interface{}) ([]byte, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s payload: %w", frameType, err)
+	}
+	return json.Marshal(Frame{Type: frameType, Payload: raw})
+}
+
+// decodeClientMessage parses a client WebSocket message, accepting either a
+// Frame or a legacy unwrapped MessageRequest. framed reports which form was used.
+//
+// MessageRequest has its own "type" field (text, command, event), so a message
+// is only treated as a Frame when it also carries a "payload".
+func decodeClientMessage(data []byte) (req MessageRequest, framed bool, err error) {
+	var probe struct {
+		Type    FrameType       `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return req, false, err
+	}
+
+	if probe.Payload == nil {
+		err = json.Unmarshal(data, &req)
+		return req, false, err
+	}
+
+	if probe.Type != FrameMessage {
+		return req, true, fmt.Errorf("unsupported frame type: %q", probe.Type)
+	}
+	err = json.Unmarshal(probe.Payload, &req)
+	return req, true, err
+}
@@ -5,9 +5,11 @@ package local
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,16 +17,52 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/zlc_ai/uip-gateway/internal/adapter"
+	"github.com/zlc_ai/uip-gateway/internal/adapter/format"
+	"github.com/zlc_ai/uip-gateway/internal/httperr"
+	"github.com/zlc_ai/uip-gateway/internal/httplimit"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
 	"github.com/zlc_ai/uip-gateway/internal/protocol"
+	"github.com/zlc_ai/uip-gateway/internal/transport"
 )
 
 func init() {
 	adapter.RegisterAdapter("local", NewLocalAdapter)
 }
 
+// DefaultSendBufferSize is the number of intents queued per WebSocket
+// connection when Config.SendBufferSize is unset.
+const DefaultSendBufferSize = 256
+
+// ErrSendBufferFull is returned by SendIntent when a WebSocket client reads
+// too slowly to keep up and the intent was dropped.
+var ErrSendBufferFull = errors.New("websocket send buffer full")
+
+var sendsDroppedTotal = metrics.NewCounter("uip_adapter_sends_dropped_total",
+	"Intents dropped because the client's send buffer was full, by adapter.",
+	"adapter")
+
 // Config holds the configuration for the local adapter.
 type Config struct {
 	HTTPPath string `json:"http_path" yaml:"http_path"`
+	// Formatter names an outbound formatter (see format.ByName), for local
+	// clients that bridge to a specific IM platform.
+	Formatter string `json:"formatter" yaml:"formatter"`
+
+	// WebSocket buffer sizes and permessage-deflate, see transport.WebSocketConfig
+	ReadBufferSize    int  `json:"ws_read_buffer_size" yaml:"ws_read_buffer_size"`
+	WriteBufferSize   int  `json:"ws_write_buffer_size" yaml:"ws_write_buffer_size"`
+	EnableCompression bool `json:"ws_enable_compression" yaml:"ws_enable_compression"`
+
+	// BotUserID is the bot's own user ID; messages mentioning it are flagged mentionsBot
+	BotUserID string `json:"bot_user_id" yaml:"bot_user_id"`
+
+	// SendBufferSize is the number of intents queued per WebSocket connection
+	// (defaults to DefaultSendBufferSize).
+	SendBufferSize int `json:"send_buffer_size" yaml:"send_buffer_size"`
+	// SendTimeout is how long SendIntent waits for room in a full buffer
+	// before dropping the intent; 0 drops at once.
+	SendTimeout time.Duration `json:"send_timeout" yaml:"send_timeout"`
 }
 
 // LocalAdapter implements the IMAdapter interface for local IM interactions.
@@ -32,8 +70,10 @@ type Config struct {
 type LocalAdapter struct {
 	name         string
 	config       Config
-	logger       *zap.Logger
+	formatter    adapter.Formatter
+	logger       log.Logger
 	eventHandler adapter.EventHandler
+	syncProcess  adapter.SyncProcessor // set in gateway sync mode; HTTP replies inline
 
 	// WebSocket connections
 	wsConnsMu sync.RWMutex
@@ -55,7 +95,19 @@ type wsConnection struct {
 	sessionID string
 	userID    string
 	sendCh    chan []byte
+	urgentCh  chan []byte // high-priority intents, written before sendCh
 	done      chan struct{}
+	closeOnce sync.Once
+	framed    atomic.Bool // client speaks the Frame envelope protocol
+}
+
+// close ends the connection's pumps and closes the socket. Both Stop and the
+// read pump call it, so it is safe to call more than once.
+func (c *wsConnection) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
 }
 
 // MessageRequest is the JSON structure for HTTP message requests.
@@ -65,7 +117,38 @@ type MessageRequest struct {
 	Text             string `json:"text"`
 	Type             string `json:"type,omitempty"`             // text, command, event
 	ChannelID        string `json:"channelId,omitempty"`        // External IM channel/group ID for routing outbound
-	ConversationType string `json:"conversationType,omitempty"` // "direct", "group", "channel"
+	ConversationType string `json:"conversationType,omitempty"` // "direct", "group", "channel", "thread" (inferred if empty)
+	ThreadID         string `json:"threadId,omitempty"`         // Thread within the channel (for the per-thread session key strategy)
+	Locale           string `json:"locale,omitempty"`           // User locale hint for system messages (e.g. "zh-CN")
+	MessageID        string `json:"messageId,omitempty"`        // Client message ID, echoed in WebSocket ack frames
+	EditOf           string `json:"editOf,omitempty"`           // messageId of an earlier message this one edits
+	Model            string `json:"model,omitempty"`            // AI model hint, overriding the configured default
+
+	// Generation overrides the configured temperature/maxTokens/topP
+	Generation *protocol.GenerationParams `json:"generation,omitempty"`
+	// Structured asks for a JSON or tool-call reply (Chat Completions path)
+	Structured *protocol.StructuredOutput `json:"structured,omitempty"`
+	// Location shares a map pin; Type defaults to "location" when set
+	Location *protocol.Location `json:"location,omitempty"`
+	// QuickReply is the value of a tapped quick-reply button; Type defaults
+	// to "quick_reply" and Text to the value when set
+	QuickReply string `json:"quickReply,omitempty"`
+	// Reaction reports an emoji reaction to an earlier message; Type
+	// defaults to "reaction" when set
+	Reaction *protocol.Reaction `json:"reaction,omitempty"`
+
+	// Mentions lists mentioned user IDs; "<@id>" tokens in Text are added.
+	// MentionsBot flags a mention of the bot when the client resolved it
+	// itself (otherwise it is derived from bot_user_id).
+	Mentions    []string `json:"mentions,omitempty"`
+	MentionsBot bool     `json:"mentionsBot,omitempty"`
+
+	// Optional sender identity. The local adapter trusts these as given, so
+	// only expose it to trusted callers.
+	UserName string   `json:"userName,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	IsAdmin  bool     `json:"isAdmin,omitempty"`
+	IsBot    bool     `json:"isBot,omitempty"`
 }
 
 // MessageResponse is the JSON structure for HTTP message responses.
@@ -78,34 +161,74 @@ type MessageResponse struct {
 // NewLocalAdapter creates a new local IM adapter.
 func NewLocalAdapter(config map[string]interface{}) (adapter.IMAdapter, error) {
 	cfg := Config{
-		HTTPPath: "/api/v1/local",
+		HTTPPath:          "/api/v1/local",
+		EnableCompression: true,
 	}
 
 	if path, ok := config["http_path"].(string); ok {
 		cfg.HTTPPath = path
 	}
+	if name, ok := config["formatter"].(string); ok {
+		cfg.Formatter = name
+	}
+	if size, ok := config["ws_read_buffer_size"].(int); ok {
+		cfg.ReadBufferSize = size
+	}
+	if size, ok := config["ws_write_buffer_size"].(int); ok {
+		cfg.WriteBufferSize = size
+	}
+	if enabled, ok := config["ws_enable_compression"].(bool); ok {
+		cfg.EnableCompression = enabled
+	}
+	if id, ok := config["bot_user_id"].(string); ok {
+		cfg.BotUserID = id
+	}
+	if size, ok := config["send_buffer_size"].(int); ok {
+		cfg.SendBufferSize = size
+	}
+	if timeout, ok := config["send_timeout"].(time.Duration); ok {
+		cfg.SendTimeout = timeout
+	}
+	if cfg.SendBufferSize <= 0 {
+		cfg.SendBufferSize = DefaultSendBufferSize
+	}
+	formatter, err := format.ByName(cfg.Formatter)
+	if err != nil {
+		return nil, err
+	}
 
-	logger, _ := zap.NewProduction()
+	// Embedders can pass their own logger in the factory config
+	logger, _ := config["logger"].(log.Logger)
+	if logger == nil {
+		logger = log.Default()
+	}
+	// and vet browser WebSocket origins (all accepted by default)
+	checkOrigin, _ := config["check_origin"].(func(*http.Request) bool)
 
 	return &LocalAdapter{
-		name:    "local",
-		config:  cfg,
-		logger:  logger,
-		wsConns: make(map[string]*wsConnection),
-		upgrader: websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all origins for local development
-			},
-		},
+		name:      "local",
+		config:    cfg,
+		formatter: formatter,
+		logger:    logger,
+		wsConns:   make(map[string]*wsConnection),
+		upgrader: transport.WebSocketConfig{
+			ReadBufferSize:    cfg.ReadBufferSize,
+			WriteBufferSize:   cfg.WriteBufferSize,
+			EnableCompression: cfg.EnableCompression,
+			CheckOrigin:       checkOrigin,
+		}.Upgrader(),
 		capabilities: &protocol.SurfaceCapabilities{
 			SupportsReply:      true,
 			SupportsEdit:       true,
-			SupportsReaction:   false,
+			SupportsReaction:   true, // clients send reactions as reaction
 			SupportsThread:     false,
 			SupportsAttachment: false,
 			SupportsMarkdown:   true,
+			SupportsSources:    true,  // clients receive content.sources as JSON
+			SupportsEphemeral:  false, // replies go to the session, not to one user
+			SupportsLocation:   true,  // clients receive content.location as JSON
+			// clients receive content.quickReplies as JSON and send taps as quickReply
+			SupportsQuickReplies: true,
 		},
 	}, nil
 }
@@ -138,8 +261,7 @@ func (a *LocalAdapter) Stop(ctx context.Context) error {
 	// Close all WebSocket connections
 	a.wsConnsMu.Lock()
 	for _, conn := range a.wsConns {
-		close(conn.done)
-		conn.conn.Close()
+		conn.close()
 	}
 	a.wsConns = make(map[string]*wsConnection)
 	a.wsConnsMu.Unlock()
@@ -153,6 +275,17 @@ func (a *LocalAdapter) OnEvent(handler adapter.EventHandler) {
 	a.eventHandler = handler
 }
 
+// Formatter returns the configured outbound formatter, if any.
+func (a *LocalAdapter) Formatter() adapter.Formatter {
+	return a.formatter
+}
+
+// SetSyncProcessor makes HTTP messages wait for their reply and return it in
+// the MessageResponse. WebSocket messages are still answered via SendIntent.
+func (a *LocalAdapter) SetSyncProcessor(processor adapter.SyncProcessor) {
+	a.syncProcess = processor
+}
+
 func (a *LocalAdapter) SendIntent(ctx context.Context, intent *protocol.InteractionIntent) error {
 	// Try to send via WebSocket if connection exists
 	a.wsConnsMu.RLock()
@@ -160,30 +293,118 @@ func (a *LocalAdapter) SendIntent(ctx context.Context, intent *protocol.Interact
 	a.wsConnsMu.RUnlock()
 
 	if exists {
-		data, err := json.Marshal(intent)
+		var data []byte
+		var err error
+		if conn.framed.Load() {
+			data, err = newFrame(FrameReply, intent)
+		} else {
+			data, err = json.Marshal(intent)
+		}
 		if err != nil {
 			return fmt.Errorf("failed to marshal intent: %w", err)
 		}
 
-		select {
-		case conn.sendCh <- data:
-			a.logger.Debug("Intent sent via WebSocket",
-				zap.String("intentId", intent.IntentID),
-				zap.String("sessionId", intent.TargetSessionID))
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			a.logger.Warn("WebSocket send buffer full, dropping message")
+		ch := conn.sendCh
+		if intent.Constraints.IsHighPriority() {
+			ch = conn.urgentCh
+		}
+		logger := log.ForIntent(ctx, a.logger, intent)
+		if err := a.enqueue(ctx, conn, ch, data); err != nil {
+			if errors.Is(err, ErrSendBufferFull) {
+				sendsDroppedTotal.Inc(a.name)
+				logger.Warn("WebSocket send buffer full, dropping message",
+					zap.Duration("waited", a.config.SendTimeout))
+			}
+			return err
 		}
+		logger.Debug("Intent sent via WebSocket",
+			zap.Int("priority", intent.Constraints.Priority),
+			zap.Int("attachments", len(intent.Content.Attachments)))
 	}
 
 	return nil
 }
 
+// enqueue queues data on one of conn's send channels, waiting up to
+// SendTimeout for room when it is full.
+func (a *LocalAdapter) enqueue(ctx context.Context, conn *wsConnection, ch chan []byte, data []byte) error {
+	select {
+	case ch <- data:
+		return nil
+	default:
+	}
+	if a.config.SendTimeout <= 0 {
+		return ErrSendBufferFull
+	}
+
+	timer := time.NewTimer(a.config.SendTimeout)
+	defer timer.Stop()
+	select {
+	case ch <- data:
+		return nil
+	case <-conn.done:
+		// The connection closed while waiting; the reply is lost as it
+		// would have been had it arrived a moment later
+		return nil
+	case <-timer.C:
+		return ErrSendBufferFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Health reports an adapter that is not started. Clients connect to the
+// gateway, so there is nothing else to check.
+func (a *LocalAdapter) Health(ctx context.Context) error {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if !a.started {
+		return fmt.Errorf("adapter not started")
+	}
+	return nil
+}
+
+// SendTyping sends a typing indicator to the session's WebSocket connection.
+// Legacy (unframed) connections have no way to receive it and are skipped.
+func (a *LocalAdapter) SendTyping(ctx context.Context, sessionID string, active bool) error {
+	a.wsConnsMu.RLock()
+	conn, exists := a.wsConns[sessionID]
+	a.wsConnsMu.RUnlock()
+
+	if !exists || !conn.framed.Load() {
+		return nil
+	}
+	return a.sendFrame(conn, FrameTyping, TypingPayload{SessionID: sessionID, Active: active})
+}
+
+// sendFrame queues a frame on a connection without blocking.
+func (a *LocalAdapter) sendFrame(conn *wsConnection, frameType FrameType, payload interface{}) error {
+	data, err := newFrame(frameType, payload)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case conn.sendCh <- data:
+	default:
+		a.logger.Warn("WebSocket send buffer full, dropping frame",
+			zap.String("type", string(frameType)),
+			zap.String("sessionId", conn.sessionID))
+	}
+	return nil
+}
+
 func (a *LocalAdapter) Capabilities() *protocol.SurfaceCapabilities {
 	return a.capabilities
 }
 
+// DedupKey returns the client's messageId, so a client retrying a request
+// with the same messageId is answered once.
+func (a *LocalAdapter) DedupKey(event *protocol.CanonicalInteractionEvent) string {
+	key, _ := event.Input.Payload["messageId"].(string)
+	return key
+}
+
 // HTTPHandler returns an http.Handler for the REST API endpoint.
 func (a *LocalAdapter) HTTPHandler() http.Handler {
 	mux := http.NewServeMux()
@@ -193,19 +414,51 @@ func (a *LocalAdapter) HTTPHandler() http.Handler {
 	return mux
 }
 
+// isStarted reports whether the adapter accepts messages.
+func (a *LocalAdapter) isStarted() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.started
+}
+
 func (a *LocalAdapter) handleMessage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		w.Header().Set("Allow", http.MethodPost)
+		a.sendErrorResponse(w, protocol.ErrCodeMethodNotAllowed, "method not allowed", "")
+		return
+	}
+	if !a.isStarted() {
+		a.sendErrorResponse(w, protocol.ErrCodeUnavailable, "adapter not started", "")
 		return
 	}
 
 	var req MessageRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if limit, ok := httplimit.TooLarge(err); ok {
+			httplimit.WriteTooLarge(w, limit)
+			return
+		}
 		a.sendErrorResponse(w, protocol.ErrCodeProtocolError, "Invalid request body", "")
 		return
 	}
+	if req.Generation != nil {
+		if err := req.Generation.Validate(); err != nil {
+			a.sendErrorResponse(w, protocol.ErrCodeProtocolError, "generation: "+err.Error(), "")
+			return
+		}
+	}
+	if req.Location != nil {
+		if err := req.Location.Validate(); err != nil {
+			a.sendErrorResponse(w, protocol.ErrCodeProtocolError, "location: "+err.Error(), "")
+			return
+		}
+	}
 
-	// Validate required fields
+	// Validate required fields. Without a sessionId, fall back to the
+	// channelId so outbound responses can still be routed.
+	if req.SessionID == "" {
+		req.SessionID = req.ChannelID
+	}
 	if req.SessionID == "" {
 		req.SessionID = uuid.New().String()
 	}
@@ -213,17 +466,7 @@ func (a *LocalAdapter) handleMessage(w http.ResponseWriter, r *http.Request) {
 		req.UserID = "anonymous"
 	}
 	if req.Type == "" {
-		req.Type = "text"
-	}
-
-	// Determine conversation type
-	convType := req.ConversationType
-	if convType == "" {
-		if req.ChannelID != "" {
-			convType = "channel"
-		} else {
-			convType = "direct"
-		}
+		req.Type = defaultType(&req)
 	}
 
 	// Create CIE
@@ -231,14 +474,10 @@ func (a *LocalAdapter) handleMessage(w http.ResponseWriter, r *http.Request) {
 	payload := map[string]interface{}{
 		"text":             req.Text,
 		"channelId":        req.ChannelID,
-		"conversationType": convType,
+		"threadId":         req.ThreadID,
+		"conversationType": req.ConversationType,
 	}
-
-	// Use channelId as sessionId if provided (for routing outbound responses)
 	sessionID := req.SessionID
-	if req.ChannelID != "" && sessionID == "" {
-		sessionID = req.ChannelID
-	}
 
 	event := protocol.NewCanonicalInteractionEvent(
 		sessionID,
@@ -249,14 +488,48 @@ func (a *LocalAdapter) handleMessage(w http.ResponseWriter, r *http.Request) {
 		"local-adapter",
 	)
 	event.Meta.AdapterName = a.name
-
-	a.logger.Debug("Received HTTP message",
-		zap.String("sessionId", sessionID),
+	event.Meta.Locale = req.Locale
+	event.Meta.Model = req.Model
+	event.Meta.Generation = req.Generation
+	event.Meta.Structured = req.Structured
+	setIdentity(event, &req)
+	a.setMentions(event, &req)
+	setMessageRefs(event, &req)
+	setLocation(event, &req)
+	setQuickReply(event, &req)
+	setReaction(event, &req)
+
+	// Normalize the conversation type (inferred from channelId/threadId if unset)
+	convType := protocol.ConversationType(event)
+	event.Input.Payload["conversationType"] = convType
+
+	log.With(a.logger, log.EventFields(event)...).Debug("Received HTTP message",
 		zap.String("userId", req.UserID),
 		zap.String("channelId", req.ChannelID),
 		zap.String("conversationType", convType),
 		zap.String("text", req.Text))
 
+	// In sync mode, wait for the reply and return it inline
+	if a.syncProcess != nil {
+		intent, err := a.syncProcess(r.Context(), event)
+		if intent == nil {
+			log.With(a.logger, log.EventFields(event)...).Warn("Sync processing failed",
+				zap.Error(err))
+			code := protocol.ErrCodeUnavailable
+			if errors.Is(err, context.DeadlineExceeded) {
+				code = protocol.ErrCodeTimeout
+			}
+			a.sendErrorResponse(w, code, err.Error(), event.Meta.TraceID)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MessageResponse{
+			Success: err == nil,
+			Intent:  intent,
+		})
+		return
+	}
+
 	// Emit event to gateway
 	if a.eventHandler != nil {
 		a.eventHandler(event)
@@ -270,6 +543,10 @@ func (a *LocalAdapter) handleMessage(w http.ResponseWriter, r *http.Request) {
 }
 
 func (a *LocalAdapter) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !a.isStarted() {
+		a.sendErrorResponse(w, protocol.ErrCodeUnavailable, "adapter not started", "")
+		return
+	}
 	conn, err := a.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		a.logger.Error("WebSocket upgrade failed", zap.Error(err))
@@ -283,20 +560,37 @@ func (a *LocalAdapter) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	}
 	userID := r.URL.Query().Get("userId")
 	if userID == "" {
-		userID = "ws-user-" + sessionID[:8]
+		short := sessionID
+		if len(short) > 8 {
+			short = short[:8]
+		}
+		userID = "ws-user-" + short
 	}
 
 	wsConn := &wsConnection{
 		conn:      conn,
 		sessionID: sessionID,
 		userID:    userID,
-		sendCh:    make(chan []byte, 256),
+		sendCh:    make(chan []byte, a.config.SendBufferSize),
+		urgentCh:  make(chan []byte, 64),
 		done:      make(chan struct{}),
 	}
+	if r.URL.Query().Get("protocol") == "frames" {
+		wsConn.framed.Store(true)
+	}
 
+	// Register under a.mu so a concurrent Stop either sees the connection
+	// and closes it, or has already stopped and it is refused here.
+	a.mu.RLock()
+	if !a.started {
+		a.mu.RUnlock()
+		conn.Close()
+		return
+	}
 	a.wsConnsMu.Lock()
 	a.wsConns[sessionID] = wsConn
 	a.wsConnsMu.Unlock()
+	a.mu.RUnlock()
 
 	a.logger.Info("WebSocket connection established",
 		zap.String("sessionId", sessionID),
@@ -312,8 +606,7 @@ func (a *LocalAdapter) wsReadPump(wsConn *wsConnection) {
 		a.wsConnsMu.Lock()
 		delete(a.wsConns, wsConn.sessionID)
 		a.wsConnsMu.Unlock()
-		close(wsConn.done)
-		wsConn.conn.Close()
+		wsConn.close()
 		a.logger.Info("WebSocket connection closed", zap.String("sessionId", wsConn.sessionID))
 	}()
 
@@ -333,10 +626,26 @@ func (a *LocalAdapter) wsReadPump(wsConn *wsConnection) {
 			return
 		}
 
-		// Parse message as MessageRequest
-		var req MessageRequest
-		if err := json.Unmarshal(message, &req); err != nil {
+		// Parse message as a Frame or a legacy MessageRequest
+		req, framed, err := decodeClientMessage(message)
+		if framed {
+			wsConn.framed.Store(true)
+		}
+		if err == nil && req.Generation != nil {
+			if verr := req.Generation.Validate(); verr != nil {
+				err = fmt.Errorf("generation: %w", verr)
+			}
+		}
+		if err == nil && req.Location != nil {
+			if verr := req.Location.Validate(); verr != nil {
+				err = fmt.Errorf("location: %w", verr)
+			}
+		}
+		if err != nil {
 			a.logger.Warn("Invalid WebSocket message", zap.Error(err))
+			if wsConn.framed.Load() {
+				a.sendFrame(wsConn, FrameError, protocol.NewUIPError(protocol.ErrCodeProtocolError, err.Error(), ""))
+			}
 			continue
 		}
 
@@ -348,17 +657,7 @@ func (a *LocalAdapter) wsReadPump(wsConn *wsConnection) {
 			req.UserID = wsConn.userID
 		}
 		if req.Type == "" {
-			req.Type = "text"
-		}
-
-		// Determine conversation type
-		convType := req.ConversationType
-		if convType == "" {
-			if req.ChannelID != "" {
-				convType = "channel"
-			} else {
-				convType = "direct"
-			}
+			req.Type = defaultType(&req)
 		}
 
 		// Create CIE
@@ -366,14 +665,10 @@ func (a *LocalAdapter) wsReadPump(wsConn *wsConnection) {
 		payload := map[string]interface{}{
 			"text":             req.Text,
 			"channelId":        req.ChannelID,
-			"conversationType": convType,
+			"threadId":         req.ThreadID,
+			"conversationType": req.ConversationType,
 		}
-
-		// Use channelId as sessionId if provided
 		sessionID := req.SessionID
-		if req.ChannelID != "" && sessionID == "" {
-			sessionID = req.ChannelID
-		}
 
 		event := protocol.NewCanonicalInteractionEvent(
 			sessionID,
@@ -384,12 +679,34 @@ func (a *LocalAdapter) wsReadPump(wsConn *wsConnection) {
 			"local-adapter-ws",
 		)
 		event.Meta.AdapterName = a.name
-
-		a.logger.Debug("Received WebSocket message",
-			zap.String("sessionId", sessionID),
+		event.Meta.Locale = req.Locale
+		event.Meta.Model = req.Model
+		event.Meta.Generation = req.Generation
+		event.Meta.Structured = req.Structured
+		setIdentity(event, &req)
+		a.setMentions(event, &req)
+		setMessageRefs(event, &req)
+		setLocation(event, &req)
+		setQuickReply(event, &req)
+		setReaction(event, &req)
+
+		// Normalize the conversation type (inferred from channelId/threadId if unset)
+		convType := protocol.ConversationType(event)
+		event.Input.Payload["conversationType"] = convType
+
+		log.With(a.logger, log.EventFields(event)...).Debug("Received WebSocket message",
 			zap.String("channelId", req.ChannelID),
 			zap.String("text", req.Text))
 
+		// Ack before emitting so the ack always precedes the reply
+		if wsConn.framed.Load() {
+			a.sendFrame(wsConn, FrameAck, AckPayload{
+				MessageID:     req.MessageID,
+				InteractionID: event.InteractionID,
+				TraceID:       event.Meta.TraceID,
+			})
+		}
+
 		// Emit event to gateway
 		if a.eventHandler != nil {
 			a.eventHandler(event)
@@ -404,17 +721,39 @@ func (a *LocalAdapter) wsWritePump(wsConn *wsConnection) {
 		wsConn.conn.Close()
 	}()
 
+	write := func(message []byte) bool {
+		wsConn.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := wsConn.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+			a.logger.Error("WebSocket write error", zap.Error(err))
+			return false
+		}
+		return true
+	}
+
 	for {
+		// Drain high-priority intents before anything queued behind them
+		select {
+		case message := <-wsConn.urgentCh:
+			if !write(message) {
+				return
+			}
+			continue
+		default:
+		}
+
 		select {
+		case message := <-wsConn.urgentCh:
+			if !write(message) {
+				return
+			}
+
 		case message, ok := <-wsConn.sendCh:
-			wsConn.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if !ok {
+				wsConn.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 				wsConn.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
-
-			if err := wsConn.conn.WriteMessage(websocket.TextMessage, message); err != nil {
-				a.logger.Error("WebSocket write error", zap.Error(err))
+			if !write(message) {
 				return
 			}
 
@@ -430,20 +769,116 @@ func (a *LocalAdapter) wsWritePump(wsConn *wsConnection) {
 	}
 }
 
+// setIdentity copies the optional sender identity from the request into the session.
+func setIdentity(event *protocol.CanonicalInteractionEvent, req *MessageRequest) {
+	event.Session.UserName = req.UserName
+	event.Session.Roles = req.Roles
+	event.Session.IsAdmin = req.IsAdmin
+	if req.IsBot {
+		event.Session.ParticipantType = protocol.ParticipantTypeSystem
+	}
+}
+
+// defaultType is the input type of a request that does not name one.
+func defaultType(req *MessageRequest) string {
+	switch {
+	case req.Reaction != nil:
+		return string(protocol.InputTypeReaction)
+	case req.QuickReply != "":
+		return string(protocol.InputTypeQuickReply)
+	case req.Location != nil:
+		return string(protocol.InputTypeLocation)
+	}
+	return string(protocol.InputTypeText)
+}
+
+// setLocation copies a shared map pin into the payload.
+func setLocation(event *protocol.CanonicalInteractionEvent, req *MessageRequest) {
+	if req.Location != nil {
+		event.Input.Payload[protocol.PayloadLocation] = req.Location
+	}
+}
+
+// setQuickReply records a tapped quick-reply button, whose value stands in
+// for the text the user did not type.
+func setQuickReply(event *protocol.CanonicalInteractionEvent, req *MessageRequest) {
+	if req.QuickReply == "" {
+		return
+	}
+	event.Input.Payload[protocol.PayloadQuickReply] = req.QuickReply
+	if req.Text == "" {
+		event.Input.Payload["text"] = req.QuickReply
+	}
+}
+
+// setReaction copies an emoji reaction into the payload.
+func setReaction(event *protocol.CanonicalInteractionEvent, req *MessageRequest) {
+	if req.Reaction != nil {
+		event.Input.Payload[protocol.PayloadReaction] = req.Reaction
+	}
+}
+
+// setMessageRefs copies the client message ID into the payload and marks
+// edits of an earlier message (see gateway RespondToEdits).
+func setMessageRefs(event *protocol.CanonicalInteractionEvent, req *MessageRequest) {
+	if req.MessageID != "" {
+		event.Input.Payload["messageId"] = req.MessageID
+	}
+	if req.EditOf != "" {
+		event.Meta.IsEdit = true
+		event.Input.Payload[protocol.PayloadEditedMessageID] = req.EditOf
+	}
+}
+
+// setMentions fills the mentions payload fields from the request and the
+// "<@id>" tokens in its text.
+func (a *LocalAdapter) setMentions(event *protocol.CanonicalInteractionEvent, req *MessageRequest) {
+	mentions := append([]string(nil), req.Mentions...)
+	for _, id := range protocol.ParseMentions(req.Text) {
+		if !contains(mentions, id) {
+			mentions = append(mentions, id)
+		}
+	}
+	if len(mentions) > 0 {
+		event.Input.Payload[protocol.PayloadMentions] = mentions
+	}
+	if req.MentionsBot || (a.config.BotUserID != "" && contains(mentions, a.config.BotUserID)) {
+		event.Input.Payload[protocol.PayloadMentionsBot] = true
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ConnectionCount returns the number of open WebSocket connections.
+func (a *LocalAdapter) ConnectionCount() int {
+	a.wsConnsMu.RLock()
+	defer a.wsConnsMu.RUnlock()
+	return len(a.wsConns)
+}
+
 func (a *LocalAdapter) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"status":      "healthy",
 		"adapter":     a.name,
-		"connections": len(a.wsConns),
+		"connections": a.ConnectionCount(),
 	})
 }
 
+// sendErrorResponse writes a failed MessageResponse with the HTTP status
+// mapped from code.
 func (a *LocalAdapter) sendErrorResponse(w http.ResponseWriter, code, message, traceID string) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusBadRequest)
+	w.WriteHeader(httperr.Status(code))
 	json.NewEncoder(w).Encode(MessageResponse{
 		Success: false,
-		Error:   protocol.NewUIPError(code, message, traceID),
+		Error:   httperr.NewUIPError(code, message, traceID),
 	})
 }
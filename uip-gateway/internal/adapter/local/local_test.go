@@ -0,0 +1,202 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+func newTestAdapter(t *testing.T) (*LocalAdapter, *httptest.Server) {
+	t.Helper()
+	a, err := NewLocalAdapter(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("NewLocalAdapter: %v", err)
+	}
+	srv := httptest.NewServer(a.(*LocalAdapter).HTTPHandler())
+	t.Cleanup(srv.Close)
+	return a.(*LocalAdapter), srv
+}
+
+func dial(t *testing.T, srv *httptest.Server, sessionID string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?sessionId=" + sessionID
+	return websocket.DefaultDialer.Dial(url, nil)
+}
+
+func waitConnections(t *testing.T, a *LocalAdapter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for a.ConnectionCount() != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("connections = %d, want %d", a.ConnectionCount(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestStopStartWithLiveWebSocket(t *testing.T) {
+	ctx := context.Background()
+	a, srv := newTestAdapter(t)
+	if err := a.Start(ctx); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	conn, _, err := dial(t, srv, "s1")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	waitConnections(t, a, 1)
+
+	// Stop closes the connection; the read pump then exits on its own
+	// without closing it a second time.
+	if err := a.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatal("read after Stop succeeded, want closed connection")
+	}
+	waitConnections(t, a, 0)
+
+	if _, resp, err := dial(t, srv, "s2"); err == nil {
+		t.Fatal("dial while stopped succeeded")
+	} else if resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("dial while stopped: resp = %v, err = %v; want 503", resp, err)
+	}
+
+	if err := a.Start(ctx); err != nil {
+		t.Fatalf("restart: %v", err)
+	}
+	conn2, _, err := dial(t, srv, "s1")
+	if err != nil {
+		t.Fatalf("dial after restart: %v", err)
+	}
+	defer conn2.Close()
+	waitConnections(t, a, 1)
+
+	intent := protocol.NewInteractionIntent(protocol.IntentTypeReply, "hello again", "s1", "i1")
+	if err := a.SendIntent(ctx, intent); err != nil {
+		t.Fatalf("SendIntent: %v", err)
+	}
+	conn2.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn2.ReadMessage()
+	if err != nil {
+		t.Fatalf("read after restart: %v", err)
+	}
+	var got protocol.InteractionIntent
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if got.Content.Text != "hello again" {
+		t.Errorf("text = %q, want %q", got.Content.Text, "hello again")
+	}
+
+	if err := a.Stop(ctx); err != nil {
+		t.Fatalf("second Stop: %v", err)
+	}
+}
+
+func TestHandleMessageRejectedWhileStopped(t *testing.T) {
+	a, srv := newTestAdapter(t)
+	events := 0
+	a.OnEvent(func(*protocol.CanonicalInteractionEvent) { events++ })
+
+	post := func() int {
+		resp, err := http.Post(srv.URL+"/message", "application/json",
+			strings.NewReader(`{"sessionId":"s1","userId":"u1","text":"hi"}`))
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := post(); code != http.StatusServiceUnavailable {
+		t.Errorf("before Start: status = %d, want 503", code)
+	}
+	a.Start(context.Background())
+	if code := post(); code != http.StatusOK {
+		t.Errorf("after Start: status = %d, want 200", code)
+	}
+	a.Stop(context.Background())
+	if code := post(); code != http.StatusServiceUnavailable {
+		t.Errorf("after Stop: status = %d, want 503", code)
+	}
+	if events != 1 {
+		t.Errorf("events = %d, want 1", events)
+	}
+}
+
+// TestHighPriorityIntentSentFirst queues normal replies and then an alert
+// before the connection's write pump runs: the alert must be written first.
+func TestHighPriorityIntentSentFirst(t *testing.T) {
+	a, _ := newTestAdapter(t)
+	upgraded := make(chan *wsConnection, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := a.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		wsConn := &wsConnection{
+			conn:      conn,
+			sessionID: "s1",
+			sendCh:    make(chan []byte, 8),
+			urgentCh:  make(chan []byte, 8),
+			done:      make(chan struct{}),
+		}
+		a.wsConnsMu.Lock()
+		a.wsConns["s1"] = wsConn
+		a.wsConnsMu.Unlock()
+		upgraded <- wsConn
+	}))
+	defer srv.Close()
+
+	client, _, err := dial(t, srv, "s1")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer client.Close()
+	wsConn := <-upgraded
+	defer wsConn.close()
+
+	send := func(text string, priority int) {
+		intent := protocol.NewInteractionIntent(protocol.IntentTypeReply, text, "s1", "")
+		intent.Constraints.Priority = priority
+		if err := a.SendIntent(context.Background(), intent); err != nil {
+			t.Fatalf("SendIntent(%s): %v", text, err)
+		}
+	}
+	send("reply-1", protocol.PriorityNormal)
+	send("reply-2", protocol.PriorityNormal)
+	send("reply-3", protocol.PriorityNormal)
+	send("alert", protocol.PriorityHigh)
+	go a.wsWritePump(wsConn)
+
+	var got []string
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for len(got) < 4 {
+		_, data, err := client.ReadMessage()
+		if err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		var intent protocol.InteractionIntent
+		if err := json.Unmarshal(data, &intent); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		got = append(got, intent.Content.Text)
+	}
+	if want := "[alert reply-1 reply-2 reply-3]"; fmt.Sprint(got) != want {
+		t.Errorf("written %v, want %s", got, want)
+	}
+}
@@ -0,0 +1,479 @@
+// Package matrix implements an IM adapter for Matrix (Element and other
+// clients) over the client-server API. It receives messages by long-polling
+// /sync (forwarding m.reaction annotations as reaction events) and replies
+// with m.room.message events.
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter"
+	"github.com/zlc_ai/uip-gateway/internal/adapter/format"
+	"github.com/zlc_ai/uip-gateway/internal/backoff"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Name is the adapter name used in logs and metrics.
+const Name = "matrix"
+
+// Defaults.
+const (
+	DefaultSyncTimeout = 30 * time.Second
+
+	maxSendAttempts = 3
+	// unhealthyAfter is the number of consecutive failed syncs after which
+	// Health reports the sync loop as failing
+	unhealthyAfter = 3
+	maxRetryDelay  = 30 * time.Second
+	// recentCapacity bounds the messages remembered for threading and edits
+	recentCapacity = 4096
+)
+
+func init() {
+	adapter.RegisterAdapter(Name, NewMatrixAdapter)
+}
+
+// Config holds the configuration for the Matrix adapter.
+type Config struct {
+	// HomeserverURL is the client-server API base, e.g. "https://matrix.org"
+	HomeserverURL string `json:"homeserver_url" yaml:"homeserver_url"`
+	// AccessToken authenticates the bot account
+	AccessToken string `json:"access_token" yaml:"access_token"`
+	// UserID is the bot's Matrix ID (@bot:example.org); looked up with
+	// /account/whoami when empty. The bot's own messages are ignored.
+	UserID string `json:"user_id" yaml:"user_id"`
+	// SyncTimeout is the /sync long-poll timeout
+	SyncTimeout time.Duration `json:"sync_timeout" yaml:"sync_timeout"`
+	// StateFile persists the /sync batch token, so a restart resumes after
+	// the last processed batch instead of skipping what arrived meanwhile
+	StateFile string `json:"state_file" yaml:"state_file"`
+}
+
+// MatrixAdapter implements the IMAdapter interface for Matrix. Rooms map to
+// sessions and senders to users; rooms with two joined members are direct
+// conversations, larger rooms are groups. Edited messages (m.replace) are
+// emitted as edit events, and intents that replace an earlier reply edit it.
+type MatrixAdapter struct {
+	config       Config
+	logger       log.Logger
+	httpClient   *http.Client // sends and lookups
+	syncClient   *http.Client // long-polls, timeout above SyncTimeout
+	capabilities *protocol.SurfaceCapabilities
+
+	mu           sync.RWMutex
+	started      bool
+	eventHandler adapter.EventHandler
+	cancel       context.CancelFunc
+	done         chan struct{}
+
+	// since is the next_batch token of the last processed /sync response;
+	// only the sync loop touches it
+	since string
+
+	syncMu     sync.Mutex
+	syncErr    error // last sync error, nil after a successful sync
+	syncErrors int   // consecutive failed syncs
+
+	membersMu sync.Mutex
+	members   map[string]int // joined member count by room ID
+
+	replies recent[replyTarget] // by interaction ID
+	sent    recent[string]      // event ID by intent ID
+}
+
+// replyTarget is the inbound message a reply answers.
+type replyTarget struct {
+	eventID string
+}
+
+// NewMatrixAdapter creates a Matrix adapter. homeserver_url and
+// access_token are required.
+func NewMatrixAdapter(config map[string]interface{}) (adapter.IMAdapter, error) {
+	cfg := Config{SyncTimeout: DefaultSyncTimeout}
+	if v, ok := config["homeserver_url"].(string); ok {
+		cfg.HomeserverURL = strings.TrimRight(v, "/")
+	}
+	if v, ok := config["access_token"].(string); ok {
+		cfg.AccessToken = v
+	}
+	if v, ok := config["user_id"].(string); ok {
+		cfg.UserID = v
+	}
+	if v, ok := config["sync_timeout"].(time.Duration); ok && v > 0 {
+		cfg.SyncTimeout = v
+	}
+	if v, ok := config["state_file"].(string); ok {
+		cfg.StateFile = v
+	}
+	if cfg.HomeserverURL == "" {
+		return nil, fmt.Errorf("matrix: homeserver_url is required")
+	}
+	if cfg.AccessToken == "" {
+		return nil, fmt.Errorf("matrix: access_token is required")
+	}
+
+	// Embedders can pass their own logger in the factory config
+	logger, _ := config["logger"].(log.Logger)
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return &MatrixAdapter{
+		config:     cfg,
+		logger:     logger,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		syncClient: &http.Client{Timeout: cfg.SyncTimeout + 30*time.Second},
+		capabilities: &protocol.SurfaceCapabilities{
+			SupportsReply:    true,
+			SupportsEdit:     true, // m.replace
+			SupportsThread:   true,
+			SupportsMarkdown: true, // sent as org.matrix.custom.html
+			SupportsLocation: true, // m.location
+			SupportsReaction: true, // m.reaction, inbound
+		},
+		members: make(map[string]int),
+	}, nil
+}
+
+func (a *MatrixAdapter) Name() string {
+	return Name
+}
+
+// Start resolves the bot's user ID if needed, loads the persisted batch
+// token and starts the sync loop.
+func (a *MatrixAdapter) Start(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.started {
+		return fmt.Errorf("adapter already started")
+	}
+	if a.config.UserID == "" {
+		userID, err := a.whoami(ctx)
+		if err != nil {
+			return fmt.Errorf("matrix whoami: %w", err)
+		}
+		a.config.UserID = userID
+	}
+	since, err := a.loadState()
+	if err != nil {
+		return err
+	}
+	a.since = since
+
+	syncCtx, cancel := context.WithCancel(context.Background())
+	a.cancel = cancel
+	a.done = make(chan struct{})
+	a.started = true
+	go a.run(syncCtx)
+
+	a.logger.Info("Matrix adapter started",
+		zap.String("homeserver", a.config.HomeserverURL),
+		zap.String("userId", a.config.UserID),
+		zap.Bool("resuming", since != ""))
+	return nil
+}
+
+// Stop ends the sync loop and waits for it to exit.
+func (a *MatrixAdapter) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	if !a.started {
+		a.mu.Unlock()
+		return nil
+	}
+	a.started = false
+	a.cancel()
+	done := a.done
+	a.mu.Unlock()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *MatrixAdapter) OnEvent(handler adapter.EventHandler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.eventHandler = handler
+}
+
+func (a *MatrixAdapter) Capabilities() *protocol.SurfaceCapabilities {
+	return a.capabilities
+}
+
+// DedupKey returns the Matrix event ID, which stays the same when a sync
+// redelivers the event.
+func (a *MatrixAdapter) DedupKey(event *protocol.CanonicalInteractionEvent) string {
+	key, _ := event.Input.Payload["messageId"].(string)
+	return key
+}
+
+// Health checks the access token with /account/whoami and reports a sync
+// loop that keeps failing.
+func (a *MatrixAdapter) Health(ctx context.Context) error {
+	a.mu.RLock()
+	started := a.started
+	a.mu.RUnlock()
+	if !started {
+		return fmt.Errorf("adapter not started")
+	}
+
+	a.syncMu.Lock()
+	syncErr, failures := a.syncErr, a.syncErrors
+	a.syncMu.Unlock()
+	if failures >= unhealthyAfter {
+		return fmt.Errorf("sync failing (%d attempts): %w", failures, syncErr)
+	}
+
+	_, err := a.whoami(ctx)
+	return err
+}
+
+// recordSync tracks the outcome of a /sync request for Health.
+func (a *MatrixAdapter) recordSync(err error) {
+	a.syncMu.Lock()
+	defer a.syncMu.Unlock()
+	a.syncErr = err
+	if err != nil {
+		a.syncErrors++
+	} else {
+		a.syncErrors = 0
+	}
+}
+
+// SendIntent posts the intent to its room as an m.room.message. Markdown is
+// sent as an org.matrix.custom.html formatted body, and replies to threaded
+// messages stay in the thread. An intent that Replaces an earlier one edits
+// that message instead. The intent ID is the transaction ID, so retries
+// never post twice.
+func (a *MatrixAdapter) SendIntent(ctx context.Context, intent *protocol.InteractionIntent) error {
+	if intent.IntentType == protocol.IntentTypeNoop {
+		return nil
+	}
+	roomID := intent.TargetSessionID
+	if roomID == "" {
+		return fmt.Errorf("matrix: intent has no target room")
+	}
+
+	body := intent.Content.Text
+	if body == "" {
+		body = intent.Content.Markdown
+	}
+	msgtype := "m.text"
+	if intent.IntentType == protocol.IntentTypeNotify {
+		msgtype = "m.notice"
+	}
+	content := map[string]interface{}{
+		"msgtype": msgtype,
+		"body":    body,
+	}
+	if loc := intent.Content.Location; loc != nil {
+		// m.location has no formatted body; the text becomes its description
+		if body == "" {
+			body = loc.Label()
+		}
+		msgtype = "m.location"
+		content = map[string]interface{}{
+			"msgtype": msgtype,
+			"body":    body,
+			"geo_uri": loc.GeoURI(),
+		}
+	} else if intent.Content.Markdown != "" {
+		content["format"] = "org.matrix.custom.html"
+		content["formatted_body"] = format.MarkdownToHTML(intent.Content.Markdown)
+	}
+	if len(intent.Content.Mentions) > 0 {
+		userIDs := make([]string, 0, len(intent.Content.Mentions))
+		for _, m := range intent.Content.Mentions {
+			if m.UserID != "" {
+				userIDs = append(userIDs, m.UserID)
+			}
+		}
+		content["m.mentions"] = map[string]interface{}{"user_ids": userIDs}
+	}
+	if original, ok := a.sent.get(intent.Replaces); ok {
+		content = map[string]interface{}{
+			"msgtype":       msgtype,
+			"body":          "* " + body,
+			"m.new_content": content,
+			"m.relates_to": map[string]interface{}{
+				"rel_type": "m.replace",
+				"event_id": original,
+			},
+		}
+	} else if intent.ThreadID != "" {
+		// Fall back to replying to the root when the answered message is unknown
+		inReplyTo := intent.ThreadID
+		if target, ok := a.replies.get(intent.InReplyTo); ok {
+			inReplyTo = target.eventID
+		}
+		content["m.relates_to"] = map[string]interface{}{
+			"rel_type":        "m.thread",
+			"event_id":        intent.ThreadID,
+			"is_falling_back": true,
+			"m.in_reply_to":   map[string]interface{}{"event_id": inReplyTo},
+		}
+	}
+
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(roomID) +
+		"/send/m.room.message/" + url.PathEscape(intent.IntentID)
+	var resp struct {
+		EventID string `json:"event_id"`
+	}
+	var err error
+	for attempt := 1; attempt <= maxSendAttempts; attempt++ {
+		if err = a.do(ctx, a.httpClient, http.MethodPut, path, content, &resp); err == nil {
+			break
+		}
+		merr, ok := err.(*apiError)
+		if !ok || !merr.retryable() || attempt == maxSendAttempts {
+			return err
+		}
+		select {
+		case <-time.After(backoff.Delay(attempt, merr.retryAfter, maxRetryDelay)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	if original, ok := a.sent.get(intent.Replaces); ok {
+		// Later edits still target the message as first posted
+		a.sent.put(intent.IntentID, original)
+	} else {
+		a.sent.put(intent.IntentID, resp.EventID)
+	}
+	log.ForIntent(ctx, a.logger, intent).Debug("Intent sent to Matrix",
+		zap.String("roomId", roomID),
+		zap.String("eventId", resp.EventID))
+	return nil
+}
+
+// recent is a map that forgets its oldest entry once it holds
+// recentCapacity entries.
+type recent[V any] struct {
+	mu    sync.Mutex
+	m     map[string]V
+	order [recentCapacity]string
+	next  int
+}
+
+func (r *recent[V]) put(key string, v V) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.m == nil {
+		r.m = make(map[string]V)
+	}
+	if _, exists := r.m[key]; !exists {
+		delete(r.m, r.order[r.next])
+		r.order[r.next] = key
+		r.next = (r.next + 1) % recentCapacity
+	}
+	r.m[key] = v
+}
+
+func (r *recent[V]) get(key string) (V, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.m[key]
+	return v, ok
+}
+
+// apiError is a non-2xx client-server API response.
+type apiError struct {
+	status     int
+	errcode    string
+	message    string
+	retryAfter time.Duration
+}
+
+func (e *apiError) Error() string {
+	if e.errcode != "" {
+		return fmt.Sprintf("matrix: HTTP %d %s: %s", e.status, e.errcode, e.message)
+	}
+	return fmt.Sprintf("matrix: HTTP %d", e.status)
+}
+
+// retryable reports whether the request may succeed if repeated.
+func (e *apiError) retryable() bool {
+	return e.status == http.StatusTooManyRequests || e.status >= 500
+}
+
+// do sends a client-server API request with the access token and decodes
+// the JSON response into out (when non-nil).
+func (a *MatrixAdapter) do(ctx context.Context, client *http.Client, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.config.HomeserverURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.config.AccessToken)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var e struct {
+			Errcode      string `json:"errcode"`
+			Error        string `json:"error"`
+			RetryAfterMs int64  `json:"retry_after_ms"`
+		}
+		json.Unmarshal(data, &e)
+		retryAfter := backoff.ParseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		if retryAfter == 0 && e.RetryAfterMs > 0 {
+			retryAfter = time.Duration(e.RetryAfterMs) * time.Millisecond
+		}
+		return &apiError{status: resp.StatusCode, errcode: e.Errcode, message: e.Error, retryAfter: retryAfter}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("matrix: invalid response: %w", err)
+	}
+	return nil
+}
+
+func (a *MatrixAdapter) whoami(ctx context.Context) (string, error) {
+	var resp struct {
+		UserID string `json:"user_id"`
+	}
+	if err := a.do(ctx, a.httpClient, http.MethodGet, "/_matrix/client/v3/account/whoami", nil, &resp); err != nil {
+		return "", err
+	}
+	if resp.UserID == "" {
+		return "", fmt.Errorf("matrix: whoami returned no user_id")
+	}
+	return resp.UserID, nil
+}
@@ -0,0 +1,440 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/backoff"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// syncFilter limits /sync to room messages, reactions and the room summary.
+const syncFilter = `{"presence":{"types":[]},"account_data":{"types":[]},` +
+	`"room":{"timeline":{"types":["m.room.message","m.reaction"]},"state":{"types":[]},` +
+	`"ephemeral":{"types":[]},"account_data":{"types":[]}}}`
+
+// syncResponse is the subset of a /sync response the adapter reads.
+type syncResponse struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]joinedRoom `json:"join"`
+	} `json:"rooms"`
+}
+
+type joinedRoom struct {
+	Summary struct {
+		JoinedMemberCount *int `json:"m.joined_member_count"`
+	} `json:"summary"`
+	Timeline struct {
+		Events []roomEvent `json:"events"`
+	} `json:"timeline"`
+}
+
+type roomEvent struct {
+	Type           string       `json:"type"`
+	EventID        string       `json:"event_id"`
+	Sender         string       `json:"sender"`
+	OriginServerTS int64        `json:"origin_server_ts"`
+	Content        eventContent `json:"content"`
+}
+
+type eventContent struct {
+	MsgType string `json:"msgtype"`
+	Body    string `json:"body"`
+	URL     string `json:"url"`
+	GeoURI  string `json:"geo_uri"`
+	Info    struct {
+		MimeType string `json:"mimetype"`
+		Size     int64  `json:"size"`
+	} `json:"info"`
+	Mentions *struct {
+		UserIDs []string `json:"user_ids"`
+	} `json:"m.mentions"`
+	NewContent *struct {
+		Body string `json:"body"`
+	} `json:"m.new_content"`
+	RelatesTo *struct {
+		RelType   string `json:"rel_type"`
+		EventID   string `json:"event_id"`
+		Key       string `json:"key"` // m.annotation (reaction) emoji
+		InReplyTo *struct {
+			EventID string `json:"event_id"`
+		} `json:"m.in_reply_to"`
+	} `json:"m.relates_to"`
+}
+
+// run long-polls /sync until ctx is cancelled. The first sync without a
+// persisted batch token only establishes the token: room history from
+// before the adapter started is never answered.
+func (a *MatrixAdapter) run(ctx context.Context) {
+	defer close(a.done)
+
+	attempt := 0
+	for ctx.Err() == nil {
+		resp, err := a.sync(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			a.recordSync(err)
+			attempt++
+			var retryAfter time.Duration
+			if merr, ok := err.(*apiError); ok {
+				retryAfter = merr.retryAfter
+			}
+			delay := backoff.Delay(attempt, retryAfter, maxRetryDelay)
+			a.logger.Warn("Matrix sync failed",
+				zap.Int("attempt", attempt),
+				zap.Duration("retryIn", delay),
+				zap.Error(err))
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		attempt = 0
+		a.recordSync(nil)
+
+		if a.since == "" {
+			a.logger.Info("Matrix initial sync complete, skipping room history")
+		} else {
+			a.handleSync(ctx, resp)
+		}
+		a.since = resp.NextBatch
+		if err := a.saveState(); err != nil {
+			a.logger.Error("Failed to persist Matrix sync token", zap.Error(err))
+		}
+	}
+}
+
+func (a *MatrixAdapter) sync(ctx context.Context) (*syncResponse, error) {
+	query := url.Values{}
+	query.Set("filter", syncFilter)
+	if a.since != "" {
+		query.Set("since", a.since)
+		query.Set("timeout", strconv.FormatInt(a.config.SyncTimeout.Milliseconds(), 10))
+	}
+	var resp syncResponse
+	if err := a.do(ctx, a.syncClient, http.MethodGet, "/_matrix/client/v3/sync?"+query.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.NextBatch == "" {
+		return nil, fmt.Errorf("matrix: sync returned no next_batch")
+	}
+	return &resp, nil
+}
+
+func (a *MatrixAdapter) handleSync(ctx context.Context, resp *syncResponse) {
+	a.mu.RLock()
+	handler := a.eventHandler
+	a.mu.RUnlock()
+
+	for roomID, room := range resp.Rooms.Join {
+		if n := room.Summary.JoinedMemberCount; n != nil {
+			a.membersMu.Lock()
+			a.members[roomID] = *n
+			a.membersMu.Unlock()
+		}
+		for _, ev := range room.Timeline.Events {
+			if ev.Sender == a.config.UserID || handler == nil {
+				continue
+			}
+			var event *protocol.CanonicalInteractionEvent
+			switch ev.Type {
+			case "m.room.message":
+				event = a.newEvent(ctx, roomID, ev)
+			case "m.reaction":
+				event = a.newReactionEvent(ctx, roomID, ev)
+			}
+			if event == nil {
+				continue
+			}
+			log.With(a.logger, log.EventFields(event)...).Debug("Received Matrix message",
+				zap.String("eventId", ev.EventID),
+				zap.String("roomId", roomID),
+				zap.String("sender", ev.Sender))
+			handler(event)
+		}
+	}
+}
+
+// newEvent translates a room message into a canonical interaction event,
+// or returns nil for message types the adapter does not handle.
+func (a *MatrixAdapter) newEvent(ctx context.Context, roomID string, ev roomEvent) *protocol.CanonicalInteractionEvent {
+	c := ev.Content
+	payload := map[string]interface{}{
+		"messageId": ev.EventID,
+	}
+
+	editOf := ""
+	if c.RelatesTo != nil && c.RelatesTo.RelType == "m.replace" {
+		if c.NewContent == nil {
+			return nil
+		}
+		editOf = c.RelatesTo.EventID
+		payload[protocol.PayloadEditedMessageID] = editOf
+	}
+
+	inputType := protocol.InputTypeText
+	switch c.MsgType {
+	case "m.text", "m.notice", "m.emote":
+		text := c.Body
+		switch {
+		case editOf != "":
+			text = c.NewContent.Body
+		case c.RelatesTo != nil && c.RelatesTo.InReplyTo != nil:
+			text = stripReplyFallback(text)
+		}
+		payload["text"] = text
+	case "m.image", "m.file", "m.audio", "m.video":
+		payload["text"] = ""
+		att := map[string]interface{}{
+			"kind":        strings.TrimPrefix(c.MsgType, "m."),
+			"url":         a.mediaURL(c.URL),
+			"contentType": c.Info.MimeType,
+			"fileName":    c.Body,
+		}
+		if c.Info.Size > 0 {
+			att["size"] = c.Info.Size
+		}
+		payload["attachments"] = []interface{}{att}
+	case "m.location":
+		loc, ok := parseGeoURI(c.GeoURI)
+		if !ok {
+			return nil
+		}
+		loc.Name = c.Body
+		payload["text"] = ""
+		payload[protocol.PayloadLocation] = loc
+		inputType = protocol.InputTypeLocation
+	default:
+		return nil
+	}
+
+	threadRoot := ""
+	if c.RelatesTo != nil && c.RelatesTo.RelType == "m.thread" {
+		threadRoot = c.RelatesTo.EventID
+	}
+	convType := protocol.ConversationGroup
+	switch {
+	case threadRoot != "":
+		convType = protocol.ConversationThread
+		payload["threadId"] = threadRoot
+	case a.memberCount(ctx, roomID) == 2:
+		convType = protocol.ConversationDirect
+	}
+	if convType != protocol.ConversationDirect {
+		payload["channelId"] = roomID
+	}
+	payload["conversationType"] = convType
+
+	var mentions []string
+	if c.Mentions != nil {
+		mentions = c.Mentions.UserIDs
+	}
+	if len(mentions) > 0 {
+		payload[protocol.PayloadMentions] = mentions
+	}
+	mentionsBot := strings.Contains(c.Body, a.config.UserID)
+	for _, id := range mentions {
+		mentionsBot = mentionsBot || id == a.config.UserID
+	}
+	payload[protocol.PayloadMentionsBot] = mentionsBot
+
+	event := protocol.NewCanonicalInteractionEvent(
+		roomID,
+		ev.Sender,
+		inputType,
+		payload,
+		*a.capabilities,
+		"matrix",
+	)
+	event.Meta.AdapterName = Name
+	event.Meta.IsEdit = editOf != ""
+	if ev.OriginServerTS > 0 {
+		event.Meta.Timestamp = ev.OriginServerTS
+	}
+	// Bots are expected to post m.notice, and must not answer one
+	if c.MsgType == "m.notice" {
+		event.Session.ParticipantType = protocol.ParticipantTypeSystem
+	}
+
+	a.replies.put(event.InteractionID, replyTarget{eventID: ev.EventID})
+	return event
+}
+
+// newReactionEvent translates an m.reaction annotation into a reaction
+// event, or returns nil for anything else. Replies to it answer the
+// message reacted to.
+func (a *MatrixAdapter) newReactionEvent(ctx context.Context, roomID string, ev roomEvent) *protocol.CanonicalInteractionEvent {
+	rel := ev.Content.RelatesTo
+	if rel == nil || rel.RelType != "m.annotation" || rel.Key == "" || rel.EventID == "" {
+		return nil
+	}
+	payload := map[string]interface{}{
+		"messageId": ev.EventID,
+		"text":      "",
+		protocol.PayloadReaction: &protocol.Reaction{
+			Emoji:     rel.Key,
+			MessageID: rel.EventID,
+		},
+	}
+	convType := protocol.ConversationGroup
+	if a.memberCount(ctx, roomID) == 2 {
+		convType = protocol.ConversationDirect
+	} else {
+		payload["channelId"] = roomID
+	}
+	payload["conversationType"] = convType
+
+	event := protocol.NewCanonicalInteractionEvent(
+		roomID,
+		ev.Sender,
+		protocol.InputTypeReaction,
+		payload,
+		*a.capabilities,
+		"matrix",
+	)
+	event.Meta.AdapterName = Name
+	if ev.OriginServerTS > 0 {
+		event.Meta.Timestamp = ev.OriginServerTS
+	}
+
+	a.replies.put(event.InteractionID, replyTarget{eventID: rel.EventID})
+	return event
+}
+
+// parseGeoURI reads the coordinates of an m.location "geo:lat,lng[,alt][;params]" URI.
+func parseGeoURI(uri string) (*protocol.Location, bool) {
+	coords, ok := strings.CutPrefix(uri, "geo:")
+	if !ok {
+		return nil, false
+	}
+	coords, _, _ = strings.Cut(coords, ";")
+	parts := strings.Split(coords, ",")
+	if len(parts) < 2 {
+		return nil, false
+	}
+	lat, err1 := strconv.ParseFloat(parts[0], 64)
+	lng, err2 := strconv.ParseFloat(parts[1], 64)
+	if err1 != nil || err2 != nil {
+		return nil, false
+	}
+	loc := &protocol.Location{Latitude: lat, Longitude: lng}
+	if loc.Validate() != nil {
+		return nil, false
+	}
+	return loc, true
+}
+
+// stripReplyFallback removes the quoted "> <@user> ..." lines clients put
+// in front of a reply's body.
+func stripReplyFallback(body string) string {
+	lines := strings.Split(body, "\n")
+	i := 0
+	for i < len(lines) && strings.HasPrefix(lines[i], ">") {
+		i++
+	}
+	if i == 0 {
+		return body
+	}
+	return strings.TrimLeft(strings.Join(lines[i:], "\n"), "\n")
+}
+
+// mediaURL turns an mxc:// content URI into a download URL on the
+// homeserver. Servers with authenticated media require the access token.
+func (a *MatrixAdapter) mediaURL(mxc string) string {
+	rest, ok := strings.CutPrefix(mxc, "mxc://")
+	if !ok {
+		return mxc
+	}
+	return a.config.HomeserverURL + "/_matrix/client/v1/media/download/" + rest
+}
+
+// memberCount returns the room's joined member count, from the sync
+// summary or, for rooms not yet seen, /joined_members. It returns 0 when
+// the count is unknown.
+func (a *MatrixAdapter) memberCount(ctx context.Context, roomID string) int {
+	a.membersMu.Lock()
+	n, ok := a.members[roomID]
+	a.membersMu.Unlock()
+	if ok {
+		return n
+	}
+
+	var resp struct {
+		Joined map[string]json.RawMessage `json:"joined"`
+	}
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(roomID) + "/joined_members"
+	if err := a.do(ctx, a.httpClient, http.MethodGet, path, nil, &resp); err != nil {
+		a.logger.Warn("Failed to look up Matrix room members",
+			zap.String("roomId", roomID),
+			zap.Error(err))
+		return 0
+	}
+	a.membersMu.Lock()
+	a.members[roomID] = len(resp.Joined)
+	a.membersMu.Unlock()
+	return len(resp.Joined)
+}
+
+// syncState is the persisted sync position.
+type syncState struct {
+	NextBatch string `json:"nextBatch"`
+}
+
+func (a *MatrixAdapter) loadState() (string, error) {
+	if a.config.StateFile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(a.config.StateFile)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("read matrix state: %w", err)
+	}
+	var state syncState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return "", fmt.Errorf("corrupt matrix state %s: %w", a.config.StateFile, err)
+	}
+	return state.NextBatch, nil
+}
+
+// saveState writes the batch token atomically, so a crash never leaves a
+// truncated file.
+func (a *MatrixAdapter) saveState() error {
+	if a.config.StateFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(syncState{NextBatch: a.since})
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(a.config.StateFile), ".matrix-state-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), a.config.StateFile)
+}
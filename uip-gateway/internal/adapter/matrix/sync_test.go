@@ -0,0 +1,121 @@
+package matrix
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+func TestParseGeoURI(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want *protocol.Location
+	}{
+		{"geo:52.52,13.405", &protocol.Location{Latitude: 52.52, Longitude: 13.405}},
+		{"geo:-33.8568,151.2153,58", &protocol.Location{Latitude: -33.8568, Longitude: 151.2153}},
+		{"geo:37.786971,-122.399677;u=35", &protocol.Location{Latitude: 37.786971, Longitude: -122.399677}},
+		{"geo:0,0;crs=wgs84;u=10", &protocol.Location{}},
+		{"geo:52.52", nil},
+		{"geo:north,east", nil},
+		{"geo:91,0", nil},
+		{"geo:0,181", nil},
+		{"52.52,13.405", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, ok := parseGeoURI(tt.uri)
+		if ok != (tt.want != nil) || ok && *got != *tt.want {
+			t.Errorf("parseGeoURI(%q) = %+v %v, want %+v", tt.uri, got, ok, tt.want)
+		}
+	}
+
+	// A location survives the round trip through its own geo URI
+	loc := &protocol.Location{Latitude: 48.8584, Longitude: 2.2945}
+	if got, ok := parseGeoURI(loc.GeoURI()); !ok || *got != *loc {
+		t.Errorf("round trip of %s = %+v %v", loc.GeoURI(), got, ok)
+	}
+}
+
+func newTestAdapter(t *testing.T) *MatrixAdapter {
+	t.Helper()
+	a, err := NewMatrixAdapter(map[string]interface{}{
+		"homeserver_url": "http://127.0.0.1:1",
+		"access_token":   "token",
+		"user_id":        "@bot:example.org",
+		"logger":         zap.NewNop(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a.(*MatrixAdapter)
+}
+
+// TestReactionEvents feeds a /sync batch of m.reaction events to the
+// adapter. Annotations become reaction events replying to the message
+// reacted to; anything else is skipped.
+func TestReactionEvents(t *testing.T) {
+	a := newTestAdapter(t)
+	var events []*protocol.CanonicalInteractionEvent
+	a.OnEvent(func(e *protocol.CanonicalInteractionEvent) { events = append(events, e) })
+
+	var resp syncResponse
+	err := json.Unmarshal([]byte(`{"rooms":{"join":{
+		"!dm:example.org":{"summary":{"m.joined_member_count":2},"timeline":{"events":[
+			{"type":"m.reaction","event_id":"$r1","sender":"@alice:example.org","origin_server_ts":1700000000000,
+			 "content":{"m.relates_to":{"rel_type":"m.annotation","event_id":"$m1","key":"👍"}}},
+			{"type":"m.reaction","event_id":"$r2","sender":"@alice:example.org",
+			 "content":{"m.relates_to":{"rel_type":"m.reference","event_id":"$m1","key":"👍"}}},
+			{"type":"m.reaction","event_id":"$r3","sender":"@alice:example.org",
+			 "content":{"m.relates_to":{"rel_type":"m.annotation","event_id":"$m1"}}},
+			{"type":"m.reaction","event_id":"$r4","sender":"@bot:example.org",
+			 "content":{"m.relates_to":{"rel_type":"m.annotation","event_id":"$m1","key":"👀"}}}
+		]}},
+		"!group:example.org":{"summary":{"m.joined_member_count":5},"timeline":{"events":[
+			{"type":"m.reaction","event_id":"$r5","sender":"@bob:example.org",
+			 "content":{"m.relates_to":{"rel_type":"m.annotation","event_id":"$m2","key":"🎉"}}}
+		]}}
+	}}}`), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.handleSync(context.Background(), &resp)
+
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Session.ExternalSessionID < events[j].Session.ExternalSessionID })
+	tests := []struct {
+		room, user, convType, channel string
+		reaction                      protocol.Reaction
+	}{
+		{"!dm:example.org", "@alice:example.org", protocol.ConversationDirect, "", protocol.Reaction{Emoji: "👍", MessageID: "$m1"}},
+		{"!group:example.org", "@bob:example.org", protocol.ConversationGroup, "!group:example.org", protocol.Reaction{Emoji: "🎉", MessageID: "$m2"}},
+	}
+	for i, tt := range tests {
+		e := events[i]
+		reaction, ok := protocol.ReactionOf(e)
+		if !ok || *reaction != tt.reaction {
+			t.Errorf("%s: reaction = %+v %v, want %+v", tt.room, reaction, ok, tt.reaction)
+		}
+		if e.Session.ExternalSessionID != tt.room || e.Session.UserID != tt.user {
+			t.Errorf("%s: session %q user %q", tt.room, e.Session.ExternalSessionID, e.Session.UserID)
+		}
+		if got := protocol.ConversationType(e); got != tt.convType {
+			t.Errorf("%s: conversation type = %q, want %q", tt.room, got, tt.convType)
+		}
+		if got, _ := e.Input.Payload["channelId"].(string); got != tt.channel {
+			t.Errorf("%s: channelId = %q, want %q", tt.room, got, tt.channel)
+		}
+		if target, ok := a.replies.get(e.InteractionID); !ok || target.eventID != tt.reaction.MessageID {
+			t.Errorf("%s: reply target = %+v, want the message reacted to", tt.room, target)
+		}
+	}
+	if events[0].Meta.Timestamp != 1700000000000 {
+		t.Errorf("timestamp = %d, want origin_server_ts", events[0].Meta.Timestamp)
+	}
+}
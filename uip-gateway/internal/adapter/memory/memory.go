@@ -0,0 +1,239 @@
+// Package memory implements an in-process adapter for exercising the full
+// gateway loop without a network or an IM platform: a caller injects events
+// as if a user had sent them, and reads back the intents the gateway
+// delivered through SendIntent.
+//
+// A typical end-to-end check registers a MemoryAdapter with a gateway backed
+// by clawdbot.MockClient:
+//
+//	mem := memory.New(nil)
+//	gw := gateway.New(gateway.DefaultConfig(), clawdbot.NewMockClient(nil), nil)
+//	gw.RegisterAdapter(mem)
+//	gw.Start(ctx)
+//	mem.Inject(mem.Message("user-1", "hello"))
+//	intents, err := mem.WaitFor(ctx, 1)
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Name is the adapter name used in logs and metrics.
+const Name = "memory"
+
+func init() {
+	adapter.RegisterAdapter(Name, NewMemoryAdapter)
+}
+
+// MemoryAdapter is an adapter whose IM platform is the caller.
+type MemoryAdapter struct {
+	logger       log.Logger
+	capabilities *protocol.SurfaceCapabilities
+
+	mu           sync.Mutex
+	started      bool
+	eventHandler adapter.EventHandler
+	received     []*protocol.InteractionIntent
+	sendErr      error
+	convCaps     map[string]*protocol.SurfaceCapabilities
+	notify       chan struct{} // closed and replaced on every SendIntent
+}
+
+// NewMemoryAdapter creates a memory adapter. The factory config accepts
+// "logger" (log.Logger) and "capabilities" (*protocol.SurfaceCapabilities);
+// by default every capability is supported, so intents reach Received
+// undegraded.
+func NewMemoryAdapter(config map[string]interface{}) (adapter.IMAdapter, error) {
+	caps, _ := config["capabilities"].(*protocol.SurfaceCapabilities)
+	a := New(caps)
+	if logger, ok := config["logger"].(log.Logger); ok {
+		a.logger = logger
+	}
+	return a, nil
+}
+
+// New creates a memory adapter with the given capabilities; nil supports
+// everything.
+func New(caps *protocol.SurfaceCapabilities) *MemoryAdapter {
+	if caps == nil {
+		caps = &protocol.SurfaceCapabilities{
+			SupportsReply:        true,
+			SupportsThread:       true,
+			SupportsAttachment:   true,
+			SupportsMarkdown:     true,
+			SupportsEphemeral:    true,
+			SupportsEdit:         true,
+			SupportsReaction:     true,
+			SupportsSources:      true,
+			SupportsLocation:     true,
+			SupportsQuickReplies: true,
+		}
+	}
+	return &MemoryAdapter{
+		logger:       log.Default(),
+		capabilities: caps,
+		notify:       make(chan struct{}),
+	}
+}
+
+func (a *MemoryAdapter) Name() string {
+	return Name
+}
+
+func (a *MemoryAdapter) Start(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.started {
+		return fmt.Errorf("adapter already started")
+	}
+	a.started = true
+	return nil
+}
+
+func (a *MemoryAdapter) Stop(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.started = false
+	return nil
+}
+
+func (a *MemoryAdapter) OnEvent(handler adapter.EventHandler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.eventHandler = handler
+}
+
+// SendIntent records the intent, or fails with the error set by
+// SetSendError without recording it.
+func (a *MemoryAdapter) SendIntent(ctx context.Context, intent *protocol.InteractionIntent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.sendErr != nil {
+		return a.sendErr
+	}
+	a.received = append(a.received, intent)
+	log.ForIntent(ctx, a.logger, intent).Debug("Memory adapter received intent",
+		zap.Int("received", len(a.received)))
+	close(a.notify)
+	a.notify = make(chan struct{})
+	return nil
+}
+
+func (a *MemoryAdapter) Capabilities() *protocol.SurfaceCapabilities {
+	return a.capabilities
+}
+
+// ConversationCapabilities returns the capabilities set for conversationType
+// with SetConversationCapabilities, or nil.
+func (a *MemoryAdapter) ConversationCapabilities(conversationType string) *protocol.SurfaceCapabilities {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.convCaps[conversationType]
+}
+
+// SetConversationCapabilities makes the adapter report caps for
+// conversations of conversationType; nil reverts to Capabilities.
+func (a *MemoryAdapter) SetConversationCapabilities(conversationType string, caps *protocol.SurfaceCapabilities) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if caps == nil {
+		delete(a.convCaps, conversationType)
+		return
+	}
+	if a.convCaps == nil {
+		a.convCaps = make(map[string]*protocol.SurfaceCapabilities)
+	}
+	a.convCaps[conversationType] = caps
+}
+
+// Health reports an adapter that is not started.
+func (a *MemoryAdapter) Health(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.started {
+		return fmt.Errorf("adapter not started")
+	}
+	return nil
+}
+
+// Message builds a direct-message text event from userID, carrying the
+// adapter's capabilities.
+func (a *MemoryAdapter) Message(userID, text string) *protocol.CanonicalInteractionEvent {
+	event := protocol.NewCanonicalInteractionEvent(
+		"memory-"+userID,
+		userID,
+		protocol.InputTypeText,
+		map[string]interface{}{"text": text},
+		*a.capabilities,
+		Name,
+	)
+	event.Meta.AdapterName = Name
+	return event
+}
+
+// Inject hands event to the gateway as if the IM platform had delivered
+// it. Processing is asynchronous; use WaitFor to collect the replies.
+func (a *MemoryAdapter) Inject(event *protocol.CanonicalInteractionEvent) error {
+	a.mu.Lock()
+	started, handler := a.started, a.eventHandler
+	a.mu.Unlock()
+	if !started || handler == nil {
+		return fmt.Errorf("memory adapter not started")
+	}
+	if event.Meta.AdapterName == "" {
+		event.Meta.AdapterName = Name
+	}
+	handler(event)
+	return nil
+}
+
+// Received returns the intents delivered so far, in delivery order.
+func (a *MemoryAdapter) Received() []*protocol.InteractionIntent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]*protocol.InteractionIntent(nil), a.received...)
+}
+
+// WaitFor blocks until at least n intents have been delivered and returns
+// them, or returns ctx's error with the intents delivered so far.
+func (a *MemoryAdapter) WaitFor(ctx context.Context, n int) ([]*protocol.InteractionIntent, error) {
+	for {
+		a.mu.Lock()
+		received := append([]*protocol.InteractionIntent(nil), a.received...)
+		notify := a.notify
+		a.mu.Unlock()
+		if len(received) >= n {
+			return received, nil
+		}
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return received, ctx.Err()
+		}
+	}
+}
+
+// SetSendError makes SendIntent fail with err; nil restores delivery.
+func (a *MemoryAdapter) SetSendError(err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.sendErr = err
+}
+
+// Reset forgets the delivered intents.
+func (a *MemoryAdapter) Reset() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.received = nil
+}
@@ -0,0 +1,130 @@
+package attachment
+
+import (
+	"fmt"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Attachment kinds with their own size limit.
+const (
+	KindImage    = "image"
+	KindAudio    = "audio"
+	KindVideo    = "video"
+	KindDocument = "document"
+)
+
+// Limits caps attachment sizes by kind.
+type Limits struct {
+	// Default applies to kinds without their own limit; 0 means no limit.
+	Default int64 `json:"default" yaml:"default"`
+	// Kinds maps KindImage, KindAudio, KindVideo and KindDocument to limits.
+	Kinds map[string]int64 `json:"kinds" yaml:"kinds"`
+}
+
+// Validate rejects unknown kinds and negative limits.
+func (l Limits) Validate() error {
+	if l.Default < 0 {
+		return fmt.Errorf("attachment limit must not be negative")
+	}
+	for kind, max := range l.Kinds {
+		switch kind {
+		case KindImage, KindAudio, KindVideo, KindDocument:
+		default:
+			return fmt.Errorf("unknown attachment kind %q (want image, audio, video or document)", kind)
+		}
+		if max < 0 {
+			return fmt.Errorf("attachment limit for %s must not be negative", kind)
+		}
+	}
+	return nil
+}
+
+// Max returns the limit for kind, or 0 for no limit. Kinds other than
+// image, audio and video count as documents.
+func (l Limits) Max(kind string) int64 {
+	if max, ok := l.Kinds[NormalizeKind(kind)]; ok && max > 0 {
+		return max
+	}
+	return l.Default
+}
+
+// Check returns a *TooLargeError if size exceeds the limit for kind. An
+// unknown (zero) size always passes.
+func (l Limits) Check(kind string, size int64) error {
+	if max := l.Max(kind); max > 0 && size > max {
+		return &TooLargeError{Kind: NormalizeKind(kind), Size: size, Max: max}
+	}
+	return nil
+}
+
+// NormalizeKind maps an adapter's attachment kind to one of the limit
+// kinds: "file", "unknown" and anything unrecognised become KindDocument.
+func NormalizeKind(kind string) string {
+	switch kind {
+	case KindImage, KindAudio, KindVideo:
+		return kind
+	}
+	return KindDocument
+}
+
+// KindOf derives the attachment kind from a MIME type.
+func KindOf(contentType string) string {
+	return protocol.InferAttachmentKind(contentType, "")
+}
+
+// SizeOf returns the "size" field of an inbound payload attachment, or 0
+// when it is missing.
+func SizeOf(att map[string]interface{}) int64 {
+	switch v := att["size"].(type) {
+	case float64:
+		return int64(v)
+	case int64:
+		return v
+	case int:
+		return int64(v)
+	}
+	return 0
+}
+
+// TooLargeError reports an attachment over its size limit.
+type TooLargeError struct {
+	Kind string
+	// Size is the attachment's size in bytes; 0 when only known to exceed Max.
+	Size int64
+	Max  int64
+}
+
+func (e *TooLargeError) Error() string {
+	what := "attachment"
+	if e.Kind != "" {
+		what = e.Kind + " attachment"
+	}
+	if e.Size == 0 {
+		return fmt.Sprintf("%s exceeds the %s limit", what, FormatSize(e.Max))
+	}
+	return fmt.Sprintf("%s of %s exceeds the %s limit", what, FormatSize(e.Size), FormatSize(e.Max))
+}
+
+// OmittedNote is the text put in place of an attachment stripped for
+// exceeding its limit, so the AI knows something was sent.
+func OmittedNote(fileName string, err *TooLargeError) string {
+	if fileName != "" {
+		fileName = " " + fileName
+	}
+	return fmt.Sprintf("[Attachment%s omitted: %s]", fileName, err.Error())
+}
+
+// FormatSize renders a byte count in KiB/MiB/GiB.
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
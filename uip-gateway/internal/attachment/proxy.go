@@ -0,0 +1,365 @@
+// Package attachment provides a short-lived re-hosting proxy for inbound attachments.
+//
+// IM platforms frequently hand out signed CDN URLs that expire within minutes.
+// The proxy downloads the attachment as soon as the event arrives and serves it
+// from the gateway itself, so OpenClaw can fetch it later without hitting an
+// expired link.
+package attachment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+	"github.com/zlc_ai/uip-gateway/internal/httperr"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Config holds the attachment proxy configuration.
+type Config struct {
+	// PublicURL is the externally reachable base URL of the gateway (e.g. "http://gateway:8080").
+	PublicURL string
+	// Path is the HTTP path prefix attachments are served from.
+	Path string
+	// MaxSize is the maximum size in bytes of a single attachment.
+	MaxSize int64
+	// MaxTotalSize caps the bytes held across all attachments. The oldest
+	// attachments are evicted to make room for a new one.
+	MaxTotalSize int64
+	// MaxItems caps the number of attachments held, evicting the oldest.
+	MaxItems int
+	// AllowPrivate permits downloads from loopback, link-local and private
+	// addresses. Off by default: the source URL comes from the inbound
+	// event, and the gateway must not fetch internal services for it.
+	AllowPrivate bool
+	// TTL is how long a re-hosted attachment stays available.
+	TTL time.Duration
+	// CleanupInterval is how often expired attachments are purged.
+	CleanupInterval time.Duration
+	// Timeout is the download timeout for a single attachment.
+	Timeout time.Duration
+	// Clock expires attachments (clock.System if nil).
+	Clock clock.Clock
+}
+
+// DefaultConfig returns the default attachment proxy configuration.
+func DefaultConfig() Config {
+	return Config{
+		PublicURL:       "http://localhost:8080",
+		Path:            "/api/v1/attachments",
+		MaxSize:         20 << 20,
+		MaxTotalSize:    256 << 20,
+		MaxItems:        1000,
+		TTL:             15 * time.Minute,
+		CleanupInterval: time.Minute,
+		Timeout:         30 * time.Second,
+	}
+}
+
+// Proxy downloads attachments and serves them from the gateway for a limited time.
+type Proxy struct {
+	config     Config
+	httpClient *http.Client
+	logger     log.Logger
+
+	mu    sync.RWMutex
+	items map[string]*storedAttachment
+	size  int64 // bytes held in items
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+type storedAttachment struct {
+	data        []byte
+	contentType string
+	expiresAt   time.Time
+}
+
+// NewProxy creates a new attachment proxy.
+func NewProxy(config Config, logger log.Logger) *Proxy {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	defaults := DefaultConfig()
+	if config.Path == "" {
+		config.Path = defaults.Path
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = defaults.MaxSize
+	}
+	if config.MaxTotalSize <= 0 {
+		config.MaxTotalSize = defaults.MaxTotalSize
+	}
+	if config.MaxItems <= 0 {
+		config.MaxItems = defaults.MaxItems
+	}
+	if config.TTL <= 0 {
+		config.TTL = defaults.TTL
+	}
+	config.Clock = clock.Or(config.Clock)
+	if config.CleanupInterval <= 0 {
+		config.CleanupInterval = defaults.CleanupInterval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	config.PublicURL = strings.TrimRight(config.PublicURL, "/")
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !config.AllowPrivate {
+		dialer.Control = refusePrivate
+	}
+	return &Proxy{
+		config: config,
+		httpClient: &http.Client{
+			Timeout: config.Timeout,
+			// No proxy: the address check must see the real destination
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: 10 * time.Second,
+				MaxIdleConns:        16,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+		logger: logger,
+		items:  make(map[string]*storedAttachment),
+		stopCh: make(chan struct{}),
+	}
+}
+
+// Start starts the background cleanup of expired attachments.
+func (p *Proxy) Start(ctx context.Context) error {
+	p.wg.Add(1)
+	go p.cleanupLoop()
+	p.logger.Info("Attachment proxy started",
+		zap.String("path", p.config.Path),
+		zap.Duration("ttl", p.config.TTL))
+	return nil
+}
+
+// Stop stops the cleanup loop and drops all stored attachments.
+func (p *Proxy) Stop(ctx context.Context) error {
+	close(p.stopCh)
+	p.wg.Wait()
+
+	p.mu.Lock()
+	p.items = make(map[string]*storedAttachment)
+	p.size = 0
+	p.mu.Unlock()
+
+	p.logger.Info("Attachment proxy stopped")
+	return nil
+}
+
+// Rehost downloads the attachment at sourceURL and returns a gateway-hosted
+// URL for it. A positive maxSize replaces the configured MaxSize; larger
+// attachments fail with a *TooLargeError without being read in full.
+//
+// Only http and https URLs are fetched, and unless AllowPrivate is set,
+// connections to loopback, link-local and private addresses are refused
+// with ErrPrivateAddress, including after a redirect.
+func (p *Proxy) Rehost(ctx context.Context, sourceURL string, maxSize int64) (string, error) {
+	if maxSize <= 0 {
+		maxSize = p.config.MaxSize
+	}
+	if maxSize > p.config.MaxTotalSize {
+		maxSize = p.config.MaxTotalSize
+	}
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid attachment URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported attachment URL scheme %q", u.Scheme)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sourceURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("download failed: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxSize {
+		return "", &TooLargeError{Size: resp.ContentLength, Max: maxSize}
+	}
+
+	// Read one byte past the limit so oversized bodies without Content-Length are detected
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+	if int64(len(data)) > maxSize {
+		return "", &TooLargeError{Max: maxSize}
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(data)
+	}
+
+	id := uuid.New().String()
+	p.store(id, &storedAttachment{
+		data:        data,
+		contentType: contentType,
+		expiresAt:   p.config.Clock.Now().Add(p.config.TTL),
+	})
+
+	hostedURL := fmt.Sprintf("%s%s/%s", p.config.PublicURL, p.config.Path, id)
+	p.logger.Debug("Attachment re-hosted",
+		zap.String("id", id),
+		zap.String("contentType", contentType),
+		zap.Int("size", len(data)))
+
+	return hostedURL, nil
+}
+
+// Path returns the HTTP path prefix attachments are served from.
+func (p *Proxy) Path() string {
+	return p.config.Path
+}
+
+// Count returns the number of attachments currently stored.
+func (p *Proxy) Count() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.items)
+}
+
+// HTTPHandler returns an http.Handler serving GET {Path}/{id}.
+func (p *Proxy) HTTPHandler() http.Handler {
+	return http.HandlerFunc(p.handleGet)
+}
+
+// store adds item under id, evicting the oldest attachments while the
+// store is over MaxItems or MaxTotalSize. Rehost caps maxSize at
+// MaxTotalSize, so the new item always fits.
+func (p *Proxy) store(id string, item *storedAttachment) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	evicted := 0
+	for len(p.items) > 0 && (len(p.items) >= p.config.MaxItems || p.size+int64(len(item.data)) > p.config.MaxTotalSize) {
+		oldest := ""
+		for id, it := range p.items {
+			if oldest == "" || it.expiresAt.Before(p.items[oldest].expiresAt) {
+				oldest = id
+			}
+		}
+		p.remove(oldest)
+		evicted++
+	}
+	if evicted > 0 {
+		p.logger.Debug("Evicted attachments to stay within the store limits",
+			zap.Int("count", evicted),
+			zap.Int("maxItems", p.config.MaxItems),
+			zap.Int64("maxTotalSize", p.config.MaxTotalSize))
+	}
+	p.items[id] = item
+	p.size += int64(len(item.data))
+}
+
+// remove deletes the attachment id. The caller holds mu for writing.
+func (p *Proxy) remove(id string) {
+	if item, ok := p.items[id]; ok {
+		p.size -= int64(len(item.data))
+		delete(p.items, id)
+	}
+}
+
+// ErrPrivateAddress is returned by Rehost for a URL resolving to a
+// loopback, link-local or private address.
+var ErrPrivateAddress = errors.New("attachment URL resolves to a private address")
+
+// refusePrivate is a net.Dialer Control function refusing connections to
+// addresses that are not publicly routable. It runs after name resolution,
+// so it also catches public names pointing at internal addresses.
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+func (p *Proxy) handleGet(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		httperr.MethodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, p.config.Path+"/")
+
+	p.mu.RLock()
+	item, exists := p.items[id]
+	p.mu.RUnlock()
+
+	if !exists || p.config.Clock.Now().After(item.expiresAt) {
+		httperr.WriteUIPError(w, protocol.ErrCodeNotFound, "not found", "")
+		return
+	}
+
+	w.Header().Set("Content-Type", item.contentType)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(item.data)))
+	w.Write(item.data)
+}
+
+func (p *Proxy) cleanupLoop() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.config.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if count := p.cleanup(); count > 0 {
+				p.logger.Debug("Cleaned up expired attachments", zap.Int("count", count))
+			}
+		case <-p.stopCh:
+			return
+		}
+	}
+}
+
+// cleanup removes expired attachments and returns the count.
+func (p *Proxy) cleanup() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	count := 0
+	now := p.config.Clock.Now()
+	for id, item := range p.items {
+		if now.After(item.expiresAt) {
+			p.remove(id)
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,110 @@
+package attachment
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func startSource(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, "/file", http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(strings.Repeat("x", 100)))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRehostRefusesUnsafeURLs(t *testing.T) {
+	src := startSource(t)
+	p := NewProxy(Config{}, zap.NewNop())
+
+	for _, sourceURL := range []string{
+		src.URL + "/file",
+		src.URL + "/redirect",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]:1/",
+		"http://10.0.0.1:1/",
+	} {
+		if _, err := p.Rehost(context.Background(), sourceURL, 0); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("Rehost(%s) err = %v, want ErrPrivateAddress", sourceURL, err)
+		}
+	}
+	for _, sourceURL := range []string{"file:///etc/passwd", "gopher://x/", "ftp://x/a.png", "/relative"} {
+		if _, err := p.Rehost(context.Background(), sourceURL, 0); err == nil || !strings.Contains(err.Error(), "scheme") {
+			t.Errorf("Rehost(%s) err = %v, want an unsupported scheme error", sourceURL, err)
+		}
+	}
+	if p.Count() != 0 {
+		t.Errorf("Count = %d after refused downloads, want 0", p.Count())
+	}
+}
+
+func TestRehostAllowPrivate(t *testing.T) {
+	src := startSource(t)
+	p := NewProxy(Config{PublicURL: "http://gw", AllowPrivate: true}, zap.NewNop())
+
+	hosted, err := p.Rehost(context.Background(), src.URL+"/redirect", 0)
+	if err != nil {
+		t.Fatalf("Rehost: %v", err)
+	}
+	w := httptest.NewRecorder()
+	p.HTTPHandler().ServeHTTP(w, httptest.NewRequest("GET", strings.TrimPrefix(hosted, "http://gw"), nil))
+	if w.Code != 200 || w.Body.Len() != 100 {
+		t.Errorf("GET %s: status %d, %d bytes, want 200 and 100 bytes", hosted, w.Code, w.Body.Len())
+	}
+}
+
+// TestRehostStoreLimits checks that the oldest attachments are evicted once
+// the item or byte cap is reached.
+func TestRehostStoreLimits(t *testing.T) {
+	src := startSource(t)
+	tests := []struct {
+		name   string
+		config Config
+		want   int
+		bytes  int64
+	}{
+		{"item cap", Config{AllowPrivate: true, MaxItems: 3}, 3, 300},
+		{"byte cap", Config{AllowPrivate: true, MaxTotalSize: 250}, 2, 200},
+	}
+	for _, tt := range tests {
+		p := NewProxy(tt.config, zap.NewNop())
+		var hosted []string
+		for i := 0; i < 5; i++ {
+			u, err := p.Rehost(context.Background(), src.URL+"/file", 0)
+			if err != nil {
+				t.Fatalf("%s: Rehost %d: %v", tt.name, i, err)
+			}
+			hosted = append(hosted, u)
+		}
+		if p.Count() != tt.want || p.size != tt.bytes {
+			t.Errorf("%s: holding %d attachments, %d bytes, want %d and %d", tt.name, p.Count(), p.size, tt.want, tt.bytes)
+		}
+		// The newest downloads survive
+		for i, u := range hosted {
+			id := u[strings.LastIndex(u, "/")+1:]
+			_, kept := p.items[id]
+			if kept != (i >= len(hosted)-tt.want) {
+				t.Errorf("%s: attachment %d kept = %v", tt.name, i, kept)
+			}
+		}
+	}
+
+	p := NewProxy(Config{AllowPrivate: true, MaxTotalSize: 50}, zap.NewNop())
+	var tooLarge *TooLargeError
+	if _, err := p.Rehost(context.Background(), src.URL+"/file", 0); !errors.As(err, &tooLarge) {
+		t.Errorf("attachment over MaxTotalSize: err = %v, want a *TooLargeError", err)
+	}
+}
@@ -0,0 +1,55 @@
+// Package backoff computes retry delays for the gateway's HTTP clients,
+// honoring a server's Retry-After hint when one is given.
+package backoff
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Base is the delay before the first retry; it doubles on each attempt.
+const Base = 100 * time.Millisecond
+
+// Delay returns how long to wait before retry attempt (1 for the first
+// retry). A positive retryAfter replaces the exponential value. A positive
+// max caps the result.
+func Delay(attempt int, retryAfter, max time.Duration) time.Duration {
+	d := retryAfter
+	if d <= 0 {
+		if attempt < 1 {
+			attempt = 1
+		}
+		d = Base << uint(attempt-1)
+		if attempt > 32 {
+			d = max
+		}
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+	return d
+}
+
+// ParseRetryAfter parses a Retry-After header value, either delay-seconds or
+// an HTTP-date, relative to now. It returns 0 for an empty, malformed or
+// past value.
+func ParseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
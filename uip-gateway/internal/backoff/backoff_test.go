@@ -0,0 +1,54 @@
+package backoff
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempt    int
+		retryAfter time.Duration
+		max        time.Duration
+		want       time.Duration
+	}{
+		{"first retry", 1, 0, 0, Base},
+		{"attempt zero counts as the first", 0, 0, 0, Base},
+		{"doubles", 3, 0, 0, 4 * Base},
+		{"capped", 10, 0, time.Second, time.Second},
+		{"huge attempt capped", 100, 0, time.Second, time.Second},
+		{"retry-after replaces backoff", 1, 2 * time.Second, 5 * time.Second, 2 * time.Second},
+		{"retry-after shorter than backoff", 6, 500 * time.Millisecond, 0, 500 * time.Millisecond},
+		{"retry-after capped", 1, time.Minute, 5 * time.Second, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := Delay(tt.attempt, tt.retryAfter, tt.max); got != tt.want {
+			t.Errorf("%s: Delay(%d, %v, %v) = %v, want %v", tt.name, tt.attempt, tt.retryAfter, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"2", 2 * time.Second},
+		{" 120 ", 2 * time.Minute},
+		{"0", 0},
+		{"-5", 0},
+		{"1.5", 0},
+		{"soon", 0},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+	}
+	for _, tt := range tests {
+		if got := ParseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("ParseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package clawdbot
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Account is one OpenClaw universal-im account.
+//
+// Events are routed to the first account whose rules match; an account with
+// no rules matches everything. If nothing matches, the first account is used.
+type Account struct {
+	// ID is the {accountId} in /universal-im/{accountId}/webhook.
+	ID string `json:"id" yaml:"id"`
+	// Secret is the account's webhook secret.
+	Secret string `json:"secret" yaml:"secret"`
+	// WebhookPath overrides the default /universal-im/{accountId}/webhook path.
+	WebhookPath string `json:"webhook_path" yaml:"webhook_path"`
+
+	// ConversationTypes matches events by protocol.ConversationType.
+	ConversationTypes []string `json:"conversation_types" yaml:"conversation_types"`
+	// ChannelPrefixes matches events whose channelId starts with any prefix.
+	ChannelPrefixes []string `json:"channel_prefixes" yaml:"channel_prefixes"`
+}
+
+// matches reports whether the account's rules select event.
+func (a *Account) matches(event *protocol.CanonicalInteractionEvent) bool {
+	if len(a.ConversationTypes) == 0 && len(a.ChannelPrefixes) == 0 {
+		return true
+	}
+	convType := protocol.ConversationType(event)
+	for _, t := range a.ConversationTypes {
+		if t == convType {
+			return true
+		}
+	}
+	channelID, _ := event.Input.Payload["channelId"].(string)
+	if channelID != "" {
+		for _, prefix := range a.ChannelPrefixes {
+			if strings.HasPrefix(channelID, prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AccountSelector picks the account ID for an event. Returning an unknown or
+// empty ID falls back to the first configured account.
+type AccountSelector func(event *protocol.CanonicalInteractionEvent) string
+
+// accountState holds an account's routing state: pending sync responses and
+// the longer-lived session contexts used by async callbacks.
+type accountState struct {
+	Account
+
+	// Pending responses - key is conversation_id (for sync mode)
+	pendingMu sync.RWMutex
+	pending   map[string]*PendingContext
+
+	// Session context store - key is sessionId (for async webhook mode).
+	// Contexts are evicted oldest first beyond maxContexts (0: no limit)
+	sessionCtxMu sync.RWMutex
+	sessionCtx   map[string]*PendingContext
+	entries      map[*PendingContext]*contextEntry
+	order        *list.List
+	maxContexts  int
+}
+
+func newAccountState(account Account, maxContexts int) *accountState {
+	if account.ID == "" {
+		account.ID = "default"
+	}
+	return &accountState{
+		Account:     account,
+		pending:     make(map[string]*PendingContext),
+		sessionCtx:  make(map[string]*PendingContext),
+		entries:     make(map[*PendingContext]*contextEntry),
+		order:       list.New(),
+		maxContexts: maxContexts,
+	}
+}
+
+// lookup finds the routing context for key, preferring pending sync requests.
+func (a *accountState) lookup(key string) (*PendingContext, bool) {
+	a.pendingMu.RLock()
+	ctx, exists := a.pending[key]
+	a.pendingMu.RUnlock()
+	if exists {
+		return ctx, true
+	}
+
+	a.sessionCtxMu.RLock()
+	defer a.sessionCtxMu.RUnlock()
+	ctx, exists = a.sessionCtx[key]
+	return ctx, exists
+}
+
+// removeSessionContextLocked deletes every key pointing to ctx. The caller must hold sessionCtxMu.
+func (a *accountState) removeSessionContextLocked(ctx *PendingContext) {
+	a.forgetLocked(ctx)
+	a.updateGaugeLocked()
+}
+
+// evict removes session contexts created before cutoff and returns the count.
+func (a *accountState) evict(cutoff time.Time) int {
+	a.sessionCtxMu.Lock()
+	defer a.sessionCtxMu.Unlock()
+
+	count := 0
+	for ctx := range a.entries {
+		if ctx.CreatedAt.Before(cutoff) {
+			count += a.forgetLocked(ctx)
+		}
+	}
+	a.updateGaugeLocked()
+	return count
+}
+
+// selectAccount returns the account an event is routed to.
+func (c *OpenclawClient) selectAccount(event *protocol.CanonicalInteractionEvent) *accountState {
+	if len(c.accounts) == 1 {
+		return c.accounts[0]
+	}
+	if c.accountSelector != nil {
+		if acct, ok := c.accountByID[c.accountSelector(event)]; ok {
+			return acct
+		}
+		return c.accounts[0]
+	}
+	for _, acct := range c.accounts {
+		if acct.matches(event) {
+			return acct
+		}
+	}
+	return c.accounts[0]
+}
+
+// SetAccountSelector replaces the rule-based account selection.
+func (c *OpenclawClient) SetAccountSelector(selector AccountSelector) {
+	c.accountSelector = selector
+}
+
+// AccountIDs returns the configured account IDs in routing order.
+func (c *OpenclawClient) AccountIDs() []string {
+	ids := make([]string, len(c.accounts))
+	for i, acct := range c.accounts {
+		ids[i] = acct.ID
+	}
+	return ids
+}
+
+// findContext looks up routing info for an outbound callback. With an
+// account ID only that account is searched, otherwise all of them in order.
+func (c *OpenclawClient) findContext(accountID string, keys ...string) (*accountState, *PendingContext, bool) {
+	accounts := c.accounts
+	if accountID != "" {
+		acct, ok := c.accountByID[accountID]
+		if !ok {
+			return nil, nil, false
+		}
+		accounts = []*accountState{acct}
+	}
+	for _, key := range keys {
+		for _, acct := range accounts {
+			if ctx, exists := acct.lookup(key); exists {
+				return acct, ctx, true
+			}
+		}
+	}
+	return nil, nil, false
+}
@@ -0,0 +1,100 @@
+package clawdbot
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Callback formats recognized by DecodeCallback.
+const (
+	CallbackFormatOpenclaw        = "openclaw_outbound"
+	CallbackFormatLegacyResponse  = "clawdbot_response"
+	CallbackFormatLegacyRequest   = "clawdbot_request"
+	CallbackFormatChatCompletions = "chat_completions"
+)
+
+// DecodeCallback parses a callback body in any known format and normalizes
+// it to an OpenclawOutboundPayload, returning the name of the format that
+// matched. Besides OpenClaw's outbound payload it accepts the legacy
+// Clawdbot response and request shapes (routed by sessionId) and a raw Chat
+// Completions response, which carries no routing of its own: sessionHint,
+// typically the X-Session-ID header, names its conversation.
+func DecodeCallback(body []byte, sessionHint string) (*OpenclawOutboundPayload, string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, "", fmt.Errorf("invalid JSON: %w", err)
+	}
+	has := func(key string) bool {
+		_, ok := fields[key]
+		return ok
+	}
+
+	switch {
+	case has("to"):
+		var p OpenclawOutboundPayload
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, "", fmt.Errorf("%s: %w", CallbackFormatOpenclaw, err)
+		}
+		if p.To == "" {
+			return nil, "", fmt.Errorf("%s: to is required", CallbackFormatOpenclaw)
+		}
+		return &p, CallbackFormatOpenclaw, nil
+
+	case has("response"):
+		var r ClawdbotResponse
+		if err := json.Unmarshal(body, &r); err != nil {
+			return nil, "", fmt.Errorf("%s: %w", CallbackFormatLegacyResponse, err)
+		}
+		if r.Error != nil {
+			return nil, "", fmt.Errorf("%s: clawdbot error: %s - %s", CallbackFormatLegacyResponse, r.Error.Code, r.Error.Message)
+		}
+		to := firstNonEmpty(r.SessionID, sessionHint)
+		if to == "" {
+			return nil, "", fmt.Errorf("%s: sessionId is required", CallbackFormatLegacyResponse)
+		}
+		return &OpenclawOutboundPayload{To: to, Text: r.Response}, CallbackFormatLegacyResponse, nil
+
+	case has("message") && (has("sessionId") || has("userId")):
+		var r ClawdbotRequest
+		if err := json.Unmarshal(body, &r); err != nil {
+			return nil, "", fmt.Errorf("%s: %w", CallbackFormatLegacyRequest, err)
+		}
+		to := r.SessionID
+		if to == "" && r.UserID != "" {
+			to = "user:" + r.UserID
+		}
+		if to == "" {
+			return nil, "", fmt.Errorf("%s: sessionId or userId is required", CallbackFormatLegacyRequest)
+		}
+		return &OpenclawOutboundPayload{To: to, Text: r.Message}, CallbackFormatLegacyRequest, nil
+
+	case has("choices"):
+		var r struct {
+			ChatCompletionsResponse
+			User string `json:"user"`
+		}
+		if err := json.Unmarshal(body, &r); err != nil {
+			return nil, "", fmt.Errorf("%s: %w", CallbackFormatChatCompletions, err)
+		}
+		if len(r.Choices) == 0 {
+			return nil, "", fmt.Errorf("%s: no choices", CallbackFormatChatCompletions)
+		}
+		to := firstNonEmpty(sessionHint, r.User)
+		if to == "" {
+			return nil, "", fmt.Errorf("%s: X-Session-ID header or user is required for routing", CallbackFormatChatCompletions)
+		}
+		return &OpenclawOutboundPayload{To: to, Text: r.Choices[0].Message.Content}, CallbackFormatChatCompletions, nil
+	}
+
+	return nil, "", fmt.Errorf("unrecognized callback format (expected %s, %s, %s or %s)",
+		CallbackFormatOpenclaw, CallbackFormatLegacyResponse, CallbackFormatLegacyRequest, CallbackFormatChatCompletions)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
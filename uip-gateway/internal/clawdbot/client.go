@@ -5,16 +5,27 @@ package clawdbot
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/zlc_ai/uip-gateway/internal/attachment"
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+	"github.com/zlc_ai/uip-gateway/internal/history"
+	"github.com/zlc_ai/uip-gateway/internal/i18n"
+	"github.com/zlc_ai/uip-gateway/internal/log"
 	"github.com/zlc_ai/uip-gateway/internal/protocol"
+	"github.com/zlc_ai/uip-gateway/internal/security"
 )
 
 // Client is the interface for OpenClaw communication.
@@ -37,17 +48,36 @@ type Config struct {
 	Timeout time.Duration `json:"timeout" yaml:"timeout"`
 	// MaxRetries is the maximum number of retry attempts.
 	MaxRetries int `json:"max_retries" yaml:"max_retries"`
-	// Insecure allows insecure connections (for local dev).
+	// MaxInterval caps the delay between retries, including delays
+	// requested by a Retry-After header.
+	MaxInterval time.Duration `json:"max_interval" yaml:"max_interval"`
+	// Insecure skips TLS certificate verification (for local dev).
 	Insecure bool `json:"insecure" yaml:"insecure"`
+	// MaxIdleConns caps idle connections kept for reuse (default DefaultMaxIdleConns).
+	MaxIdleConns int `json:"max_idle_conns" yaml:"max_idle_conns"`
+	// MaxIdleConnsPerHost caps idle connections per host (default DefaultMaxIdleConnsPerHost).
+	MaxIdleConnsPerHost int `json:"max_idle_conns_per_host" yaml:"max_idle_conns_per_host"`
+	// IdleConnTimeout closes connections idle this long (default DefaultIdleConnTimeout).
+	IdleConnTimeout time.Duration `json:"idle_conn_timeout" yaml:"idle_conn_timeout"`
+	// MaxConnLifetime retires connections this old after their current
+	// request, so none outlives a load balancer or DNS change (0 = no
+	// limit, the default). Setting it turns HTTP/2 off.
+	MaxConnLifetime time.Duration `json:"max_conn_lifetime" yaml:"max_conn_lifetime"`
+	// Clock drives timestamps, context expiry and signature checks
+	// (clock.System if nil).
+	Clock clock.Clock `json:"-" yaml:"-"`
 }
 
+// DefaultMaxInterval caps retry delays when Config.MaxInterval is unset.
+const DefaultMaxInterval = 5 * time.Second
+
 // DefaultConfig returns the default OpenClaw client configuration.
 func DefaultConfig() Config {
 	return Config{
-		Endpoint:   "http://localhost:18789",
-		Timeout:    30 * time.Second,
-		MaxRetries: 3,
-		Insecure:   true,
+		Endpoint:    "http://localhost:18789",
+		Timeout:     30 * time.Second,
+		MaxRetries:  3,
+		MaxInterval: DefaultMaxInterval,
 	}
 }
 
@@ -55,7 +85,7 @@ func DefaultConfig() Config {
 type HTTPClient struct {
 	config     Config
 	httpClient *http.Client
-	logger     *zap.Logger
+	logger     log.Logger
 	mu         sync.RWMutex
 	closed     bool
 }
@@ -100,7 +130,7 @@ type OpenclawConversation struct {
 
 // OpenclawAttachment represents an attachment.
 type OpenclawAttachment struct {
-	Kind        string `json:"kind"` // "image", "audio", "video", "document", "unknown"
+	Kind        string `json:"kind"` // "image", "audio", "video", "document"
 	URL         string `json:"url,omitempty"`
 	Path        string `json:"path,omitempty"`
 	ContentType string `json:"contentType,omitempty"`
@@ -109,10 +139,26 @@ type OpenclawAttachment struct {
 }
 
 // OpenclawWebhookResponse is the immediate response from the webhook.
+// Backends that answer synchronously put the AI reply in Text (or Reply);
+// otherwise it arrives later via the outbound callback.
 type OpenclawWebhookResponse struct {
 	OK        bool   `json:"ok"`
 	MessageID string `json:"messageId,omitempty"`
 	Error     string `json:"error,omitempty"`
+	Text      string `json:"text,omitempty"`
+	Reply     string `json:"reply,omitempty"`
+}
+
+// SyncReply returns the reply carried in the webhook response, or "" when
+// the reply will come via the outbound callback.
+func (r *OpenclawWebhookResponse) SyncReply() string {
+	if strings.TrimSpace(r.Text) != "" {
+		return r.Text
+	}
+	if strings.TrimSpace(r.Reply) != "" {
+		return r.Reply
+	}
+	return ""
 }
 
 // OpenclawOutboundPayload is the format OpenClaw sends to our outbound URL.
@@ -123,11 +169,117 @@ type OpenclawOutboundPayload struct {
 	// Text is the AI response text.
 	Text string `json:"text"`
 	// MediaUrl is optional media attachment URL.
+	// Deprecated: use Attachments. Still accepted and treated as a single attachment.
 	MediaUrl string `json:"mediaUrl,omitempty"`
+	// Attachments is the list of media/files attached to the AI response.
+	Attachments []OutboundAttachment `json:"attachments,omitempty"`
 	// ReplyToId is the original message ID being replied to.
 	ReplyToId string `json:"replyToId,omitempty"`
 	// ThreadId is the thread ID for threaded conversations.
 	ThreadId string `json:"threadId,omitempty"`
+	// AccountID optionally names the universal-im account the reply belongs
+	// to; without it every configured account is searched.
+	AccountID string `json:"accountId,omitempty"`
+	// Mentions lists users the reply should @-mention.
+	Mentions []protocol.Mention `json:"mentions,omitempty"`
+	// Location is a map pin to share with the reply.
+	Location *protocol.Location `json:"location,omitempty"`
+	// QuickReplies are suggested answers shown as buttons. Without them,
+	// trailing "[[Label|value]]" lines of Text are used.
+	QuickReplies []protocol.QuickReply `json:"quickReplies,omitempty"`
+	// Ask makes Text a question and describes the expected answer. The
+	// gateway only checks answers to replies it delivers itself, not those
+	// forwarded through the outbound callback.
+	Ask *protocol.AskSpec `json:"ask,omitempty"`
+}
+
+// OutboundAttachment is a media or file attachment on an AI response.
+type OutboundAttachment struct {
+	URL         string `json:"url"`
+	ContentType string `json:"contentType,omitempty"`
+	FileName    string `json:"fileName,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+}
+
+// AllAttachments returns Attachments with the deprecated MediaUrl folded in
+// as the first item (unless it is already listed).
+func (p *OpenclawOutboundPayload) AllAttachments() []OutboundAttachment {
+	if p.MediaUrl == "" {
+		return p.Attachments
+	}
+	for _, att := range p.Attachments {
+		if att.URL == p.MediaUrl {
+			return p.Attachments
+		}
+	}
+	return append([]OutboundAttachment{{URL: p.MediaUrl}}, p.Attachments...)
+}
+
+// OutboundAck is the gateway's response to an OpenClaw outbound POST. OpenClaw
+// only requires "ok"; the other fields echo what was delivered and where.
+type OutboundAck struct {
+	// OK is true once the payload has been accepted.
+	OK bool `json:"ok"`
+	// MessageID identifies the delivered message. It is derived from the
+	// payload, so a retried POST gets the same ID.
+	MessageID string `json:"messageId"`
+	// To and Text echo the payload.
+	To   string `json:"to"`
+	Text string `json:"text"`
+	// Routing is where the reply is going; Matched is false when no routing
+	// context was found for the payload's "to" target.
+	Routing OutboundRouting `json:"routing"`
+	// MediaUrl is the deprecated single attachment, echoed if present.
+	MediaUrl string `json:"mediaUrl,omitempty"`
+	// Attachments echoes the payload's attachments, MediaUrl included.
+	Attachments []OutboundAttachment `json:"attachments,omitempty"`
+	// ThreadId echoes the payload's thread.
+	ThreadId string `json:"threadId,omitempty"`
+}
+
+// OutboundRouting is the routing block of an OutboundAck.
+type OutboundRouting struct {
+	Matched   bool   `json:"matched"`
+	ChannelID string `json:"channelId"`
+	UserID    string `json:"userId"`
+	SessionID string `json:"sessionId"`
+}
+
+// NewOutboundAck builds the acknowledgement for payload. resp is the result
+// of HandleCallback and may be nil when no OpenClaw client is configured.
+func NewOutboundAck(payload *OpenclawOutboundPayload, resp *OutboundResponse) OutboundAck {
+	ack := OutboundAck{
+		OK:          true,
+		MessageID:   OutboundMessageID(payload),
+		To:          payload.To,
+		Text:        payload.Text,
+		MediaUrl:    payload.MediaUrl,
+		Attachments: payload.AllAttachments(),
+		ThreadId:    payload.ThreadId,
+	}
+	if resp != nil && (resp.ChannelID != "" || resp.UserID != "" || resp.SessionID != "") {
+		ack.Routing = OutboundRouting{
+			Matched:   true,
+			ChannelID: resp.ChannelID,
+			UserID:    resp.UserID,
+			SessionID: resp.SessionID,
+		}
+	}
+	return ack
+}
+
+// OutboundMessageID derives a stable message ID from an outbound payload.
+func OutboundMessageID(payload *OpenclawOutboundPayload) string {
+	h := sha256.New()
+	for _, part := range []string{payload.AccountID, payload.To, payload.ReplyToId, payload.ThreadId, payload.Text, payload.MediaUrl} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	for _, att := range payload.Attachments {
+		h.Write([]byte(att.URL))
+		h.Write([]byte{0})
+	}
+	return "outbound-" + hex.EncodeToString(h.Sum(nil))[:16]
 }
 
 // Legacy type aliases for backward compatibility
@@ -148,6 +300,22 @@ type ClawdbotResponse struct {
 	SessionID string                 `json:"sessionId,omitempty"`
 	Metadata  map[string]interface{} `json:"metadata,omitempty"`
 	Error     *ErrorInfo             `json:"error,omitempty"`
+	// QuickReplies are suggested answers offered with Response.
+	QuickReplies []protocol.QuickReply `json:"quickReplies,omitempty"`
+	// Ask makes Response a question and describes the expected answer.
+	Ask *protocol.AskSpec `json:"ask,omitempty"`
+	// Actions, when present, replaces Response/Type with several intents,
+	// delivered in order.
+	Actions []ClawdbotAction `json:"actions,omitempty"`
+}
+
+// ClawdbotAction is one intent in a multi-action response.
+type ClawdbotAction struct {
+	Type         string                `json:"type"`
+	Response     string                `json:"response"`
+	Priority     int                   `json:"priority,omitempty"`
+	QuickReplies []protocol.QuickReply `json:"quickReplies,omitempty"`
+	Ask          *protocol.AskSpec     `json:"ask,omitempty"`
 }
 
 type ErrorInfo struct {
@@ -156,21 +324,35 @@ type ErrorInfo struct {
 }
 
 // NewHTTPClient creates a new HTTP-based Clawdbot client.
-func NewHTTPClient(config Config, logger *zap.Logger) (*HTTPClient, error) {
+func NewHTTPClient(config Config, logger log.Logger) (*HTTPClient, error) {
 	if logger == nil {
-		logger, _ = zap.NewProduction()
+		logger = log.Default()
 	}
+	config.Clock = clock.Or(config.Clock)
 
 	return &HTTPClient{
 		config: config,
 		httpClient: &http.Client{
-			Timeout: config.Timeout,
+			Timeout:   config.Timeout,
+			Transport: newLoggingTransport(newTransport(config, logger), logger),
 		},
 		logger: logger,
 	}, nil
 }
 
 func (c *HTTPClient) ProcessEvent(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+	intents, err := c.ProcessEventMulti(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	return intents[0], nil
+}
+
+// ProcessEventMulti is ProcessEvent returning every intent of a
+// multi-action response (see ClawdbotResponse.Actions).
+func (c *HTTPClient) ProcessEventMulti(ctx context.Context, event *protocol.CanonicalInteractionEvent) ([]*protocol.InteractionIntent, error) {
+	logger := log.ForEvent(ctx, c.logger, event)
+
 	c.mu.RLock()
 	if c.closed {
 		c.mu.RUnlock()
@@ -188,7 +370,7 @@ func (c *HTTPClient) ProcessEvent(ctx context.Context, event *protocol.Canonical
 
 	// Build request
 	req := ClawdbotRequest{
-		SessionID: event.Session.ExternalSessionID,
+		SessionID: event.Session.RoutingKey(),
 		UserID:    event.Session.UserID,
 		Message:   text,
 		Type:      string(event.Input.Type),
@@ -197,29 +379,43 @@ func (c *HTTPClient) ProcessEvent(ctx context.Context, event *protocol.Canonical
 			"traceId":       event.Meta.TraceID,
 			"timestamp":     event.Meta.Timestamp,
 			"capabilities":  event.Capabilities,
+			"userName":      event.Session.UserName,
+			"roles":         event.Session.Roles,
+			"isAdmin":       event.Session.IsAdmin,
 		},
 	}
+	if loc, ok := protocol.LocationOf(event); ok {
+		req.Metadata["location"] = loc
+	}
+	if value, ok := event.Input.Payload[protocol.PayloadQuickReply].(string); ok {
+		req.Metadata["quickReply"] = value
+	}
+	if reaction, ok := protocol.ReactionOf(event); ok {
+		req.Metadata["reaction"] = reaction
+	}
 
 	// Execute with retry
 	var lastErr error
 	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
 		if attempt > 0 {
-			// Exponential backoff
-			backoff := time.Duration(1<<uint(attempt-1)) * 100 * time.Millisecond
+			// Exponential backoff, or the server's Retry-After hint
 			select {
-			case <-time.After(backoff):
+			case <-time.After(retryDelay(attempt, lastErr, c.config.MaxInterval)):
 			case <-ctx.Done():
 				return nil, ctx.Err()
 			}
 		}
 
-		intent, err := c.doRequest(ctx, req, event)
+		intents, err := c.doRequest(ctx, req, event)
 		if err == nil {
-			return intent, nil
+			return intents, nil
+		}
+		if !IsRetryable(err) {
+			return nil, err
 		}
 
 		lastErr = err
-		c.logger.Warn("Clawdbot request failed, retrying",
+		logger.Warn("Clawdbot request failed, retrying",
 			zap.Int("attempt", attempt+1),
 			zap.Error(err))
 	}
@@ -227,7 +423,9 @@ func (c *HTTPClient) ProcessEvent(ctx context.Context, event *protocol.Canonical
 	return nil, fmt.Errorf("all retries exhausted: %w", lastErr)
 }
 
-func (c *HTTPClient) doRequest(ctx context.Context, req ClawdbotRequest, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+func (c *HTTPClient) doRequest(ctx context.Context, req ClawdbotRequest, event *protocol.CanonicalInteractionEvent) ([]*protocol.InteractionIntent, error) {
+	logger := log.ForEvent(ctx, c.logger, event)
+
 	// Marshal request
 	body, err := json.Marshal(req)
 	if err != nil {
@@ -243,7 +441,7 @@ func (c *HTTPClient) doRequest(ctx context.Context, req ClawdbotRequest, event *
 
 	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("X-Trace-ID", event.Meta.TraceID)
-	httpReq.Header.Set("X-Session-ID", event.Session.ExternalSessionID)
+	httpReq.Header.Set("X-Session-ID", event.Session.RoutingKey())
 
 	// Execute request
 	resp, err := c.httpClient.Do(httpReq)
@@ -260,7 +458,7 @@ func (c *HTTPClient) doRequest(ctx context.Context, req ClawdbotRequest, event *
 
 	// Check status code
 	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("server error: %d - %s", resp.StatusCode, string(respBody))
+		return nil, statusError(resp, respBody, c.config.Clock.Now())
 	}
 
 	// Parse response
@@ -271,29 +469,61 @@ func (c *HTTPClient) doRequest(ctx context.Context, req ClawdbotRequest, event *
 
 	// Check for error in response
 	if clawdbotResp.Error != nil {
-		return nil, fmt.Errorf("clawdbot error: %s - %s", clawdbotResp.Error.Code, clawdbotResp.Error.Message)
+		return nil, responseError(
+			fmt.Sprintf("clawdbot error: %s - %s", clawdbotResp.Error.Code, clawdbotResp.Error.Message),
+			classifyError(clawdbotResp.Error.Code), true)
 	}
 
-	// Convert to InteractionIntent
-	intentType := protocol.IntentTypeReply
-	if clawdbotResp.Type == "ask" {
-		intentType = protocol.IntentTypeAsk
-	} else if clawdbotResp.Type == "notify" {
-		intentType = protocol.IntentTypeNotify
+	// Convert to InteractionIntents
+	actions := clawdbotResp.Actions
+	if len(actions) == 0 {
+		actions = []ClawdbotAction{{Type: clawdbotResp.Type, Response: clawdbotResp.Response, QuickReplies: clawdbotResp.QuickReplies, Ask: clawdbotResp.Ask}}
+	}
+	intents := make([]*protocol.InteractionIntent, 0, len(actions))
+	for _, action := range actions {
+		text, quickReplies := withQuickReplies(action.Response, action.QuickReplies)
+		intent := protocol.NewInteractionIntent(
+			responseIntentType(action.Type),
+			text,
+			event.Session.ExternalSessionID,
+			event.InteractionID,
+		)
+		intent.Constraints.Priority = action.Priority
+		intent.Content.QuickReplies = quickReplies
+		if action.Ask != nil {
+			intent.IntentType = protocol.IntentTypeAsk
+			intent.Ask = action.Ask
+		}
+		intents = append(intents, intent)
 	}
 
-	intent := protocol.NewInteractionIntent(
-		intentType,
-		clawdbotResp.Response,
-		event.Session.ExternalSessionID,
-		event.InteractionID,
-	)
+	logger.Debug("Received Clawdbot response",
+		zap.String("intentId", intents[0].IntentID),
+		zap.Int("intents", len(intents)))
 
-	c.logger.Debug("Received Clawdbot response",
-		zap.String("intentId", intent.IntentID),
-		zap.String("sessionId", event.Session.ExternalSessionID))
+	return intents, nil
+}
 
-	return intent, nil
+// withQuickReplies returns the reply's quick replies: the structured ones
+// when given, else those written as trailing "[[Label|value]]" lines of
+// text, which are then cut from it.
+func withQuickReplies(text string, structured []protocol.QuickReply) (string, []protocol.QuickReply) {
+	if qrs := protocol.NormalizeQuickReplies(structured); len(qrs) > 0 {
+		return text, qrs
+	}
+	return protocol.ExtractQuickReplies(text)
+}
+
+// responseIntentType maps a Clawdbot response type to an intent type;
+// anything unknown is a reply.
+func responseIntentType(t string) protocol.IntentType {
+	switch t {
+	case "ask":
+		return protocol.IntentTypeAsk
+	case "notify":
+		return protocol.IntentTypeNotify
+	}
+	return protocol.IntentTypeReply
 }
 
 func (c *HTTPClient) Close() error {
@@ -331,31 +561,81 @@ type PendingContext struct {
 	ChannelID  string // External IM channel ID for routing
 	UserID     string // Original user ID
 	SessionID  string // Original session ID
+	ThreadID   string // Thread of the original message, for replies that omit threadId
+	CreatedAt  time.Time
+
+	// Closed when the context is evicted to make room (see MaxPendingContexts)
+	evicted chan struct{}
+
+	// Set by the first deliver; ResponseCh receives exactly one intent
+	delivered atomic.Bool
+}
+
+// deliver hands intent to the ProcessEvent waiting on ResponseCh. Only the
+// first call delivers; later ones report false and their intent is not
+// sent, so concurrent deliveries (a webhook reply racing a callback) can
+// neither block nor replace the response the waiter gets.
+func (p *PendingContext) deliver(intent *protocol.InteractionIntent) bool {
+	if !p.delivered.CompareAndSwap(false, true) {
+		return false
+	}
+	p.ResponseCh <- intent // buffered for the one response, never blocks
+	return true
 }
 
 // OpenclawClient implements the Client interface for OpenClaw's universal-im plugin.
 // This client sends messages to the /universal-im/{accountId}/webhook endpoint.
 type OpenclawClient struct {
-	config      Config
-	httpClient  *http.Client
-	logger      *zap.Logger
-	secret      string // Webhook secret for authentication
-	accountID   string // Account ID in OpenClaw config (default: "default")
-	webhookPath string // Custom webhook path (optional)
-	mu          sync.RWMutex
-	closed      bool
-
-	// Pending responses - key is conversation_id (for sync mode)
-	pendingMu sync.RWMutex
-	pending   map[string]*PendingContext
-
-	// Session context store - key is sessionId (for async webhook mode)
-	// This stores routing info for longer periods to handle async callbacks
-	sessionCtxMu sync.RWMutex
-	sessionCtx   map[string]*PendingContext
+	config     Config
+	httpClient *http.Client
+	logger     log.Logger
+
+	// Universal-im accounts in routing order, each with its own routing state
+	accounts        []*accountState
+	accountByID     map[string]*accountState
+	accountSelector AccountSelector
+
+	// Outbound request authentication
+	outboundAuthHeader string
+	outboundSecret     string
+	signatureTolerance time.Duration
+	replayGuard        *security.ReplayGuard
+
+	pendingReplyText string
+	messages         *i18n.Catalog
+	history          *history.History
+
+	model            string
+	generation       protocol.GenerationParams
+	systemPrompts    SystemPrompts
+	maxContinuations int
+	continuePrompt   string
+	truncatedNote    string
+	targetKinds      []string
+
+	mu     sync.RWMutex
+	closed bool
+
+	// Session contexts store routing info for longer periods to handle async callbacks
+	sessionCtxTTL time.Duration
+	stopCh        chan struct{}
+	wg            sync.WaitGroup
 
 	// Outbound callback function for external IM routing
 	outboundCallback OutboundCallback
+
+	// Optional re-hosting of inbound attachments before forwarding
+	attachments AttachmentRehoster
+	// Size limits for re-hosted inbound and outbound callback attachments
+	attachmentLimits attachment.Limits
+}
+
+// AttachmentRehoster downloads an inbound attachment and returns a gateway-hosted URL for it.
+// This protects against short-lived signed URLs expiring before OpenClaw fetches them.
+// A positive maxSize bounds the download; larger attachments fail with an
+// *attachment.TooLargeError.
+type AttachmentRehoster interface {
+	Rehost(ctx context.Context, url string, maxSize int64) (string, error)
 }
 
 // OutboundCallback is called when AI response is received for routing to external IM
@@ -363,14 +643,18 @@ type OutboundCallback func(response *OutboundResponse)
 
 // OutboundResponse contains the AI response with routing information
 type OutboundResponse struct {
-	To        string `json:"to"`        // Target in format "user:userId" or "channel:channelId"
-	Text      string `json:"text"`      // AI response text
-	MediaUrl  string `json:"mediaUrl"`  // Optional media attachment
-	ReplyToId string `json:"replyToId"` // Original message ID
-	ThreadId  string `json:"threadId"`  // Thread ID for threaded conversations
-	ChannelID string `json:"channelId"` // External IM channel ID for routing
-	UserID    string `json:"userId"`    // Original user ID
-	SessionID string `json:"sessionId"` // Original session ID
+	To           string                `json:"to"`                     // Target in format "user:userId" or "channel:channelId"
+	Text         string                `json:"text"`                   // AI response text
+	MediaUrl     string                `json:"mediaUrl"`               // Optional media attachment (deprecated: use Attachments)
+	ReplyToId    string                `json:"replyToId"`              // Original message ID
+	ThreadId     string                `json:"threadId"`               // Thread ID for threaded conversations
+	ChannelID    string                `json:"channelId"`              // External IM channel ID for routing
+	UserID       string                `json:"userId"`                 // Original user ID
+	SessionID    string                `json:"sessionId"`              // Original session ID
+	Attachments  []OutboundAttachment  `json:"attachments,omitempty"`  // All media/files, MediaUrl included
+	Mentions     []protocol.Mention    `json:"mentions,omitempty"`     // Users to @-mention
+	Location     *protocol.Location    `json:"location,omitempty"`     // Map pin to share
+	QuickReplies []protocol.QuickReply `json:"quickReplies,omitempty"` // Suggested answers, shown as buttons
 }
 
 // OpenclawClientConfig holds additional configuration for OpenclawClient
@@ -378,31 +662,153 @@ type OpenclawClientConfig struct {
 	Secret      string // Webhook secret (X-Webhook-Secret header)
 	AccountID   string // Account ID (default: "default")
 	WebhookPath string // Custom webhook path (default: "/universal-im/{accountId}/webhook")
+
+	// Accounts configures several universal-im accounts; when set, Secret,
+	// AccountID and WebhookPath are ignored
+	Accounts []Account
+
+	OutboundAuthHeader string        // Expected Authorization header on outbound requests (optional)
+	OutboundSecret     string        // HMAC secret for outbound signature verification (optional)
+	SignatureTolerance time.Duration // Max timestamp skew for signed requests (default: 5m)
+
+	PendingReplyText string // Placeholder reply while waiting for the async outbound callback
+
+	SessionContextTTL time.Duration // How long routing info is kept for async callbacks (default: 5m)
+
+	// MaxPendingContexts caps the routing contexts kept per account; beyond
+	// it the oldest is evicted and its waiting ProcessEvent returns
+	// ErrContextEvicted (default: DefaultMaxPendingContexts, negative: no limit)
+	MaxPendingContexts int
+
+	// Model is the Chat Completions model; events may override it with
+	// Meta.Model (default: "default")
+	Model string
+
+	// Generation holds default generation parameters; events may override
+	// each field with Meta.Generation. Unset fields are not sent.
+	Generation protocol.GenerationParams
+
+	// SystemPrompts selects the system prompt sent ahead of the conversation
+	SystemPrompts SystemPrompts
+
+	// Chat Completions replies cut off by the token limit
+	MaxContinuations int    // Follow-up "continue" requests per reply (default: 0, disabled)
+	ContinuePrompt   string // Prompt sent to continue a truncated reply (default: "continue")
+
+	// TargetKinds are the callback "to" prefixes split off by HandleCallback
+	// (default: DefaultTargetKinds)
+	TargetKinds []string
 }
 
+// DefaultSessionContextTTL is how long routing info for async callbacks is kept by default.
+const DefaultSessionContextTTL = 5 * time.Minute
+
+// DefaultModel is the Chat Completions model used when none is configured.
+const DefaultModel = "default"
+
+// DefaultContinuePrompt asks the model to continue a truncated reply.
+const DefaultContinuePrompt = "continue"
+
+// DefaultTruncatedNote is appended to replies cut off by the token limit when
+// no catalog is set; the catalog's response_truncated message takes precedence.
+const DefaultTruncatedNote = "(response truncated)"
+
+// DefaultPendingReplyText is the webhook-mode placeholder used when none is configured.
+const DefaultPendingReplyText = "消息已发送到 OpenClaw，等待 AI 响应..."
+
 // NewOpenclawClient creates a new OpenClaw universal-im client.
-func NewOpenclawClient(config Config, opts OpenclawClientConfig, logger *zap.Logger) (*OpenclawClient, error) {
+func NewOpenclawClient(config Config, opts OpenclawClientConfig, logger log.Logger) (*OpenclawClient, error) {
 	if logger == nil {
-		logger, _ = zap.NewProduction()
+		logger = log.Default()
+	}
+	config.Clock = clock.Or(config.Clock)
+
+	accountList := opts.Accounts
+	if len(accountList) == 0 {
+		accountList = []Account{{
+			ID:          opts.AccountID,
+			Secret:      opts.Secret,
+			WebhookPath: opts.WebhookPath,
+		}}
+	}
+	maxContexts := opts.MaxPendingContexts
+	if maxContexts == 0 {
+		maxContexts = DefaultMaxPendingContexts
+	} else if maxContexts < 0 {
+		maxContexts = 0
+	}
+	accounts := make([]*accountState, 0, len(accountList))
+	accountByID := make(map[string]*accountState, len(accountList))
+	for _, account := range accountList {
+		acct := newAccountState(account, maxContexts)
+		if _, dup := accountByID[acct.ID]; dup {
+			return nil, fmt.Errorf("duplicate OpenClaw account %q", acct.ID)
+		}
+		accounts = append(accounts, acct)
+		accountByID[acct.ID] = acct
 	}
 
-	accountID := opts.AccountID
-	if accountID == "" {
-		accountID = "default"
+	tolerance := opts.SignatureTolerance
+	if tolerance <= 0 {
+		tolerance = DefaultSignatureTolerance
 	}
 
-	return &OpenclawClient{
+	pendingReplyText := opts.PendingReplyText
+	if pendingReplyText == "" {
+		pendingReplyText = DefaultPendingReplyText
+	}
+
+	sessionCtxTTL := opts.SessionContextTTL
+	if sessionCtxTTL <= 0 {
+		sessionCtxTTL = DefaultSessionContextTTL
+	}
+
+	model := opts.Model
+	if model == "" {
+		model = DefaultModel
+	}
+
+	continuePrompt := opts.ContinuePrompt
+	if continuePrompt == "" {
+		continuePrompt = DefaultContinuePrompt
+	}
+
+	targetKinds := opts.TargetKinds
+	if len(targetKinds) == 0 {
+		targetKinds = DefaultTargetKinds
+	}
+
+	c := &OpenclawClient{
 		config: config,
 		httpClient: &http.Client{
-			Timeout: config.Timeout,
+			Timeout:   config.Timeout,
+			Transport: newLoggingTransport(newTransport(config, logger), logger),
 		},
 		logger:      logger,
-		secret:      opts.Secret,
-		accountID:   accountID,
-		webhookPath: opts.WebhookPath,
-		pending:     make(map[string]*PendingContext),
-		sessionCtx:  make(map[string]*PendingContext),
-	}, nil
+		accounts:    accounts,
+		accountByID: accountByID,
+
+		outboundAuthHeader: opts.OutboundAuthHeader,
+		outboundSecret:     opts.OutboundSecret,
+		signatureTolerance: tolerance,
+		pendingReplyText:   pendingReplyText,
+
+		model:            model,
+		generation:       opts.Generation,
+		systemPrompts:    opts.SystemPrompts,
+		maxContinuations: opts.MaxContinuations,
+		continuePrompt:   continuePrompt,
+		truncatedNote:    DefaultTruncatedNote,
+		targetKinds:      targetKinds,
+
+		sessionCtxTTL: sessionCtxTTL,
+		stopCh:        make(chan struct{}),
+	}
+
+	c.wg.Add(1)
+	go c.evictLoop()
+
+	return c, nil
 }
 
 // SetOutboundCallback sets the callback for routing AI responses to external IM
@@ -410,31 +816,101 @@ func (c *OpenclawClient) SetOutboundCallback(callback OutboundCallback) {
 	c.outboundCallback = callback
 }
 
+// SetAttachmentRehoster enables re-hosting of inbound attachment URLs before forwarding
+func (c *OpenclawClient) SetAttachmentRehoster(rehoster AttachmentRehoster) {
+	c.attachments = rehoster
+}
+
+// SetAttachmentLimits bounds re-hosted inbound attachments, which are
+// dropped with a note in the text when their download exceeds the limit,
+// and drops outbound callback attachments whose declared size exceeds it.
+func (c *OpenclawClient) SetAttachmentLimits(limits attachment.Limits) {
+	c.attachmentLimits = limits
+}
+
+// SetHistory keeps per-conversation history for the Chat Completions
+// fallback, which is otherwise stateless: earlier turns are sent with each
+// request, and "/reset" clears them. Conversations are keyed by the
+// session's routing key. Call before processing events.
+func (c *OpenclawClient) SetHistory(h *history.History) {
+	c.history = h
+}
+
+// SetCatalog enables localized placeholder replies using the event's locale hint.
+// When set, the catalog's pending_reply message takes precedence over PendingReplyText.
+func (c *OpenclawClient) SetCatalog(catalog *i18n.Catalog) {
+	c.messages = catalog
+}
+
 // ClearSessionContext clears a specific session context (call after processing outbound)
 func (c *OpenclawClient) ClearSessionContext(sessionID string) {
-	c.sessionCtxMu.Lock()
-	defer c.sessionCtxMu.Unlock()
-
-	if ctx, exists := c.sessionCtx[sessionID]; exists {
-		// Also remove by userId if it points to the same context
-		for key, val := range c.sessionCtx {
-			if val == ctx && key != sessionID {
-				delete(c.sessionCtx, key)
+	for _, acct := range c.accounts {
+		acct.sessionCtxMu.Lock()
+		if ctx, exists := acct.sessionCtx[sessionID]; exists {
+			// Also remove by userId if it points to the same context
+			acct.removeSessionContextLocked(ctx)
+		}
+		acct.sessionCtxMu.Unlock()
+	}
+}
+
+// evictLoop periodically removes session contexts older than the TTL.
+// Contexts are normally cleared once their outbound callback is handled; this
+// catches the ones whose callback never arrives.
+func (c *OpenclawClient) evictLoop() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.sessionCtxTTL / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if count := c.evictSessionContexts(); count > 0 {
+				c.logger.Debug("Evicted stale session contexts", zap.Int("count", count))
 			}
+		case <-c.stopCh:
+			return
 		}
-		delete(c.sessionCtx, sessionID)
 	}
 }
 
+// evictSessionContexts removes session contexts older than the TTL and returns the count.
+func (c *OpenclawClient) evictSessionContexts() int {
+	count := 0
+	cutoff := c.config.Clock.Now().Add(-c.sessionCtxTTL)
+	for _, acct := range c.accounts {
+		count += acct.evict(cutoff)
+	}
+	return count
+}
+
+// SessionContextCount returns the number of stored session context keys across all accounts.
+func (c *OpenclawClient) SessionContextCount() int {
+	count := 0
+	for _, acct := range c.accounts {
+		acct.sessionCtxMu.RLock()
+		count += len(acct.sessionCtx)
+		acct.sessionCtxMu.RUnlock()
+	}
+	return count
+}
+
 // GetSessionContext returns the routing context for a session
 func (c *OpenclawClient) GetSessionContext(sessionID string) *PendingContext {
-	c.sessionCtxMu.RLock()
-	defer c.sessionCtxMu.RUnlock()
-	return c.sessionCtx[sessionID]
+	for _, acct := range c.accounts {
+		acct.sessionCtxMu.RLock()
+		ctx := acct.sessionCtx[sessionID]
+		acct.sessionCtxMu.RUnlock()
+		if ctx != nil {
+			return ctx
+		}
+	}
+	return nil
 }
 
 // NewMoltbotClient is a legacy alias for NewOpenclawClient
-func NewMoltbotClient(config Config, token string, endpointID string, logger *zap.Logger) (*OpenclawClient, error) {
+func NewMoltbotClient(config Config, token string, endpointID string, logger log.Logger) (*OpenclawClient, error) {
 	return NewOpenclawClient(config, OpenclawClientConfig{
 		Secret:    token,
 		AccountID: endpointID,
@@ -442,6 +918,8 @@ func NewMoltbotClient(config Config, token string, endpointID string, logger *za
 }
 
 func (c *OpenclawClient) ProcessEvent(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+	logger := log.ForEvent(ctx, c.logger, event)
+
 	c.mu.RLock()
 	if c.closed {
 		c.mu.RUnlock()
@@ -457,104 +935,192 @@ func (c *OpenclawClient) ProcessEvent(ctx context.Context, event *protocol.Canon
 		}
 	}
 
+	if c.history != nil && strings.TrimSpace(text) == ResetCommand {
+		return c.resetHistory(ctx, event)
+	}
+
 	// Extract attachments if any
 	var attachments []OpenclawAttachment
 	if payload := event.Input.Payload; payload != nil {
 		if atts, ok := payload["attachments"].([]interface{}); ok {
 			for _, att := range atts {
 				if attMap, ok := att.(map[string]interface{}); ok {
-					attachment := OpenclawAttachment{
-						Kind: getString(attMap, "kind", "unknown"),
-						URL:  getString(attMap, "url", ""),
+					item := OpenclawAttachment{
+						Kind:        getString(attMap, "kind", ""),
+						URL:         getString(attMap, "url", ""),
+						ContentType: getString(attMap, "contentType", ""),
+						FileName:    getString(attMap, "fileName", ""),
+						Size:        attachment.SizeOf(attMap),
 					}
-					attachments = append(attachments, attachment)
+					if item.Kind == "" || item.Kind == "unknown" {
+						item.Kind = protocol.InferAttachmentKind(item.ContentType, item.FileName)
+					}
+					if c.attachments != nil && item.URL != "" {
+						hostedURL, err := c.attachments.Rehost(ctx, item.URL, c.attachmentLimits.Max(item.Kind))
+						var tooLarge *attachment.TooLargeError
+						switch {
+						case errors.As(err, &tooLarge):
+							// Too large to download is too large to forward
+							tooLarge.Kind = attachment.NormalizeKind(item.Kind)
+							logger.Warn("Dropping oversized attachment",
+								zap.Error(err))
+							text = strings.TrimSpace(text + "\n\n" + attachment.OmittedNote(item.FileName, tooLarge))
+							continue
+						case err != nil:
+							logger.Warn("Failed to re-host attachment, forwarding original URL",
+								zap.Error(err))
+						default:
+							item.URL = hostedURL
+						}
+					}
+					attachments = append(attachments, item)
 				}
 			}
 		}
 	}
 
-	// Determine conversation type from input payload
-	convType := "direct"
+	// Extract channelId and threadId from payload if provided
+	channelID, threadID := "", ""
 	if payload := event.Input.Payload; payload != nil {
-		if ct, ok := payload["conversationType"].(string); ok {
-			convType = ct
-		}
+		channelID, _ = payload["channelId"].(string)
+		threadID, _ = payload["threadId"].(string)
 	}
 
-	// Extract channelId from payload if provided
-	channelID := ""
-	if payload := event.Input.Payload; payload != nil {
-		if cid, ok := payload["channelId"].(string); ok {
-			channelID = cid
-		}
+	// OpenClaw has no thread conversation type: a thread is a channel
+	// conversation carrying a threadId
+	convType := protocol.ConversationType(event)
+	if convType == protocol.ConversationThread {
+		convType = protocol.ConversationChannel
 	}
 
 	// Build OpenClaw universal-im request (Custom Provider format)
 	req := OpenclawUniversalIMRequest{
 		MessageID: event.InteractionID,
-		Timestamp: time.Now().UnixMilli(),
+		Timestamp: c.config.Clock.Now().UnixMilli(),
 		Sender: OpenclawSender{
-			ID:   event.Session.UserID,
-			Name: event.Session.UserID, // Can be enhanced with actual name
+			ID:    event.Session.UserID,
+			Name:  event.Session.DisplayName(),
+			IsBot: event.Session.IsBot(),
 		},
 		Conversation: OpenclawConversation{
-			Type: convType,
-			ID:   event.Session.ExternalSessionID,
+			Type:     convType,
+			ID:       event.Session.RoutingKey(),
+			ThreadID: threadID,
 		},
 		Text:        text,
 		Attachments: attachments,
+		Mentions:    protocol.Mentions(event),
 		Meta: map[string]interface{}{
 			"traceId":      event.Meta.TraceID,
 			"capabilities": event.Capabilities,
 			"channelId":    channelID, // Include channelId in meta for tracking
 		},
 	}
+	if len(event.Session.Roles) > 0 {
+		req.Meta["roles"] = event.Session.Roles
+	}
+	if event.Session.IsAdmin {
+		req.Meta["isAdmin"] = true
+	}
+	if event.Meta.Model != "" {
+		req.Meta["model"] = event.Meta.Model
+	}
+	if gen := c.generationFor(event); !gen.IsZero() {
+		req.Meta["generation"] = gen
+	}
+	if prompt := c.systemPrompts.Resolve(event); prompt != "" {
+		req.Meta["systemPrompt"] = prompt
+	}
+	if protocol.MentionsBot(event) {
+		req.Meta["mentionsBot"] = true
+	}
+	if !event.Meta.Structured.IsZero() {
+		req.Meta["structured"] = event.Meta.Structured
+	}
+	if event.Meta.RawText != "" {
+		req.Meta["rawText"] = event.Meta.RawText
+	}
+	if loc, ok := protocol.LocationOf(event); ok {
+		req.Meta["location"] = loc
+		// Runtimes that ignore meta still see where the user is
+		if strings.TrimSpace(req.Text) == "" {
+			req.Text = loc.Text()
+		}
+	}
+	if value, ok := event.Input.Payload[protocol.PayloadQuickReply].(string); ok {
+		req.Meta["quickReply"] = value
+	}
+	if reaction, ok := protocol.ReactionOf(event); ok {
+		req.Meta["reaction"] = reaction
+		if strings.TrimSpace(req.Text) == "" {
+			req.Text = reaction.Text()
+		}
+	}
+	if event.Meta.IsEdit {
+		req.Meta["isEdit"] = true
+		if event.Meta.EditOf != "" {
+			req.Meta["editOf"] = event.Meta.EditOf
+		}
+	}
 
-	// Create pending response context with channelId for routing
-	conversationKey := event.Session.ExternalSessionID
+	// Create pending response context with channelId for routing.
+	// Contexts are keyed by the derived session key; SessionID keeps the
+	// adapter's own session ID so intents are delivered back to it.
+	conversationKey := event.Session.RoutingKey()
 	pendingCtx := &PendingContext{
 		ResponseCh: make(chan *protocol.InteractionIntent, 1),
 		ChannelID:  channelID,
 		UserID:     event.Session.UserID,
 		SessionID:  event.Session.ExternalSessionID,
+		ThreadID:   threadID,
+		CreatedAt:  c.config.Clock.Now(),
+		evicted:    make(chan struct{}),
 	}
-	c.pendingMu.Lock()
-	c.pending[conversationKey] = pendingCtx
-	c.pendingMu.Unlock()
+	acct := c.selectAccount(event)
+	acct.pendingMu.Lock()
+	acct.pending[conversationKey] = pendingCtx
+	acct.pendingMu.Unlock()
 
 	// Also store in sessionCtx for async webhook mode (keyed by both sessionId and userId)
 	// This allows outbound callbacks to find routing info even after sync timeout
-	c.sessionCtxMu.Lock()
-	c.sessionCtx[conversationKey] = pendingCtx
-	c.sessionCtx[event.Session.UserID] = pendingCtx // Also key by userId for "user:xxx" format
-	c.sessionCtxMu.Unlock()
+	acct.sessionCtxMu.Lock()
+	acct.storeLocked(pendingCtx, conversationKey, event.Session.UserID) // Also key by userId for "user:xxx" format
+	acct.sessionCtxMu.Unlock()
 
 	defer func() {
-		c.pendingMu.Lock()
-		delete(c.pending, conversationKey)
-		c.pendingMu.Unlock()
-		// Note: We don't delete from sessionCtx immediately - let it persist for async callbacks
+		acct.pendingMu.Lock()
+		delete(acct.pending, conversationKey)
+		acct.pendingMu.Unlock()
+		// Note: We don't delete from sessionCtx here - it persists for async callbacks
+		// until HandleCallback clears it or it expires after sessionCtxTTL
 	}()
 
 	// Execute with retry
 	var lastErr error
 	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
 		if attempt > 0 {
-			backoff := time.Duration(1<<uint(attempt-1)) * 100 * time.Millisecond
 			select {
-			case <-time.After(backoff):
+			case <-time.After(retryDelay(attempt, lastErr, c.config.MaxInterval)):
+			case <-pendingCtx.evicted:
+				return nil, ErrContextEvicted
 			case <-ctx.Done():
 				return nil, ctx.Err()
 			}
 		}
 
-		err := c.sendToOpenclaw(ctx, req, event)
+		err := c.sendToOpenclaw(ctx, acct, req, event)
+		lastErr = err
 		if err == nil {
 			break
 		}
+		if !IsRetryable(err) {
+			logger.Warn("OpenClaw request failed, not retrying",
+				zap.Int("attempt", attempt+1),
+				zap.Error(err))
+			return nil, err
+		}
 
-		lastErr = err
-		c.logger.Warn("OpenClaw request failed, retrying",
+		logger.Warn("OpenClaw request failed, retrying",
 			zap.Int("attempt", attempt+1),
 			zap.Error(err))
 	}
@@ -567,9 +1133,11 @@ func (c *OpenclawClient) ProcessEvent(ctx context.Context, event *protocol.Canon
 	select {
 	case intent := <-pendingCtx.ResponseCh:
 		return intent, nil
+	case <-pendingCtx.evicted:
+		return nil, ErrContextEvicted
 	case <-time.After(100 * time.Millisecond):
 		// If no response in channel, something went wrong
-		c.logger.Warn("No response received from OpenClaw",
+		logger.Warn("No response received from OpenClaw",
 			zap.String("conversationId", conversationKey))
 		return nil, fmt.Errorf("no response from OpenClaw")
 	case <-ctx.Done():
@@ -578,10 +1146,19 @@ func (c *OpenclawClient) ProcessEvent(ctx context.Context, event *protocol.Canon
 }
 
 // ChatCompletionsRequest is the OpenAI-compatible request format.
+//
+// Generation parameters and the structured output fields are only sent when
+// set, for backends that reject fields they do not know.
 type ChatCompletionsRequest struct {
-	Model    string                   `json:"model"`
-	Messages []ChatCompletionsMessage `json:"messages"`
-	Stream   bool                     `json:"stream,omitempty"`
+	Model          string                   `json:"model"`
+	Messages       []ChatCompletionsMessage `json:"messages"`
+	Stream         bool                     `json:"stream,omitempty"`
+	Temperature    *float64                 `json:"temperature,omitempty"`
+	MaxTokens      *int                     `json:"max_tokens,omitempty"`
+	TopP           *float64                 `json:"top_p,omitempty"`
+	ResponseFormat json.RawMessage          `json:"response_format,omitempty"`
+	Tools          json.RawMessage          `json:"tools,omitempty"`
+	ToolChoice     json.RawMessage          `json:"tool_choice,omitempty"`
 }
 
 // ChatCompletionsMessage is a single message in the chat.
@@ -590,6 +1167,9 @@ type ChatCompletionsMessage struct {
 	Content string `json:"content"`
 }
 
+// FinishReasonLength is the finish_reason of a reply cut off by the token limit.
+const FinishReasonLength = "length"
+
 // ChatCompletionsResponse is the OpenAI-compatible response format.
 type ChatCompletionsResponse struct {
 	ID      string `json:"id"`
@@ -599,8 +1179,9 @@ type ChatCompletionsResponse struct {
 	Choices []struct {
 		Index   int `json:"index"`
 		Message struct {
-			Role    string `json:"role"`
-			Content string `json:"content"`
+			Role      string                    `json:"role"`
+			Content   string                    `json:"content"`
+			ToolCalls []ChatCompletionsToolCall `json:"tool_calls,omitempty"`
 		} `json:"message"`
 		FinishReason string `json:"finish_reason"`
 	} `json:"choices"`
@@ -610,159 +1191,334 @@ type ChatCompletionsResponse struct {
 	} `json:"error,omitempty"`
 }
 
-func (c *OpenclawClient) sendToOpenclaw(ctx context.Context, req OpenclawUniversalIMRequest, event *protocol.CanonicalInteractionEvent) error {
+func (c *OpenclawClient) sendToOpenclaw(ctx context.Context, acct *accountState, req OpenclawUniversalIMRequest, event *protocol.CanonicalInteractionEvent) error {
+	logger := log.ForEvent(ctx, c.logger, event)
+
 	// Try webhook first (for test-server or properly configured OpenClaw)
-	err := c.sendViaWebhook(ctx, req, event)
+	err := c.sendViaWebhook(ctx, acct, req, event)
 	if err != nil {
-		c.logger.Debug("Webhook failed, trying Chat Completions API",
+		logger.Debug("Webhook failed, trying Chat Completions API",
 			zap.Error(err))
 		// Fallback to Chat Completions API
-		return c.sendViaChatCompletions(ctx, req, event)
+		chatErr := c.sendViaChatCompletions(ctx, acct, req, event)
+		var cerr *ClawdbotError
+		if errors.As(chatErr, &cerr) && cerr.Unsupported() {
+			// No Chat Completions route: the webhook failure is the one that matters
+			logger.Debug("Chat Completions API not available",
+				zap.Int("status", cerr.StatusCode))
+			return err
+		}
+		return chatErr
 	}
 	return nil
 }
 
 // sendViaWebhook sends message via Universal IM webhook endpoint
-func (c *OpenclawClient) sendViaWebhook(ctx context.Context, req OpenclawUniversalIMRequest, event *protocol.CanonicalInteractionEvent) error {
+func (c *OpenclawClient) sendViaWebhook(ctx context.Context, acct *accountState, req OpenclawUniversalIMRequest, event *protocol.CanonicalInteractionEvent) error {
+	logger := log.ForEvent(ctx, c.logger, event)
+
 	body, err := json.Marshal(req)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return permanentError("failed to marshal request", err)
 	}
 
 	// Use universal-im webhook endpoint
 	// Format: /universal-im/{accountId}/webhook (accountId defaults to "default")
 	var url string
-	if c.webhookPath != "" {
-		url = fmt.Sprintf("%s%s", c.config.Endpoint, c.webhookPath)
+	if acct.WebhookPath != "" {
+		url = fmt.Sprintf("%s%s", c.config.Endpoint, acct.WebhookPath)
 	} else {
 		// Default path with accountId
-		url = fmt.Sprintf("%s/universal-im/%s/webhook", c.config.Endpoint, c.accountID)
+		url = fmt.Sprintf("%s/universal-im/%s/webhook", c.config.Endpoint, acct.ID)
 	}
 
-	c.logger.Debug("Sending webhook request",
+	logger.Debug("Sending webhook request",
 		zap.String("url", url),
-		zap.String("accountId", c.accountID),
+		zap.String("accountId", acct.ID),
 		zap.Int("bodyLen", len(body)))
 
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return permanentError("failed to create request", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	if c.secret != "" {
-		httpReq.Header.Set("X-Webhook-Secret", c.secret)
+	if acct.Secret != "" {
+		httpReq.Header.Set("X-Webhook-Secret", acct.Secret)
 	}
 	httpReq.Header.Set("X-Trace-ID", event.Meta.TraceID)
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return transportError("request failed", err)
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return transportError("failed to read response", err)
 	}
 
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("server error: %d - %s", resp.StatusCode, string(respBody))
+		return statusError(resp, respBody, c.config.Clock.Now())
 	}
 
 	var webhookResp OpenclawWebhookResponse
 	if err := json.Unmarshal(respBody, &webhookResp); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
+		return permanentError("failed to parse response", err)
 	}
 
 	if !webhookResp.OK {
-		return fmt.Errorf("webhook error: %s", webhookResp.Error)
+		return &ClawdbotError{Message: "webhook error: " + webhookResp.Error}
 	}
 
-	c.logger.Info("Message sent via webhook",
+	logger.Info("Message sent via webhook",
 		zap.String("messageId", req.MessageID),
 		zap.String("endpoint", url))
 
+	// The backend answered in the response itself: no callback to wait for
+	if reply := webhookResp.SyncReply(); reply != "" {
+		meta := map[string]interface{}{}
+		reply = applyStructured(event.Meta.Structured, reply, nil, meta)
+		if len(meta) == 0 {
+			meta = nil
+		}
+		logger.Info("Received AI response via webhook response",
+			zap.String("messageId", req.MessageID),
+			zap.Int("responseLen", len(reply)))
+		c.deliverResponse(acct, event.Session.RoutingKey(), reply, req.MessageID, meta)
+		return nil
+	}
+
 	// Webhook mode: response comes via outbound callback, deliver a placeholder
-	c.deliverResponse(event.Session.ExternalSessionID,
-		"消息已发送到 OpenClaw，等待 AI 响应...", req.MessageID)
+	placeholder := c.pendingReplyText
+	if c.messages != nil {
+		if msg, ok := c.messages.Lookup(i18n.LocaleOf(event), i18n.KeyPendingReply); ok {
+			placeholder = msg
+		}
+	}
+	c.deliverResponse(acct, event.Session.RoutingKey(), placeholder, req.MessageID, nil)
 
 	return nil
 }
 
-// sendViaChatCompletions sends message via OpenAI-compatible Chat Completions API
-func (c *OpenclawClient) sendViaChatCompletions(ctx context.Context, req OpenclawUniversalIMRequest, event *protocol.CanonicalInteractionEvent) error {
+// sendViaChatCompletions sends message via OpenAI-compatible Chat Completions API.
+//
+// A reply cut off by the token limit (finish_reason "length") is continued
+// with up to MaxContinuations follow-up requests when configured; if it is
+// still incomplete, the truncation note is appended. The final finish_reason
+// is surfaced in the intent metadata.
+func (c *OpenclawClient) sendViaChatCompletions(ctx context.Context, acct *accountState, req OpenclawUniversalIMRequest, event *protocol.CanonicalInteractionEvent) error {
+	logger := log.ForEvent(ctx, c.logger, event)
+
+	// The system prompt is resolved per request and never stored, so history
+	// pruning only ever sees the conversation itself
+	var messages []ChatCompletionsMessage
+	if prompt := c.systemPrompts.Resolve(event); prompt != "" {
+		messages = append(messages, ChatCompletionsMessage{Role: "system", Content: prompt})
+	}
+	historyKey := event.Session.RoutingKey()
+	if c.history != nil {
+		prior, err := c.history.Get(ctx, historyKey)
+		if err != nil {
+			logger.Warn("Failed to load conversation history",
+				zap.String("conversationId", historyKey),
+				zap.Error(err))
+		}
+		for _, m := range prior {
+			messages = append(messages, ChatCompletionsMessage{Role: m.Role, Content: m.Content})
+		}
+	}
+	messages = append(messages, ChatCompletionsMessage{
+		Role:    "user",
+		Content: req.Text,
+	})
+
+	model := c.model
+	if event.Meta.Model != "" {
+		model = event.Meta.Model
+	}
+	gen := c.generationFor(event)
+
+	chatResp, err := c.postChatCompletion(ctx, acct, model, gen, event.Meta.Structured, messages, event.Meta.TraceID)
+	if err != nil {
+		return err
+	}
+	if len(chatResp.Choices) == 0 {
+		return fmt.Errorf("chat completion returned no choices")
+	}
+
+	// Extract the response text
+	choice := chatResp.Choices[0]
+	responseText := choice.Message.Content
+	finishReason := choice.FinishReason
+
+	continuations := 0
+	for finishReason == FinishReasonLength && continuations < c.maxContinuations {
+		messages = append(messages,
+			ChatCompletionsMessage{Role: "assistant", Content: choice.Message.Content},
+			ChatCompletionsMessage{Role: "user", Content: c.continuePrompt},
+		)
+		next, err := c.postChatCompletion(ctx, acct, model, gen, event.Meta.Structured, messages, event.Meta.TraceID)
+		if err != nil || len(next.Choices) == 0 {
+			// Keep what we have; the truncation note below tells the user
+			logger.Warn("Chat Completions continuation failed",
+				zap.String("messageId", req.MessageID),
+				zap.Int("continuation", continuations+1),
+				zap.Error(err))
+			break
+		}
+		continuations++
+		choice = next.Choices[0]
+		responseText += choice.Message.Content
+		finishReason = choice.FinishReason
+	}
+
+	if c.history != nil {
+		err := c.history.Append(ctx, historyKey,
+			history.Message{Role: history.RoleUser, Content: req.Text},
+			history.Message{Role: history.RoleAssistant, Content: responseText})
+		if err != nil {
+			logger.Warn("Failed to save conversation history",
+				zap.String("conversationId", historyKey),
+				zap.Error(err))
+		}
+	}
+
+	meta := map[string]interface{}{
+		"finishReason": finishReason,
+	}
+	if continuations > 0 {
+		meta["continuations"] = continuations
+	}
+	responseText = applyStructured(event.Meta.Structured, responseText, choice.Message.ToolCalls, meta)
+	if finishReason == FinishReasonLength {
+		meta["truncated"] = true
+		note := c.truncatedNote
+		if c.messages != nil {
+			if msg, ok := c.messages.Lookup(i18n.LocaleOf(event), i18n.KeyResponseTruncated); ok {
+				note = msg
+			}
+		}
+		responseText += "\n\n" + note
+		logger.Warn("Chat Completions response truncated",
+			zap.String("messageId", req.MessageID),
+			zap.Int("continuations", continuations))
+	}
+
+	logger.Info("Received AI response via Chat Completions",
+		zap.String("messageId", req.MessageID),
+		zap.String("finishReason", finishReason),
+		zap.Int("responseLen", len(responseText)))
+
+	c.deliverResponse(acct, event.Session.RoutingKey(), responseText, req.MessageID, meta)
+
+	return nil
+}
+
+// ResetCommand clears the conversation history when history is enabled.
+const ResetCommand = "/reset"
+
+// DefaultHistoryResetText confirms ResetCommand when no catalog is set.
+const DefaultHistoryResetText = "Conversation history cleared."
+
+// resetHistory clears the event's conversation and answers with a
+// confirmation, without contacting OpenClaw.
+func (c *OpenclawClient) resetHistory(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+	logger := log.ForEvent(ctx, c.logger, event)
+
+	key := event.Session.RoutingKey()
+	if err := c.history.Clear(ctx, key); err != nil {
+		return nil, fmt.Errorf("clear history: %w", err)
+	}
+	logger.Info("Conversation history cleared",
+		zap.String("conversationId", key),
+		zap.String("userId", event.Session.UserID))
+
+	text := DefaultHistoryResetText
+	if c.messages != nil {
+		if msg, ok := c.messages.Lookup(i18n.LocaleOf(event), i18n.KeyHistoryReset); ok {
+			text = msg
+		}
+	}
+	intent := protocol.NewInteractionIntent(protocol.IntentTypeReply, text, event.Session.ExternalSessionID, event.InteractionID)
+	intent.Ephemeral = true // Command acknowledgements should not spam the channel
+	return intent, nil
+}
+
+// generationFor returns the configured generation parameters with the
+// event's overrides applied.
+func (c *OpenclawClient) generationFor(event *protocol.CanonicalInteractionEvent) protocol.GenerationParams {
+	return c.generation.Override(event.Meta.Generation)
+}
+
+// postChatCompletion performs one Chat Completions request.
+func (c *OpenclawClient) postChatCompletion(ctx context.Context, acct *accountState, model string, gen protocol.GenerationParams, structured *protocol.StructuredOutput, messages []ChatCompletionsMessage, traceID string) (*ChatCompletionsResponse, error) {
 	chatReq := ChatCompletionsRequest{
-		Model: "default",
-		Messages: []ChatCompletionsMessage{
-			{
-				Role:    "user",
-				Content: req.Text,
-			},
-		},
-		Stream: false,
+		Model:       model,
+		Messages:    messages,
+		Stream:      false,
+		Temperature: gen.Temperature,
+		MaxTokens:   gen.MaxTokens,
+		TopP:        gen.TopP,
+	}
+	if structured != nil {
+		chatReq.ResponseFormat = structured.ResponseFormat
+		chatReq.Tools = structured.Tools
+		chatReq.ToolChoice = structured.ToolChoice
 	}
 
 	body, err := json.Marshal(chatReq)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return nil, permanentError("failed to marshal request", err)
 	}
 
 	url := fmt.Sprintf("%s/v1/chat/completions", c.config.Endpoint)
 
 	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, permanentError("failed to create request", err)
 	}
 
 	httpReq.Header.Set("Content-Type", "application/json")
-	if c.secret != "" {
-		httpReq.Header.Set("Authorization", "Bearer "+c.secret)
+	if acct.Secret != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+acct.Secret)
 	}
-	httpReq.Header.Set("X-Trace-ID", event.Meta.TraceID)
+	httpReq.Header.Set("X-Trace-ID", traceID)
 
 	resp, err := c.httpClient.Do(httpReq)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return nil, transportError("request failed", err)
 	}
 	defer resp.Body.Close()
 
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return nil, transportError("failed to read response", err)
 	}
 
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("server error: %d - %s", resp.StatusCode, string(respBody))
+		return nil, statusError(resp, respBody, c.config.Clock.Now())
 	}
 
 	var chatResp ChatCompletionsResponse
 	if err := json.Unmarshal(respBody, &chatResp); err != nil {
-		return fmt.Errorf("failed to parse response: %w", err)
+		return nil, permanentError("failed to parse response", err)
 	}
 
 	if chatResp.Error != nil {
-		return fmt.Errorf("chat completions error: %s", chatResp.Error.Message)
+		return nil, responseError("chat completions error: "+chatResp.Error.Message,
+			classifyError(chatResp.Error.Type), false)
 	}
-
-	// Extract the response text
-	if len(chatResp.Choices) > 0 {
-		responseText := chatResp.Choices[0].Message.Content
-		c.logger.Info("Received AI response via Chat Completions",
-			zap.String("messageId", req.MessageID),
-			zap.Int("responseLen", len(responseText)))
-
-		c.deliverResponse(event.Session.ExternalSessionID, responseText, req.MessageID)
-	}
-
-	return nil
+	return &chatResp, nil
 }
 
 // deliverResponse delivers the AI response to the pending channel.
-func (c *OpenclawClient) deliverResponse(conversationID, text, replyToID string) {
-	c.pendingMu.RLock()
-	pendingCtx, exists := c.pending[conversationID]
-	c.pendingMu.RUnlock()
+// meta, if non-nil, becomes the intent's metadata.
+func (c *OpenclawClient) deliverResponse(acct *accountState, conversationID, text, replyToID string, meta map[string]interface{}) {
+	acct.pendingMu.RLock()
+	pendingCtx, exists := acct.pending[conversationID]
+	acct.pendingMu.RUnlock()
 
 	if !exists {
 		c.logger.Warn("No pending channel for response",
@@ -770,21 +1526,43 @@ func (c *OpenclawClient) deliverResponse(conversationID, text, replyToID string)
 		return
 	}
 
+	text, quickReplies := withQuickReplies(text, nil)
 	intent := protocol.NewInteractionIntent(
 		protocol.IntentTypeReply,
 		text,
-		conversationID,
+		pendingCtx.SessionID,
 		replyToID,
 	)
+	intent.Metadata = meta
+	intent.ThreadID = pendingCtx.ThreadID
+	intent.Content.QuickReplies = quickReplies
 
-	select {
-	case pendingCtx.ResponseCh <- intent:
-		c.logger.Debug("Response delivered",
-			zap.String("conversationId", conversationID))
-	default:
-		c.logger.Warn("Response channel full",
-			zap.String("conversationId", conversationID))
+	if !pendingCtx.deliver(intent) {
+		c.logger.Warn("Response already delivered, dropping duplicate",
+			zap.String("conversationId", conversationID),
+			zap.String("replyTo", replyToID),
+			zap.Int("textLength", len(text)))
+		return
 	}
+	c.logger.Debug("Response delivered",
+		zap.String("conversationId", conversationID))
+}
+
+// limitOutbound drops callback attachments whose declared size exceeds the
+// attachment limits, so the rest of the reply is still delivered.
+func (c *OpenclawClient) limitOutbound(atts []OutboundAttachment) []OutboundAttachment {
+	var kept []OutboundAttachment
+	for _, att := range atts {
+		if err := c.attachmentLimits.Check(attachment.KindOf(att.ContentType), att.Size); err != nil {
+			c.logger.Warn("Dropping oversized outbound attachment",
+				zap.String("url", att.URL),
+				zap.String("fileName", att.FileName),
+				zap.Error(err))
+			continue
+		}
+		kept = append(kept, att)
+	}
+	return kept
 }
 
 // HandleCallback processes the callback from OpenClaw.
@@ -793,69 +1571,85 @@ func (c *OpenclawClient) deliverResponse(conversationID, text, replyToID string)
 func (c *OpenclawClient) HandleCallback(callback *OpenclawOutboundPayload) *OutboundResponse {
 	// Parse the "to" field to extract conversation ID
 	// Format: "user:userId" or "channel:channelId" or "group:groupId"
-	conversationID := callback.To
-	toType := ""
-	if len(callback.To) > 0 {
-		// Extract the ID part after the colon
-		for i := 0; i < len(callback.To); i++ {
-			if callback.To[i] == ':' {
-				toType = callback.To[:i]
-				conversationID = callback.To[i+1:]
-				break
-			}
-		}
-	}
+	toType, conversationID := parseTarget(callback.To, c.targetKinds)
 
 	// Build outbound response with routing information
+	text, quickReplies := withQuickReplies(callback.Text, callback.QuickReplies)
 	outboundResp := &OutboundResponse{
-		To:        callback.To,
-		Text:      callback.Text,
-		MediaUrl:  callback.MediaUrl,
-		ReplyToId: callback.ReplyToId,
-		ThreadId:  callback.ThreadId,
+		To:           callback.To,
+		Text:         text,
+		MediaUrl:     callback.MediaUrl,
+		Attachments:  c.limitOutbound(callback.AllAttachments()),
+		ReplyToId:    callback.ReplyToId,
+		ThreadId:     callback.ThreadId,
+		Mentions:     callback.Mentions,
+		Location:     callback.Location,
+		QuickReplies: quickReplies,
+	}
+	if loc := callback.Location; loc != nil {
+		if err := loc.Validate(); err != nil {
+			c.logger.Warn("Dropping invalid callback location",
+				zap.String("to", callback.To),
+				zap.Error(err))
+			outboundResp.Location = nil
+		}
 	}
 
-	// Try to find pending context (sync mode)
-	c.pendingMu.RLock()
-	pendingCtx, exists := c.pending[conversationID]
-	c.pendingMu.RUnlock()
-
-	// If not found in pending, try sessionCtx (async webhook mode)
-	if !exists {
-		c.sessionCtxMu.RLock()
-		pendingCtx, exists = c.sessionCtx[conversationID]
-		c.sessionCtxMu.RUnlock()
+	// Find the routing context: pending (sync mode) first, then sessionCtx
+	// (async webhook mode). Derived session keys contain colons themselves
+	// ("channel:c1:user:u1"), so also try the unsplit "to" value
+	keys := []string{conversationID}
+	if conversationID != callback.To {
+		keys = append(keys, callback.To)
 	}
+	acct, pendingCtx, exists := c.findContext(callback.AccountID, keys...)
 
 	if exists {
 		// Fill in routing information from context
 		outboundResp.ChannelID = pendingCtx.ChannelID
 		outboundResp.UserID = pendingCtx.UserID
 		outboundResp.SessionID = pendingCtx.SessionID
+		if outboundResp.ThreadId == "" {
+			outboundResp.ThreadId = pendingCtx.ThreadID
+		}
 
 		intent := protocol.NewInteractionIntent(
 			protocol.IntentTypeReply,
-			callback.Text,
-			conversationID,
+			outboundResp.Text,
+			pendingCtx.SessionID,
 			callback.ReplyToId,
 		)
+		intent.Content.Mentions = callback.Mentions
+		intent.Content.Location = outboundResp.Location
+		intent.Content.QuickReplies = outboundResp.QuickReplies
+		intent.ThreadID = outboundResp.ThreadId
+		if callback.Ask != nil {
+			intent.IntentType = protocol.IntentTypeAsk
+			intent.Ask = callback.Ask
+		}
 
-		// Add media URL as attachment if present
-		if callback.MediaUrl != "" {
+		// Add all media/files as intent attachments
+		for _, att := range outboundResp.Attachments {
+			attType := att.ContentType
+			if attType == "" {
+				attType = "media"
+			}
 			intent.Content.Attachments = append(intent.Content.Attachments, protocol.Attachment{
-				Type: "media",
-				URL:  callback.MediaUrl,
+				Type: attType,
+				URL:  att.URL,
+				Name: att.FileName,
+				Size: att.Size,
 			})
 		}
 
-		select {
-		case pendingCtx.ResponseCh <- intent:
+		if pendingCtx.deliver(intent) {
 			c.logger.Debug("Callback processed",
 				zap.String("conversationId", conversationID),
 				zap.String("channelId", pendingCtx.ChannelID))
-		default:
-			// Channel might be full or closed (webhook async mode)
-			c.logger.Debug("Callback response channel not available (async mode)",
+		} else {
+			// Webhook async mode: the placeholder answered ProcessEvent and
+			// this reply reaches the IM through the outbound callback
+			c.logger.Debug("Callback response already delivered (async mode)",
 				zap.String("conversationId", conversationID))
 		}
 
@@ -877,6 +1671,13 @@ func (c *OpenclawClient) HandleCallback(callback *OpenclawOutboundPayload) *Outb
 		c.outboundCallback(outboundResp)
 	}
 
+	// Routing info has been handed off; drop it rather than waiting for the TTL
+	if exists {
+		acct.sessionCtxMu.Lock()
+		acct.removeSessionContextLocked(pendingCtx)
+		acct.sessionCtxMu.Unlock()
+	}
+
 	return outboundResp
 }
 
@@ -884,7 +1685,12 @@ func (c *OpenclawClient) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if c.closed {
+		return nil
+	}
 	c.closed = true
+	close(c.stopCh)
+	c.wg.Wait()
 	c.httpClient.CloseIdleConnections()
 	return nil
 }
@@ -923,15 +1729,15 @@ type MoltbotClient = OpenclawClient
 
 // MockClient is a mock implementation for testing and development.
 type MockClient struct {
-	logger   *zap.Logger
+	logger   log.Logger
 	delay    time.Duration
 	response string
 }
 
 // NewMockClient creates a mock OpenClaw client for testing.
-func NewMockClient(logger *zap.Logger) *MockClient {
+func NewMockClient(logger log.Logger) *MockClient {
 	if logger == nil {
-		logger, _ = zap.NewProduction()
+		logger = log.Default()
 	}
 	return &MockClient{
 		logger:   logger,
@@ -941,6 +1747,8 @@ func NewMockClient(logger *zap.Logger) *MockClient {
 }
 
 func (c *MockClient) ProcessEvent(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+	logger := log.ForEvent(ctx, c.logger, event)
+
 	// Simulate processing delay
 	select {
 	case <-time.After(c.delay):
@@ -966,7 +1774,7 @@ func (c *MockClient) ProcessEvent(ctx context.Context, event *protocol.Canonical
 		event.InteractionID,
 	)
 
-	c.logger.Debug("Mock Clawdbot response",
+	logger.Debug("Mock Clawdbot response",
 		zap.String("intentId", intent.IntentID),
 		zap.String("response", response))
 
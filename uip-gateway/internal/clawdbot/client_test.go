@@ -0,0 +1,510 @@
+package clawdbot_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/clawdbot"
+	"github.com/zlc_ai/uip-gateway/internal/clawdbot/testserver"
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// newTestClient starts a fake OpenClaw server and a client talking to it.
+func newTestClient(t *testing.T, srvOpts testserver.Options, config clawdbot.Config, opts clawdbot.OpenclawClientConfig) (*clawdbot.OpenclawClient, *testserver.Server) {
+	t.Helper()
+	srv := testserver.New(srvOpts)
+	t.Cleanup(srv.Close)
+	config.Endpoint = srv.URL
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+	client, err := clawdbot.NewOpenclawClient(config, opts, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewOpenclawClient: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, srv
+}
+
+func textEvent(sessionID, userID, text string) *protocol.CanonicalInteractionEvent {
+	return protocol.NewCanonicalInteractionEvent(sessionID, userID, protocol.InputTypeText,
+		map[string]interface{}{"text": text}, protocol.SurfaceCapabilities{}, "test")
+}
+
+// TestSessionContextsBounded sends many sessions whose outbound callback
+// never arrives: the routing contexts stay capped and expire after the TTL.
+func TestSessionContextsBounded(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	client, _ := newTestClient(t, testserver.Options{}, clawdbot.Config{Clock: clk},
+		clawdbot.OpenclawClientConfig{SessionContextTTL: time.Minute, MaxPendingContexts: 10})
+
+	for i := 0; i < 50; i++ {
+		event := textEvent(fmt.Sprintf("s%d", i), fmt.Sprintf("u%d", i), "hi")
+		if _, err := client.ProcessEvent(context.Background(), event); err != nil {
+			t.Fatalf("ProcessEvent %d: %v", i, err)
+		}
+	}
+	// Each context is keyed by its session and its user
+	if n := client.SessionContextCount(); n == 0 || n > 20 {
+		t.Fatalf("SessionContextCount = %d after 50 sessions, want 1..20", n)
+	}
+	if client.GetSessionContext("u49") == nil {
+		t.Error("newest context was evicted")
+	}
+
+	clk.Advance(30 * time.Second)
+	if n := client.EvictSessionContexts(); n != 0 {
+		t.Errorf("evicted %d contexts before the TTL", n)
+	}
+	clk.Advance(31 * time.Second)
+	if n := client.EvictSessionContexts(); n == 0 {
+		t.Error("no contexts evicted after the TTL")
+	}
+	if n := client.SessionContextCount(); n != 0 {
+		t.Errorf("SessionContextCount = %d after the TTL, want 0", n)
+	}
+}
+
+func TestSessionContextClearedAfterCallback(t *testing.T) {
+	client, _ := newTestClient(t, testserver.Options{}, clawdbot.Config{}, clawdbot.OpenclawClientConfig{})
+
+	for _, user := range []string{"u1", "u2"} {
+		if _, err := client.ProcessEvent(context.Background(), textEvent("s-"+user, user, "hi")); err != nil {
+			t.Fatalf("ProcessEvent: %v", err)
+		}
+	}
+	before := client.SessionContextCount()
+
+	resp := client.HandleCallback(&clawdbot.OpenclawOutboundPayload{To: "user:u1", Text: "hello"})
+	if resp.SessionID != "s-u1" {
+		t.Fatalf("callback routed to session %q, want s-u1", resp.SessionID)
+	}
+	if client.GetSessionContext("u1") != nil {
+		t.Error("u1 context kept after its callback")
+	}
+	if client.GetSessionContext("u2") == nil {
+		t.Error("u2 context cleared by u1's callback")
+	}
+	if n := client.SessionContextCount(); n >= before {
+		t.Errorf("SessionContextCount = %d after a callback, want below %d", n, before)
+	}
+
+	client.ClearSessionContext("u2")
+	if n := client.SessionContextCount(); n != 0 {
+		t.Errorf("SessionContextCount = %d after ClearSessionContext, want 0", n)
+	}
+}
+
+// TestCallbackInheritsThread checks that a callback without a threadId
+// replies in the thread of the message it answers.
+func TestCallbackInheritsThread(t *testing.T) {
+	for _, tt := range []struct {
+		thread, want string
+	}{
+		{"", "t1"},
+		{"t2", "t2"},
+	} {
+		client, srv := newTestClient(t, testserver.Options{}, clawdbot.Config{}, clawdbot.OpenclawClientConfig{})
+		event := textEvent("s1", "u1", "hi")
+		event.Input.Payload["channelId"] = "c1"
+		event.Input.Payload["threadId"] = "t1"
+		if _, err := client.ProcessEvent(context.Background(), event); err != nil {
+			t.Fatalf("ProcessEvent: %v", err)
+		}
+		var req clawdbot.OpenclawUniversalIMRequest
+		if err := json.Unmarshal(srv.Requests(testserver.EndpointWebhook)[0].Body, &req); err != nil {
+			t.Fatal(err)
+		}
+		to := "channel:" + req.Conversation.ID
+		resp := client.HandleCallback(&clawdbot.OpenclawOutboundPayload{To: to, Text: "hello", ThreadId: tt.thread})
+		if resp.ChannelID != "c1" || resp.ThreadId != tt.want {
+			t.Errorf("callback thread %q: routed to channel %q thread %q, want c1 thread %q", tt.thread, resp.ChannelID, resp.ThreadId, tt.want)
+		}
+	}
+}
+
+func TestProcessEventDelivery(t *testing.T) {
+	type failure struct {
+		endpoint testserver.Endpoint
+		n        int
+		status   int
+	}
+	tests := []struct {
+		name       string
+		maxRetries int
+		webhook    testserver.Response
+		chat       testserver.Response
+		fail       []failure
+		wantText   string
+		wantErr    bool
+		// errText, if set, must appear in the error
+		errText string
+		// Requests made to the webhook and Chat Completions endpoints
+		webhooks, chats int
+		// Retries wait at least MaxInterval each (backoff.Base exceeds it)
+		retries int
+	}{
+		{
+			name:     "webhook accepted, reply comes via callback",
+			wantText: clawdbot.DefaultPendingReplyText,
+			webhooks: 1,
+		},
+		{
+			name:     "webhook answers synchronously",
+			webhook:  testserver.Response{Body: clawdbot.OpenclawWebhookResponse{OK: true, Reply: "sync reply"}},
+			wantText: "sync reply",
+			webhooks: 1,
+		},
+		{
+			name:     "no webhook route falls back to chat completions",
+			webhook:  testserver.Response{Status: 404},
+			wantText: "echo: hello",
+			webhooks: 1, chats: 1,
+		},
+		{
+			name:     "failing webhook falls back to chat completions",
+			fail:     []failure{{testserver.EndpointWebhook, 1, 500}},
+			wantText: "echo: hello",
+			webhooks: 1, chats: 1,
+		},
+		{
+			name:       "both failing are retried with backoff",
+			maxRetries: 2,
+			fail:       []failure{{testserver.EndpointWebhook, 1, 503}, {testserver.EndpointChatCompletions, 1, 503}},
+			wantText:   clawdbot.DefaultPendingReplyText,
+			webhooks:   2, chats: 1, retries: 1,
+		},
+		{
+			name:     "chat completion without choices",
+			webhook:  testserver.Response{Status: 404},
+			chat:     testserver.Response{Body: clawdbot.ChatCompletionsResponse{}},
+			wantErr:  true,
+			errText:  "no choices",
+			webhooks: 1, chats: 1,
+		},
+		{
+			name:       "rate limited chat completions retried",
+			maxRetries: 2,
+			webhook:    testserver.Response{Status: 404},
+			fail:       []failure{{testserver.EndpointChatCompletions, 2, 429}},
+			wantText:   "echo: hello",
+			webhooks:   3, chats: 3, retries: 2,
+		},
+		{
+			name:       "retries exhausted",
+			maxRetries: 2,
+			fail:       []failure{{testserver.EndpointWebhook, 10, 502}, {testserver.EndpointChatCompletions, 10, 502}},
+			wantErr:    true,
+			webhooks:   3, chats: 3, retries: 2,
+		},
+		{
+			name:       "webhook rejection without chat completions is not retried",
+			maxRetries: 2,
+			webhook:    testserver.Response{Status: 400},
+			chat:       testserver.Response{Status: 404},
+			wantErr:    true,
+			webhooks:   1, chats: 1,
+		},
+	}
+	const maxInterval = 20 * time.Millisecond
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, srv := newTestClient(t, testserver.Options{},
+				clawdbot.Config{MaxRetries: tt.maxRetries, MaxInterval: maxInterval}, clawdbot.OpenclawClientConfig{})
+			srv.SetResponse(testserver.EndpointWebhook, tt.webhook)
+			srv.SetResponse(testserver.EndpointChatCompletions, tt.chat)
+			for _, f := range tt.fail {
+				srv.FailNext(f.endpoint, f.n, f.status)
+			}
+
+			start := time.Now()
+			intent, err := client.ProcessEvent(context.Background(), textEvent("s1", "u1", "hello"))
+			elapsed := time.Since(start)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ProcessEvent succeeded with %q, want an error", intent.Content.Text)
+				}
+				if !strings.Contains(err.Error(), tt.errText) {
+					t.Fatalf("ProcessEvent error = %v, want it to mention %q", err, tt.errText)
+				}
+			} else if err != nil {
+				t.Fatalf("ProcessEvent: %v", err)
+			} else if intent.Content.Text != tt.wantText {
+				t.Errorf("reply = %q, want %q", intent.Content.Text, tt.wantText)
+			}
+
+			if got := srv.Count(testserver.EndpointWebhook); got != tt.webhooks {
+				t.Errorf("webhook requests = %d, want %d", got, tt.webhooks)
+			}
+			if got := srv.Count(testserver.EndpointChatCompletions); got != tt.chats {
+				t.Errorf("chat completions requests = %d, want %d", got, tt.chats)
+			}
+			if min := time.Duration(tt.retries) * maxInterval; elapsed < min {
+				t.Errorf("took %v with %d retries, want at least %v of backoff", elapsed, tt.retries, min)
+			}
+		})
+	}
+}
+
+// TestCallbackRoundTrip lets the fake server answer accepted webhooks by
+// POSTing the reply to an outbound handler, as OpenClaw does.
+func TestCallbackRoundTrip(t *testing.T) {
+	tests := []struct {
+		name         string
+		serverSecret string
+		clientSecret string
+		wantStatus   int
+	}{
+		{"unsigned", "", "", http.StatusOK},
+		{"signed", "s3cret", "s3cret", http.StatusOK},
+		{"bad signature", "wrong", "s3cret", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var client *clawdbot.OpenclawClient
+			outbound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if err := client.VerifyOutbound(r.Header, body); err != nil {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				var payload clawdbot.OpenclawOutboundPayload
+				if err := json.Unmarshal(body, &payload); err != nil {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				json.NewEncoder(w).Encode(clawdbot.NewOutboundAck(&payload, client.HandleCallback(&payload)))
+			}))
+			defer outbound.Close()
+
+			client, srv := newTestClient(t,
+				testserver.Options{OutboundURL: outbound.URL, OutboundSecret: tt.serverSecret},
+				clawdbot.Config{}, clawdbot.OpenclawClientConfig{OutboundSecret: tt.clientSecret})
+			routed := make(chan *clawdbot.OutboundResponse, 1)
+			client.SetOutboundCallback(func(resp *clawdbot.OutboundResponse) { routed <- resp })
+
+			event := textEvent("s1", "u1", "hello")
+			if _, err := client.ProcessEvent(context.Background(), event); err != nil {
+				t.Fatalf("ProcessEvent: %v", err)
+			}
+
+			var result testserver.OutboundResult
+			select {
+			case result = <-srv.Outbound():
+			case <-time.After(5 * time.Second):
+				t.Fatal("no outbound POST")
+			}
+			if result.Err != nil || result.StatusCode != tt.wantStatus {
+				t.Fatalf("outbound POST: status %d, err %v, want %d", result.StatusCode, result.Err, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if client.GetSessionContext("u1") == nil {
+					t.Error("rejected callback cleared the routing context")
+				}
+				return
+			}
+
+			resp := <-routed
+			if resp.Text != "echo: hello" || resp.ReplyToId != event.InteractionID {
+				t.Errorf("routed reply = %q in reply to %q", resp.Text, resp.ReplyToId)
+			}
+			if resp.SessionID != "s1" || resp.UserID != "u1" {
+				t.Errorf("routed to session %q user %q, want s1 u1", resp.SessionID, resp.UserID)
+			}
+			if client.GetSessionContext("u1") != nil {
+				t.Error("routing context kept after the callback")
+			}
+		})
+	}
+}
+
+// TestOutboundAckJSON pins the acknowledgement OpenClaw and IM integrations
+// parse; renaming a field or dropping the routing block breaks them.
+func TestOutboundAckJSON(t *testing.T) {
+	payload := &clawdbot.OpenclawOutboundPayload{To: "user:u1", Text: "hi", ReplyToId: "m1"}
+	id := clawdbot.OutboundMessageID(payload)
+	tests := []struct {
+		name    string
+		payload *clawdbot.OpenclawOutboundPayload
+		resp    *clawdbot.OutboundResponse
+		want    string
+	}{
+		{
+			name:    "no client",
+			payload: payload,
+			want:    `{"ok":true,"messageId":"` + id + `","to":"user:u1","text":"hi","routing":{"matched":false,"channelId":"","userId":"","sessionId":""}}`,
+		},
+		{
+			name:    "unknown conversation",
+			payload: payload,
+			resp:    &clawdbot.OutboundResponse{To: "user:u1", Text: "hi"},
+			want:    `{"ok":true,"messageId":"` + id + `","to":"user:u1","text":"hi","routing":{"matched":false,"channelId":"","userId":"","sessionId":""}}`,
+		},
+		{
+			name:    "routed",
+			payload: payload,
+			resp:    &clawdbot.OutboundResponse{ChannelID: "c1", UserID: "u1", SessionID: "s1"},
+			want:    `{"ok":true,"messageId":"` + id + `","to":"user:u1","text":"hi","routing":{"matched":true,"channelId":"c1","userId":"u1","sessionId":"s1"}}`,
+		},
+		{
+			name: "media and thread",
+			payload: &clawdbot.OpenclawOutboundPayload{To: "channel:c1", Text: "pic", MediaUrl: "https://x/a.png", ThreadId: "t1",
+				Attachments: []clawdbot.OutboundAttachment{{URL: "https://x/b.pdf", ContentType: "application/pdf", FileName: "b.pdf", Size: 3}}},
+			want: `{"ok":true,"messageId":"ID","to":"channel:c1","text":"pic","routing":{"matched":false,"channelId":"","userId":"","sessionId":""},` +
+				`"mediaUrl":"https://x/a.png","attachments":[{"url":"https://x/a.png"},{"url":"https://x/b.pdf","contentType":"application/pdf","fileName":"b.pdf","size":3}],"threadId":"t1"}`,
+		},
+	}
+	for _, tt := range tests {
+		data, err := json.Marshal(clawdbot.NewOutboundAck(tt.payload, tt.resp))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		want := strings.Replace(tt.want, `"messageId":"ID"`, `"messageId":"`+clawdbot.OutboundMessageID(tt.payload)+`"`, 1)
+		if string(data) != want {
+			t.Errorf("%s:\n got %s\nwant %s", tt.name, data, want)
+		}
+	}
+
+	retried := *payload
+	if clawdbot.OutboundMessageID(&retried) != id {
+		t.Error("a retried payload got a different messageId")
+	}
+	retried.Text = "other"
+	if clawdbot.OutboundMessageID(&retried) == id {
+		t.Error("a different payload got the same messageId")
+	}
+}
+
+// TestRetryAfterDelaysRetry answers the first webhook with a 429 carrying
+// Retry-After and checks when the retry arrives.
+func TestRetryAfterDelaysRetry(t *testing.T) {
+	tests := []struct {
+		name        string
+		retryAfter  string
+		maxInterval time.Duration
+		min, max    time.Duration
+	}{
+		{"hint honored", "2", 5 * time.Second, 2 * time.Second, 3 * time.Second},
+		{"hint capped at MaxInterval", "60", 50 * time.Millisecond, 50 * time.Millisecond, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var attempts []time.Time
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				attempts = append(attempts, time.Now())
+				first := len(attempts) == 1
+				mu.Unlock()
+				switch {
+				case r.URL.Path == "/v1/chat/completions":
+					// No fallback: only the webhook is retried
+					http.NotFound(w, r)
+				case first:
+					w.Header().Set("Retry-After", tt.retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+				default:
+					json.NewEncoder(w).Encode(clawdbot.OpenclawWebhookResponse{OK: true, Reply: "done"})
+				}
+			}))
+			defer srv.Close()
+
+			client, err := clawdbot.NewOpenclawClient(clawdbot.Config{
+				Endpoint: srv.URL, Timeout: 5 * time.Second, MaxRetries: 1, MaxInterval: tt.maxInterval,
+			}, clawdbot.OpenclawClientConfig{}, zap.NewNop())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			intent, err := client.ProcessEvent(context.Background(), textEvent("s1", "u1", "hello"))
+			if err != nil {
+				t.Fatalf("ProcessEvent: %v", err)
+			}
+			if intent.Content.Text != "done" {
+				t.Errorf("reply = %q, want done", intent.Content.Text)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			// webhook (429), chat completions (404), webhook again
+			if len(attempts) != 3 {
+				t.Fatalf("%d requests, want 3", len(attempts))
+			}
+			if gap := attempts[2].Sub(attempts[0]); gap < tt.min || gap > tt.max {
+				t.Errorf("retry after %v, want between %v and %v", gap, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+// TestSyncReplyRacesCallback has the webhook answer synchronously while the
+// same reply also arrives as an outbound callback. ProcessEvent must get
+// exactly one response and neither side may block.
+func TestSyncReplyRacesCallback(t *testing.T) {
+	var client *clawdbot.OpenclawClient
+	outbound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload clawdbot.OpenclawOutboundPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		client.HandleCallback(&payload)
+	}))
+	defer outbound.Close()
+
+	client, srv := newTestClient(t, testserver.Options{OutboundURL: outbound.URL}, clawdbot.Config{}, clawdbot.OpenclawClientConfig{})
+	srv.SetResponse(testserver.EndpointWebhook, testserver.Response{Body: clawdbot.OpenclawWebhookResponse{OK: true, Reply: "sync"}})
+
+	for i := 0; i < 20; i++ {
+		intent, err := client.ProcessEvent(context.Background(), textEvent("s1", "u1", "hello"))
+		if err != nil {
+			t.Fatalf("ProcessEvent: %v", err)
+		}
+		if intent.Content.Text != "sync" && intent.Content.Text != "echo: hello" {
+			t.Fatalf("reply = %q", intent.Content.Text)
+		}
+		select {
+		case result := <-srv.Outbound():
+			if result.Err != nil || result.StatusCode != http.StatusOK {
+				t.Fatalf("callback: status %d, err %v", result.StatusCode, result.Err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("callback blocked")
+		}
+	}
+}
+
+func TestProcessEventInfersAttachmentKinds(t *testing.T) {
+	client, srv := newTestClient(t, testserver.Options{}, clawdbot.Config{}, clawdbot.OpenclawClientConfig{})
+	event := textEvent("s1", "u1", "files")
+	event.Input.Payload["attachments"] = []interface{}{
+		map[string]interface{}{"url": "https://x/1", "contentType": "image/png"},
+		map[string]interface{}{"url": "https://x/2", "kind": "unknown", "fileName": "memo.m4a"},
+		map[string]interface{}{"url": "https://x/3", "kind": "video", "contentType": "application/pdf"},
+		map[string]interface{}{"url": "https://x/4"},
+	}
+	if _, err := client.ProcessEvent(context.Background(), event); err != nil {
+		t.Fatalf("ProcessEvent: %v", err)
+	}
+
+	var req clawdbot.OpenclawUniversalIMRequest
+	if err := json.Unmarshal(srv.Requests(testserver.EndpointWebhook)[0].Body, &req); err != nil {
+		t.Fatal(err)
+	}
+	var kinds []string
+	for _, att := range req.Attachments {
+		kinds = append(kinds, att.Kind)
+	}
+	// An explicit kind is kept; missing and "unknown" ones are inferred
+	if want := "[image audio video document]"; fmt.Sprint(kinds) != want {
+		t.Errorf("kinds sent = %v, want %s", kinds, want)
+	}
+}
@@ -0,0 +1,105 @@
+package clawdbot
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+)
+
+// DefaultMaxPendingContexts caps the routing contexts kept per account.
+const DefaultMaxPendingContexts = 10000
+
+// ErrContextEvicted is returned by ProcessEvent when its routing context was
+// evicted to make room for newer requests before a response arrived. It
+// wraps context.DeadlineExceeded, so callers treat it as a timeout.
+var ErrContextEvicted = fmt.Errorf("pending context evicted: %w", context.DeadlineExceeded)
+
+var pendingContexts = metrics.NewGauge("uip_pending_contexts",
+	"Routing contexts waiting for an OpenClaw response or callback, by account.",
+	"account")
+
+// contextEntry tracks a routing context in the account's LRU order and the
+// sessionCtx keys that point to it.
+type contextEntry struct {
+	elem *list.Element
+	keys []string
+}
+
+// storeLocked points keys at ctx and evicts the oldest contexts beyond the
+// account's cap, signalling their waiting ProcessEvent calls. The caller
+// must hold sessionCtxMu.
+func (a *accountState) storeLocked(ctx *PendingContext, keys ...string) {
+	entry, exists := a.entries[ctx]
+	if !exists {
+		entry = &contextEntry{elem: a.order.PushBack(ctx)}
+		a.entries[ctx] = entry
+	} else {
+		a.order.MoveToBack(entry.elem)
+	}
+	for _, key := range keys {
+		old, had := a.sessionCtx[key]
+		if had && old == ctx {
+			continue
+		}
+		if had {
+			a.unrefLocked(old, key)
+		}
+		a.sessionCtx[key] = ctx
+		entry.keys = append(entry.keys, key)
+	}
+
+	for a.maxContexts > 0 && a.order.Len() > a.maxContexts {
+		oldest := a.order.Front().Value.(*PendingContext)
+		a.removeSessionContextLocked(oldest)
+		oldest.evict()
+	}
+	a.updateGaugeLocked()
+}
+
+// unrefLocked drops key's reference to ctx, forgetting the context once no
+// key points to it. The caller must hold sessionCtxMu and repoint or delete
+// sessionCtx[key] itself.
+func (a *accountState) unrefLocked(ctx *PendingContext, key string) {
+	entry, exists := a.entries[ctx]
+	if !exists {
+		return
+	}
+	for i, k := range entry.keys {
+		if k == key {
+			entry.keys = append(entry.keys[:i], entry.keys[i+1:]...)
+			break
+		}
+	}
+	if len(entry.keys) == 0 {
+		a.order.Remove(entry.elem)
+		delete(a.entries, ctx)
+	}
+}
+
+// forgetLocked deletes ctx and the keys pointing to it, returning the number
+// of keys deleted. The caller must hold sessionCtxMu.
+func (a *accountState) forgetLocked(ctx *PendingContext) int {
+	entry, exists := a.entries[ctx]
+	if !exists {
+		return 0
+	}
+	for _, key := range entry.keys {
+		delete(a.sessionCtx, key)
+	}
+	a.order.Remove(entry.elem)
+	delete(a.entries, ctx)
+	return len(entry.keys)
+}
+
+func (a *accountState) updateGaugeLocked() {
+	pendingContexts.Set(float64(a.order.Len()), a.ID)
+}
+
+// evict wakes the ProcessEvent call waiting on the context, if any.
+func (p *PendingContext) evict() {
+	if p.evicted != nil {
+		close(p.evicted)
+	}
+}
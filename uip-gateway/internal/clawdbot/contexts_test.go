@@ -0,0 +1,123 @@
+package clawdbot
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+func newTestContext(created time.Time) *PendingContext {
+	return &PendingContext{CreatedAt: created, evicted: make(chan struct{})}
+}
+
+func isEvicted(ctx *PendingContext) bool {
+	select {
+	case <-ctx.evicted:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestContextEvictionOrder(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	acct := newAccountState(Account{ID: "test"}, 2)
+	ctx1, ctx2, ctx3, ctx4 := newTestContext(now), newTestContext(now), newTestContext(now), newTestContext(now)
+
+	store := func(ctx *PendingContext, keys ...string) {
+		acct.sessionCtxMu.Lock()
+		acct.storeLocked(ctx, keys...)
+		acct.sessionCtxMu.Unlock()
+	}
+	wantKeys := func(want map[string]*PendingContext) {
+		t.Helper()
+		if len(acct.sessionCtx) != len(want) {
+			t.Errorf("sessionCtx has %d keys, want %d", len(acct.sessionCtx), len(want))
+		}
+		for key, ctx := range want {
+			if acct.sessionCtx[key] != ctx {
+				t.Errorf("sessionCtx[%q] points to the wrong context", key)
+			}
+		}
+	}
+
+	store(ctx1, "s1", "u1")
+	store(ctx2, "s2", "u2")
+	store(ctx3, "s3", "u3")
+	if !isEvicted(ctx1) || isEvicted(ctx2) || isEvicted(ctx3) {
+		t.Fatal("want only the oldest context evicted")
+	}
+	wantKeys(map[string]*PendingContext{"s2": ctx2, "u2": ctx2, "s3": ctx3, "u3": ctx3})
+
+	// ctx4 takes over u2; evicting ctx2 next must leave u2 pointing at ctx4
+	store(ctx4, "s4", "u2")
+	if !isEvicted(ctx2) || isEvicted(ctx3) || isEvicted(ctx4) {
+		t.Fatal("want ctx2 evicted next")
+	}
+	wantKeys(map[string]*PendingContext{"s3": ctx3, "u3": ctx3, "s4": ctx4, "u2": ctx4})
+	if acct.order.Len() != 2 || len(acct.entries) != 2 {
+		t.Errorf("tracking %d/%d contexts, want 2", acct.order.Len(), len(acct.entries))
+	}
+}
+
+func TestContextRepointedKeysForgetContext(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	acct := newAccountState(Account{ID: "test"}, 0)
+	old, newer := newTestContext(now.Add(-time.Hour)), newTestContext(now)
+
+	acct.sessionCtxMu.Lock()
+	acct.storeLocked(old, "s1", "u1")
+	acct.storeLocked(newer, "s1", "u1")
+	acct.sessionCtxMu.Unlock()
+
+	if _, tracked := acct.entries[old]; tracked {
+		t.Error("context with no keys left is still tracked")
+	}
+	if n := acct.evict(now.Add(-time.Minute)); n != 0 {
+		t.Errorf("evict removed %d keys, want 0", n)
+	}
+	if n := acct.evict(now.Add(time.Minute)); n != 2 {
+		t.Errorf("evict removed %d keys, want 2", n)
+	}
+	if len(acct.sessionCtx) != 0 || acct.order.Len() != 0 {
+		t.Errorf("left %d keys and %d contexts", len(acct.sessionCtx), acct.order.Len())
+	}
+}
+
+// TestPendingContextDeliverOnce races many deliveries to one context. Run
+// with -race: exactly one wins and its intent is the one received.
+func TestPendingContextDeliverOnce(t *testing.T) {
+	for round := 0; round < 50; round++ {
+		ctx := newTestContext(time.Now())
+		ctx.ResponseCh = make(chan *protocol.InteractionIntent, 1)
+
+		const senders = 8
+		won := make(chan *protocol.InteractionIntent, senders)
+		var wg sync.WaitGroup
+		for i := 0; i < senders; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				intent := protocol.NewInteractionIntent(protocol.IntentTypeReply, fmt.Sprint(i), "s1", "")
+				if ctx.deliver(intent) {
+					won <- intent
+				}
+			}(i)
+		}
+		wg.Wait()
+		close(won)
+
+		if len(won) != 1 {
+			t.Fatalf("%d deliveries succeeded, want 1", len(won))
+		}
+		if got := <-ctx.ResponseCh; got != <-won {
+			t.Fatal("ResponseCh holds a different intent than the winning delivery")
+		}
+		if ctx.deliver(protocol.NewInteractionIntent(protocol.IntentTypeReply, "late", "s1", "")) {
+			t.Fatal("delivery after the response was taken succeeded")
+		}
+	}
+}
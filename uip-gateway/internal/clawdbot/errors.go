@@ -0,0 +1,191 @@
+package clawdbot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/backoff"
+)
+
+// ClawdbotError is returned by the OpenClaw send paths. Retryable tells the
+// retry loop whether another attempt can succeed: 429, 5xx and network
+// failures are retryable, other 4xx responses and malformed requests are not.
+type ClawdbotError struct {
+	// StatusCode is the HTTP status, or 0 if no response was received.
+	StatusCode int
+	// Message describes the failure.
+	Message   string
+	Retryable bool
+	// RetryAfter is the server's Retry-After hint on a 429/503 response.
+	RetryAfter time.Duration
+	// Category classifies the failure for the user's reply, one of the
+	// Category constants or "" when unknown.
+	Category string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+func (e *ClawdbotError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *ClawdbotError) Unwrap() error {
+	return e.Err
+}
+
+// Unsupported reports whether the endpoint has no such route (404/405).
+func (e *ClawdbotError) Unsupported() bool {
+	return e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusMethodNotAllowed
+}
+
+// IsRetryable reports whether err is worth retrying. Errors that are not a
+// ClawdbotError are treated as retryable, except context cancellation.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var cerr *ClawdbotError
+	if errors.As(err, &cerr) {
+		return cerr.Retryable
+	}
+	return true
+}
+
+// Error categories reported by OpenClaw, through the error type or code
+// of a response body or the HTTP status.
+const (
+	CategoryAuth             = "auth"
+	CategoryRateLimit        = "rate_limit"
+	CategoryModelUnavailable = "model_unavailable"
+	CategoryContentFiltered  = "content_filtered"
+)
+
+// categoryHints maps substrings of OpenClaw and OpenAI-style error types
+// and codes to categories, checked in order.
+var categoryHints = []struct {
+	hint     string
+	category string
+}{
+	{"content_filter", CategoryContentFiltered},
+	{"content_policy", CategoryContentFiltered},
+	{"moderation", CategoryContentFiltered},
+	{"safety", CategoryContentFiltered},
+	{"rate_limit", CategoryRateLimit},
+	{"too_many_requests", CategoryRateLimit},
+	{"quota", CategoryRateLimit},
+	{"overloaded", CategoryRateLimit},
+	{"model_not_found", CategoryModelUnavailable},
+	{"model_unavailable", CategoryModelUnavailable},
+	{"model_not_available", CategoryModelUnavailable},
+	{"auth", CategoryAuth},
+	{"api_key", CategoryAuth},
+	{"permission", CategoryAuth},
+	{"forbidden", CategoryAuth},
+	{"unauthorized", CategoryAuth},
+}
+
+// classifyError returns the category of an OpenClaw error type or code,
+// or "" if none matches.
+func classifyError(codes ...string) string {
+	for _, code := range codes {
+		code = strings.ToLower(code)
+		if code == "" {
+			continue
+		}
+		for _, h := range categoryHints {
+			if strings.Contains(code, h.hint) {
+				return h.category
+			}
+		}
+	}
+	return ""
+}
+
+// ErrorCategory returns the category of a Clawdbot error, or "" if err is
+// not a ClawdbotError or its category is unknown.
+func ErrorCategory(err error) string {
+	var cerr *ClawdbotError
+	if errors.As(err, &cerr) {
+		return cerr.Category
+	}
+	return ""
+}
+
+// responseError wraps an error reported in a response body. Auth and
+// content errors are never retried, rate limits always; other errors
+// follow retryable.
+func responseError(message, category string, retryable bool) *ClawdbotError {
+	switch category {
+	case CategoryAuth, CategoryContentFiltered:
+		retryable = false
+	case CategoryRateLimit:
+		retryable = true
+	}
+	return &ClawdbotError{Message: message, Retryable: retryable, Category: category}
+}
+
+// statusError classifies an HTTP error response received at now.
+func statusError(resp *http.Response, body []byte, now time.Time) *ClawdbotError {
+	statusCode := resp.StatusCode
+	cerr := &ClawdbotError{
+		StatusCode: statusCode,
+		Message:    fmt.Sprintf("server error: %d - %s", statusCode, string(body)),
+		Retryable:  statusCode == http.StatusTooManyRequests || statusCode >= 500,
+	}
+	if statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable {
+		cerr.RetryAfter = backoff.ParseRetryAfter(resp.Header.Get("Retry-After"), now)
+	}
+
+	// A JSON error body is more specific than the status
+	var errBody struct {
+		Error struct {
+			Type string      `json:"type"`
+			Code interface{} `json:"code"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &errBody) == nil {
+		code, _ := errBody.Error.Code.(string)
+		cerr.Category = classifyError(errBody.Error.Type, code)
+	}
+	if cerr.Category == "" {
+		switch statusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			cerr.Category = CategoryAuth
+		case http.StatusTooManyRequests:
+			cerr.Category = CategoryRateLimit
+		}
+	}
+	return cerr
+}
+
+// retryDelay is the wait before retry attempt, honoring the Retry-After hint
+// carried by lastErr, capped at maxInterval.
+func retryDelay(attempt int, lastErr error, maxInterval time.Duration) time.Duration {
+	if maxInterval <= 0 {
+		maxInterval = DefaultMaxInterval
+	}
+	var retryAfter time.Duration
+	var cerr *ClawdbotError
+	if errors.As(lastErr, &cerr) {
+		retryAfter = cerr.RetryAfter
+	}
+	return backoff.Delay(attempt, retryAfter, maxInterval)
+}
+
+// transportError wraps a failure to send the request or read its response.
+func transportError(message string, err error) *ClawdbotError {
+	return &ClawdbotError{Message: message, Retryable: true, Err: err}
+}
+
+// permanentError wraps a failure that another attempt would repeat.
+func permanentError(message string, err error) *ClawdbotError {
+	return &ClawdbotError{Message: message, Err: err}
+}
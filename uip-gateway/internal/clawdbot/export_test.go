@@ -0,0 +1,4 @@
+package clawdbot
+
+// EvictSessionContexts runs one pass of the TTL eviction loop.
+func (c *OpenclawClient) EvictSessionContexts() int { return c.evictSessionContexts() }
@@ -0,0 +1,104 @@
+package clawdbot
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/log"
+)
+
+// maxLoggedBodyBytes is the maximum number of body bytes captured per request/response.
+const maxLoggedBodyBytes = 2048
+
+// redactedHeaders lists headers whose values must never appear in logs.
+var redactedHeaders = []string{"Authorization", "X-Webhook-Secret"}
+
+// loggingTransport is an http.RoundTripper that logs every round trip to OpenClaw.
+// It is a no-op unless the logger has debug level enabled, so production stays quiet.
+type loggingTransport struct {
+	next   http.RoundTripper
+	logger log.Logger
+}
+
+// newLoggingTransport wraps next with round-trip logging.
+func newLoggingTransport(next http.RoundTripper, logger log.Logger) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &loggingTransport{
+		next:   next,
+		logger: logger,
+	}
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !log.DebugEnabled(t.logger) {
+		return t.next.RoundTrip(req)
+	}
+
+	start := time.Now()
+	fields := []zap.Field{
+		zap.String("method", req.Method),
+		zap.String("url", req.URL.String()),
+		zap.Any("headers", redactHeaders(req.Header)),
+	}
+
+	// GetBody returns a fresh copy, so capturing never consumes the real body
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			data, _ := io.ReadAll(io.LimitReader(body, maxLoggedBodyBytes+1))
+			body.Close()
+			fields = append(fields, zap.String("requestBody", truncateBody(data)))
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	fields = append(fields, zap.Duration("duration", time.Since(start)))
+	if err != nil {
+		t.logger.Debug("HTTP round trip failed", append(fields, zap.Error(err))...)
+		return nil, err
+	}
+
+	// Peek at the response body and stitch it back together for the caller
+	prefix, _ := io.ReadAll(io.LimitReader(resp.Body, maxLoggedBodyBytes+1))
+	resp.Body = &peekedBody{
+		Reader: io.MultiReader(bytes.NewReader(prefix), resp.Body),
+		Closer: resp.Body,
+	}
+
+	t.logger.Debug("HTTP round trip",
+		append(fields,
+			zap.Int("status", resp.StatusCode),
+			zap.String("responseBody", truncateBody(prefix)))...)
+
+	return resp, nil
+}
+
+// peekedBody restores a response body after part of it has been read for logging.
+type peekedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// redactHeaders returns a copy of the headers with secret values masked.
+func redactHeaders(h http.Header) http.Header {
+	out := h.Clone()
+	for _, name := range redactedHeaders {
+		if out.Get(name) != "" {
+			out.Set(name, "[REDACTED]")
+		}
+	}
+	return out
+}
+
+// truncateBody renders a captured body, marking it when it exceeded the capture limit.
+func truncateBody(data []byte) string {
+	if len(data) > maxLoggedBodyBytes {
+		return string(data[:maxLoggedBodyBytes]) + "...(truncated)"
+	}
+	return string(data)
+}
@@ -0,0 +1,75 @@
+package clawdbot
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+var (
+	requestsInFlight = metrics.NewGauge("uip_clawdbot_requests_in_flight",
+		"OpenClaw requests in flight.")
+	requestsWaiting = metrics.NewGauge("uip_clawdbot_requests_waiting",
+		"OpenClaw requests waiting for a free slot under clawdbot.max_concurrent.")
+)
+
+// LimitedClient caps the requests a Client has in flight, for backends
+// that reject calls beyond a concurrency limit. Requests over the cap wait
+// for a free slot until their context ends, so the processing timeout
+// bounds the wait.
+type LimitedClient struct {
+	Client
+	slots chan struct{}
+}
+
+// NewLimitedClient wraps c so at most max requests run at once.
+func NewLimitedClient(c Client, max int) *LimitedClient {
+	return &LimitedClient{Client: c, slots: make(chan struct{}, max)}
+}
+
+// ProcessEvent forwards to the wrapped client once a slot is free.
+func (c *LimitedClient) ProcessEvent(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+	if err := c.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.release()
+	return c.Client.ProcessEvent(ctx, event)
+}
+
+// ProcessEventMulti forwards to the wrapped client once a slot is free,
+// keeping every intent of a MultiIntentClient.
+func (c *LimitedClient) ProcessEventMulti(ctx context.Context, event *protocol.CanonicalInteractionEvent) ([]*protocol.InteractionIntent, error) {
+	if err := c.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer c.release()
+	return ProcessAll(ctx, c.Client, event)
+}
+
+// InFlight is the number of requests currently holding a slot.
+func (c *LimitedClient) InFlight() int {
+	return len(c.slots)
+}
+
+func (c *LimitedClient) acquire(ctx context.Context) error {
+	select {
+	case c.slots <- struct{}{}:
+	default:
+		requestsWaiting.Inc()
+		defer requestsWaiting.Dec()
+		select {
+		case c.slots <- struct{}{}:
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for a free OpenClaw request slot: %w", ctx.Err())
+		}
+	}
+	requestsInFlight.Inc()
+	return nil
+}
+
+func (c *LimitedClient) release() {
+	requestsInFlight.Dec()
+	<-c.slots
+}
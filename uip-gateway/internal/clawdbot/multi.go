@@ -0,0 +1,30 @@
+package clawdbot
+
+import (
+	"context"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// MultiIntentClient is implemented by clients whose backend can answer one
+// event with several intents, e.g. a reply followed by a channel notice.
+type MultiIntentClient interface {
+	Client
+
+	// ProcessEventMulti sends a CIE to OpenClaw and returns its intents in
+	// delivery order.
+	ProcessEventMulti(ctx context.Context, event *protocol.CanonicalInteractionEvent) ([]*protocol.InteractionIntent, error)
+}
+
+// ProcessAll returns every intent for event: all of them from a
+// MultiIntentClient, otherwise the single intent from ProcessEvent.
+func ProcessAll(ctx context.Context, c Client, event *protocol.CanonicalInteractionEvent) ([]*protocol.InteractionIntent, error) {
+	if mc, ok := c.(MultiIntentClient); ok {
+		return mc.ProcessEventMulti(ctx, event)
+	}
+	intent, err := c.ProcessEvent(ctx, event)
+	if err != nil {
+		return nil, err
+	}
+	return []*protocol.InteractionIntent{intent}, nil
+}
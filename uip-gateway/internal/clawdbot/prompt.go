@@ -0,0 +1,45 @@
+package clawdbot
+
+import (
+	"strings"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// SystemPrompts configures the system prompt (persona) sent ahead of the
+// conversation. The most specific match wins: a channel prefix, then the
+// event's adapter, then Default.
+type SystemPrompts struct {
+	// Default applies when nothing more specific matches.
+	Default string
+	// Adapters maps an adapter name to its prompt.
+	Adapters map[string]string
+	// Channels match the event's channelId by prefix; the longest prefix wins.
+	Channels []ChannelPrompt
+}
+
+// ChannelPrompt is the system prompt for channels whose ID starts with Prefix.
+type ChannelPrompt struct {
+	Prefix string
+	Prompt string
+}
+
+// Resolve returns the system prompt for event, or "" for none.
+func (p SystemPrompts) Resolve(event *protocol.CanonicalInteractionEvent) string {
+	if channelID, _ := event.Input.Payload["channelId"].(string); channelID != "" {
+		best := -1
+		prompt := ""
+		for _, c := range p.Channels {
+			if strings.HasPrefix(channelID, c.Prefix) && len(c.Prefix) > best {
+				best, prompt = len(c.Prefix), c.Prompt
+			}
+		}
+		if best >= 0 {
+			return prompt
+		}
+	}
+	if prompt, ok := p.Adapters[event.Meta.AdapterName]; ok {
+		return prompt
+	}
+	return p.Default
+}
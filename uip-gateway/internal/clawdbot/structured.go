@@ -0,0 +1,82 @@
+package clawdbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// ChatCompletionsToolCall is a function call in a Chat Completions reply.
+type ChatCompletionsToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // JSON-encoded
+	} `json:"function"`
+}
+
+// applyStructured validates the reply to a structured output request and
+// records it in meta: tool calls under protocol.MetaToolCalls, a JSON reply
+// under protocol.MetaStructured. It returns the reply text, which is the
+// JSON reply's top-level "text" string when it has one.
+//
+// A reply that does not parse is delivered as plain text, with the reason
+// in protocol.MetaStructuredError.
+func applyStructured(structured *protocol.StructuredOutput, content string, toolCalls []ChatCompletionsToolCall, meta map[string]interface{}) string {
+	if structured.IsZero() {
+		return content
+	}
+
+	if len(toolCalls) > 0 {
+		calls := make([]interface{}, 0, len(toolCalls))
+		for _, tc := range toolCalls {
+			var args interface{}
+			if err := json.Unmarshal([]byte(tc.Function.Arguments), &args); err != nil {
+				meta[protocol.MetaStructuredError] = fmt.Sprintf("tool call %s: invalid arguments: %v", tc.Function.Name, err)
+				if content == "" {
+					return tc.Function.Arguments
+				}
+				return content
+			}
+			calls = append(calls, map[string]interface{}{
+				"id":        tc.ID,
+				"name":      tc.Function.Name,
+				"arguments": args,
+			})
+		}
+		meta[protocol.MetaToolCalls] = calls
+		return content
+	}
+	if len(structured.ResponseFormat) == 0 {
+		return content
+	}
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(stripCodeFence(content)), &v); err != nil {
+		meta[protocol.MetaStructuredError] = "invalid JSON reply: " + err.Error()
+		return content
+	}
+	meta[protocol.MetaStructured] = v
+	if obj, ok := v.(map[string]interface{}); ok {
+		if text, ok := obj["text"].(string); ok && text != "" {
+			return text
+		}
+	}
+	return content
+}
+
+// stripCodeFence removes a ```json ... ``` fence some models wrap JSON in.
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") || !strings.HasSuffix(s, "```") || len(s) < 6 {
+		return s
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "```"), "```")
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:] // language tag
+	}
+	return s
+}
@@ -0,0 +1,26 @@
+package clawdbot
+
+import "strings"
+
+// DefaultTargetKinds are the prefixes of an outbound "to" value that
+// ParseTarget recognises, as in "user:u1" or "channel:c1".
+var DefaultTargetKinds = []string{"user", "channel", "group"}
+
+// ParseTarget splits an outbound "to" value into its kind and ID, using
+// DefaultTargetKinds.
+//
+// Only a known prefix is split off; the rest is the ID even when it
+// contains colons, so "user:@alice:example.org" has ID "@alice:example.org"
+// and a bare Matrix ID such as "@alice:example.org" has no kind at all.
+func ParseTarget(to string) (kind, id string) {
+	return parseTarget(to, DefaultTargetKinds)
+}
+
+func parseTarget(to string, kinds []string) (kind, id string) {
+	for _, k := range kinds {
+		if rest, ok := strings.CutPrefix(to, k+":"); ok && rest != "" {
+			return k, rest
+		}
+	}
+	return "", to
+}
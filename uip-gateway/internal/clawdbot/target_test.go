@@ -0,0 +1,62 @@
+package clawdbot_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zlc_ai/uip-gateway/internal/clawdbot"
+	"github.com/zlc_ai/uip-gateway/internal/clawdbot/testserver"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		to, kind, id string
+	}{
+		{"user:u1", "user", "u1"},
+		{"channel:c1", "channel", "c1"},
+		{"group:g1", "group", "g1"},
+		{"user:@alice:example.org", "user", "@alice:example.org"},
+		{"channel:!room:example.org", "channel", "!room:example.org"},
+		{"@alice:example.org", "", "@alice:example.org"},
+		{"channel:c1:user:u1", "channel", "c1:user:u1"},
+		{"room:r1", "", "room:r1"},
+		{"user:", "", "user:"},
+		{"User:u1", "", "User:u1"},
+		{"u1", "", "u1"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		kind, id := clawdbot.ParseTarget(tt.to)
+		if kind != tt.kind || id != tt.id {
+			t.Errorf("ParseTarget(%q) = %q, %q; want %q, %q", tt.to, kind, id, tt.kind, tt.id)
+		}
+	}
+}
+
+// TestCallbackRoutesColonIDs routes callbacks for a Matrix user, whose ID
+// contains a colon, with and without a kind prefix.
+func TestCallbackRoutesColonIDs(t *testing.T) {
+	tests := []struct {
+		name  string
+		kinds []string
+		to    string
+	}{
+		{"user prefix", nil, "user:@alice:example.org"},
+		{"bare Matrix ID", nil, "@alice:example.org"},
+		{"configured kind", []string{"matrix"}, "matrix:@alice:example.org"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newTestClient(t, testserver.Options{}, clawdbot.Config{},
+				clawdbot.OpenclawClientConfig{TargetKinds: tt.kinds})
+			event := textEvent("!dm:example.org", "@alice:example.org", "hi")
+			if _, err := client.ProcessEvent(context.Background(), event); err != nil {
+				t.Fatalf("ProcessEvent: %v", err)
+			}
+			resp := client.HandleCallback(&clawdbot.OpenclawOutboundPayload{To: tt.to, Text: "hello"})
+			if resp.SessionID != "!dm:example.org" || resp.UserID != "@alice:example.org" {
+				t.Errorf("routed to session %q user %q, want !dm:example.org @alice:example.org", resp.SessionID, resp.UserID)
+			}
+		})
+	}
+}
@@ -0,0 +1,332 @@
+// Package testserver provides an in-process fake OpenClaw server for
+// exercising the real clawdbot.OpenclawClient over HTTP.
+//
+// The server implements the Universal IM webhook
+// (/universal-im/{account}/webhook), the Chat Completions fallback
+// (/v1/chat/completions) and /health. Each endpoint's status, body and delay
+// can be configured, failures can be injected for the next N requests, and
+// accepted webhooks can be answered asynchronously by POSTing an outbound
+// payload to the gateway, as OpenClaw does.
+//
+//	srv := testserver.New(testserver.Options{OutboundURL: gatewayURL + "/api/v1/openclaw/outbound"})
+//	defer srv.Close()
+//	client, _ := clawdbot.NewOpenclawClient(clawdbot.Config{Endpoint: srv.URL}, clawdbot.OpenclawClientConfig{}, nil)
+package testserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/clawdbot"
+)
+
+// Endpoint identifies one of the fake server's routes.
+type Endpoint string
+
+const (
+	EndpointWebhook         Endpoint = "webhook"
+	EndpointChatCompletions Endpoint = "chat_completions"
+	EndpointHealth          Endpoint = "health"
+)
+
+// Response overrides how an endpoint answers.
+type Response struct {
+	// Status is the HTTP status (defaults to 200).
+	Status int
+	// Body is written as JSON; nil uses the endpoint's normal response.
+	Body interface{}
+	// Delay is applied before responding.
+	Delay time.Duration
+}
+
+// ReplyFunc produces the AI reply text for an inbound message.
+type ReplyFunc func(text string) string
+
+// Options configures the fake server.
+type Options struct {
+	// Reply produces reply text (defaults to "echo: " + text).
+	Reply ReplyFunc
+	// OutboundURL, if set, receives an OpenclawOutboundPayload after each
+	// accepted webhook, mirroring OpenClaw's async reply path.
+	OutboundURL string
+	// OutboundSecret signs outbound POSTs (X-Webhook-Signature/Timestamp).
+	OutboundSecret string
+	// OutboundAuthHeader is sent as the Authorization header on outbound POSTs.
+	OutboundAuthHeader string
+	// OutboundDelay is applied before the outbound POST.
+	OutboundDelay time.Duration
+}
+
+// Request is a recorded request to the fake server.
+type Request struct {
+	Endpoint Endpoint
+	// Account is the {account} path segment of webhook requests.
+	Account string
+	Header  http.Header
+	Body    []byte
+}
+
+// OutboundResult is the gateway's answer to an outbound POST.
+type OutboundResult struct {
+	Payload    clawdbot.OpenclawOutboundPayload
+	StatusCode int
+	Err        error
+}
+
+// Server is a fake OpenClaw server. Configure it with SetResponse and
+// FailNext; inspect it with Requests, Count and Outbound.
+type Server struct {
+	*httptest.Server
+
+	opts       Options
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	responses map[Endpoint]Response
+	failures  map[Endpoint]failure
+	requests  []Request
+
+	outbound chan OutboundResult // buffered; results are dropped when full
+	wg       sync.WaitGroup
+}
+
+type failure struct {
+	remaining int
+	status    int
+}
+
+// New starts a fake OpenClaw server.
+func New(opts Options) *Server {
+	if opts.Reply == nil {
+		opts.Reply = func(text string) string { return "echo: " + text }
+	}
+	s := &Server{
+		opts:       opts,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		responses:  make(map[Endpoint]Response),
+		failures:   make(map[Endpoint]failure),
+		outbound:   make(chan OutboundResult, 64),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/universal-im/", s.handleWebhook)
+	mux.HandleFunc("/v1/chat/completions", s.handleChatCompletions)
+	mux.HandleFunc("/health", s.handleHealth)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Close waits for pending outbound POSTs and shuts the server down.
+func (s *Server) Close() {
+	s.wg.Wait()
+	s.Server.Close()
+}
+
+// SetResponse overrides an endpoint's response until changed again.
+func (s *Server) SetResponse(ep Endpoint, resp Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[ep] = resp
+}
+
+// FailNext makes the next n requests to ep fail with status.
+func (s *Server) FailNext(ep Endpoint, n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[ep] = failure{remaining: n, status: status}
+}
+
+// Requests returns the recorded requests to ep, oldest first.
+func (s *Server) Requests(ep Endpoint) []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Request
+	for _, r := range s.requests {
+		if r.Endpoint == ep {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Count returns the number of requests made to ep.
+func (s *Server) Count(ep Endpoint) int {
+	return len(s.Requests(ep))
+}
+
+// Outbound returns the results of outbound POSTs as they complete.
+func (s *Server) Outbound() <-chan OutboundResult {
+	return s.outbound
+}
+
+// begin records the request, applies the configured delay and reports an
+// injected failure status, if any.
+func (s *Server) begin(ep Endpoint, r *http.Request, account string) (Response, []byte, int) {
+	body := new(bytes.Buffer)
+	body.ReadFrom(r.Body)
+
+	s.mu.Lock()
+	s.requests = append(s.requests, Request{
+		Endpoint: ep,
+		Account:  account,
+		Header:   r.Header.Clone(),
+		Body:     body.Bytes(),
+	})
+	resp := s.responses[ep]
+	failStatus := 0
+	if f := s.failures[ep]; f.remaining > 0 {
+		f.remaining--
+		s.failures[ep] = f
+		failStatus = f.status
+	}
+	s.mu.Unlock()
+
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(resp.Delay):
+		case <-r.Context().Done():
+		}
+	}
+	return resp, body.Bytes(), failStatus
+}
+
+// write sends the override if one is configured, else the default body.
+func write(w http.ResponseWriter, resp Response, failStatus int, def interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if failStatus != 0 {
+		w.WriteHeader(failStatus)
+		json.NewEncoder(w).Encode(map[string]string{"error": http.StatusText(failStatus)})
+		return
+	}
+	if resp.Status != 0 {
+		w.WriteHeader(resp.Status)
+	}
+	if resp.Body != nil {
+		def = resp.Body
+	}
+	json.NewEncoder(w).Encode(def)
+}
+
+func (s *Server) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/universal-im/")
+	account, ok := strings.CutSuffix(rest, "/webhook")
+	if !ok || account == "" || strings.Contains(account, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp, body, failStatus := s.begin(EndpointWebhook, r, account)
+
+	var req clawdbot.OpenclawUniversalIMRequest
+	if err := json.Unmarshal(body, &req); err != nil && failStatus == 0 && resp.Body == nil {
+		write(w, Response{Status: http.StatusBadRequest}, 0,
+			clawdbot.OpenclawWebhookResponse{OK: false, Error: "invalid JSON"})
+		return
+	}
+
+	write(w, resp, failStatus, clawdbot.OpenclawWebhookResponse{OK: true, MessageID: req.MessageID})
+
+	accepted := failStatus == 0 && (resp.Status == 0 || resp.Status < 400)
+	if accepted && s.opts.OutboundURL != "" {
+		s.wg.Add(1)
+		go s.postOutbound(req)
+	}
+}
+
+func (s *Server) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	resp, body, failStatus := s.begin(EndpointChatCompletions, r, "")
+
+	var req clawdbot.ChatCompletionsRequest
+	json.Unmarshal(body, &req)
+	text := ""
+	if n := len(req.Messages); n > 0 {
+		text = req.Messages[n-1].Content
+	}
+
+	write(w, resp, failStatus, map[string]interface{}{
+		"id":      "chatcmpl-test",
+		"object":  "chat.completion",
+		"created": time.Now().Unix(),
+		"model":   req.Model,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": s.opts.Reply(text)},
+			"finish_reason": "stop",
+		}},
+	})
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	resp, _, failStatus := s.begin(EndpointHealth, r, "")
+	write(w, resp, failStatus, map[string]string{"status": "ok"})
+}
+
+// postOutbound delivers the reply for req to the gateway's outbound URL.
+func (s *Server) postOutbound(req clawdbot.OpenclawUniversalIMRequest) {
+	defer s.wg.Done()
+
+	if s.opts.OutboundDelay > 0 {
+		time.Sleep(s.opts.OutboundDelay)
+	}
+
+	to := "channel:" + req.Conversation.ID
+	if req.Conversation.Type == "direct" {
+		to = "user:" + req.Sender.ID
+	}
+	payload := clawdbot.OpenclawOutboundPayload{
+		To:        to,
+		Text:      s.opts.Reply(req.Text),
+		ReplyToId: req.MessageID,
+		ThreadId:  req.Conversation.ThreadID,
+	}
+	result := OutboundResult{Payload: payload}
+	defer func() {
+		select {
+		case s.outbound <- result:
+		default: // nobody is reading; don't block Close
+		}
+	}()
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	httpReq, err := http.NewRequest(http.MethodPost, s.opts.OutboundURL, bytes.NewReader(body))
+	if err != nil {
+		result.Err = err
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if s.opts.OutboundAuthHeader != "" {
+		httpReq.Header.Set("Authorization", s.opts.OutboundAuthHeader)
+	}
+	if s.opts.OutboundSecret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		httpReq.Header.Set(clawdbot.HeaderWebhookTimestamp, ts)
+		httpReq.Header.Set(clawdbot.HeaderWebhookSignature, clawdbot.SignOutbound(s.opts.OutboundSecret, ts, body))
+	}
+
+	resp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		result.Err = err
+		return
+	}
+	resp.Body.Close()
+	result.StatusCode = resp.StatusCode
+}
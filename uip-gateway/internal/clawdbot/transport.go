@@ -0,0 +1,110 @@
+package clawdbot
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+)
+
+// Connection pool defaults, sized for a chat workload: a handful of
+// workers talking to a single OpenClaw host.
+const (
+	DefaultMaxIdleConns        = 64
+	DefaultMaxIdleConnsPerHost = 32
+	DefaultIdleConnTimeout     = 90 * time.Second
+)
+
+// newTransport builds the connection pool for OpenClaw requests from the
+// pool settings in config, filling in defaults for unset ones.
+func newTransport(config Config, logger log.Logger) http.RoundTripper {
+	maxIdle := config.MaxIdleConns
+	if maxIdle <= 0 {
+		maxIdle = DefaultMaxIdleConns
+	}
+	maxIdlePerHost := config.MaxIdleConnsPerHost
+	if maxIdlePerHost <= 0 {
+		maxIdlePerHost = DefaultMaxIdleConnsPerHost
+	}
+	idleTimeout := config.IdleConnTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = DefaultIdleConnTimeout
+	}
+
+	clk := clock.Or(config.Clock)
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          maxIdle,
+		MaxIdleConnsPerHost:   maxIdlePerHost,
+		IdleConnTimeout:       idleTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if config.Insecure {
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		if strings.HasPrefix(strings.ToLower(config.Endpoint), "https://") {
+			logger.Warn("TLS certificate verification disabled for OpenClaw endpoint, use only for local dev",
+				zap.String("endpoint", config.Endpoint))
+		}
+	}
+	if config.MaxConnLifetime <= 0 {
+		return t
+	}
+	// Lifetime tracking needs to see the raw connections, which HTTP/2
+	// multiplexing hides behind its own pool, so a lifetime costs HTTP/2
+	t.ForceAttemptHTTP2 = false
+	t.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dialer.DialContext(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return &agedConn{Conn: conn, expires: clk.Now().Add(config.MaxConnLifetime)}, nil
+	}
+	return &lifetimeTransport{next: t, clock: clk}
+}
+
+// agedConn is a pooled connection with an expiry time.
+type agedConn struct {
+	net.Conn
+	expires time.Time
+}
+
+// lifetimeTransport retires connections past their lifetime: a request
+// that gets an expired connection is sent with "Connection: close", so the
+// transport closes the connection after the response instead of pooling
+// it. The transport does the closing, so requests in flight are never cut
+// off.
+type lifetimeTransport struct {
+	next  http.RoundTripper
+	clock clock.Clock
+}
+
+func (t *lifetimeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var out *http.Request
+	trace := &httptrace.ClientTrace{
+		// Called before the request is written, on the RoundTrip goroutine
+		GotConn: func(info httptrace.GotConnInfo) {
+			conn := info.Conn
+			if tc, ok := conn.(*tls.Conn); ok {
+				conn = tc.NetConn()
+			}
+			if c, ok := conn.(*agedConn); ok && t.clock.Now().After(c.expires) {
+				out.Close = true
+			}
+		},
+	}
+	// out is our copy, so setting Close leaves the caller's request alone
+	out = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	return t.next.RoundTrip(out)
+}
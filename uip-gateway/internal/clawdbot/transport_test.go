@@ -0,0 +1,110 @@
+package clawdbot
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	stdlog "log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+)
+
+// TestTransportTLS dials a self-signed TLS server: certificate
+// verification rejects it by default, and Insecure skips the check.
+func TestTransportTLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	// The rejected handshake is expected, keep it out of the test output
+	srv.Config.ErrorLog = stdlog.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		name   string
+		config Config
+		ok     bool
+	}{
+		{"verified by default", Config{Endpoint: srv.URL}, false},
+		{"insecure", Config{Endpoint: srv.URL, Insecure: true}, true},
+		{"insecure with conn lifetime", Config{Endpoint: srv.URL, Insecure: true, MaxConnLifetime: time.Minute}, true},
+	}
+	for _, tt := range tests {
+		client := &http.Client{Transport: newTransport(tt.config, zap.NewNop()), Timeout: 5 * time.Second}
+		resp, err := client.Get(srv.URL)
+		if !tt.ok {
+			var certErr *tls.CertificateVerificationError
+			if !errors.As(err, &certErr) {
+				t.Errorf("%s: err = %v, want a certificate verification error", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Errorf("%s: status %d, want 204", tt.name, resp.StatusCode)
+		}
+	}
+}
+
+// TestTransportRetiresOldConnections checks that a request landing on an
+// expired connection asks for "Connection: close", and the next request
+// gets a fresh connection.
+func TestTransportRetiresOldConnections(t *testing.T) {
+	var mu sync.Mutex
+	var conns int
+	var closes []bool
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		closes = append(closes, r.Close)
+		mu.Unlock()
+	}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	client := &http.Client{Transport: newTransport(Config{MaxConnLifetime: time.Minute, Clock: clk}, zap.NewNop())}
+	get := func() {
+		t.Helper()
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	get()
+	get()
+	clk.Advance(2 * time.Minute)
+	get() // reuses the expired connection for one last request
+	get()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if conns != 2 {
+		t.Errorf("server saw %d connections, want 2", conns)
+	}
+	if want := []bool{false, false, true, false}; fmt.Sprint(closes) != fmt.Sprint(want) {
+		t.Errorf("Connection: close per request = %v, want %v", closes, want)
+	}
+}
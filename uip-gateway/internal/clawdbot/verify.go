@@ -0,0 +1,111 @@
+package clawdbot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/security"
+)
+
+// Outbound signature headers.
+//
+// When an outbound secret is configured, OpenClaw signs each outbound POST as
+//
+//	X-Webhook-Timestamp: <unix seconds>
+//	X-Webhook-Signature: sha256=<hex(HMAC-SHA256(secret, timestamp + "." + body))>
+//
+// Including the timestamp in the signed material lets the gateway reject
+// replays outside the tolerance window. Within the window, an optional
+// security.ReplayGuard (see SetReplayGuard) rejects repeated signatures.
+const (
+	HeaderWebhookSignature = "X-Webhook-Signature"
+	HeaderWebhookTimestamp = "X-Webhook-Timestamp"
+	HeaderWebhookSecret    = "X-Webhook-Secret"
+)
+
+// DefaultSignatureTolerance is the maximum accepted clock skew for signed outbound requests.
+const DefaultSignatureTolerance = 5 * time.Minute
+
+// ErrUnauthorized is returned by VerifyOutbound when a request fails authentication.
+var ErrUnauthorized = errors.New("unauthorized outbound request")
+
+// VerifyOutbound authenticates a request posted by OpenClaw to our outbound URL.
+//
+// Checks are applied in order and all configured checks must pass:
+//   - the static Authorization header, if OutboundAuthHeader is configured;
+//   - the HMAC signature, if OutboundSecret is configured, followed by the
+//     replay guard if one is set. A request carrying
+//     only X-Webhook-Secret equal to the shared secret is accepted for
+//     compatibility with OpenClaw builds that cannot sign, but gets no replay
+//     protection.
+func (c *OpenclawClient) VerifyOutbound(headers http.Header, body []byte) error {
+	if c.outboundAuthHeader != "" {
+		got := headers.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(c.outboundAuthHeader)) != 1 {
+			return fmt.Errorf("%w: invalid authorization header", ErrUnauthorized)
+		}
+	}
+
+	if c.outboundSecret == "" {
+		return nil
+	}
+
+	signature := headers.Get(HeaderWebhookSignature)
+	if signature == "" {
+		if secret := headers.Get(HeaderWebhookSecret); secret != "" &&
+			subtle.ConstantTimeCompare([]byte(secret), []byte(c.outboundSecret)) == 1 {
+			return nil
+		}
+		return fmt.Errorf("%w: missing signature", ErrUnauthorized)
+	}
+
+	tsHeader := headers.Get(HeaderWebhookTimestamp)
+	ts, err := strconv.ParseInt(tsHeader, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp", ErrUnauthorized)
+	}
+	skew := c.config.Clock.Since(time.Unix(ts, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > c.signatureTolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance (%s)", ErrUnauthorized, skew.Round(time.Second))
+	}
+
+	expected := SignOutbound(c.outboundSecret, tsHeader, body)
+	if !hmac.Equal([]byte(strings.TrimPrefix(signature, "sha256=")), []byte(strings.TrimPrefix(expected, "sha256="))) {
+		return fmt.Errorf("%w: signature mismatch", ErrUnauthorized)
+	}
+
+	// The signature covers timestamp and body, so it doubles as the nonce:
+	// an attacker cannot produce a fresh one without the secret
+	if c.replayGuard != nil {
+		if err := c.replayGuard.Check(signature, time.Unix(ts, 0)); err != nil {
+			return fmt.Errorf("%w: %v", ErrUnauthorized, err)
+		}
+	}
+
+	return nil
+}
+
+// SetReplayGuard enables replay protection for signed outbound requests.
+func (c *OpenclawClient) SetReplayGuard(guard *security.ReplayGuard) {
+	c.replayGuard = guard
+}
+
+// SignOutbound computes the X-Webhook-Signature value for a body and timestamp.
+func SignOutbound(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
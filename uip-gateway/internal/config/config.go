@@ -4,20 +4,30 @@ package config
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"github.com/zlc_ai/uip-gateway/internal/attachment"
+	"github.com/zlc_ai/uip-gateway/internal/clawdbot"
+	"github.com/zlc_ai/uip-gateway/internal/history"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
 )
 
 // Config is the root configuration structure.
 type Config struct {
 	Server        ServerConfig        `yaml:"server"`
+	Gateway       GatewayConfig       `yaml:"gateway"`
 	Clawdbot      ClawdbotConfig      `yaml:"clawdbot"`
 	Adapters      AdaptersConfig      `yaml:"adapters"`
 	Session       SessionConfig       `yaml:"session"`
 	Observability ObservabilityConfig `yaml:"observability"`
+	Security      SecurityConfig      `yaml:"security"`
 	// IMWebhook is the configuration for notifying external IM systems
 	IMWebhook IMWebhookConfig `yaml:"im_webhook"`
+	// Attachments is the configuration for re-hosting inbound attachments
+	Attachments AttachmentsConfig `yaml:"attachments"`
 }
 
 // ServerConfig holds HTTP server configuration.
@@ -28,6 +38,250 @@ type ServerConfig struct {
 	ReadTimeout     time.Duration `yaml:"read_timeout"`
 	WriteTimeout    time.Duration `yaml:"write_timeout"`
 	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// AdminToken protects admin/debug endpoints (Authorization: Bearer <token>).
+	// Admin endpoints are disabled when empty.
+	AdminToken string `yaml:"admin_token"`
+	// TLS enables HTTPS when cert_file and key_file are set (plain HTTP otherwise).
+	TLS TLSConfig `yaml:"tls"`
+	// MaxBodySize is the default request body limit in bytes for webhook-style endpoints
+	MaxBodySize int64 `yaml:"max_body_size"`
+	// Endpoints overrides the body limit and sets a handler timeout per path
+	Endpoints map[string]EndpointConfig `yaml:"endpoints"`
+	// CORS allows browser clients on other origins (same-origin only by default)
+	CORS CORSConfig `yaml:"cors"`
+	// SelfTest runs a synthetic event through the pipeline at startup and exits if any stage fails
+	SelfTest bool `yaml:"selftest"`
+	// SelfTestTimeout bounds the whole self-test
+	SelfTestTimeout time.Duration `yaml:"selftest_timeout"`
+	// OpenAI serves an OpenAI-compatible /v1/chat/completions API
+	OpenAI OpenAIConfig `yaml:"openai_api"`
+}
+
+// OpenAIConfig holds the OpenAI-compatible inbound API settings.
+type OpenAIConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// APIKeys are the accepted bearer keys; each key gets its own session
+	APIKeys []string `yaml:"api_keys"`
+	// Model is the model name reported to clients (default "uip-gateway")
+	Model string `yaml:"model"`
+	// ForwardModel passes the request's model to OpenClaw instead of the configured one
+	ForwardModel bool `yaml:"forward_model"`
+}
+
+// CORSConfig holds cross-origin access settings for the HTTP API and local adapter.
+type CORSConfig struct {
+	// AllowedOrigins lists origins allowed to call the gateway; "*" allows any
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// AllowedMethods are the methods preflights may request (default GET, POST, OPTIONS)
+	AllowedMethods []string `yaml:"allowed_methods"`
+	// AllowedHeaders are the headers preflights may request (default Content-Type, Authorization)
+	AllowedHeaders []string `yaml:"allowed_headers"`
+	// AllowCredentials lets browsers send cookies and Authorization headers
+	AllowCredentials bool `yaml:"allow_credentials"`
+	// MaxAge is how long browsers may cache a preflight response
+	MaxAge time.Duration `yaml:"max_age"`
+	// Permissive allows every origin, method and header, for development
+	Permissive bool `yaml:"permissive"`
+}
+
+// EndpointConfig holds per-endpoint request limits.
+type EndpointConfig struct {
+	// MaxBodySize overrides server.max_body_size for this endpoint
+	MaxBodySize int64 `yaml:"max_body_size"`
+	// Timeout bounds handler execution (503 when exceeded); 0 relies on the server timeouts
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// Endpoint returns the effective limits for an HTTP path.
+func (s ServerConfig) Endpoint(path string) EndpointConfig {
+	ep := s.Endpoints[path]
+	if ep.MaxBodySize <= 0 {
+		ep.MaxBodySize = s.MaxBodySize
+	}
+	return ep
+}
+
+// TLSConfig holds HTTPS and mTLS settings for the gateway HTTP server.
+// Certificates are reloaded on SIGHUP.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientCAFile enables mTLS: clients must present a certificate signed by this CA bundle
+	ClientCAFile string `yaml:"client_ca_file"`
+	// AllowedClientCNs restricts mTLS clients to these certificate common names
+	AllowedClientCNs []string `yaml:"allowed_client_cns"`
+}
+
+// Enabled reports whether the server should serve HTTPS.
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// GatewayConfig holds event processing configuration.
+type GatewayConfig struct {
+	// WorkerCount is the initial number of event workers
+	WorkerCount int `yaml:"worker_count"`
+	// QueueSize is the event queue buffer size
+	QueueSize int `yaml:"queue_size"`
+	// Mode is "async" (replies via SendIntent) or "sync" (adapters that support it reply inline)
+	Mode string `yaml:"mode"`
+	// SerializePerSession processes each conversation's events in order, one at a time
+	SerializePerSession bool `yaml:"serialize_per_session"`
+	// WorkerAffinity routes each conversation to one worker's own queue, ordering it without serialization
+	WorkerAffinity bool `yaml:"worker_affinity"`
+	// QueueFullPolicy is "drop_new" (default), "drop_old" or "block"
+	QueueFullPolicy string `yaml:"queue_full_policy"`
+	// EnqueueTimeout bounds how long the "block" policy waits for queue room
+	EnqueueTimeout time.Duration `yaml:"enqueue_timeout"`
+	// BusyReply tells users whose messages are dropped at a full queue that the gateway is overloaded
+	BusyReply BusyReplyConfig `yaml:"busy_reply"`
+	// AutoScale configures worker pool auto-scaling
+	AutoScale AutoScaleConfig `yaml:"autoscale"`
+	// ErrorReply is the reply template used when processing fails
+	ErrorReply string `yaml:"error_reply"`
+	// TimeoutReply is the reply template used when OpenClaw times out
+	TimeoutReply string `yaml:"timeout_reply"`
+	// DefaultLocale is the locale for system messages when the event has no hint
+	DefaultLocale string `yaml:"default_locale"`
+	// CatalogPath is an optional JSON/YAML message catalog file
+	CatalogPath string `yaml:"catalog_path"`
+	// Debug configures debugging aids
+	Debug GatewayDebugConfig `yaml:"debug"`
+	// Sources configures extraction of cited sources from AI replies
+	Sources SourcesConfig `yaml:"sources"`
+	// RespondOnlyWhenMentioned ignores group/channel messages that do not mention the bot
+	RespondOnlyWhenMentioned bool `yaml:"respond_only_when_mentioned"`
+	// RespondToEdits re-answers edited messages, updating the earlier reply where supported
+	RespondToEdits bool `yaml:"respond_to_edits"`
+	// ForwardReactions sends emoji reactions to OpenClaw as reaction events
+	ForwardReactions bool `yaml:"forward_reactions"`
+	// DedupWindow drops platform redeliveries of an inbound event seen this recently (0 = off)
+	DedupWindow time.Duration `yaml:"dedup_window"`
+	// DedupWindows overrides DedupWindow by adapter name
+	DedupWindows map[string]time.Duration `yaml:"dedup_windows"`
+	// DryRun processes events normally but logs the replies instead of sending them
+	DryRun bool `yaml:"dry_run"`
+	// CrashOnPanic exits on a panic in event processing instead of recovering the worker
+	CrashOnPanic bool `yaml:"crash_on_panic"`
+	// Filters drops events by channel or user before they reach Clawdbot
+	Filters FiltersConfig `yaml:"filters"`
+	// Preprocess cleans up inbound text (bot mentions, commands, whitespace) before it reaches Clawdbot
+	Preprocess PreprocessConfig `yaml:"preprocess"`
+	// ContentFilter redacts or blocks AI replies before they reach users
+	ContentFilter ContentFilterConfig `yaml:"content_filter"`
+	// Ignore lists message patterns the bot stays silent on, e.g. "//" notes to self
+	Ignore []IgnoreRuleConfig `yaml:"ignore"`
+	// ConversationCapabilities overrides adapter capabilities by adapter name, then conversation type
+	ConversationCapabilities map[string]protocol.ConversationCapabilities `yaml:"conversation_capabilities"`
+}
+
+// PreprocessConfig holds inbound text preprocessing configuration.
+type PreprocessConfig struct {
+	// StripPrefix removes leading mentions of the bot ("<@id>", "@name", "name:")
+	StripPrefix bool `yaml:"strip_prefix"`
+	// BotNames lists the user IDs and display names the bot is addressed by
+	BotNames []string `yaml:"bot_names"`
+	// Commands lists command triggers removed from the start of the text, e.g. "/ask"
+	Commands []string `yaml:"commands"`
+	// NormalizeUnicode folds full-width characters and Unicode spaces and drops zero-width spaces
+	NormalizeUnicode bool `yaml:"normalize_unicode"`
+	// Trim removes surrounding whitespace
+	Trim bool `yaml:"trim"`
+}
+
+// ContentFilterConfig holds reply content filter configuration.
+type ContentFilterConfig struct {
+	// Redact lists rules whose matches are replaced in reply text
+	Redact []RedactRuleConfig `yaml:"redact"`
+	// Block lists regular expressions; a matching reply is replaced by BlockedMessage
+	Block []string `yaml:"block"`
+	// BlockedMessage replaces blocked replies; empty uses the localized default
+	BlockedMessage string `yaml:"blocked_message"`
+}
+
+// RedactRuleConfig is one redaction rule.
+type RedactRuleConfig struct {
+	// Name labels the rule in logs; "email" and "phone" have built-in patterns
+	Name string `yaml:"name"`
+	// Pattern is a Go regular expression; optional for the built-in names
+	Pattern string `yaml:"pattern"`
+	// Replacement replaces each match, default "[redacted]"
+	Replacement string `yaml:"replacement"`
+}
+
+// IgnoreRuleConfig is one ignore rule.
+type IgnoreRuleConfig struct {
+	// Pattern is the text to match, or a Go regular expression with match "regex"
+	Pattern string `yaml:"pattern"`
+	// Match is "prefix" (default), "contains" or "regex"
+	Match string `yaml:"match"`
+	// IgnoreCase matches case-insensitively
+	IgnoreCase bool `yaml:"ignore_case"`
+}
+
+// FiltersConfig holds inbound event filter configuration.
+type FiltersConfig struct {
+	// AllowChannels, when non-empty, only answers channels matching one of these globs
+	AllowChannels []string `yaml:"allow_channels"`
+	// DenyChannels never answers channels matching these globs; deny wins over allow
+	DenyChannels []string `yaml:"deny_channels"`
+	// AllowUsers, when non-empty, only answers users matching one of these globs
+	AllowUsers []string `yaml:"allow_users"`
+	// DenyUsers never answers users matching these globs; deny wins over allow
+	DenyUsers []string `yaml:"deny_users"`
+	// DropBots drops bot-authored messages: "groups" (default), "all" or "none"
+	DropBots string `yaml:"drop_bots"`
+	// AllowBots lists bot user ID globs that are never dropped as bots
+	AllowBots []string `yaml:"allow_bots"`
+	// LogDropped logs every filtered event
+	LogDropped bool `yaml:"log_dropped"`
+}
+
+// SourcesConfig holds source extraction configuration.
+type SourcesConfig struct {
+	// Enabled lifts source references into intent content.sources for adapters that render them
+	Enabled bool `yaml:"enabled"`
+	// Patterns are regexes with a (?P<url>...) and optional (?P<title>...) group; empty uses the default
+	Patterns []string `yaml:"patterns"`
+	// JSONBlock also lifts a trailing {"sources": [...]} JSON block
+	JSONBlock bool `yaml:"json_block"`
+}
+
+// GatewayDebugConfig holds gateway debugging configuration.
+type GatewayDebugConfig struct {
+	// RecentEvents is the size of the recent-events ring buffer (0 disables)
+	RecentEvents int `yaml:"recent_events"`
+	// SampleRate is the fraction of events (0-1) copied to the debug tap (0 disables)
+	SampleRate float64 `yaml:"sample_rate"`
+	// TapURL receives each tapped event and its intents as a JSON POST
+	TapURL string `yaml:"tap_url"`
+	// TapFile receives tapped events as JSON lines, when TapURL is empty
+	TapFile string `yaml:"tap_file"`
+}
+
+// BusyReplyConfig holds the reply sent for events dropped at a full queue.
+type BusyReplyConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Message overrides the busy_reply catalog message (same placeholders as error_reply)
+	Message string `yaml:"message"`
+	// Interval is the least time between busy replies to one session (default 1m)
+	Interval time.Duration `yaml:"interval"`
+}
+
+// AutoScaleConfig holds worker pool auto-scaling configuration.
+type AutoScaleConfig struct {
+	// Enabled turns on auto-scaling between MinWorkers and MaxWorkers
+	Enabled bool `yaml:"enabled"`
+	// MinWorkers is the lower bound of the pool (defaults to worker_count)
+	MinWorkers int `yaml:"min_workers"`
+	// MaxWorkers is the upper bound of the pool
+	MaxWorkers int `yaml:"max_workers"`
+	// ScaleUpDepth is the queue depth above which workers are added
+	ScaleUpDepth int `yaml:"scale_up_depth"`
+	// ScaleDownDepth is the queue depth below which idle workers are retired
+	ScaleDownDepth int `yaml:"scale_down_depth"`
+	// Interval is how often the queue depth is sampled
+	Interval time.Duration `yaml:"interval"`
 }
 
 // ClawdbotConfig holds OpenClaw client configuration.
@@ -35,7 +289,18 @@ type ClawdbotConfig struct {
 	Endpoint    string            `yaml:"endpoint"`
 	Timeout     time.Duration     `yaml:"timeout"`
 	RetryPolicy RetryPolicyConfig `yaml:"retry_policy"`
-	Insecure    bool              `yaml:"insecure"`
+	// Insecure skips TLS certificate verification (local dev only)
+	Insecure bool `yaml:"insecure"`
+	// MaxIdleConns and MaxIdleConnsPerHost cap the idle connections kept for reuse
+	MaxIdleConns        int `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+	// IdleConnTimeout closes connections idle this long
+	IdleConnTimeout time.Duration `yaml:"idle_conn_timeout"`
+	// MaxConnLifetime retires connections this old after their current request (0 = no limit).
+	// Setting it turns HTTP/2 off for OpenClaw requests.
+	MaxConnLifetime time.Duration `yaml:"max_conn_lifetime"`
+	// MaxConcurrent caps OpenClaw requests in flight; the rest wait up to the processing timeout (0 = unlimited)
+	MaxConcurrent int `yaml:"max_concurrent"`
 	// OpenClaw Universal IM configuration
 	Mode        string `yaml:"mode"`         // "openclaw" (universal-im) or "legacy"
 	Token       string `yaml:"token"`        // Legacy: Auth token
@@ -54,6 +319,8 @@ type UniversalIMConfig struct {
 	WebhookPath string `yaml:"webhook_path"`
 	// Secret is the webhook secret for X-Webhook-Secret header authentication
 	Secret string `yaml:"secret"`
+	// Accounts routes events to several universal-im accounts (overrides account_id/secret/webhook_path)
+	Accounts []UniversalIMAccountConfig `yaml:"accounts"`
 	// Transport is the transport type: "webhook", "websocket", or "polling"
 	Transport string `yaml:"transport"`
 	// WebSocket configuration (for transport: websocket)
@@ -64,22 +331,87 @@ type UniversalIMConfig struct {
 	OutboundURL string `yaml:"outbound_url"`
 	// OutboundAuthHeader is the Authorization header value for outbound requests
 	OutboundAuthHeader string `yaml:"outbound_auth_header"`
+	// OutboundSecret enables HMAC signature verification of outbound requests
+	OutboundSecret string `yaml:"outbound_secret"`
+	// SignatureTolerance is the max timestamp skew accepted for signed requests
+	SignatureTolerance time.Duration `yaml:"signature_tolerance"`
+	// PendingReply is the placeholder reply sent while waiting for the async outbound callback
+	PendingReply string `yaml:"pending_reply"`
+	// SessionContextTTL is how long routing info is kept waiting for an async outbound callback
+	SessionContextTTL time.Duration `yaml:"session_context_ttl"`
+	// MaxPendingContexts caps routing contexts per account, evicting the oldest (0: default, -1: no limit)
+	MaxPendingContexts int `yaml:"max_pending_contexts"`
+	// Model is the Chat Completions model name (per-event override: the event's meta.model)
+	Model string `yaml:"model"`
+	// SystemPrompt sets the Chat Completions persona globally, per adapter or per channel prefix
+	SystemPrompt SystemPromptConfig `yaml:"system_prompt"`
+	// Generation holds default temperature/max_tokens/top_p (per-event override: meta.generation)
+	Generation protocol.GenerationParams `yaml:"generation"`
+	// MaxContinuations is how many "continue" requests follow a truncated Chat Completions reply (0 disables)
+	MaxContinuations int `yaml:"max_continuations"`
+	// ContinuePrompt is the user message sent to continue a truncated reply
+	ContinuePrompt string `yaml:"continue_prompt"`
+	// TargetKinds are the callback "to" prefixes (default: user, channel, group); the rest is the ID
+	TargetKinds []string `yaml:"target_kinds"`
+}
+
+// SystemPromptConfig holds system prompts; the most specific match is used.
+type SystemPromptConfig struct {
+	// Default is the prompt when no adapter or channel prompt matches
+	Default string `yaml:"default"`
+	// Adapters maps adapter names to prompts
+	Adapters map[string]string `yaml:"adapters"`
+	// Channels map channelId prefixes to prompts; the longest matching prefix wins
+	Channels []ChannelPromptConfig `yaml:"channels"`
+}
+
+// ChannelPromptConfig is the system prompt for a channelId prefix.
+type ChannelPromptConfig struct {
+	Prefix string `yaml:"prefix"`
+	Prompt string `yaml:"prompt"`
+}
+
+// UniversalIMAccountConfig is one OpenClaw universal-im account. Events go to
+// the first account whose rules match; an account without rules matches all.
+type UniversalIMAccountConfig struct {
+	// ID is the account identifier in OpenClaw config
+	ID string `yaml:"id"`
+	// Secret is the account's webhook secret
+	Secret string `yaml:"secret"`
+	// WebhookPath overrides the default "/universal-im/{id}/webhook" path
+	WebhookPath string `yaml:"webhook_path"`
+	// ConversationTypes selects events by conversation type (direct, group, channel, thread)
+	ConversationTypes []string `yaml:"conversation_types"`
+	// ChannelPrefixes selects events whose channelId starts with one of the prefixes
+	ChannelPrefixes []string `yaml:"channel_prefixes"`
 }
 
 // WebSocketConfig holds WebSocket transport configuration.
 type WebSocketConfig struct {
-	// URL is the WebSocket server URL to connect to
+	// URL, when set, makes the gateway dial this WebSocket server instead of waiting for OpenClaw to connect
 	URL string `yaml:"url"`
-	// ReconnectMs is the reconnection interval in milliseconds
+	// ReconnectMs caps the client's reconnect backoff in milliseconds
 	ReconnectMs int `yaml:"reconnect_ms"`
+	// Server tunes the gateway's /api/v1/openclaw/ws endpoint
+	Server WebSocketTuningConfig `yaml:"server"`
+	// AuthToken is the shared secret clients must present to connect to /api/v1/openclaw/ws;
+	// with URL set, the gateway presents it to the server as a bearer token
+	AuthToken string `yaml:"auth_token"`
 }
 
 // PollingConfig holds Polling transport configuration.
 type PollingConfig struct {
-	// URL is the HTTP endpoint to poll for messages
+	// URL, when set, makes the gateway poll this endpoint (GET ?since=) and POST sent messages to it
 	URL string `yaml:"url"`
-	// IntervalMs is the polling interval in milliseconds
+	// IntervalMs is the client's polling interval in milliseconds
 	IntervalMs int `yaml:"interval_ms"`
+	// DefaultLimit is the page size for polls without a limit parameter
+	DefaultLimit int `yaml:"default_limit"`
+	// MaxLimit caps the limit parameter of a poll
+	MaxLimit int `yaml:"max_limit"`
+	// AuthToken is the shared secret required on the poll and inbound endpoints;
+	// with URL set, the gateway presents it to the server as a bearer token
+	AuthToken string `yaml:"auth_token"`
 }
 
 // RetryPolicyConfig holds retry policy configuration.
@@ -95,12 +427,33 @@ type AdaptersConfig struct {
 	Local  LocalAdapterConfig  `yaml:"local"`
 	Slack  SlackAdapterConfig  `yaml:"slack"`
 	WeChat WeChatAdapterConfig `yaml:"wechat"`
+	Matrix MatrixAdapterConfig `yaml:"matrix"`
 }
 
 // LocalAdapterConfig holds local adapter configuration.
 type LocalAdapterConfig struct {
 	Enabled  bool   `yaml:"enabled"`
 	HTTPPath string `yaml:"http_path"`
+	// Formatter is an optional outbound formatter: telegram_markdownv2, slack or slack_blocks
+	Formatter string `yaml:"formatter"`
+	// WebSocket tunes the adapter's /ws endpoint
+	WebSocket WebSocketTuningConfig `yaml:"websocket"`
+	// BotUserID is the bot's user ID, used to detect mentions of the bot
+	BotUserID string `yaml:"bot_user_id"`
+	// SendBufferSize is the number of replies queued per WebSocket connection
+	SendBufferSize int `yaml:"send_buffer_size"`
+	// SendTimeout is how long a reply waits for room in a full buffer before it is dropped (0 drops at once)
+	SendTimeout time.Duration `yaml:"send_timeout"`
+}
+
+// WebSocketTuningConfig holds WebSocket upgrader settings.
+type WebSocketTuningConfig struct {
+	// ReadBufferSize is the per-connection read buffer in bytes (default 1024)
+	ReadBufferSize int `yaml:"read_buffer_size"`
+	// WriteBufferSize is the per-connection write buffer in bytes; larger messages are split into frames
+	WriteBufferSize int `yaml:"write_buffer_size"`
+	// EnableCompression negotiates permessage-deflate with clients that support it
+	EnableCompression bool `yaml:"enable_compression"`
 }
 
 // IMWebhookConfig holds the configuration for notifying external IM systems.
@@ -113,8 +466,56 @@ type IMWebhookConfig struct {
 	AuthHeader string `yaml:"auth_header"`
 	// Timeout is the request timeout
 	Timeout time.Duration `yaml:"timeout"`
+	// DeliveryTimeout bounds a whole delivery including retries (default: timeout)
+	DeliveryTimeout time.Duration `yaml:"delivery_timeout"`
 	// RetryCount is the number of retry attempts
 	RetryCount int `yaml:"retry_count"`
+	// MaxInterval caps the delay between retries, including Retry-After hints
+	MaxInterval time.Duration `yaml:"max_interval"`
+	// TrackedDeliveries is how many recent messages are kept to match delivery receipts
+	TrackedDeliveries int `yaml:"tracked_deliveries"`
+	// Queue persists outbound messages and retries them until delivered
+	Queue IMWebhookQueueConfig `yaml:"queue"`
+}
+
+// IMWebhookQueueConfig holds the durable outbound queue configuration.
+type IMWebhookQueueConfig struct {
+	// Enabled queues outbound messages on disk instead of retrying inline
+	Enabled bool `yaml:"enabled"`
+	// Dir is the directory holding pending messages
+	Dir string `yaml:"dir"`
+	// MaxAge is how long a message is retried before it is dropped
+	MaxAge time.Duration `yaml:"max_age"`
+	// MaxBackoff caps the delay between attempts
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+// AttachmentsConfig holds the inbound attachment proxy configuration.
+type AttachmentsConfig struct {
+	// Enabled downloads inbound attachments and serves them from the gateway
+	Enabled bool `yaml:"enabled"`
+	// PublicURL is the gateway base URL reachable by OpenClaw
+	PublicURL string `yaml:"public_url"`
+	// MaxSize is the maximum attachment size in bytes, for kinds without their own limit
+	MaxSize int64 `yaml:"max_size"`
+	// Limits caps sizes in bytes per kind: image, audio, video, document
+	Limits map[string]int64 `yaml:"limits"`
+	// MaxTotalSize caps the bytes held by the proxy across all attachments
+	MaxTotalSize int64 `yaml:"max_total_size"`
+	// MaxItems caps the number of attachments the proxy holds
+	MaxItems int `yaml:"max_items"`
+	// AllowPrivateHosts lets the proxy download from loopback, link-local and private addresses
+	AllowPrivateHosts bool `yaml:"allow_private_hosts"`
+	// Oversized is what happens to inbound attachments over the limit: "reject" (default) or "strip"
+	Oversized string `yaml:"oversized"`
+	// TTL is how long a re-hosted attachment remains available
+	TTL time.Duration `yaml:"ttl"`
+}
+
+// SizeLimits returns the per-kind attachment size limits, with MaxSize as
+// the default.
+func (c AttachmentsConfig) SizeLimits() attachment.Limits {
+	return attachment.Limits{Default: c.MaxSize, Kinds: c.Limits}
 }
 
 // SlackAdapterConfig holds Slack adapter configuration.
@@ -129,11 +530,59 @@ type WeChatAdapterConfig struct {
 	WebhookPath string `yaml:"webhook_path"`
 }
 
+// MatrixAdapterConfig holds Matrix adapter configuration.
+type MatrixAdapterConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// HomeserverURL is the client-server API base, e.g. "https://matrix.org"
+	HomeserverURL string `yaml:"homeserver_url"`
+	// AccessToken authenticates the bot account
+	AccessToken string `yaml:"access_token"`
+	// UserID is the bot's Matrix ID; looked up with /account/whoami when empty
+	UserID string `yaml:"user_id"`
+	// SyncTimeout is the /sync long-poll timeout (default 30s)
+	SyncTimeout time.Duration `yaml:"sync_timeout"`
+	// StateFile persists the sync batch token across restarts
+	StateFile string `yaml:"state_file"`
+}
+
 // SessionConfig holds session management configuration.
 type SessionConfig struct {
 	TTL             time.Duration `yaml:"ttl"`
 	MaxSessions     int           `yaml:"max_sessions"`
 	CleanupInterval time.Duration `yaml:"cleanup_interval"`
+	// KeyStrategy decides which events share a conversation context:
+	// per-session (default), per-user, per-channel, per-user-per-channel, per-thread
+	KeyStrategy string `yaml:"key_strategy"`
+	// AskTimeout is how long the answer to an ask intent is awaited (default 10m)
+	AskTimeout time.Duration `yaml:"ask_timeout"`
+	// History keeps conversation history for the Chat Completions fallback
+	History HistoryConfig `yaml:"history"`
+}
+
+// HistoryConfig holds conversation history configuration.
+type HistoryConfig struct {
+	// Enabled sends earlier turns with each Chat Completions request; "/reset" clears them
+	Enabled bool `yaml:"enabled"`
+	// Store is where history is kept: memory
+	Store string `yaml:"store"`
+	// Strategy prunes each conversation: turns, tokens or window
+	Strategy string `yaml:"strategy"`
+	// Limit is the strategy's bound: user turns, estimated tokens, or messages
+	Limit int `yaml:"limit"`
+}
+
+// SecurityConfig holds request verification configuration.
+type SecurityConfig struct {
+	Replay ReplayConfig `yaml:"replay"`
+}
+
+// ReplayConfig holds replay protection for signed inbound webhooks.
+type ReplayConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Window is the accepted timestamp skew; nonces are remembered this long
+	Window time.Duration `yaml:"window"`
+	// CacheSize bounds the number of remembered nonces
+	CacheSize int `yaml:"cache_size"`
 }
 
 // ObservabilityConfig holds observability configuration.
@@ -141,6 +590,8 @@ type ObservabilityConfig struct {
 	Tracing     bool   `yaml:"tracing"`
 	MetricsPort int    `yaml:"metrics_port"`
 	LogLevel    string `yaml:"log_level"`
+	// FinalScrapeWait keeps the metrics server up at shutdown until Prometheus scrapes the final values, at most this long (0 = stop at once)
+	FinalScrapeWait time.Duration `yaml:"final_scrape_wait"`
 }
 
 // DefaultConfig returns the default configuration.
@@ -153,6 +604,27 @@ func DefaultConfig() *Config {
 			ReadTimeout:     30 * time.Second,
 			WriteTimeout:    30 * time.Second,
 			ShutdownTimeout: 10 * time.Second,
+			MaxBodySize:     1 << 20,
+			SelfTestTimeout: 60 * time.Second,
+		},
+		Gateway: GatewayConfig{
+			WorkerCount:     10,
+			QueueSize:       1000,
+			Mode:            "async",
+			QueueFullPolicy: "drop_new",
+			EnqueueTimeout:  5 * time.Second,
+			BusyReply:       BusyReplyConfig{Interval: time.Minute},
+			DefaultLocale:   "en",
+			AutoScale: AutoScaleConfig{
+				Enabled:        false,
+				MaxWorkers:     50,
+				ScaleUpDepth:   100,
+				ScaleDownDepth: 1,
+				Interval:       time.Second,
+			},
+			Sources: SourcesConfig{
+				JSONBlock: true,
+			},
 		},
 		Clawdbot: ClawdbotConfig{
 			Endpoint: "http://localhost:18789", // OpenClaw gateway default port
@@ -163,17 +635,25 @@ func DefaultConfig() *Config {
 				InitialInterval: 100 * time.Millisecond,
 				MaxInterval:     5 * time.Second,
 			},
-			Insecure:    true,
-			Mode:        "openclaw",                                       // Use OpenClaw universal-im
-			CallbackURL: "http://localhost:8080/api/v1/openclaw/outbound", // Our outbound URL
+			MaxIdleConns:        clawdbot.DefaultMaxIdleConns,
+			MaxIdleConnsPerHost: clawdbot.DefaultMaxIdleConnsPerHost,
+			IdleConnTimeout:     clawdbot.DefaultIdleConnTimeout,
+			Mode:                "openclaw",                                       // Use OpenClaw universal-im
+			CallbackURL:         "http://localhost:8080/api/v1/openclaw/outbound", // Our outbound URL
 			UniversalIM: UniversalIMConfig{
 				AccountID:          "default",
 				Transport:          "webhook", // Default to webhook transport
 				Secret:             "",        // Webhook secret (X-Webhook-Secret)
 				OutboundURL:        "http://localhost:8080/api/v1/openclaw/outbound",
 				OutboundAuthHeader: "", // Optional auth header for outbound
+				OutboundSecret:     "", // Optional HMAC secret for outbound signatures
+				SignatureTolerance: 5 * time.Minute,
+				Model:              "default",
 				WebSocket: WebSocketConfig{
 					ReconnectMs: 5000,
+					Server: WebSocketTuningConfig{
+						EnableCompression: true,
+					},
 				},
 				Polling: PollingConfig{
 					IntervalMs: 5000,
@@ -184,6 +664,10 @@ func DefaultConfig() *Config {
 			Local: LocalAdapterConfig{
 				Enabled:  true,
 				HTTPPath: "/api/v1/local",
+				WebSocket: WebSocketTuningConfig{
+					EnableCompression: true,
+				},
+				SendBufferSize: 256,
 			},
 			Slack: SlackAdapterConfig{
 				Enabled: false,
@@ -191,63 +675,253 @@ func DefaultConfig() *Config {
 			WeChat: WeChatAdapterConfig{
 				Enabled: false,
 			},
+			Matrix: MatrixAdapterConfig{
+				Enabled:     false,
+				SyncTimeout: 30 * time.Second,
+			},
 		},
 		Session: SessionConfig{
 			TTL:             24 * time.Hour,
 			MaxSessions:     10000,
 			CleanupInterval: 5 * time.Minute,
+			KeyStrategy:     string(protocol.SessionKeySession),
+			History: HistoryConfig{
+				Enabled:  false,
+				Store:    "memory",
+				Strategy: "window",
+				Limit:    20,
+			},
 		},
 		Observability: ObservabilityConfig{
 			Tracing:     true,
 			MetricsPort: 9091,
 			LogLevel:    "info",
 		},
+		Security: SecurityConfig{
+			Replay: ReplayConfig{
+				Enabled:   true,
+				Window:    5 * time.Minute,
+				CacheSize: 100000,
+			},
+		},
 		IMWebhook: IMWebhookConfig{
-			Enabled:    false, // Disabled by default
-			URL:        "",    // Must be configured by user
-			AuthHeader: "",
-			Timeout:    10 * time.Second,
-			RetryCount: 3,
+			Enabled:           false, // Disabled by default
+			URL:               "",    // Must be configured by user
+			AuthHeader:        "",
+			Timeout:           10 * time.Second,
+			RetryCount:        3,
+			MaxInterval:       5 * time.Second,
+			TrackedDeliveries: 1000,
+			Queue: IMWebhookQueueConfig{
+				Enabled:    false,
+				Dir:        "data/im-queue",
+				MaxAge:     24 * time.Hour,
+				MaxBackoff: 5 * time.Minute,
+			},
+		},
+		Attachments: AttachmentsConfig{
+			Enabled:      false, // Opt-in
+			PublicURL:    "http://localhost:8080",
+			MaxSize:      20 << 20, // 20 MiB
+			MaxTotalSize: 256 << 20,
+			MaxItems:     1000,
+			Oversized:    "reject",
+			TTL:          15 * time.Minute,
 		},
 	}
 }
 
-// Load loads configuration from a YAML file.
-func Load(path string) (*Config, error) {
+// Load loads configuration from a YAML file. Besides the config it returns
+// the non-fatal warnings from Validate, for the caller to log.
+func Load(path string) (*Config, []string, error) {
 	cfg := DefaultConfig()
 
 	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return cfg, nil // Use defaults if file doesn't exist
+			return cfg, nil, nil // Use defaults if file doesn't exist
 		}
-		return nil, fmt.Errorf("failed to read config file: %w", err)
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
 	if err := yaml.Unmarshal(data, cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+		return nil, nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
-	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %w", err)
+	warnings, err := cfg.Validate()
+	if err != nil {
+		return nil, warnings, fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	return cfg, nil
+	return cfg, warnings, nil
 }
 
 // Validate validates the configuration.
-func (c *Config) Validate() error {
+func (c *Config) Validate() ([]string, error) {
 	if c.Server.HTTPPort <= 0 || c.Server.HTTPPort > 65535 {
-		return fmt.Errorf("invalid HTTP port: %d", c.Server.HTTPPort)
+		return nil, fmt.Errorf("invalid HTTP port: %d", c.Server.HTTPPort)
+	}
+
+	if tls := c.Server.TLS; tls.Enabled() {
+		if tls.CertFile == "" || tls.KeyFile == "" {
+			return nil, fmt.Errorf("server tls requires both cert_file and key_file")
+		}
+	}
+	if len(c.Server.TLS.AllowedClientCNs) > 0 && c.Server.TLS.ClientCAFile == "" {
+		return nil, fmt.Errorf("server tls allowed_client_cns requires client_ca_file")
 	}
 
 	if c.Clawdbot.Endpoint == "" {
-		return fmt.Errorf("clawdbot endpoint is required")
+		return nil, fmt.Errorf("clawdbot endpoint is required")
 	}
 
 	if c.Clawdbot.Timeout <= 0 {
-		return fmt.Errorf("clawdbot timeout must be positive")
+		return nil, fmt.Errorf("clawdbot timeout must be positive")
+	}
+
+	seenAccounts := make(map[string]bool)
+	for i, account := range c.Clawdbot.UniversalIM.Accounts {
+		if account.ID == "" {
+			return nil, fmt.Errorf("clawdbot universal_im accounts[%d]: id is required", i)
+		}
+		if seenAccounts[account.ID] {
+			return nil, fmt.Errorf("clawdbot universal_im accounts: duplicate id %q", account.ID)
+		}
+		seenAccounts[account.ID] = true
+	}
+
+	for name, ws := range map[string]WebSocketTuningConfig{
+		"adapters local websocket":               c.Adapters.Local.WebSocket,
+		"clawdbot universal_im websocket server": c.Clawdbot.UniversalIM.WebSocket.Server,
+	} {
+		if ws.ReadBufferSize < 0 || ws.WriteBufferSize < 0 {
+			return nil, fmt.Errorf("%s buffer sizes must not be negative", name)
+		}
+	}
+
+	if c.Clawdbot.UniversalIM.Polling.DefaultLimit < 0 || c.Clawdbot.UniversalIM.Polling.MaxLimit < 0 {
+		return nil, fmt.Errorf("clawdbot universal_im polling limits must not be negative")
+	}
+
+	if c.Clawdbot.Mode == "openclaw" && c.Clawdbot.UniversalIM.Model == "" {
+		return nil, fmt.Errorf("clawdbot universal_im model must not be empty")
+	}
+
+	if err := c.Clawdbot.UniversalIM.Generation.Validate(); err != nil {
+		return nil, fmt.Errorf("clawdbot universal_im generation: %w", err)
+	}
+
+	if c.Clawdbot.UniversalIM.MaxContinuations < 0 {
+		return nil, fmt.Errorf("clawdbot universal_im max_continuations must not be negative")
+	}
+
+	if c.IMWebhook.Queue.Enabled {
+		if c.IMWebhook.Queue.Dir == "" {
+			return nil, fmt.Errorf("im_webhook queue dir is required")
+		}
+		if c.IMWebhook.Queue.MaxAge <= 0 || c.IMWebhook.Queue.MaxBackoff <= 0 {
+			return nil, fmt.Errorf("im_webhook queue max_age and max_backoff must be positive")
+		}
+	}
+
+	if h := c.Session.History; h.Enabled {
+		if h.Store != "" && h.Store != "memory" {
+			return nil, fmt.Errorf("session history store must be \"memory\", got %q", h.Store)
+		}
+		if _, err := history.NewPruner(h.Strategy, h.Limit); err != nil {
+			return nil, fmt.Errorf("session history: %w", err)
+		}
 	}
 
-	return nil
+	if c.Gateway.WorkerCount <= 0 {
+		return nil, fmt.Errorf("gateway worker_count must be positive")
+	}
+
+	switch c.Gateway.QueueFullPolicy {
+	case "", "drop_new", "drop_old", "block":
+	default:
+		return nil, fmt.Errorf("gateway queue_full_policy must be drop_new, drop_old or block, got %q", c.Gateway.QueueFullPolicy)
+	}
+
+	if c.Gateway.Mode != "" && c.Gateway.Mode != "async" && c.Gateway.Mode != "sync" {
+		return nil, fmt.Errorf("gateway mode must be \"async\" or \"sync\", got %q", c.Gateway.Mode)
+	}
+
+	for name, caps := range c.Gateway.ConversationCapabilities {
+		if err := caps.Validate(); err != nil {
+			return nil, fmt.Errorf("gateway conversation_capabilities %s: %w", name, err)
+		}
+	}
+
+	if _, err := protocol.SessionKeyFuncFor(protocol.SessionKeyStrategy(c.Session.KeyStrategy)); err != nil {
+		return nil, fmt.Errorf("session key_strategy: %w", err)
+	}
+
+	if c.Gateway.AutoScale.Enabled && c.Gateway.AutoScale.MaxWorkers < c.Gateway.WorkerCount {
+		return nil, fmt.Errorf("gateway autoscale max_workers (%d) must be >= worker_count (%d)",
+			c.Gateway.AutoScale.MaxWorkers, c.Gateway.WorkerCount)
+	}
+
+	switch c.Clawdbot.UniversalIM.Transport {
+	case "", "webhook", "websocket", "polling":
+	default:
+		return nil, fmt.Errorf("clawdbot universal_im transport must be webhook, websocket or polling, got %q", c.Clawdbot.UniversalIM.Transport)
+	}
+
+	switch c.Attachments.Oversized {
+	case "", "reject", "strip":
+	default:
+		return nil, fmt.Errorf("attachments oversized must be reject or strip, got %q", c.Attachments.Oversized)
+	}
+	if err := c.Attachments.SizeLimits().Validate(); err != nil {
+		return nil, fmt.Errorf("attachments limits: %w", err)
+	}
+	if c.Attachments.MaxTotalSize < 0 || c.Attachments.MaxItems < 0 {
+		return nil, fmt.Errorf("attachments max_total_size and max_items must not be negative")
+	}
+
+	if c.Server.OpenAI.Enabled && len(c.Server.OpenAI.APIKeys) == 0 {
+		return nil, fmt.Errorf("server openai_api api_keys is required when enabled")
+	}
+
+	if c.Adapters.Local.SendBufferSize < 0 || c.Adapters.Local.SendTimeout < 0 {
+		return nil, fmt.Errorf("adapters local send_buffer_size and send_timeout must not be negative")
+	}
+	if c.Adapters.Local.Enabled && !strings.HasPrefix(c.Adapters.Local.HTTPPath, "/") {
+		return nil, fmt.Errorf("adapters local http_path must start with \"/\", got %q", c.Adapters.Local.HTTPPath)
+	}
+	if c.Adapters.Slack.Enabled && c.Adapters.Slack.WebhookPath == "" {
+		return nil, fmt.Errorf("adapters slack webhook_path is required when enabled")
+	}
+	if c.Adapters.WeChat.Enabled && c.Adapters.WeChat.WebhookPath == "" {
+		return nil, fmt.Errorf("adapters wechat webhook_path is required when enabled")
+	}
+	if c.Adapters.Matrix.Enabled && (c.Adapters.Matrix.HomeserverURL == "" || c.Adapters.Matrix.AccessToken == "") {
+		return nil, fmt.Errorf("adapters matrix homeserver_url and access_token are required when enabled")
+	}
+
+	return c.warnings(), nil
+}
+
+// warnings reports settings that are valid but probably not what was meant.
+func (c *Config) warnings() []string {
+	var warnings []string
+	im := c.Clawdbot.UniversalIM
+
+	if c.Clawdbot.Mode == "openclaw" {
+		if (im.Transport == "" || im.Transport == "webhook") && im.Secret == "" && len(im.Accounts) == 0 {
+			warnings = append(warnings, "clawdbot universal_im transport is webhook but secret is empty; requests to OpenClaw are unauthenticated")
+		}
+		if im.AccountID == "" && len(im.Accounts) == 0 {
+			warnings = append(warnings, "clawdbot universal_im account_id is empty; the \"default\" account is used")
+		}
+	}
+	if c.Clawdbot.CallbackURL != "" && im.OutboundURL != "" && c.Clawdbot.CallbackURL != im.OutboundURL {
+		warnings = append(warnings, fmt.Sprintf("clawdbot callback_url (%s) and universal_im outbound_url (%s) differ; OpenClaw posts replies to only one of them",
+			c.Clawdbot.CallbackURL, im.OutboundURL))
+	}
+	if c.IMWebhook.Enabled && c.IMWebhook.URL == "" {
+		warnings = append(warnings, "im_webhook is enabled but url is empty; AI responses will not be forwarded")
+	}
+	return warnings
 }
@@ -0,0 +1,183 @@
+// Package cors lets browser clients on other origins call the gateway's
+// HTTP API and open WebSockets to it.
+//
+// Handler wraps the whole mux, outside any authentication, so preflight
+// OPTIONS requests are answered before auth runs: browsers never attach
+// credentials to a preflight. Actual requests still pass through the
+// wrapped handlers, auth included, and only gain the CORS response headers.
+//
+// With no allowed origins configured only same-origin requests are
+// allowed, which needs no CORS headers at all. Permissive mode allows every
+// origin and header and is meant for development.
+package cors
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/httperr"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Defaults for an empty Config.
+var (
+	DefaultMethods = []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+	DefaultHeaders = []string{"Content-Type", "Authorization"}
+)
+
+// Config configures cross-origin access.
+type Config struct {
+	// AllowedOrigins lists origins ("https://app.example.com") allowed to
+	// call the gateway. "*" allows any origin.
+	AllowedOrigins []string
+	// AllowedMethods are the methods a preflight may ask for (default DefaultMethods).
+	AllowedMethods []string
+	// AllowedHeaders are the request headers a preflight may ask for (default DefaultHeaders).
+	AllowedHeaders []string
+	// AllowCredentials lets browsers send cookies and Authorization headers.
+	// The request's origin is echoed instead of "*", as browsers require.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight response (0 leaves it to the browser).
+	MaxAge time.Duration
+	// Permissive allows every origin, method and header. For development only.
+	Permissive bool
+}
+
+// Policy is a compiled Config.
+type Policy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	methods     string
+	headers     []string
+	credentials bool
+	maxAge      string
+	permissive  bool
+}
+
+// New compiles cfg into a Policy.
+func New(cfg Config) *Policy {
+	p := &Policy{
+		origins:     make(map[string]bool, len(cfg.AllowedOrigins)),
+		credentials: cfg.AllowCredentials,
+		permissive:  cfg.Permissive,
+		anyOrigin:   cfg.Permissive,
+	}
+	for _, o := range cfg.AllowedOrigins {
+		if o == "*" {
+			p.anyOrigin = true
+			continue
+		}
+		p.origins[strings.ToLower(strings.TrimRight(o, "/"))] = true
+	}
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = DefaultMethods
+	}
+	p.methods = strings.ToUpper(strings.Join(methods, ", "))
+	headers := cfg.AllowedHeaders
+	if len(headers) == 0 {
+		headers = DefaultHeaders
+	}
+	for _, h := range headers {
+		p.headers = append(p.headers, http.CanonicalHeaderKey(h))
+	}
+	if cfg.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(cfg.MaxAge.Seconds()))
+	}
+	return p
+}
+
+// AllowOrigin reports whether a request from origin may be served: a
+// configured origin, any origin in permissive mode or with "*", or the
+// gateway's own origin (host).
+func (p *Policy) AllowOrigin(origin, host string) bool {
+	if p.anyOrigin || p.origins[strings.ToLower(origin)] {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, host)
+}
+
+// CheckOrigin is a websocket.Upgrader CheckOrigin: requests without an
+// Origin header (non-browser clients) are accepted, browsers need an
+// allowed origin.
+func (p *Policy) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || p.AllowOrigin(origin, r.Host)
+}
+
+// Handler adds CORS headers to responses for allowed origins and answers
+// preflight requests itself, without calling next.
+func (p *Policy) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !p.AllowOrigin(origin, r.Host) {
+			if preflight {
+				httperr.WriteUIPError(w, protocol.ErrCodeForbidden, "origin not allowed", "")
+				return
+			}
+			// The browser withholds the response without CORS headers
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		if p.anyOrigin && !p.credentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if p.credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		if p.permissive {
+			h.Set("Access-Control-Allow-Methods", r.Header.Get("Access-Control-Request-Method"))
+		} else {
+			h.Set("Access-Control-Allow-Methods", p.methods)
+		}
+		if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			allowed, ok := p.allowHeaders(requested)
+			if !ok {
+				httperr.WriteUIPError(w, protocol.ErrCodeForbidden, "request headers not allowed", "")
+				return
+			}
+			h.Set("Access-Control-Allow-Headers", allowed)
+		}
+		if p.maxAge != "" {
+			h.Set("Access-Control-Max-Age", p.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// allowHeaders checks the headers a preflight asks for, returning the
+// value for Access-Control-Allow-Headers.
+func (p *Policy) allowHeaders(requested string) (string, bool) {
+	if p.permissive {
+		return requested, true
+	}
+	for _, h := range strings.Split(requested, ",") {
+		h = http.CanonicalHeaderKey(strings.TrimSpace(h))
+		if h != "" && !slices.Contains(p.headers, h) {
+			return "", false
+		}
+	}
+	return strings.Join(p.headers, ", "), true
+}
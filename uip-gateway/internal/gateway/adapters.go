@@ -0,0 +1,133 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+)
+
+// ErrAdapterNotFound is returned by StartAdapter and StopAdapter for a
+// name that was never registered.
+var ErrAdapterNotFound = errors.New("adapter not found")
+
+// AdapterStatus is one registered adapter's runtime state.
+type AdapterStatus struct {
+	Name string `json:"name"`
+	// Running is false once the adapter was stopped with StopAdapter.
+	Running bool `json:"running"`
+	// Healthy is the adapter's own health check; stopped adapters are not checked.
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+}
+
+// StartAdapter starts a registered adapter that was stopped with
+// StopAdapter. Starting a running adapter is a no-op.
+func (g *Gateway) StartAdapter(ctx context.Context, name string) error {
+	g.adapterOps.Lock()
+	defer g.adapterOps.Unlock()
+
+	g.mu.RLock()
+	a, exists := g.adapters[name]
+	started, stopped := g.started, g.stopped[name]
+	g.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrAdapterNotFound, name)
+	}
+	if !started {
+		return ErrGatewayStopped
+	}
+	if !stopped {
+		return nil
+	}
+
+	if err := a.Start(ctx); err != nil {
+		g.logger.Error("Failed to start adapter",
+			zap.String("adapter", name),
+			zap.Error(err))
+		return fmt.Errorf("failed to start adapter %s: %w", name, err)
+	}
+
+	g.mu.Lock()
+	delete(g.stopped, name)
+	g.mu.Unlock()
+	g.logger.Info("Adapter started at runtime", zap.String("adapter", name))
+	return nil
+}
+
+// StopAdapter stops a registered adapter without stopping the gateway.
+// It stays registered, so StartAdapter can bring it back. Events it
+// already queued are still processed, but their replies fail to send.
+// Stopping a stopped adapter is a no-op.
+func (g *Gateway) StopAdapter(ctx context.Context, name string) error {
+	g.adapterOps.Lock()
+	defer g.adapterOps.Unlock()
+
+	g.mu.RLock()
+	a, exists := g.adapters[name]
+	started, stopped := g.started, g.stopped[name]
+	g.mu.RUnlock()
+
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrAdapterNotFound, name)
+	}
+	if !started {
+		return ErrGatewayStopped
+	}
+	if stopped {
+		return nil
+	}
+
+	if err := a.Stop(ctx); err != nil {
+		g.logger.Error("Failed to stop adapter",
+			zap.String("adapter", name),
+			zap.Error(err))
+		return fmt.Errorf("failed to stop adapter %s: %w", name, err)
+	}
+
+	g.mu.Lock()
+	g.stopped[name] = true
+	g.mu.Unlock()
+	g.logger.Info("Adapter stopped at runtime", zap.String("adapter", name))
+	return nil
+}
+
+// AdapterStatuses reports every registered adapter, sorted by name,
+// health-checking the running ones concurrently within ctx.
+func (g *Gateway) AdapterStatuses(ctx context.Context) []AdapterStatus {
+	g.mu.RLock()
+	statuses := make([]AdapterStatus, 0, len(g.adapters))
+	health := make([]func(context.Context) error, 0, len(g.adapters))
+	for name, a := range g.adapters {
+		running := g.started && !g.stopped[name]
+		statuses = append(statuses, AdapterStatus{Name: name, Running: running})
+		if running {
+			health = append(health, a.Health)
+		} else {
+			health = append(health, nil)
+		}
+	}
+	g.mu.RUnlock()
+
+	done := make(chan struct{}, len(statuses))
+	for i := range statuses {
+		if health[i] == nil {
+			done <- struct{}{}
+			continue
+		}
+		go func(i int) {
+			h := componentHealth(runHealth(ctx, health[i]))
+			statuses[i].Healthy, statuses[i].Error = h.Healthy, h.Error
+			done <- struct{}{}
+		}(i)
+	}
+	for range statuses {
+		<-done
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
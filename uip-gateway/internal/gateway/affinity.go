@@ -0,0 +1,79 @@
+package gateway
+
+import (
+	"hash/fnv"
+)
+
+// newWorkerQueues splits a queue of size events across n workers.
+func newWorkerQueues(n, size int) []chan *eventContext {
+	per := (size + n - 1) / n
+	if per < 1 {
+		per = 1
+	}
+	queues := make([]chan *eventContext, n)
+	for i := range queues {
+		queues[i] = make(chan *eventContext, per)
+	}
+	return queues
+}
+
+// queueFor returns the queue ec belongs on: its conversation's worker
+// queue under WorkerAffinity, the shared queue otherwise.
+//
+// The worker is chosen by hashing the conversation key (the key
+// SerializePerSession uses, derived from the session ID). A worker handles
+// its events one at a time, so a conversation's events run in arrival
+// order without any lock shared between workers, while different
+// conversations still spread across the pool. The price is that a slow
+// conversation holds up the others hashed to its worker.
+func (g *Gateway) queueFor(ec *eventContext) chan *eventContext {
+	if g.workerQueues == nil {
+		return g.eventQueue
+	}
+	h := fnv.New32a()
+	h.Write([]byte(g.sessionKey(ec.event)))
+	return g.workerQueues[h.Sum32()%uint32(len(g.workerQueues))]
+}
+
+// workerQueue returns the queue worker id reads from.
+func (g *Gateway) workerQueue(id int) chan *eventContext {
+	if g.workerQueues == nil {
+		return g.eventQueue
+	}
+	return g.workerQueues[id%len(g.workerQueues)]
+}
+
+// queueDepth is the number of events waiting across all queues.
+func (g *Gateway) queueDepth() int {
+	if g.workerQueues == nil {
+		return len(g.eventQueue)
+	}
+	depth := 0
+	for _, q := range g.workerQueues {
+		depth += len(q)
+	}
+	return depth
+}
+
+// queueCapacity is the total capacity of all queues.
+func (g *Gateway) queueCapacity() int {
+	if g.workerQueues == nil {
+		return cap(g.eventQueue)
+	}
+	capacity := 0
+	for _, q := range g.workerQueues {
+		capacity += cap(q)
+	}
+	return capacity
+}
+
+// closeQueues closes every queue. The caller holds queueMu for writing.
+func (g *Gateway) closeQueues() {
+	if g.workerQueues == nil {
+		close(g.eventQueue)
+		return
+	}
+	for _, q := range g.workerQueues {
+		close(q)
+	}
+}
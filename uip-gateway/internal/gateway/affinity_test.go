@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"fmt"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter/memory"
+)
+
+func TestWorkerAffinityOrdering(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.WorkerAffinity = true
+	checkConversationOrder(t, cfg)
+}
+
+// TestQueueForAffinity checks that a conversation always maps to the same
+// worker queue and that conversations spread across the pool.
+func TestQueueForAffinity(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.WorkerCount = 4
+	cfg.WorkerAffinity = true
+	g := New(cfg, echoClient, zap.NewNop())
+	if len(g.workerQueues) != 4 {
+		t.Fatalf("worker queues = %d, want 4", len(g.workerQueues))
+	}
+	mem := memory.New(nil)
+
+	used := map[chan *eventContext]bool{}
+	for i := 0; i < 32; i++ {
+		user := fmt.Sprintf("u%d", i)
+		q := g.queueFor(&eventContext{event: mem.Message(user, "a")})
+		if again := g.queueFor(&eventContext{event: mem.Message(user, "b")}); again != q {
+			t.Errorf("%s: events went to different worker queues", user)
+		}
+		used[q] = true
+	}
+	if len(used) != 4 {
+		t.Errorf("32 conversations used %d of 4 worker queues", len(used))
+	}
+
+	cfg.WorkerAffinity = false
+	g = New(cfg, echoClient, zap.NewNop())
+	if q := g.queueFor(&eventContext{event: mem.Message("u1", "a")}); q != g.eventQueue {
+		t.Error("without affinity, events must go on the shared queue")
+	}
+}
@@ -0,0 +1,153 @@
+package gateway
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/i18n"
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// DefaultAskTimeout is how long an answer is awaited when neither the ask
+// nor Config.AskTimeout says otherwise.
+const DefaultAskTimeout = 10 * time.Minute
+
+// Outcomes of checking a message against a pending ask, used as the
+// uip_ask_answers_total result label.
+const (
+	AskValid     = "valid"
+	AskInvalid   = "invalid"
+	AskExpired   = "expired"
+	AskAbandoned = "abandoned"
+)
+
+var askAnswersTotal = metrics.NewCounter("uip_ask_answers_total",
+	"Answers to ask intents, by result (valid/invalid/expired/abandoned).",
+	"result")
+
+// pendingAsk is the answer a session is waiting to give.
+type pendingAsk struct {
+	spec     *protocol.AskSpec
+	pattern  *regexp.Regexp
+	question string
+	attempts int
+	expires  time.Time
+}
+
+// setAsk records the ask session id awaits an answer to; nil clears it.
+func (r *SessionRegistry) setAsk(id string, ask *pendingAsk) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, exists := r.sessions[id]; exists {
+		entry.ask = ask
+	}
+}
+
+// answerAsk checks answer against the ask session id awaits, clearing it
+// unless the answer is invalid and may be retried. It returns the ask with
+// the outcome, or nil when none is pending.
+func (r *SessionRegistry) answerAsk(id, answer string, now time.Time) (*pendingAsk, string, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry, exists := r.sessions[id]
+	if !exists || entry.ask == nil {
+		return nil, "", ""
+	}
+	ask := entry.ask
+	if now.After(ask.expires) {
+		entry.ask = nil
+		return ask, "", AskExpired
+	}
+	if matched, ok := ask.spec.Match(answer, ask.pattern); ok {
+		entry.ask = nil
+		return ask, matched, AskValid
+	}
+	ask.attempts++
+	if ask.spec.MaxAttempts > 0 && ask.attempts > ask.spec.MaxAttempts {
+		entry.ask = nil
+		return ask, "", AskAbandoned
+	}
+	return ask, "", AskInvalid
+}
+
+// checkAnswer validates a message against the ask its session awaits. A
+// valid answer is forwarded with a matching choice in its listed spelling;
+// an invalid one gets the returned re-prompt instead of reaching Clawdbot.
+// Once the ask expires or runs out of attempts the message goes through
+// unchecked.
+func (g *Gateway) checkAnswer(ctx *eventContext) *protocol.InteractionIntent {
+	event := ctx.event
+	text, _ := event.Input.Payload["text"].(string)
+	ask, answer, result := g.sessions.answerAsk(event.Session.Key, text, g.clock.Now())
+	if ask == nil {
+		return nil
+	}
+	askAnswersTotal.Inc(result)
+	switch result {
+	case AskValid:
+		event.Input.Payload["text"] = answer
+		return nil
+	case AskInvalid:
+	default:
+		g.eventLogger(ctx).Debug("Forwarding message without an answer check",
+			zap.String("result", result))
+		return nil
+	}
+
+	retry := ask.spec.RetryPrompt
+	if retry == "" {
+		notice, _ := g.messages.Lookup(i18n.LocaleOf(event), i18n.KeyAskInvalidAnswer)
+		retry = strings.TrimSpace(notice + "\n" + ask.question)
+	}
+	intent := protocol.NewInteractionIntent(
+		protocol.IntentTypeAsk,
+		retry,
+		event.Session.ExternalSessionID,
+		event.InteractionID,
+	)
+	intent.Ask = ask.spec
+	intent.Content.QuickReplies = ask.spec.ChoiceReplies()
+	return intent
+}
+
+// trackAsks records the answer Clawdbot's intents ask for, replacing any
+// earlier ask of the session. An ask intent without a usable spec, or any
+// other reply, leaves the session awaiting nothing.
+func (g *Gateway) trackAsks(ctx *eventContext, intents []*protocol.InteractionIntent) {
+	var ask *pendingAsk
+	for _, intent := range intents {
+		if intent.IntentType != protocol.IntentTypeAsk || intent.Ask == nil {
+			continue
+		}
+		spec := intent.Ask
+		pattern, err := spec.Compile()
+		if err != nil {
+			g.eventLogger(ctx).Warn("Ignoring ask spec", zap.Error(err))
+			continue
+		}
+		if intent.Content.Text == "" {
+			intent.Content.Text = spec.Prompt
+		}
+		if len(intent.Content.QuickReplies) == 0 {
+			intent.Content.QuickReplies = spec.ChoiceReplies()
+		}
+		timeout := time.Duration(spec.TimeoutSec) * time.Second
+		if timeout <= 0 {
+			timeout = g.config.AskTimeout
+		}
+		if timeout <= 0 {
+			timeout = DefaultAskTimeout
+		}
+		ask = &pendingAsk{
+			spec:     spec,
+			pattern:  pattern,
+			question: intent.Content.Text,
+			expires:  g.clock.Now().Add(timeout),
+		}
+	}
+	g.sessions.setAsk(ctx.event.Session.Key, ask)
+}
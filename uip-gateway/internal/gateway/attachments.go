@@ -0,0 +1,127 @@
+package gateway
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/attachment"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// What LimitInboundAttachments does with an attachment over its limit.
+const (
+	// OversizedReject fails the event with a PAYLOAD_TOO_LARGE UIPError.
+	OversizedReject = "reject"
+	// OversizedStrip removes the attachment and notes it in the text.
+	OversizedStrip = "strip"
+)
+
+var attachmentsOversizedTotal = metrics.NewCounter("uip_attachments_oversized_total",
+	"Attachments over their size limit, by direction (inbound or outbound) and kind.",
+	"direction", "kind")
+
+// LimitInboundAttachments returns an inbound middleware enforcing limits on
+// the attachments an event's payload declares a size for. Attachments of
+// unknown size pass; the attachment proxy bounds those when it downloads
+// them. policy is OversizedReject or OversizedStrip.
+func LimitInboundAttachments(limits attachment.Limits, policy string) InboundMiddleware {
+	return func(event *protocol.CanonicalInteractionEvent) error {
+		atts, ok := event.Input.Payload["attachments"].([]interface{})
+		if !ok || len(atts) == 0 {
+			return nil
+		}
+
+		kept := atts[:0:0]
+		var notes []string
+		for _, att := range atts {
+			m, ok := att.(map[string]interface{})
+			if !ok {
+				kept = append(kept, att)
+				continue
+			}
+			// "unknown" means the adapter could not tell; infer it like a missing kind
+			kind, _ := m["kind"].(string)
+			if kind == "" || kind == "unknown" {
+				contentType, _ := m["contentType"].(string)
+				kind = attachment.KindOf(contentType)
+			}
+			err := limits.Check(kind, attachment.SizeOf(m))
+			if err == nil {
+				kept = append(kept, att)
+				continue
+			}
+
+			var tooLarge *attachment.TooLargeError
+			errors.As(err, &tooLarge)
+			attachmentsOversizedTotal.Inc("inbound", tooLarge.Kind)
+			fileName, _ := m["fileName"].(string)
+			if policy != OversizedStrip {
+				uerr := protocol.NewUIPError(protocol.ErrCodePayloadTooLarge, err.Error(), event.Meta.TraceID)
+				uerr.Details = map[string]interface{}{
+					"kind":     tooLarge.Kind,
+					"size":     tooLarge.Size,
+					"maxSize":  tooLarge.Max,
+					"fileName": fileName,
+				}
+				return uerr
+			}
+			notes = append(notes, attachment.OmittedNote(fileName, tooLarge))
+		}
+
+		if len(notes) == 0 {
+			return nil
+		}
+		if len(kept) > 0 {
+			event.Input.Payload["attachments"] = kept
+		} else {
+			delete(event.Input.Payload, "attachments")
+		}
+		text, _ := event.Input.Payload["text"].(string)
+		event.Input.Payload["text"] = strings.TrimSpace(text + "\n\n" + strings.Join(notes, "\n"))
+		return nil
+	}
+}
+
+// LimitOutboundAttachments returns an outbound middleware that drops reply
+// attachments over their limit, logging a warning, so one huge file does
+// not fail the whole reply. Sizes come from Attachment.Size or, for inline
+// attachments, the length of Data.
+func LimitOutboundAttachments(limits attachment.Limits, logger log.Logger) OutboundMiddleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(intent *protocol.InteractionIntent) error {
+		atts := intent.Content.Attachments
+		if len(atts) == 0 {
+			return nil
+		}
+
+		kept := atts[:0:0]
+		for _, att := range atts {
+			size := att.Size
+			if size == 0 && att.Data != "" {
+				size = int64(base64.StdEncoding.DecodedLen(len(att.Data)))
+			}
+			kind := attachment.KindOf(att.Type)
+			if err := limits.Check(kind, size); err != nil {
+				attachmentsOversizedTotal.Inc("outbound", kind)
+				logger.Warn("Dropping oversized reply attachment",
+					zap.String("intentId", intent.IntentID),
+					zap.String("name", att.Name),
+					zap.Error(err))
+				continue
+			}
+			kept = append(kept, att)
+		}
+		if len(kept) == 0 {
+			kept = nil
+		}
+		intent.Content.Attachments = kept
+		return nil
+	}
+}
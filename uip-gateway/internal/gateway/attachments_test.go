@@ -0,0 +1,42 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/zlc_ai/uip-gateway/internal/attachment"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+func TestLimitInboundAttachmentsKind(t *testing.T) {
+	limits := attachment.Limits{Kinds: map[string]int64{attachment.KindImage: 1000}}
+	tests := []struct {
+		name      string
+		kind      string
+		wantStrip bool
+	}{
+		{"missing kind inferred from MIME type", "", true},
+		{"unknown kind inferred from MIME type", "unknown", true},
+		{"declared kind trusted", attachment.KindImage, true},
+		{"declared document not limited as an image", attachment.KindDocument, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			att := map[string]interface{}{"contentType": "image/png", "size": 2000, "fileName": "a.png"}
+			if tt.kind != "" {
+				att["kind"] = tt.kind
+			}
+			event := &protocol.CanonicalInteractionEvent{Input: protocol.Input{Payload: map[string]interface{}{
+				"text":        "look",
+				"attachments": []interface{}{att},
+			}}}
+
+			if err := LimitInboundAttachments(limits, OversizedStrip)(event); err != nil {
+				t.Fatalf("LimitInboundAttachments: %v", err)
+			}
+			_, kept := event.Input.Payload["attachments"]
+			if kept == tt.wantStrip {
+				t.Errorf("attachment kept = %v, want %v (text %q)", kept, !tt.wantStrip, event.Input.Payload["text"])
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package gateway
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// scaleSustainTicks is how many consecutive samples the queue depth must stay
+// past a watermark before the pool is resized, to avoid flapping on spikes.
+const scaleSustainTicks = 2
+
+// spawnWorker starts one additional event worker.
+func (g *Gateway) spawnWorker() {
+	g.wg.Add(1)
+	go g.eventWorker(int(g.nextWorkerID.Add(1) - 1))
+}
+
+// WorkerCount returns the number of currently running event workers.
+func (g *Gateway) WorkerCount() int {
+	return int(g.activeWorkers.Load())
+}
+
+// autoscale grows the worker pool while the queue stays above ScaleUpDepth and
+// retires idle workers while it stays below ScaleDownDepth, within
+// [MinWorkers, MaxWorkers]. Retired workers exit through retireCh and are
+// accounted for by the shared wait group like any other worker.
+func (g *Gateway) autoscale() {
+	defer g.wg.Done()
+
+	ticker := time.NewTicker(g.config.ScaleInterval)
+	defer ticker.Stop()
+
+	var above, below int
+	for {
+		select {
+		case <-ticker.C:
+			depth := g.queueDepth()
+			workers := g.WorkerCount()
+
+			switch {
+			case depth > g.config.ScaleUpDepth:
+				above, below = above+1, 0
+				if above >= scaleSustainTicks && workers < g.config.MaxWorkers {
+					g.spawnWorker()
+					above = 0
+					g.logger.Info("Scaled up event workers",
+						zap.Int("workers", workers+1),
+						zap.Int("queueDepth", depth))
+				}
+
+			case depth < g.config.ScaleDownDepth:
+				below, above = below+1, 0
+				if below >= scaleSustainTicks && workers > g.config.MinWorkers {
+					// Only an idle worker (blocked in select) can take the signal
+					select {
+					case g.retireCh <- struct{}{}:
+						g.logger.Info("Scaled down event workers",
+							zap.Int("workers", workers-1),
+							zap.Int("queueDepth", depth))
+					default:
+					}
+					below = 0
+				}
+
+			default:
+				above, below = 0, 0
+			}
+
+		case <-g.stopCh:
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+	"github.com/zlc_ai/uip-gateway/internal/i18n"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// DefaultBusyReplyInterval is the least time between busy replies to one
+// session when Config.BusyReplyInterval is unset.
+const DefaultBusyReplyInterval = time.Minute
+
+// busyReplyTimeout bounds sending one busy reply.
+const busyReplyTimeout = 5 * time.Second
+
+// busyCapacity bounds the sessions whose last busy reply is remembered.
+const busyCapacity = 16384
+
+var busyRepliesTotal = metrics.NewCounter("uip_busy_replies_total",
+	"Busy replies to events dropped at a full queue, by adapter and result (sent/suppressed/failure).",
+	"adapter", "result")
+
+// busyLimiter remembers when each session last got a busy reply, so an
+// overloaded gateway tells a user once instead of answering every message.
+type busyLimiter struct {
+	mu       sync.Mutex
+	last     *ttlMap[struct{}]
+	interval time.Duration
+	clock    clock.Clock
+}
+
+func newBusyLimiter(interval time.Duration, clk clock.Clock) *busyLimiter {
+	return &busyLimiter{last: newTTLMap[struct{}](busyCapacity), interval: interval, clock: clk}
+}
+
+// allow reports whether session may get a busy reply now, recording it if so.
+func (b *busyLimiter) allow(session string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	if _, at, ok := b.last.get(session); ok && now.Sub(at) < b.interval {
+		return false
+	}
+	b.last.put(session, struct{}{}, now, b.interval)
+	return true
+}
+
+// replyBusy tells the sender of an event dropped at a full queue (rejected,
+// or displaced under QueueDropOld) that the gateway is overloaded. The reply
+// goes straight to the adapter from a new goroutine, bypassing the queue and
+// the processing pipeline, and is sent at most once per session per
+// BusyReplyInterval. ProcessSync callers are answered with ErrQueueFull
+// instead.
+func (g *Gateway) replyBusy(ec *eventContext) {
+	if g.busy == nil || ec.reply != nil || !g.accepting.Load() {
+		return
+	}
+	event := ec.event
+	if !g.busy.allow(event.Session.ExternalSessionID) {
+		busyRepliesTotal.Inc(ec.adapterName, "suppressed")
+		return
+	}
+
+	g.mu.RLock()
+	a, exists := g.adapters[ec.adapterName]
+	g.mu.RUnlock()
+	if !exists {
+		return
+	}
+
+	msg, _ := g.messages.Lookup(i18n.LocaleOf(event), i18n.KeyBusyReply)
+	intent := protocol.NewInteractionIntent(
+		protocol.IntentTypeReply,
+		renderTemplate(msg, event),
+		event.Session.ExternalSessionID,
+		event.InteractionID,
+	)
+	logger := g.eventLogger(ec)
+	go func() {
+		ctx, cancel := context.WithTimeout(log.NewContext(context.Background(), logger), busyReplyTimeout)
+		defer cancel()
+		if err := a.SendIntent(ctx, intent); err != nil {
+			busyRepliesTotal.Inc(ec.adapterName, "failure")
+			logger.Warn("Failed to send busy reply", zap.Error(err))
+			return
+		}
+		busyRepliesTotal.Inc(ec.adapterName, "sent")
+		g.echoes.record(intent.IntentID)
+	}()
+}
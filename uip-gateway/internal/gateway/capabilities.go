@@ -0,0 +1,32 @@
+package gateway
+
+import (
+	"github.com/zlc_ai/uip-gateway/internal/adapter"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// resolveCapabilities replaces event.Capabilities with the capabilities of
+// the event's conversation type, so Clawdbot and degradation both see what
+// the conversation can actually do. Later steps win:
+//
+//  1. the adapter default, as set on the event by the adapter;
+//  2. ConversationCapabilities of an adapter.ConversationCapabilityAdapter,
+//     when it returns non-nil for the conversation type;
+//  3. the overrides in Config.ConversationCapabilities for the adapter and
+//     conversation type, field by field.
+func (g *Gateway) resolveCapabilities(adapterName string, event *protocol.CanonicalInteractionEvent) {
+	convType := protocol.ConversationType(event)
+
+	g.mu.RLock()
+	a := g.adapters[adapterName]
+	g.mu.RUnlock()
+	if ca, ok := a.(adapter.ConversationCapabilityAdapter); ok {
+		if caps := ca.ConversationCapabilities(convType); caps != nil {
+			event.Capabilities = *caps
+		}
+	}
+
+	if override, ok := g.config.ConversationCapabilities[adapterName][convType]; ok {
+		override.Apply(&event.Capabilities)
+	}
+}
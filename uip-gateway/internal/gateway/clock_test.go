@@ -0,0 +1,83 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+var epoch = time.Unix(1700000000, 0)
+
+func TestSessionTTLFollowsClock(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	var expired []string
+	r := newSessionRegistry(time.Minute, func(s protocol.Session) {
+		expired = append(expired, s.ExternalSessionID)
+	}, clk)
+
+	r.Touch("a", protocol.Session{ExternalSessionID: "a"})
+	r.Touch("b", protocol.Session{ExternalSessionID: "b"})
+	clk.Advance(40 * time.Second)
+	r.Touch("b", protocol.Session{ExternalSessionID: "b"})
+
+	clk.Advance(time.Minute - 40*time.Second)
+	if n := r.Cleanup(); n != 0 {
+		t.Fatalf("Cleanup at exactly the TTL evicted %d sessions", n)
+	}
+	clk.Advance(time.Second)
+	if n := r.Cleanup(); n != 1 || len(expired) != 1 || expired[0] != "a" {
+		t.Fatalf("Cleanup = %d, expired %v; want only a", n, expired)
+	}
+	if _, ok := r.Get("b"); !ok {
+		t.Fatal("session b touched within the TTL was evicted")
+	}
+	clk.Advance(40 * time.Second)
+	if n := r.Cleanup(); n != 1 || r.Count() != 0 {
+		t.Fatalf("Cleanup = %d, %d sessions left; want b evicted", n, r.Count())
+	}
+}
+
+func TestEchoExpiryFollowsClock(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	e := newEchoGuard(clk)
+
+	e.record("m1")
+	clk.Advance(echoTTL)
+	if !e.seen("m1") {
+		t.Fatal("echo not recognised at exactly echoTTL")
+	}
+	clk.Advance(time.Second)
+	if e.seen("m1") {
+		t.Fatal("echo still recognised after echoTTL")
+	}
+	// Expired entries are forgotten, not revived by a clock moving back
+	clk.Set(epoch)
+	if e.seen("m1") {
+		t.Fatal("expired echo recognised again")
+	}
+}
+
+func TestDedupExpiryFollowsClock(t *testing.T) {
+	clk := clock.NewFake(epoch)
+	d := newDedupGuard(clk)
+	const window = 5 * time.Minute
+
+	if d.duplicate("k", window) {
+		t.Fatal("first delivery reported as duplicate")
+	}
+	clk.Advance(window)
+	if !d.duplicate("k", window) {
+		t.Fatal("redelivery at exactly the window not reported as duplicate")
+	}
+	clk.Advance(window + time.Second)
+	if d.duplicate("k", window) {
+		t.Fatal("redelivery after the window reported as duplicate")
+	}
+	// That delivery was remembered afresh
+	clk.Advance(time.Second)
+	if !d.duplicate("k", window) {
+		t.Fatal("delivery after expiry not remembered")
+	}
+}
@@ -0,0 +1,193 @@
+package gateway
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/i18n"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// ContentFilterConfig configures the filter applied to replies before
+// they reach users. Block rules are checked first: a reply matching any of
+// them is replaced whole by the blocked message, so redaction never runs
+// on it.
+type ContentFilterConfig struct {
+	// Redact lists rules whose matches are replaced in the reply text.
+	Redact []RedactRule `json:"redact" yaml:"redact"`
+	// Block lists regular expressions that block the whole reply.
+	Block []string `json:"block" yaml:"block"`
+	// BlockedMessage replaces a blocked reply. Empty uses the localized
+	// "reply_blocked" message.
+	BlockedMessage string `json:"blocked_message" yaml:"blocked_message"`
+}
+
+// RedactRule replaces every match of Pattern in a reply with Replacement.
+type RedactRule struct {
+	// Name identifies the rule in logs. The names "email" and "phone"
+	// select a built-in pattern when Pattern is empty.
+	Name string `json:"name" yaml:"name"`
+	// Pattern is a Go regular expression.
+	Pattern string `json:"pattern" yaml:"pattern"`
+	// Replacement may use $1-style group references. Empty means "[redacted]".
+	Replacement string `json:"replacement" yaml:"replacement"`
+}
+
+// DefaultRedaction replaces matches of rules without a Replacement.
+const DefaultRedaction = "[redacted]"
+
+// builtinRedactions are the patterns behind the named rules.
+var builtinRedactions = map[string]string{
+	"email": `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	// Numbers of 7+ digits ending in a group of four, with an optional
+	// country code and area code, separated by spaces, dots or dashes
+	"phone": `(?:\+\d{1,3}[\s.-]?)?(?:\(\d{1,4}\)[\s.-]?|\b)(?:\d{2,4}[\s.-]?)?\d{3,4}[\s.-]?\d{4}\b`,
+}
+
+// Content filter actions, used as the uip_replies_filtered_total action label.
+const (
+	ContentFilterRedacted = "redacted"
+	ContentFilterBlocked  = "blocked"
+)
+
+var repliesFilteredTotal = metrics.NewCounter("uip_replies_filtered_total",
+	"Replies changed by the content filter, by adapter and action (redacted/blocked).",
+	"adapter", "action")
+
+type redaction struct {
+	name        string
+	re          *regexp.Regexp
+	replacement string
+}
+
+// ContentFilter redacts and blocks reply text according to a
+// ContentFilterConfig.
+type ContentFilter struct {
+	redact         []redaction
+	block          []*regexp.Regexp
+	blockedMessage string
+}
+
+// NewContentFilter compiles the filter's patterns. Empty and invalid
+// patterns are rejected.
+func NewContentFilter(cfg ContentFilterConfig) (*ContentFilter, error) {
+	f := &ContentFilter{blockedMessage: cfg.BlockedMessage}
+	for i, r := range cfg.Redact {
+		pattern := r.Pattern
+		if pattern == "" {
+			pattern = builtinRedactions[r.Name]
+		}
+		if strings.TrimSpace(pattern) == "" {
+			return nil, fmt.Errorf("redact[%d]: empty pattern", i)
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redact[%d]: %w", i, err)
+		}
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("redact[%d]", i)
+		}
+		replacement := r.Replacement
+		if replacement == "" {
+			replacement = DefaultRedaction
+		}
+		f.redact = append(f.redact, redaction{name: name, re: re, replacement: replacement})
+	}
+	for i, p := range cfg.Block {
+		if strings.TrimSpace(p) == "" {
+			return nil, fmt.Errorf("block[%d]: empty pattern", i)
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("block[%d]: %w", i, err)
+		}
+		f.block = append(f.block, re)
+	}
+	return f, nil
+}
+
+// Blocked reports whether text matches a block rule, and which one.
+func (f *ContentFilter) Blocked(text string) (int, bool) {
+	for i, re := range f.block {
+		if re.MatchString(text) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// Redact applies every redaction rule to text, returning the result and
+// the names of the rules that matched.
+func (f *ContentFilter) Redact(text string) (string, []string) {
+	var matched []string
+	for _, r := range f.redact {
+		if !r.re.MatchString(text) {
+			continue
+		}
+		text = r.re.ReplaceAllString(text, r.replacement)
+		matched = append(matched, r.name)
+	}
+	return text, matched
+}
+
+// SetContentFilter installs the reply content filter. A nil filter lets
+// replies through unchanged.
+func (g *Gateway) SetContentFilter(f *ContentFilter) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.contentFilter = f
+}
+
+// applyContentFilter blocks or redacts the intent's text and markdown. A
+// blocked reply keeps nothing of the original: attachments, sources and
+// native payloads go too.
+func (g *Gateway) applyContentFilter(ctx *eventContext, intent *protocol.InteractionIntent) {
+	g.mu.RLock()
+	f := g.contentFilter
+	g.mu.RUnlock()
+	if f == nil || (intent.Content.Text == "" && intent.Content.Markdown == "") {
+		return
+	}
+	logger := g.eventLogger(ctx)
+
+	rule, blocked := f.Blocked(intent.Content.Text)
+	if !blocked {
+		rule, blocked = f.Blocked(intent.Content.Markdown)
+	}
+	if blocked {
+		msg := f.blockedMessage
+		if msg == "" {
+			msg, _ = g.messages.Lookup(i18n.LocaleOf(ctx.event), i18n.KeyReplyBlocked)
+		}
+		intent.Content = protocol.IntentContent{Text: msg}
+		repliesFilteredTotal.Inc(ctx.adapterName, ContentFilterBlocked)
+		logger.Warn("Reply blocked by content filter",
+			zap.String(log.KeyIntentID, intent.IntentID),
+			zap.Int("rule", rule))
+		return
+	}
+
+	text, matchedText := f.Redact(intent.Content.Text)
+	markdown, matchedMarkdown := f.Redact(intent.Content.Markdown)
+	if len(matchedText) == 0 && len(matchedMarkdown) == 0 {
+		return
+	}
+	intent.Content.Text, intent.Content.Markdown = text, markdown
+	rules := matchedText
+	for _, name := range matchedMarkdown {
+		if !slices.Contains(rules, name) {
+			rules = append(rules, name)
+		}
+	}
+	repliesFilteredTotal.Inc(ctx.adapterName, ContentFilterRedacted)
+	logger.Info("Reply redacted by content filter",
+		zap.String(log.KeyIntentID, intent.IntentID),
+		zap.Strings("rules", rules))
+}
@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter/memory"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+func TestContentFilterRedact(t *testing.T) {
+	f, err := NewContentFilter(ContentFilterConfig{Redact: []RedactRule{
+		{Name: "email"},
+		{Name: "phone", Replacement: "[phone]"},
+		{Name: "card", Pattern: `\b(\d{4})\d{8}(\d{4})\b`, Replacement: "$1********$2"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text  string
+		want  string
+		rules []string
+	}{
+		{"no secrets here", "no secrets here", nil},
+		{"mail bob.smith+tag@example.co.uk now", "mail [redacted] now", []string{"email"}},
+		{"a@b.io and c@d.org", "[redacted] and [redacted]", []string{"email"}},
+		{"not an email: user@localhost", "not an email: user@localhost", nil},
+		{"call 555-123-4567", "call [phone]", []string{"phone"}},
+		{"call +1 (555) 123-4567 today", "call [phone] today", []string{"phone"}},
+		{"office 020 7946 0958", "office [phone]", []string{"phone"}},
+		{"order 12345 shipped", "order 12345 shipped", nil},
+		{"card 4111111111111111", "card 4111********1111", []string{"card"}},
+		{"x@y.com or 555.123.4567", "[redacted] or [phone]", []string{"email", "phone"}},
+	}
+	for _, tt := range tests {
+		got, rules := f.Redact(tt.text)
+		if got != tt.want || fmt.Sprint(rules) != fmt.Sprint(tt.rules) {
+			t.Errorf("Redact(%q) = %q %v, want %q %v", tt.text, got, rules, tt.want, tt.rules)
+		}
+	}
+}
+
+func TestContentFilterBlocked(t *testing.T) {
+	f, err := NewContentFilter(ContentFilterConfig{Block: []string{`(?i)internal use only`, `password:\s*\S+`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		rule int
+		want bool
+	}{
+		{"all good", -1, false},
+		{"INTERNAL USE ONLY: roadmap", 0, true},
+		{"your password: hunter2", 1, true},
+		{"password reset link sent", -1, false},
+	}
+	for _, tt := range tests {
+		if rule, blocked := f.Blocked(tt.text); rule != tt.rule || blocked != tt.want {
+			t.Errorf("Blocked(%q) = %d %v, want %d %v", tt.text, rule, blocked, tt.rule, tt.want)
+		}
+	}
+}
+
+func TestNewContentFilterRejectsBadConfig(t *testing.T) {
+	for _, cfg := range []ContentFilterConfig{
+		{Redact: []RedactRule{{Name: "ssn"}}},
+		{Redact: []RedactRule{{Pattern: "("}}},
+		{Block: []string{" "}},
+		{Block: []string{"[a-"}},
+	} {
+		if _, err := NewContentFilter(cfg); err == nil {
+			t.Errorf("NewContentFilter(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
+
+// TestContentFilterReplies runs replies through the gateway: blocked ones
+// are replaced whole, redacted ones keep everything but their matches.
+func TestContentFilterReplies(t *testing.T) {
+	reply := clientFunc(func(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+		text, _ := event.Input.Payload["text"].(string)
+		intent := protocol.NewInteractionIntent(protocol.IntentTypeReply, text, event.Session.ExternalSessionID, event.InteractionID)
+		intent.Content.Markdown = "**" + text + "**"
+		intent.Content.Attachments = []protocol.Attachment{{Type: "image", URL: "https://x/a.png"}}
+		return intent, nil
+	})
+	g, mem := startGateway(t, DefaultConfig(), reply)
+	f, err := NewContentFilter(ContentFilterConfig{
+		Redact:         []RedactRule{{Name: "email"}},
+		Block:          []string{"secret"},
+		BlockedMessage: "Sorry, I can't share that.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetContentFilter(f)
+	blocked := repliesFilteredTotal.Value(memory.Name, ContentFilterBlocked)
+	redacted := repliesFilteredTotal.Value(memory.Name, ContentFilterRedacted)
+
+	mem.Inject(mem.Message("u1", "the secret is 42"))
+	got := waitReplies(t, mem, 1)[0].Content
+	if got.Text != "Sorry, I can't share that." || got.Markdown != "" || len(got.Attachments) != 0 {
+		t.Errorf("blocked reply = %+v, want only the blocked message", got)
+	}
+
+	mem.Reset()
+	mem.Inject(mem.Message("u1", "write to a@b.io"))
+	got = waitReplies(t, mem, 1)[0].Content
+	if got.Text != "write to [redacted]" || got.Markdown != "**write to [redacted]**" || len(got.Attachments) != 1 {
+		t.Errorf("redacted reply = %+v", got)
+	}
+
+	mem.Reset()
+	mem.Inject(mem.Message("u1", "hello"))
+	if got := waitReplies(t, mem, 1)[0].Content; got.Text != "hello" {
+		t.Errorf("clean reply = %q, want it unchanged", got.Text)
+	}
+
+	if d := repliesFilteredTotal.Value(memory.Name, ContentFilterBlocked) - blocked; d != 1 {
+		t.Errorf("blocked count grew by %v, want 1", d)
+	}
+	if d := repliesFilteredTotal.Value(memory.Name, ContentFilterRedacted) - redacted; d != 1 {
+		t.Errorf("redacted count grew by %v, want 1", d)
+	}
+}
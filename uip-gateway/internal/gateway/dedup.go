@@ -0,0 +1,74 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter"
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+)
+
+// dedupCapacity bounds the remembered inbound keys across all adapters.
+const dedupCapacity = 16384
+
+// dedupGuard remembers the idempotency keys of recent inbound events, so a
+// platform redelivering an event it thinks was lost is not answered twice.
+type dedupGuard struct {
+	mu    sync.Mutex
+	seen  *ttlMap[struct{}]
+	clock clock.Clock
+}
+
+func newDedupGuard(clk clock.Clock) *dedupGuard {
+	return &dedupGuard{seen: newTTLMap[struct{}](dedupCapacity), clock: clk}
+}
+
+// duplicate reports whether key was seen within window, remembering it as
+// seen now otherwise.
+func (d *dedupGuard) duplicate(key string, window time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+	if _, at, ok := d.seen.get(key); ok && now.Sub(at) <= window {
+		return true
+	}
+	// Windows differ by adapter, so only entries older than the current
+	// window are known to be safe to drop first
+	d.seen.put(key, struct{}{}, now, window)
+	return false
+}
+
+// dedupWindow returns the deduplication window for an adapter:
+// Config.DedupWindows[adapterName] if set, else Config.DedupWindow.
+func (g *Gateway) dedupWindow(adapterName string) time.Duration {
+	if w, ok := g.config.DedupWindows[adapterName]; ok {
+		return w
+	}
+	return g.config.DedupWindow
+}
+
+// duplicateEvent reports whether the event repeats one the adapter
+// delivered within its deduplication window. The idempotency key comes from
+// an adapter.DedupAdapter, falling back to the event's InteractionID.
+func (g *Gateway) duplicateEvent(ec *eventContext) bool {
+	window := g.dedupWindow(ec.adapterName)
+	if window <= 0 {
+		return false
+	}
+
+	g.mu.RLock()
+	a := g.adapters[ec.adapterName]
+	g.mu.RUnlock()
+	key := ""
+	if da, ok := a.(adapter.DedupAdapter); ok {
+		key = da.DedupKey(ec.event)
+	}
+	if key == "" {
+		key = ec.event.InteractionID
+	}
+	if key == "" {
+		return false
+	}
+	return g.dedup.duplicate(ec.adapterName+"\x00"+key, window)
+}
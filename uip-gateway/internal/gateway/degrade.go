@@ -0,0 +1,99 @@
+package gateway
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Degradation types, used as the uip_intents_degraded_total type label.
+const (
+	DegradeMarkdownStripped   = "markdown_stripped"
+	DegradeAttachmentsDropped = "attachments_dropped"
+	DegradeEphemeralPublic    = "ephemeral_public"
+	DegradeEditReposted       = "edit_reposted"
+	DegradeLocationLinked     = "location_linked"
+	DegradeThreadFlattened    = "thread_flattened"
+	DegradeQuickRepliesListed = "quick_replies_listed"
+)
+
+var intentsDegradedTotal = metrics.NewCounter("uip_intents_degraded_total",
+	"Outbound intents modified to fit adapter capabilities, by adapter and type.",
+	"adapter", "type")
+
+// applyDegradation modifies the intent based on IM capabilities, counting
+// each modification so operators can see what their adapters lose.
+func (g *Gateway) applyDegradation(ec *eventContext, intent *protocol.InteractionIntent) {
+	event := ec.event
+	caps := event.Capabilities
+
+	// Lift cited sources out of the text where the platform can render them
+	g.applySources(event, intent)
+
+	// If markdown not supported, strip markdown
+	if !caps.SupportsMarkdown && intent.Content.Markdown != "" {
+		intent.Content.Markdown = ""
+		g.recordDegradation(ec, intent, DegradeMarkdownStripped)
+	}
+
+	// If attachments not supported, remove them
+	if !caps.SupportsAttachment && len(intent.Content.Attachments) > 0 {
+		intent.Content.Attachments = nil
+		g.recordDegradation(ec, intent, DegradeAttachmentsDropped)
+	}
+
+	// If private replies are not supported, post publicly
+	if !caps.SupportsEphemeral && intent.Ephemeral {
+		intent.Ephemeral = false
+		g.recordDegradation(ec, intent, DegradeEphemeralPublic)
+	}
+
+	// If map pins are not supported, append a map link to the text
+	if !caps.SupportsLocation && intent.Content.Location != nil {
+		link := intent.Content.Location.Text()
+		intent.Content.Text = strings.TrimSpace(intent.Content.Text + "\n\n" + link)
+		if intent.Content.Markdown != "" {
+			intent.Content.Markdown += "\n\n" + link
+		}
+		intent.Content.Location = nil
+		g.recordDegradation(ec, intent, DegradeLocationLinked)
+	}
+
+	// If buttons are not supported, list the choices in the text
+	if !caps.SupportsQuickReplies && len(intent.Content.QuickReplies) > 0 {
+		list := protocol.QuickRepliesText(intent.Content.QuickReplies)
+		intent.Content.Text = strings.TrimSpace(intent.Content.Text + "\n\n" + list)
+		if intent.Content.Markdown != "" {
+			intent.Content.Markdown += "\n\n" + list
+		}
+		intent.Content.QuickReplies = nil
+		g.recordDegradation(ec, intent, DegradeQuickRepliesListed)
+	}
+
+	// Reply in the thread the event came from, or in the channel root
+	// where threads are not supported
+	if intent.ThreadID == "" {
+		intent.ThreadID = protocol.ThreadID(event)
+	}
+	if !caps.SupportsThread && intent.ThreadID != "" {
+		intent.ThreadID = ""
+		g.recordDegradation(ec, intent, DegradeThreadFlattened)
+	}
+
+	// If edits are not supported, post the updated reply as a new one
+	if !caps.SupportsEdit && intent.Replaces != "" {
+		intent.Replaces = ""
+		g.recordDegradation(ec, intent, DegradeEditReposted)
+	}
+}
+
+func (g *Gateway) recordDegradation(ec *eventContext, intent *protocol.InteractionIntent, kind string) {
+	intentsDegradedTotal.Inc(ec.adapterName, kind)
+	g.eventLogger(ec).Debug("Intent degraded",
+		zap.String(log.KeyIntentID, intent.IntentID),
+		zap.String("type", kind))
+}
@@ -0,0 +1,141 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter/memory"
+	"github.com/zlc_ai/uip-gateway/internal/clawdbot"
+	"github.com/zlc_ai/uip-gateway/internal/clawdbot/testserver"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// threadMessage is a message posted in thread t1 of channel c1.
+func threadMessage(mem *memory.MemoryAdapter, text string) *protocol.CanonicalInteractionEvent {
+	event := mem.Message("u1", text)
+	event.Input.Payload["channelId"] = "c1"
+	event.Input.Payload["threadId"] = "t1"
+	return event
+}
+
+// TestThreadReplyEndToEnd sends a thread message through an OpenClaw
+// client: the placeholder reply is posted into the thread, and so is the
+// runtime's reply arriving on the outbound callback.
+func TestThreadReplyEndToEnd(t *testing.T) {
+	var client *clawdbot.OpenclawClient
+	callbacks := make(chan *clawdbot.OutboundResponse, 1)
+	outbound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload clawdbot.OpenclawOutboundPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		resp := client.HandleCallback(&payload)
+		json.NewEncoder(w).Encode(clawdbot.NewOutboundAck(&payload, resp))
+		callbacks <- resp
+	}))
+	defer outbound.Close()
+	srv := testserver.New(testserver.Options{OutboundURL: outbound.URL})
+	defer srv.Close()
+	client, err := clawdbot.NewOpenclawClient(clawdbot.Config{Endpoint: srv.URL, Timeout: 5 * time.Second},
+		clawdbot.OpenclawClientConfig{}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	_, mem := startGateway(t, DefaultConfig(), client)
+
+	mem.Inject(threadMessage(mem, "hello"))
+	if intent := waitReplies(t, mem, 1)[0]; intent.ThreadID != "t1" {
+		t.Errorf("placeholder reply posted in thread %q, want t1", intent.ThreadID)
+	}
+	select {
+	case resp := <-callbacks:
+		if resp.Text != "echo: hello" || resp.ChannelID != "c1" || resp.ThreadId != "t1" {
+			t.Errorf("callback = %q to channel %q thread %q, want %q to c1 thread t1",
+				resp.Text, resp.ChannelID, resp.ThreadId, "echo: hello")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no outbound callback")
+	}
+}
+
+func TestThreadFlattened(t *testing.T) {
+	tests := []struct {
+		name      string
+		thread    bool
+		replyTo   string // thread the runtime names, "" to inherit
+		want      string
+		flattened float64
+	}{
+		{"inherits the event's thread", true, "", "t1", 0},
+		{"runtime picks the thread", true, "t2", "t2", 0},
+		{"no thread support", false, "", "", 1},
+		{"no thread support, runtime thread", false, "t2", "", 1},
+	}
+	for _, tt := range tests {
+		replyTo := tt.replyTo
+		client := clientFunc(func(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+			intent, err := echoClient(ctx, event)
+			intent.ThreadID = replyTo
+			return intent, err
+		})
+		_, mem := startGateway(t, DefaultConfig(), client)
+		caps := *mem.Capabilities()
+		caps.SupportsThread = tt.thread
+		mem.SetConversationCapabilities(protocol.ConversationThread, &caps)
+		before := intentsDegradedTotal.Value(memory.Name, DegradeThreadFlattened)
+
+		mem.Inject(threadMessage(mem, "hi"))
+		if got := waitReplies(t, mem, 1)[0].ThreadID; got != tt.want {
+			t.Errorf("%s: reply thread = %q, want %q", tt.name, got, tt.want)
+		}
+		if d := intentsDegradedTotal.Value(memory.Name, DegradeThreadFlattened) - before; d != tt.flattened {
+			t.Errorf("%s: thread_flattened grew by %v, want %v", tt.name, d, tt.flattened)
+		}
+	}
+}
+
+// TestLocationLinked checks that a map pin reaches adapters with
+// SupportsLocation as is, and is turned into a map link elsewhere.
+func TestLocationLinked(t *testing.T) {
+	pin := &protocol.Location{Latitude: 52.52, Longitude: 13.405, Name: "Alexanderplatz"}
+	tests := []struct {
+		name     string
+		location bool
+		text     string
+		markdown string
+		linked   float64
+	}{
+		{"native pin", true, "meet here", "**meet here**", 0},
+		{"map link", false, "meet here\n\n" + pin.Text(), "**meet here**\n\n" + pin.Text(), 1},
+	}
+	for _, tt := range tests {
+		client := clientFunc(func(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+			intent, err := echoClient(ctx, event)
+			intent.Content.Markdown = "**meet here**"
+			intent.Content.Location = pin
+			return intent, err
+		})
+		_, mem := startGateway(t, DefaultConfig(), client)
+		caps := *mem.Capabilities()
+		caps.SupportsLocation = tt.location
+		mem.SetConversationCapabilities(protocol.ConversationDirect, &caps)
+		before := intentsDegradedTotal.Value(memory.Name, DegradeLocationLinked)
+
+		mem.Inject(mem.Message("u1", "meet here"))
+		got := waitReplies(t, mem, 1)[0].Content
+		if got.Text != tt.text || got.Markdown != tt.markdown {
+			t.Errorf("%s: reply = %q / %q, want %q / %q", tt.name, got.Text, got.Markdown, tt.text, tt.markdown)
+		}
+		if (got.Location != nil) != tt.location {
+			t.Errorf("%s: reply location = %+v", tt.name, got.Location)
+		}
+		if d := intentsDegradedTotal.Value(memory.Name, DegradeLocationLinked) - before; d != tt.linked {
+			t.Errorf("%s: location_linked grew by %v, want %v", tt.name, d, tt.linked)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package gateway
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// shadow logs and counts the intents an event would have sent in dry-run
+// mode. The first intent also lands in the recent-events buffer, marked
+// DryRun, so replies can be reviewed at /api/v1/debug/recent.
+func (g *Gateway) shadow(ctx *eventContext, intents []*protocol.InteractionIntent) {
+	ctx.shadowed = true
+	logger := g.eventLogger(ctx)
+	for i, intent := range intents {
+		intentsShadowedTotal.Inc(ctx.adapterName, string(intent.IntentType))
+		logger.Info("Dry run: intent not sent",
+			zap.String(log.KeyIntentID, intent.IntentID),
+			zap.String("type", string(intent.IntentType)),
+			zap.Int("index", i),
+			zap.Int("textLength", len(intent.Content.Text)),
+			zap.Int("attachments", len(intent.Content.Attachments)))
+		logger.Debug("Dry run intent content",
+			zap.String(log.KeyIntentID, intent.IntentID),
+			zap.String("text", intent.Content.Text))
+	}
+}
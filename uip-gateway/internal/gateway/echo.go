@@ -0,0 +1,61 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+)
+
+// Echo tracking bounds.
+const (
+	echoTTL      = 10 * time.Minute
+	echoCapacity = 4096
+)
+
+// echoGuard remembers the IDs of recently sent messages, so an IM that
+// echoes the bot's own reply back as an inbound message is not answered
+// again (which would otherwise loop).
+type echoGuard struct {
+	mu    sync.Mutex
+	sent  *ttlMap[struct{}]
+	clock clock.Clock
+}
+
+func newEchoGuard(clk clock.Clock) *echoGuard {
+	return &echoGuard{sent: newTTLMap[struct{}](echoCapacity), clock: clk}
+}
+
+// record remembers id as sent now.
+func (e *echoGuard) record(id string) {
+	if id == "" {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.sent.put(id, struct{}{}, e.clock.Now(), echoTTL)
+}
+
+// seen reports whether id was sent within echoTTL.
+func (e *echoGuard) seen(id string) bool {
+	if id == "" {
+		return false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	_, at, ok := e.sent.get(id)
+	if ok && e.clock.Since(at) > echoTTL {
+		e.sent.delete(id)
+		return false
+	}
+	return ok
+}
+
+// RecordSent remembers the ID of a message the gateway delivered outside
+// SendIntent (for example through the IM webhook), so an inbound echo of it
+// is dropped. Intents sent through adapters are recorded automatically.
+func (g *Gateway) RecordSent(messageID string) {
+	g.echoes.record(messageID)
+}
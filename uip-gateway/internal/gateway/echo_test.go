@@ -0,0 +1,122 @@
+package gateway
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter/memory"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// echoOf builds the inbound event an IM delivers when it echoes intent back,
+// from bot in a group conversation when group is set.
+func echoOf(mem *memory.MemoryAdapter, intent *protocol.InteractionIntent, id string, bot, group bool) *protocol.CanonicalInteractionEvent {
+	event := mem.Message("echo-bot", intent.Content.Text)
+	event.Input.Payload["messageId"] = id
+	if group {
+		event.Input.Payload["conversationType"] = protocol.ConversationGroup
+		event.Input.Payload["channelId"] = "g1"
+	}
+	if bot {
+		event.Session.ParticipantType = protocol.ParticipantTypeSystem
+	}
+	return event
+}
+
+// waitRecorded waits for the gateway to record id as sent, which happens
+// just after the adapter received the intent.
+func waitRecorded(t *testing.T, g *Gateway, id string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !g.echoes.seen(id) {
+		if time.Now().After(deadline) {
+			t.Fatalf("intent %s never recorded as sent", id)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// TestEchoLoop simulates an IM that feeds every reply back to the gateway
+// as a new inbound message. Each echo must be dropped, so a single user
+// message is answered exactly once instead of looping.
+func TestEchoLoop(t *testing.T) {
+	tests := []struct {
+		name string
+		// id picks the echoed message ID from the reply's intent ID
+		id         func(intentID string) string
+		bot, group bool
+		want       string
+	}{
+		{"own reply echoed as a user message", func(id string) string { return id }, false, false, FilterSelfEcho},
+		{"own reply echoed by a bot in a group", func(id string) string { return id }, true, true, FilterSelfEcho},
+		{"another bot answering in a group", func(string) string { return "other-bot-msg" }, true, true, FilterBotSender},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, mem := startGateway(t, DefaultConfig(), echoClient)
+			mem.Inject(mem.Message("u1", "hello"))
+			reply := waitReplies(t, mem, 1)[0]
+			waitRecorded(t, g, reply.IntentID)
+
+			before := eventsFilteredTotal.Value(memory.Name, tt.want)
+			for round := 0; round < 5; round++ {
+				mem.Inject(echoOf(mem, reply, tt.id(reply.IntentID), tt.bot, tt.group))
+			}
+			// Filtering happens before the event is queued, so the drops
+			// are counted once Inject returns
+			if got := eventsFilteredTotal.Value(memory.Name, tt.want) - before; got != 5 {
+				t.Errorf("%s drops grew by %v, want 5", tt.want, got)
+			}
+			if got := len(mem.Received()); got != 1 {
+				t.Errorf("received %d intents, want the single reply", got)
+			}
+		})
+	}
+}
+
+func TestRecordSentDropsWebhookEcho(t *testing.T) {
+	g, mem := startGateway(t, DefaultConfig(), echoClient)
+	g.RecordSent("ai-resp-1")
+
+	event := mem.Message("u1", "echoed webhook reply")
+	event.Input.Payload["messageId"] = "ai-resp-1"
+	mem.Inject(event)
+	mem.Inject(mem.Message("u1", "fresh"))
+	if got := waitReplies(t, mem, 1)[0].Content.Text; got != "fresh" {
+		t.Errorf("answered %q, want only the fresh message", got)
+	}
+	if got := len(mem.Received()); got != 1 {
+		t.Errorf("received %d intents, want 1", got)
+	}
+}
+
+func TestEventFilterBots(t *testing.T) {
+	bot := func(user, channel string) *protocol.CanonicalInteractionEvent {
+		event := filterEvent(user, channel)
+		event.Session.ParticipantType = protocol.ParticipantTypeSystem
+		return event
+	}
+	tests := []struct {
+		name  string
+		cfg   FilterConfig
+		event *protocol.CanonicalInteractionEvent
+		want  string
+	}{
+		{"bot in a group dropped by default", FilterConfig{}, bot("b1", "c1"), FilterBotSender},
+		{"bot in a direct message answered by default", FilterConfig{}, bot("b1", ""), ""},
+		{"drop_bots all", FilterConfig{DropBots: DropBotsAll}, bot("b1", ""), FilterBotSender},
+		{"drop_bots none", FilterConfig{DropBots: DropBotsNone}, bot("b1", "c1"), ""},
+		{"allowed bot", FilterConfig{AllowBots: []string{"helper-*"}}, bot("helper-1", "c1"), ""},
+		{"human in a group", FilterConfig{DropBots: DropBotsAll}, filterEvent("u1", "c1"), ""},
+		{"deny wins over allow_bots", FilterConfig{AllowBots: []string{"*"}, DenyUsers: []string{"b1"}}, bot("b1", "c1"), FilterDenyUser},
+	}
+	for _, tt := range tests {
+		f, err := NewEventFilter(tt.cfg)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := f.Check(tt.event); got != tt.want {
+			t.Errorf("%s: Check = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package gateway
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Edit tracking bounds.
+const (
+	editTTL      = time.Hour
+	editCapacity = 4096
+)
+
+// editTracker remembers, per inbound message, the interaction it started
+// and the first reply sent for it, so an edit of the message can update
+// that reply instead of posting a new one. Only used with RespondToEdits.
+type editTracker struct {
+	mu            sync.Mutex
+	byMessage     *ttlMap[*editEntry]   // by adapter + message ID
+	byInteraction map[string]*editEntry // original and edit interaction IDs
+	clock         clock.Clock
+}
+
+type editEntry struct {
+	key           string
+	interactionID string
+	replyIntentID string
+
+	// edits lists the interaction IDs of edit events linked to this entry
+	edits []string
+}
+
+func newEditTracker(clk clock.Clock) *editTracker {
+	t := &editTracker{
+		byMessage:     newTTLMap[*editEntry](editCapacity),
+		byInteraction: make(map[string]*editEntry),
+		clock:         clk,
+	}
+	t.byMessage.onEvict = t.forgetInteractionsLocked
+	return t
+}
+
+func editKey(adapterName, messageID string) string {
+	return adapterName + "\x00" + messageID
+}
+
+// track remembers the message that started an interaction.
+func (t *editTracker) track(adapterName, messageID, interactionID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := editKey(adapterName, messageID)
+	if old, _, ok := t.byMessage.get(key); ok {
+		t.forgetLocked(old)
+	}
+	e := &editEntry{key: key, interactionID: interactionID}
+	t.byMessage.put(key, e, t.clock.Now(), editTTL)
+	t.byInteraction[interactionID] = e
+}
+
+// link associates an edit event with the original message's entry and
+// returns the original interaction ID, or "" if the message is unknown.
+func (t *editTracker) link(adapterName, messageID, interactionID string) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, at, ok := t.byMessage.get(editKey(adapterName, messageID))
+	if !ok || t.clock.Since(at) > editTTL {
+		return ""
+	}
+	e.edits = append(e.edits, interactionID)
+	t.byInteraction[interactionID] = e
+	return e.interactionID
+}
+
+// prepare runs before an interaction's intents are delivered. For an edit
+// it points the first intent at the original reply; for an original
+// message it remembers the first intent as that reply.
+func (t *editTracker) prepare(event *protocol.CanonicalInteractionEvent, intent *protocol.InteractionIntent) {
+	if intent == nil || intent.IntentType == protocol.IntentTypeNoop {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, ok := t.byInteraction[event.InteractionID]
+	if !ok {
+		return
+	}
+	switch {
+	case event.Meta.IsEdit:
+		intent.Replaces = e.replyIntentID
+	case e.replyIntentID == "":
+		e.replyIntentID = intent.IntentID
+	}
+}
+
+func (t *editTracker) forgetLocked(e *editEntry) {
+	t.byMessage.delete(e.key)
+	t.forgetInteractionsLocked(e)
+}
+
+// forgetInteractionsLocked drops the interaction IDs linked to e.
+func (t *editTracker) forgetInteractionsLocked(e *editEntry) {
+	delete(t.byInteraction, e.interactionID)
+	for _, id := range e.edits {
+		delete(t.byInteraction, id)
+	}
+}
+
+// linkEdit records inbound messages, and links edit events to the message
+// they change by setting Meta.EditOf. It is a no-op without RespondToEdits.
+func (g *Gateway) linkEdit(ec *eventContext) {
+	if !g.config.RespondToEdits {
+		return
+	}
+	event := ec.event
+	if event.Meta.IsEdit {
+		if messageID := protocol.EditedMessageID(event); messageID != "" {
+			event.Meta.EditOf = g.edits.link(ec.adapterName, messageID, event.InteractionID)
+		}
+		return
+	}
+	if messageID, _ := event.Input.Payload["messageId"].(string); messageID != "" {
+		g.edits.track(ec.adapterName, messageID, event.InteractionID)
+	}
+}
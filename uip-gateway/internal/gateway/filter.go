@@ -0,0 +1,217 @@
+package gateway
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// FilterConfig selects which events the gateway answers, by channel and user.
+// Patterns are globs: "*" matches any run of characters and "?" one character.
+//
+// Deny wins: an event matching any deny pattern is dropped even if it also
+// matches an allow pattern. A non-empty allow list drops everything it does
+// not match. The channel lists only apply to events with a channelId, so
+// direct messages are governed by the user lists alone.
+//
+// Messages from bots are dropped in group, channel and thread conversations
+// by default, so bots cannot answer each other (or themselves) in a loop;
+// see DropBots. Inbound messages whose messageId matches a message the
+// gateway recently sent are always dropped as echoes.
+type FilterConfig struct {
+	AllowChannels []string `json:"allow_channels" yaml:"allow_channels"`
+	DenyChannels  []string `json:"deny_channels" yaml:"deny_channels"`
+	AllowUsers    []string `json:"allow_users" yaml:"allow_users"`
+	DenyUsers     []string `json:"deny_users" yaml:"deny_users"`
+	// DropBots selects where bot-authored messages are dropped: "groups"
+	// (the default), "all", or "none".
+	DropBots string `json:"drop_bots" yaml:"drop_bots"`
+	// AllowBots lists bot user IDs (globs) that are never dropped as bots.
+	AllowBots []string `json:"allow_bots" yaml:"allow_bots"`
+	// LogDropped logs each filtered event at info level.
+	LogDropped bool `json:"log_dropped" yaml:"log_dropped"`
+}
+
+// Filter reasons, used as the uip_events_filtered_total reason label.
+const (
+	FilterDenyChannel       = "deny_channel"
+	FilterDenyUser          = "deny_user"
+	FilterChannelNotAllowed = "channel_not_allowed"
+	FilterUserNotAllowed    = "user_not_allowed"
+	FilterNotMentioned      = "not_mentioned"
+	FilterBotSender         = "bot_sender"
+	FilterSelfEcho          = "self_echo"
+	FilterEditIgnored       = "edit_ignored"
+	FilterReactionIgnored   = "reaction_ignored"
+	FilterDuplicate         = "duplicate"
+	FilterIgnorePattern     = "ignore_pattern"
+)
+
+// DropBots values.
+const (
+	DropBotsGroups = "groups"
+	DropBotsAll    = "all"
+	DropBotsNone   = "none"
+)
+
+var eventsFilteredTotal = metrics.NewCounter("uip_events_filtered_total",
+	"Inbound events dropped by gateway filters, by adapter and reason.",
+	"adapter", "reason")
+
+// EventFilter drops inbound events before they reach Clawdbot, according to
+// a FilterConfig.
+type EventFilter struct {
+	allowChannels, denyChannels []*regexp.Regexp
+	allowUsers, denyUsers       []*regexp.Regexp
+	allowBots                   []*regexp.Regexp
+	dropBots                    string
+	logDropped                  bool
+}
+
+// NewEventFilter compiles the filter's patterns. Empty patterns are rejected.
+func NewEventFilter(cfg FilterConfig) (*EventFilter, error) {
+	f := &EventFilter{dropBots: cfg.DropBots, logDropped: cfg.LogDropped}
+	switch f.dropBots {
+	case "":
+		f.dropBots = DropBotsGroups
+	case DropBotsGroups, DropBotsAll, DropBotsNone:
+	default:
+		return nil, fmt.Errorf("drop_bots: unknown value %q (want groups, all or none)", cfg.DropBots)
+	}
+	lists := []struct {
+		name     string
+		patterns []string
+		dst      *[]*regexp.Regexp
+	}{
+		{"allow_channels", cfg.AllowChannels, &f.allowChannels},
+		{"deny_channels", cfg.DenyChannels, &f.denyChannels},
+		{"allow_users", cfg.AllowUsers, &f.allowUsers},
+		{"deny_users", cfg.DenyUsers, &f.denyUsers},
+		{"allow_bots", cfg.AllowBots, &f.allowBots},
+	}
+	for _, l := range lists {
+		for _, p := range l.patterns {
+			if strings.TrimSpace(p) == "" {
+				return nil, fmt.Errorf("%s: empty pattern", l.name)
+			}
+			*l.dst = append(*l.dst, compileGlob(p))
+		}
+	}
+	return f, nil
+}
+
+// compileGlob turns a "*" / "?" glob into an anchored regular expression.
+func compileGlob(pattern string) *regexp.Regexp {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, ".*")
+	quoted = strings.ReplaceAll(quoted, `\?`, ".")
+	return regexp.MustCompile("^" + quoted + "$")
+}
+
+func matchAny(globs []*regexp.Regexp, s string) bool {
+	for _, re := range globs {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check returns the reason event is filtered out, or "" if it may proceed.
+func (f *EventFilter) Check(event *protocol.CanonicalInteractionEvent) string {
+	channelID, _ := event.Input.Payload["channelId"].(string)
+	userID := event.Session.UserID
+
+	// Deny lists first: deny wins over allow
+	if channelID != "" && matchAny(f.denyChannels, channelID) {
+		return FilterDenyChannel
+	}
+	if matchAny(f.denyUsers, userID) {
+		return FilterDenyUser
+	}
+	if channelID != "" && len(f.allowChannels) > 0 && !matchAny(f.allowChannels, channelID) {
+		return FilterChannelNotAllowed
+	}
+	if len(f.allowUsers) > 0 && !matchAny(f.allowUsers, userID) {
+		return FilterUserNotAllowed
+	}
+	if event.Session.IsBot() && f.dropsBot(event) && !matchAny(f.allowBots, userID) {
+		return FilterBotSender
+	}
+	return ""
+}
+
+func (f *EventFilter) dropsBot(event *protocol.CanonicalInteractionEvent) bool {
+	switch f.dropBots {
+	case DropBotsAll:
+		return true
+	case DropBotsGroups:
+		return protocol.ConversationType(event) != protocol.ConversationDirect
+	}
+	return false
+}
+
+// SetFilter installs the inbound event filter. A nil filter lets every
+// event through.
+func (g *Gateway) SetFilter(f *EventFilter) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.filter = f
+}
+
+// filtered reports whether the event is dropped by the configured filter or
+// by RespondOnlyWhenMentioned, recording the drop.
+func (g *Gateway) filtered(ec *eventContext) bool {
+	g.mu.RLock()
+	f := g.filter
+	g.mu.RUnlock()
+
+	reason := ""
+	if g.duplicateEvent(ec) {
+		reason = FilterDuplicate
+	} else if messageID, _ := ec.event.Input.Payload["messageId"].(string); g.echoes.seen(messageID) {
+		reason = FilterSelfEcho
+	} else if f != nil {
+		reason = f.Check(ec.event)
+	} else if ec.event.Session.IsBot() && protocol.ConversationType(ec.event) != protocol.ConversationDirect {
+		// No filter installed: keep the default bot drop for groups
+		reason = FilterBotSender
+	}
+	isReaction := ec.event.Input.Type == protocol.InputTypeReaction
+	if reason == "" && g.config.RespondOnlyWhenMentioned && !isReaction &&
+		protocol.ConversationType(ec.event) != protocol.ConversationDirect &&
+		!protocol.MentionsBot(ec.event) {
+		reason = FilterNotMentioned
+	}
+	if reason == "" && ec.event.Meta.IsEdit && !g.config.RespondToEdits {
+		reason = FilterEditIgnored
+	}
+	if reason == "" && isReaction {
+		if _, ok := protocol.ReactionOf(ec.event); !ok || g.reactionsIgnored() {
+			reason = FilterReactionIgnored
+		}
+	}
+	if reason == "" {
+		return false
+	}
+
+	eventsFilteredTotal.Inc(ec.adapterName, reason)
+	if f != nil && f.logDropped {
+		channelID, _ := ec.event.Input.Payload["channelId"].(string)
+		g.eventLogger(ec).Info("Event filtered",
+			zap.String("userId", ec.event.Session.UserID),
+			zap.String("channelId", channelID),
+			zap.String("reason", reason))
+	}
+	return true
+}
+
+// noopIntent is returned to sync callers for filtered events.
+func noopIntent(event *protocol.CanonicalInteractionEvent) *protocol.InteractionIntent {
+	return protocol.NewInteractionIntent(protocol.IntentTypeNoop, "", event.Session.ExternalSessionID, event.InteractionID)
+}
@@ -0,0 +1,87 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter/memory"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// filterEvent builds an event from userID, in channelID when set.
+func filterEvent(userID, channelID string) *protocol.CanonicalInteractionEvent {
+	payload := map[string]interface{}{"text": "hi"}
+	if channelID != "" {
+		payload["channelId"] = channelID
+	}
+	return protocol.NewCanonicalInteractionEvent("s-"+userID, userID, protocol.InputTypeText,
+		payload, protocol.SurfaceCapabilities{}, "test")
+}
+
+func TestEventFilterPrecedence(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     FilterConfig
+		user    string
+		channel string
+		want    string
+	}{
+		{"no lists", FilterConfig{}, "u1", "c1", ""},
+		{"denied user", FilterConfig{DenyUsers: []string{"u1"}}, "u1", "", FilterDenyUser},
+		{"deny wins over allow", FilterConfig{AllowUsers: []string{"u*"}, DenyUsers: []string{"u1"}}, "u1", "", FilterDenyUser},
+		{"allowed next to a denied user", FilterConfig{AllowUsers: []string{"u*"}, DenyUsers: []string{"u1"}}, "u2", "", ""},
+		{"user not allowed", FilterConfig{AllowUsers: []string{"admin-?"}}, "u1", "", FilterUserNotAllowed},
+		{"single-character glob", FilterConfig{AllowUsers: []string{"admin-?"}}, "admin-7", "", ""},
+		{"glob is anchored", FilterConfig{AllowUsers: []string{"admin"}}, "admin-7", "", FilterUserNotAllowed},
+		{"regexp characters are literal", FilterConfig{AllowUsers: []string{"a.b"}}, "axb", "", FilterUserNotAllowed},
+		{"deny channel wins over allow channel", FilterConfig{AllowChannels: []string{"*"}, DenyChannels: []string{"ops-*"}}, "u1", "ops-1", FilterDenyChannel},
+		{"channel not allowed", FilterConfig{AllowChannels: []string{"support"}}, "u1", "random", FilterChannelNotAllowed},
+		{"channel lists skip direct messages", FilterConfig{AllowChannels: []string{"support"}, DenyChannels: []string{"*"}}, "u1", "", ""},
+		{"denied channel wins over allowed user", FilterConfig{AllowUsers: []string{"u1"}, DenyChannels: []string{"c1"}}, "u1", "c1", FilterDenyChannel},
+		{"denied user wins over allowed channel", FilterConfig{AllowChannels: []string{"c1"}, DenyUsers: []string{"u1"}}, "u1", "c1", FilterDenyUser},
+		{"allowed channel but user not allowed", FilterConfig{AllowChannels: []string{"c1"}, AllowUsers: []string{"u2"}}, "u1", "c1", FilterUserNotAllowed},
+	}
+	for _, tt := range tests {
+		f, err := NewEventFilter(tt.cfg)
+		if err != nil {
+			t.Fatalf("%s: NewEventFilter: %v", tt.name, err)
+		}
+		if got := f.Check(filterEvent(tt.user, tt.channel)); got != tt.want {
+			t.Errorf("%s: Check = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNewEventFilterRejectsBadConfig(t *testing.T) {
+	for _, cfg := range []FilterConfig{
+		{DenyUsers: []string{" "}},
+		{AllowChannels: []string{""}},
+		{DropBots: "sometimes"},
+	} {
+		if _, err := NewEventFilter(cfg); err == nil {
+			t.Errorf("NewEventFilter(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
+
+func TestFilteredEventsGetNoReply(t *testing.T) {
+	g, mem := startGateway(t, DefaultConfig(), echoClient)
+	f, err := NewEventFilter(FilterConfig{AllowUsers: []string{"*"}, DenyUsers: []string{"blocked"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetFilter(f)
+	before := eventsFilteredTotal.Value(memory.Name, FilterDenyUser)
+
+	mem.Inject(mem.Message("blocked", "ignored"))
+	mem.Inject(mem.Message("u1", "answered"))
+	replies := waitReplies(t, mem, 1)
+	if replies[0].TargetSessionID != "memory-u1" {
+		t.Errorf("reply went to %q, want memory-u1", replies[0].TargetSessionID)
+	}
+	if got := eventsFilteredTotal.Value(memory.Name, FilterDenyUser) - before; got != 1 {
+		t.Errorf("deny_user drops grew by %v, want 1", got)
+	}
+	if got := len(mem.Received()); got != 1 {
+		t.Errorf("received %d intents, want 1", got)
+	}
+}
@@ -0,0 +1,51 @@
+package gateway
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// RegisterFormatter sets the formatter applied to intents routed to the named
+// adapter, replacing any formatter the adapter provides itself. A nil
+// formatter disables formatting for that adapter.
+func (g *Gateway) RegisterFormatter(adapterName string, f adapter.Formatter) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.setFormatterLocked(adapterName, f)
+}
+
+func (g *Gateway) setFormatterLocked(adapterName string, f adapter.Formatter) {
+	if f == nil {
+		delete(g.formatters, adapterName)
+		return
+	}
+	if g.formatters == nil {
+		g.formatters = make(map[string]adapter.Formatter)
+	}
+	g.formatters[adapterName] = f
+}
+
+// attachFormatter registers the formatter of adapters that ship one.
+// Called with g.mu held.
+func (g *Gateway) attachFormatter(a adapter.IMAdapter) {
+	fa, ok := a.(adapter.FormattingAdapter)
+	if !ok {
+		return
+	}
+	if f := fa.Formatter(); f != nil {
+		g.setFormatterLocked(a.Name(), f)
+		g.logger.Debug("Adapter formatter registered", zap.String("adapter", a.Name()))
+	}
+}
+
+// applyFormatter converts the intent content to the adapter's native markup.
+func (g *Gateway) applyFormatter(adapterName string, intent *protocol.InteractionIntent) {
+	g.mu.RLock()
+	f := g.formatters[adapterName]
+	g.mu.RUnlock()
+	if f != nil {
+		f.Format(&intent.Content)
+	}
+}
@@ -4,14 +4,20 @@ package gateway
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
 
 	"github.com/zlc_ai/uip-gateway/internal/adapter"
+	"github.com/zlc_ai/uip-gateway/internal/clock"
 	"github.com/zlc_ai/uip-gateway/internal/clawdbot"
+	"github.com/zlc_ai/uip-gateway/internal/i18n"
+	"github.com/zlc_ai/uip-gateway/internal/log"
 	"github.com/zlc_ai/uip-gateway/internal/protocol"
 )
 
@@ -19,17 +25,59 @@ import (
 type Gateway struct {
 	adapters       map[string]adapter.IMAdapter
 	clawdbot       clawdbot.Client
-	logger         *zap.Logger
+	logger         log.Logger
+	config         Config
+	messages       *i18n.Catalog
 	
 	// Session management
 	sessions       *SessionRegistry
+	sessionKey     protocol.SessionKeyFunc
+	serializer     *sessionSerializer // nil unless SerializePerSession
+	
+	// Per-adapter outbound formatters
+	formatters     map[string]adapter.Formatter
+	
+	// Middleware chains
+	inbound        []InboundMiddleware
+	outbound       []OutboundMiddleware
+	reactions      []ReactionHandler
+	sources        *SourceExtractor
+	filter         *EventFilter
+	preprocessor   *Preprocessor
+	contentFilter  *ContentFilter
+	ignore         *IgnoreList
+	tap            *EventTap
+	echoes         *echoGuard
+	dedup          *dedupGuard
+	busy           *busyLimiter // nil unless Config.BusyReply
+	edits          *editTracker
+	
+	// Debugging (nil when disabled)
+	recent         *RecentBuffer
+	
+	// Stats endpoint counters
+	stats          intervalCounters
+	startedAt      time.Time
 	
 	// Event processing
 	eventQueue     chan *eventContext
+	workerQueues   []chan *eventContext // per-worker queues under WorkerAffinity, else nil
 	workerCount    int
+	pending        atomic.Int64 // queued + in-flight events
+	processed      atomic.Int64
+	accepting      atomic.Bool  // cleared when Stop begins
+	queueMu        sync.RWMutex // held for reading by senders, for writing to close the queues
+	
+	// Worker pool
+	activeWorkers  atomic.Int64
+	nextWorkerID   atomic.Int64
+	retireCh       chan struct{}
 	
 	// State
+	clock          clock.Clock
 	started        bool
+	stopped        map[string]bool // adapters stopped at runtime by StopAdapter
+	adapterOps     sync.Mutex      // serializes adapter start/stop
 	mu             sync.RWMutex
 	wg             sync.WaitGroup
 	stopCh         chan struct{}
@@ -40,6 +88,16 @@ type eventContext struct {
 	event       *protocol.CanonicalInteractionEvent
 	adapterName string
 	receivedAt  time.Time
+	
+	// Set for ProcessSync callers: the intent is returned on reply instead of sent
+	callerCtx context.Context
+	reply     chan syncResult
+	
+	// Set when the intents were recorded instead of sent (Config.DryRun)
+	shadowed bool
+	
+	// logger carries the event's correlation fields, set by processEvent
+	logger log.Logger
 }
 
 // Config holds the Gateway configuration.
@@ -50,35 +108,234 @@ type Config struct {
 	QueueSize int `json:"queue_size" yaml:"queue_size"`
 	// SessionTTL is the session time-to-live.
 	SessionTTL time.Duration `json:"session_ttl" yaml:"session_ttl"`
+	// AskTimeout is how long an ask intent's answer is awaited (defaults to DefaultAskTimeout).
+	AskTimeout time.Duration `json:"ask_timeout" yaml:"ask_timeout"`
+	
+	// MinWorkers is the lower bound of the pool when auto-scaling (defaults to WorkerCount).
+	MinWorkers int `json:"min_workers" yaml:"min_workers"`
+	// MaxWorkers enables auto-scaling when greater than WorkerCount.
+	MaxWorkers int `json:"max_workers" yaml:"max_workers"`
+	// ScaleUpDepth is the queue depth above which workers are added.
+	ScaleUpDepth int `json:"scale_up_depth" yaml:"scale_up_depth"`
+	// ScaleDownDepth is the queue depth below which idle workers are retired.
+	ScaleDownDepth int `json:"scale_down_depth" yaml:"scale_down_depth"`
+	// ScaleInterval is how often the queue depth is sampled.
+	ScaleInterval time.Duration `json:"scale_interval" yaml:"scale_interval"`
+	
+	// ErrorReplyTemplate is the reply sent when processing fails.
+	// Supports {userId}, {sessionId}, {interactionId} and {traceId} placeholders.
+	ErrorReplyTemplate string `json:"error_reply_template" yaml:"error_reply_template"`
+	// TimeoutReplyTemplate is the reply sent when Clawdbot times out (defaults to ErrorReplyTemplate).
+	TimeoutReplyTemplate string `json:"timeout_reply_template" yaml:"timeout_reply_template"`
+	
+	// DefaultLocale is the locale used for system messages when the event carries no hint.
+	DefaultLocale string `json:"default_locale" yaml:"default_locale"`
+	// RecentEventsSize is the capacity of the recent-events debug buffer (0 disables it).
+	RecentEventsSize int `json:"recent_events_size" yaml:"recent_events_size"`
+	// SessionKeyStrategy selects a protocol.SessionKeyStrategy preset (defaults to per-session).
+	SessionKeyStrategy string `json:"session_key_strategy" yaml:"session_key_strategy"`
+	
+	// Mode is ModeAsync (default) or ModeSync.
+	Mode string `json:"mode" yaml:"mode"`
+	// SerializePerSession processes events of one conversation in order, one at a time.
+	SerializePerSession bool `json:"serialize_per_session" yaml:"serialize_per_session"`
+	// WorkerAffinity gives each worker its own queue and routes every event
+	// of a conversation to the same worker, which orders them without
+	// SerializePerSession. It fixes the pool at WorkerCount: auto-scaling
+	// is disabled.
+	WorkerAffinity bool `json:"worker_affinity" yaml:"worker_affinity"`
+	// QueueFullPolicy is QueueDropNew (default), QueueDropOld or QueueBlock.
+	QueueFullPolicy string `json:"queue_full_policy" yaml:"queue_full_policy"`
+	// EnqueueTimeout bounds the wait under QueueBlock (defaults to DefaultEnqueueTimeout).
+	EnqueueTimeout time.Duration `json:"enqueue_timeout" yaml:"enqueue_timeout"`
+	// BusyReply tells users whose messages are dropped at a full queue that
+	// the gateway is overloaded (see replyBusy), instead of dropping silently.
+	BusyReply bool `json:"busy_reply" yaml:"busy_reply"`
+	// BusyReplyTemplate overrides the busy reply (i18n.KeyBusyReply), with the
+	// ErrorReplyTemplate placeholders.
+	BusyReplyTemplate string `json:"busy_reply_template" yaml:"busy_reply_template"`
+	// BusyReplyInterval is the least time between busy replies to one session
+	// (defaults to DefaultBusyReplyInterval).
+	BusyReplyInterval time.Duration `json:"busy_reply_interval" yaml:"busy_reply_interval"`
+	// RespondOnlyWhenMentioned drops group, channel and thread events that do
+	// not mention the bot (protocol.MentionsBot). Direct messages are unaffected.
+	RespondOnlyWhenMentioned bool `json:"respond_only_when_mentioned" yaml:"respond_only_when_mentioned"`
+	// RespondToEdits re-runs edited messages (EventMeta.IsEdit) and updates
+	// the earlier reply in place where the platform supports edits. Edit
+	// events are dropped when false.
+	RespondToEdits bool `json:"respond_to_edits" yaml:"respond_to_edits"`
+	// ForwardReactions sends reaction events (protocol.InputTypeReaction)
+	// to Clawdbot. When false they only reach RegisterReactionHandler
+	// handlers, and are dropped if there are none.
+	ForwardReactions bool `json:"forward_reactions" yaml:"forward_reactions"`
+	// DedupWindow drops an inbound event whose idempotency key (see
+	// adapter.DedupAdapter) was already seen from the same adapter this
+	// recently, as a platform redelivery (0 disables deduplication).
+	DedupWindow time.Duration `json:"dedup_window" yaml:"dedup_window"`
+	// DedupWindows overrides DedupWindow by adapter name, e.g. longer for a
+	// platform that retries over minutes; 0 disables it for that adapter.
+	DedupWindows map[string]time.Duration `json:"dedup_windows" yaml:"dedup_windows"`
+	// ConversationCapabilities overrides capabilities by adapter name, then
+	// conversation type (see resolveCapabilities).
+	ConversationCapabilities map[string]protocol.ConversationCapabilities `json:"conversation_capabilities" yaml:"conversation_capabilities"`
+	// DryRun processes events through Clawdbot as usual but only logs and
+	// records the resulting intents instead of sending them (shadow mode).
+	DryRun bool `json:"dry_run" yaml:"dry_run"`
+	// CrashOnPanic re-raises a panic in event processing after logging it,
+	// for deployments that prefer a supervisor restart. By default the
+	// panic is recovered and the worker carries on.
+	CrashOnPanic bool `json:"crash_on_panic" yaml:"crash_on_panic"`
+	
+	// SessionKey overrides SessionKeyStrategy with a custom key function.
+	SessionKey protocol.SessionKeyFunc `json:"-" yaml:"-"`
+	// OnSessionExpire is called for each session evicted after SessionTTL of
+	// inactivity (see SessionRegistry.OnExpire).
+	OnSessionExpire func(session protocol.Session) `json:"-" yaml:"-"`
+	
+	// Catalog holds localized system messages (a built-in catalog is used if nil).
+	// ErrorReplyTemplate and TimeoutReplyTemplate are registered into it as
+	// DefaultLocale overrides.
+	Catalog *i18n.Catalog `json:"-" yaml:"-"`
+	
+	// Clock drives session, ask, echo, edit and dedup expiry and the event
+	// timings (clock.System if nil).
+	Clock clock.Clock `json:"-" yaml:"-"`
 }
 
 // DefaultConfig returns the default Gateway configuration.
 func DefaultConfig() Config {
 	return Config{
-		WorkerCount: 10,
-		QueueSize:   1000,
-		SessionTTL:  24 * time.Hour,
+		WorkerCount:     10,
+		QueueSize:       1000,
+		SessionTTL:      24 * time.Hour,
+		ScaleUpDepth:    100,
+		ScaleDownDepth:  1,
+		ScaleInterval:   time.Second,
+		QueueFullPolicy: QueueDropNew,
+		EnqueueTimeout:  DefaultEnqueueTimeout,
 	}
 }
 
 // New creates a new UIP Gateway.
-func New(cfg Config, clawdbotClient clawdbot.Client, logger *zap.Logger) *Gateway {
+func New(cfg Config, clawdbotClient clawdbot.Client, logger log.Logger) *Gateway {
 	if logger == nil {
-		logger, _ = zap.NewProduction()
+		logger = log.Default()
+	}
+	
+	defaults := DefaultConfig()
+	if cfg.MinWorkers <= 0 || cfg.MinWorkers > cfg.WorkerCount {
+		cfg.MinWorkers = cfg.WorkerCount
+	}
+	if cfg.ScaleUpDepth <= 0 {
+		cfg.ScaleUpDepth = defaults.ScaleUpDepth
+	}
+	if cfg.ScaleDownDepth <= 0 {
+		cfg.ScaleDownDepth = defaults.ScaleDownDepth
+	}
+	if cfg.ScaleInterval <= 0 {
+		cfg.ScaleInterval = defaults.ScaleInterval
+	}
+	if !validQueueFullPolicy(cfg.QueueFullPolicy) {
+		if cfg.QueueFullPolicy != "" {
+			logger.Warn("Unknown queue full policy, dropping new events",
+				zap.String("policy", cfg.QueueFullPolicy))
+		}
+		cfg.QueueFullPolicy = QueueDropNew
+	}
+	if cfg.EnqueueTimeout <= 0 {
+		cfg.EnqueueTimeout = DefaultEnqueueTimeout
+	}
+	if cfg.BusyReplyInterval <= 0 {
+		cfg.BusyReplyInterval = DefaultBusyReplyInterval
+	}
+	if cfg.WorkerAffinity && cfg.WorkerCount <= 0 {
+		cfg.WorkerAffinity = false
+	}
+	if cfg.WorkerAffinity && cfg.MaxWorkers > cfg.WorkerCount {
+		// Resizing the pool would move conversations between workers
+		logger.Warn("Worker affinity enabled, disabling worker auto-scaling",
+			zap.Int("workers", cfg.WorkerCount))
+		cfg.MaxWorkers = 0
+	}
+	
+	clk := clock.Or(cfg.Clock)
+	messages := cfg.Catalog
+	if messages == nil {
+		messages = i18n.NewCatalog(cfg.DefaultLocale)
+	}
+	overrides := make(map[string]string)
+	if cfg.ErrorReplyTemplate != "" {
+		overrides[i18n.KeyErrorReply] = cfg.ErrorReplyTemplate
+	}
+	if cfg.TimeoutReplyTemplate != "" {
+		overrides[i18n.KeyTimeoutReply] = cfg.TimeoutReplyTemplate
+	}
+	if cfg.BusyReplyTemplate != "" {
+		overrides[i18n.KeyBusyReply] = cfg.BusyReplyTemplate
+	}
+	messages.Register(messages.DefaultLocale(), overrides)
+	
+	sessionKey := cfg.SessionKey
+	if sessionKey == nil {
+		var err error
+		sessionKey, err = protocol.SessionKeyFuncFor(protocol.SessionKeyStrategy(cfg.SessionKeyStrategy))
+		if err != nil {
+			logger.Warn("Falling back to per-session keys", zap.Error(err))
+			sessionKey, _ = protocol.SessionKeyFuncFor(protocol.SessionKeySession)
+		}
+	}
+	
+	var recent *RecentBuffer
+	if cfg.RecentEventsSize > 0 {
+		recent = NewRecentBuffer(cfg.RecentEventsSize)
+	}
+	var busy *busyLimiter
+	if cfg.BusyReply {
+		busy = newBusyLimiter(cfg.BusyReplyInterval, clk)
+	}
+	
+	// Worker affinity already runs each conversation in order
+	var serializer *sessionSerializer
+	if cfg.SerializePerSession && !cfg.WorkerAffinity {
+		serializer = newSessionSerializer()
+	}
+	
+	var eventQueue chan *eventContext
+	var workerQueues []chan *eventContext
+	if cfg.WorkerAffinity {
+		workerQueues = newWorkerQueues(cfg.WorkerCount, cfg.QueueSize)
+	} else {
+		eventQueue = make(chan *eventContext, cfg.QueueSize)
 	}
 	
 	return &Gateway{
-		adapters:    make(map[string]adapter.IMAdapter),
-		clawdbot:    clawdbotClient,
-		logger:      logger,
-		sessions:    NewSessionRegistry(cfg.SessionTTL),
-		eventQueue:  make(chan *eventContext, cfg.QueueSize),
-		workerCount: cfg.WorkerCount,
-		stopCh:      make(chan struct{}),
+		adapters:     make(map[string]adapter.IMAdapter),
+		stopped:      make(map[string]bool),
+		clawdbot:     clawdbotClient,
+		logger:       logger,
+		config:       cfg,
+		messages:     messages,
+		recent:       recent,
+		echoes:       newEchoGuard(clk),
+		dedup:        newDedupGuard(clk),
+		busy:         busy,
+		edits:        newEditTracker(clk),
+		sessionKey:   sessionKey,
+		serializer:   serializer,
+		retireCh:     make(chan struct{}),
+		sessions:     newSessionRegistry(cfg.SessionTTL, cfg.OnSessionExpire, clk),
+		eventQueue:   eventQueue,
+		workerQueues: workerQueues,
+		workerCount:  cfg.WorkerCount,
+		stopCh:       make(chan struct{}),
+		startedAt:    clk.Now(),
+		clock:        clk,
 	}
 }
 
-// RegisterAdapter adds an IM adapter to the gateway.
+// RegisterAdapter adds an IM adapter to the gateway. Adapters can only be
+// added before Start; once running, registered adapters are toggled with
+// StopAdapter and StartAdapter.
 func (g *Gateway) RegisterAdapter(a adapter.IMAdapter) error {
 	g.mu.Lock()
 	defer g.mu.Unlock()
@@ -97,6 +354,8 @@ func (g *Gateway) RegisterAdapter(a adapter.IMAdapter) error {
 		g.handleEvent(event, name)
 	})
 	
+	g.attachSync(a)
+	g.attachFormatter(a)
 	g.adapters[name] = a
 	g.logger.Info("Adapter registered", zap.String("adapter", name))
 	return nil
@@ -111,6 +370,7 @@ func (g *Gateway) Start(ctx context.Context) error {
 	}
 	g.started = true
 	g.mu.Unlock()
+	g.accepting.Store(true)
 	
 	g.logger.Info("Starting UIP Gateway",
 		zap.Int("workers", g.workerCount),
@@ -118,8 +378,13 @@ func (g *Gateway) Start(ctx context.Context) error {
 	
 	// Start event processing workers
 	for i := 0; i < g.workerCount; i++ {
+		g.spawnWorker()
+	}
+	
+	// Start worker pool auto-scaling
+	if g.config.MaxWorkers > g.workerCount {
 		g.wg.Add(1)
-		go g.eventWorker(i)
+		go g.autoscale()
 	}
 	
 	// Start session cleanup
@@ -150,22 +415,41 @@ func (g *Gateway) Stop(ctx context.Context) error {
 	g.started = false
 	g.mu.Unlock()
 	
-	g.logger.Info("Stopping UIP Gateway")
+	// Reject events from here on: adapters may still deliver a few while
+	// they shut down, and those must not reach a closed queue
+	g.accepting.Store(false)
 	
-	// Signal workers to stop
-	close(g.stopCh)
+	g.logger.Info("Stopping UIP Gateway")
 	
-	// Stop all adapters
+	// Stop all adapters so no new events arrive, skipping those already
+	// stopped at runtime
+	g.adapterOps.Lock()
 	for name, a := range g.adapters {
+		if g.stopped[name] {
+			continue
+		}
 		if err := a.Stop(ctx); err != nil {
 			g.logger.Error("Failed to stop adapter",
 				zap.String("adapter", name),
 				zap.Error(err))
 		}
 	}
+	g.adapterOps.Unlock()
+	
+	// Let workers finish queued events before forcing a stop
+	result := g.Drain(ctx)
+	g.logger.Info("Event queue drained",
+		zap.Int64("processed", result.Processed),
+		zap.Int("abandoned", result.Abandoned))
+	
+	// Signal workers to stop
+	close(g.stopCh)
 	
-	// Close event queue
-	close(g.eventQueue)
+	// Close event queue once no sender is mid-enqueue. Blocked senders
+	// were released by stopCh above.
+	g.queueMu.Lock()
+	g.closeQueues()
+	g.queueMu.Unlock()
 	
 	// Wait for workers to finish
 	done := make(chan struct{})
@@ -189,22 +473,66 @@ func (g *Gateway) Stop(ctx context.Context) error {
 	return nil
 }
 
+// DrainResult reports the outcome of draining the event queue.
+type DrainResult struct {
+	// Processed is the number of events completed while draining.
+	Processed int64
+	// Abandoned is the number of events still queued when the drain gave up.
+	Abandoned int
+}
+
+// Drain blocks until the event queue is empty and no event is in flight,
+// or until ctx expires. Workers keep running; callers should stop adapters
+// first so the queue is not refilled while draining.
+func (g *Gateway) Drain(ctx context.Context) DrainResult {
+	start := g.processed.Load()
+	
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	
+	for {
+		if g.pending.Load() == 0 {
+			return DrainResult{Processed: g.processed.Load() - start}
+		}
+		
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			abandoned := g.queueDepth()
+			g.logger.Warn("Drain timed out with events still queued",
+				zap.Int("abandoned", abandoned),
+				zap.Int64("pending", g.pending.Load()))
+			return DrainResult{
+				Processed: g.processed.Load() - start,
+				Abandoned: abandoned,
+			}
+		}
+	}
+}
+
 // handleEvent is called by adapters when they receive an event.
 func (g *Gateway) handleEvent(event *protocol.CanonicalInteractionEvent, adapterName string) {
 	ctx := &eventContext{
 		event:       event,
 		adapterName: adapterName,
-		receivedAt:  time.Now(),
+		receivedAt:  g.clock.Now(),
 	}
 	
-	select {
-	case g.eventQueue <- ctx:
-		g.logger.Debug("Event queued",
-			zap.String("interactionId", event.InteractionID),
-			zap.String("adapter", adapterName))
-	default:
-		g.logger.Warn("Event queue full, dropping event",
-			zap.String("interactionId", event.InteractionID))
+	eventsTotal.Inc(adapterName, conversationTypeLabel(event))
+	g.stats.recordEvent(adapterName)
+	
+	if g.filtered(ctx) {
+		return
+	}
+	g.linkEdit(ctx)
+	
+	// Build the logger before a worker can take the event: eventLogger
+	// caches it on the context, so calling it after enqueue races
+	logger := g.eventLogger(ctx)
+	if g.enqueue(context.Background(), ctx) {
+		logger.Debug("Event queued")
+	} else {
+		g.replyBusy(ctx)
 	}
 }
 
@@ -212,20 +540,30 @@ func (g *Gateway) handleEvent(event *protocol.CanonicalInteractionEvent, adapter
 func (g *Gateway) eventWorker(id int) {
 	defer g.wg.Done()
 	
+	activeWorkersGauge.Set(float64(g.activeWorkers.Add(1)))
+	defer func() {
+		activeWorkersGauge.Set(float64(g.activeWorkers.Add(-1)))
+	}()
+	
 	g.logger.Debug("Event worker started", zap.Int("workerId", id))
 	
+	queue := g.workerQueue(id)
 	for {
 		select {
-		case ctx, ok := <-g.eventQueue:
+		case ctx, ok := <-queue:
 			if !ok {
 				g.logger.Debug("Event worker stopping", zap.Int("workerId", id))
 				return
 			}
-			g.processEvent(ctx)
+			g.dispatch(ctx)
 			
 		case <-g.stopCh:
 			g.logger.Debug("Event worker received stop signal", zap.Int("workerId", id))
 			return
+			
+		case <-g.retireCh:
+			g.logger.Debug("Event worker retired", zap.Int("workerId", id))
+			return
 		}
 	}
 }
@@ -233,84 +571,223 @@ func (g *Gateway) eventWorker(id int) {
 // processEvent handles a single interaction event.
 func (g *Gateway) processEvent(ctx *eventContext) {
 	event := ctx.event
+	logger := g.eventLogger(ctx)
 	
 	// Log processing start
-	g.logger.Info("Processing event",
-		zap.String("interactionId", event.InteractionID),
-		zap.String("sessionId", event.Session.ExternalSessionID),
-		zap.String("adapter", ctx.adapterName),
-		zap.Duration("queueTime", time.Since(ctx.receivedAt)))
+	logger.Info("Processing event",
+		zap.Duration("queueTime", g.clock.Since(ctx.receivedAt)))
+	
+	// Derive the conversation key and update session
+	event.Session.Key = g.sessionKey(event)
+	g.sessions.Touch(event.Session.Key, event.Session)
+	
+	// Negotiate capabilities for this conversation before Clawdbot sees them
+	g.resolveCapabilities(ctx.adapterName, event)
+	
+	// Strip bot mentions and command triggers before the text reaches Clawdbot
+	g.applyPreprocess(event)
 	
-	// Update session
-	g.sessions.Touch(event.Session.ExternalSessionID, event.Session)
+	// Reactions reach the reaction handlers, and Clawdbot only when forwarded
+	if g.handleReaction(ctx) {
+		return
+	}
+	
+	// Stay silent on messages matching an ignore rule
+	if g.ignored(ctx) {
+		return
+	}
 	
-	// Create processing context with timeout
-	processCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Create processing context with timeout, bounded by the sync caller if any
+	parent := context.Background()
+	if ctx.callerCtx != nil {
+		parent = ctx.callerCtx
+	}
+	processCtx, cancel := context.WithTimeout(log.NewContext(parent, logger), 30*time.Second)
 	defer cancel()
 	
-	// Send to Clawdbot
-	intent, err := g.clawdbot.ProcessEvent(processCtx, event)
-	if err != nil {
-		g.logger.Error("Clawdbot processing failed",
-			zap.String("interactionId", event.InteractionID),
+	var intents []*protocol.InteractionIntent
+	var procErr error
+	if g.recent != nil {
+		defer func() { g.recent.record(ctx, g.clock.Now(), firstIntent(intents), procErr) }()
+	}
+	
+	if err := g.runInbound(event); err != nil {
+		procErr = err
+		logger.Warn("Inbound middleware rejected event",
 			zap.Error(err))
-		
-		// Create error intent
-		intent = protocol.NewInteractionIntent(
-			protocol.IntentTypeReply,
-			"Sorry, I encountered an error processing your request. Please try again.",
-			event.Session.ExternalSessionID,
-			event.InteractionID,
-		)
+		intents = []*protocol.InteractionIntent{g.errorIntent(event, err)}
+	} else if retry := g.checkAnswer(ctx); retry != nil {
+		// The answer does not fit the pending ask: prompt again
+		intents = []*protocol.InteractionIntent{retry}
+	} else {
+		// Send to Clawdbot
+		intents, err = clawdbot.ProcessAll(processCtx, g.clawdbot, event)
+		g.stats.recordClawdbot(err != nil)
+		if err != nil {
+			procErr = err
+			category := clawdbot.ErrorCategory(err)
+			clawdbotErrorsTotal.Inc(ctx.adapterName, errorCategoryLabel(category))
+			logger.Error("Clawdbot processing failed",
+				zap.String("category", category),
+				zap.Error(err))
+			intents = []*protocol.InteractionIntent{g.errorIntent(event, err)}
+		} else {
+			if len(intents) == 0 {
+				intents = []*protocol.InteractionIntent{noopIntent(event)}
+			}
+			for _, intent := range intents {
+				if err := g.runOutbound(intent); err != nil {
+					procErr = err
+					logger.Warn("Outbound middleware rejected intent",
+						zap.String(log.KeyIntentID, intent.IntentID),
+						zap.Error(err))
+					intents = []*protocol.InteractionIntent{g.errorIntent(event, err)}
+					break
+				}
+			}
+			g.trackAsks(ctx, intents)
+		}
+	}
+	
+	// Point a reply to an edited message at the reply it updates
+	g.edits.prepare(event, firstIntent(intents))
+	
+	// Scrub replies, then apply capability-based degradation and
+	// platform-native formatting
+	for _, intent := range intents {
+		g.applyContentFilter(ctx, intent)
+		g.applyDegradation(ctx, intent)
+		g.applyFormatter(ctx.adapterName, intent)
+	}
+	g.tapEvent(ctx, intents, procErr)
+	
+	// In dry-run mode nothing is posted: sync callers get a noop
+	if g.config.DryRun {
+		g.shadow(ctx, intents)
+		if ctx.reply != nil {
+			ctx.reply <- syncResult{intent: noopIntent(event), err: procErr}
+		}
+		eventDuration.Observe(g.clock.Since(ctx.receivedAt).Seconds(), ctx.adapterName, conversationTypeLabel(event))
+		return
 	}
 	
-	// Apply capability-based degradation
-	g.applyDegradation(event, intent)
+	// Sync callers deliver the first intent themselves; the rest are sent
+	if ctx.reply != nil {
+		ctx.reply <- syncResult{intent: intents[0], err: procErr}
+		intents = intents[1:]
+		if len(intents) == 0 {
+			eventDuration.Observe(g.clock.Since(ctx.receivedAt).Seconds(), ctx.adapterName, conversationTypeLabel(event))
+			return
+		}
+	}
 	
-	// Route intent back to adapter
+	// Route intents back to adapter
 	g.mu.RLock()
 	adapter, exists := g.adapters[ctx.adapterName]
 	g.mu.RUnlock()
 	
 	if !exists {
-		g.logger.Error("Adapter not found for response",
-			zap.String("adapter", ctx.adapterName))
+		procErr = fmt.Errorf("adapter %s not found", ctx.adapterName)
+		logger.Error("Adapter not found for response")
 		return
 	}
 	
-	// Send intent
-	if err := adapter.SendIntent(processCtx, intent); err != nil {
-		g.logger.Error("Failed to send intent",
-			zap.String("intentId", intent.IntentID),
-			zap.String("adapter", ctx.adapterName),
-			zap.Error(err))
-		return
+	// Send intents in order, stopping at the first failure so a follow-up
+	// never arrives without the intents before it
+	for i, intent := range intents {
+		if err := adapter.SendIntent(processCtx, intent); err != nil {
+			procErr = err
+			sendIntentTotal.Inc(ctx.adapterName, "failure")
+			logger.Error("Failed to send intent",
+				zap.String(log.KeyIntentID, intent.IntentID),
+				zap.Int("skipped", len(intents)-i-1),
+				zap.Error(err))
+			return
+		}
+		sendIntentTotal.Inc(ctx.adapterName, "success")
+		g.echoes.record(intent.IntentID)
 	}
+	eventDuration.Observe(g.clock.Since(ctx.receivedAt).Seconds(), ctx.adapterName, conversationTypeLabel(event))
 	
-	g.logger.Info("Event processed successfully",
-		zap.String("interactionId", event.InteractionID),
-		zap.String("intentId", intent.IntentID),
-		zap.Duration("totalTime", time.Since(ctx.receivedAt)))
+	logger.Info("Event processed successfully",
+		zap.String(log.KeyIntentID, intents[0].IntentID),
+		zap.Int("intents", len(intents)),
+		zap.Duration("totalTime", g.clock.Since(ctx.receivedAt)))
 }
 
-// applyDegradation modifies the intent based on IM capabilities.
-func (g *Gateway) applyDegradation(event *protocol.CanonicalInteractionEvent, intent *protocol.InteractionIntent) {
-	caps := event.Capabilities
-	
-	// If markdown not supported, strip markdown
-	if !caps.SupportsMarkdown {
-		intent.Content.Markdown = ""
+// firstIntent returns the first intent, or nil.
+func firstIntent(intents []*protocol.InteractionIntent) *protocol.InteractionIntent {
+	if len(intents) == 0 {
+		return nil
 	}
-	
-	// If attachments not supported, remove them
-	if !caps.SupportsAttachment {
-		intent.Content.Attachments = nil
+	return intents[0]
+}
+
+// errorIntent builds the reply sent when an event could not be processed.
+func (g *Gateway) errorIntent(event *protocol.CanonicalInteractionEvent, err error) *protocol.InteractionIntent {
+	return protocol.NewInteractionIntent(
+		protocol.IntentTypeReply,
+		renderTemplate(g.errorMessage(event, err), event),
+		event.Session.ExternalSessionID,
+		event.InteractionID,
+	)
+}
+
+// categoryMessages maps OpenClaw error categories to their error replies.
+var categoryMessages = map[string]string{
+	clawdbot.CategoryAuth:             i18n.KeyErrorAuth,
+	clawdbot.CategoryRateLimit:        i18n.KeyErrorRateLimit,
+	clawdbot.CategoryModelUnavailable: i18n.KeyErrorModelUnavailable,
+	clawdbot.CategoryContentFiltered:  i18n.KeyErrorContentFiltered,
+}
+
+// errorCategoryLabel maps an error category to its metric label value.
+func errorCategoryLabel(category string) string {
+	if category == "" {
+		return "unknown"
 	}
-	
-	// If edit not supported and this is an edit intent, convert to reply
-	if !caps.SupportsEdit && intent.IntentType == protocol.IntentTypeNotify {
-		// For now, we just keep as reply
+	return category
+}
+
+// errorMessage picks the localized error template, preferring the timeout
+// variant for deadline errors, the attachment variant for oversized
+// attachments and the category variant for classified OpenClaw errors when
+// they are defined.
+func (g *Gateway) errorMessage(event *protocol.CanonicalInteractionEvent, err error) string {
+	locale := i18n.LocaleOf(event)
+	if errors.Is(err, context.DeadlineExceeded) {
+		if msg, ok := g.messages.Lookup(locale, i18n.KeyTimeoutReply); ok {
+			return msg
+		}
+	}
+	var uerr *protocol.UIPError
+	if errors.As(err, &uerr) && uerr.Code == protocol.ErrCodePayloadTooLarge {
+		if msg, ok := g.messages.Lookup(locale, i18n.KeyAttachmentTooLarge); ok {
+			return msg
+		}
 	}
+	if key, ok := categoryMessages[clawdbot.ErrorCategory(err)]; ok {
+		if msg, ok := g.messages.Lookup(locale, key); ok {
+			return msg
+		}
+	}
+	msg, _ := g.messages.Lookup(locale, i18n.KeyErrorReply)
+	return msg
+}
+
+// Catalog returns the catalog used for system messages, so callers can register translations.
+func (g *Gateway) Catalog() *i18n.Catalog {
+	return g.messages
+}
+
+// renderTemplate substitutes event placeholders in a system reply template.
+func renderTemplate(tmpl string, event *protocol.CanonicalInteractionEvent) string {
+	return strings.NewReplacer(
+		"{userId}", event.Session.UserID,
+		"{sessionId}", event.Session.ExternalSessionID,
+		"{interactionId}", event.InteractionID,
+		"{traceId}", event.Meta.TraceID,
+	).Replace(tmpl)
 }
 
 // sessionCleanup periodically cleans up expired sessions.
@@ -346,13 +823,19 @@ func (g *Gateway) GetAdapter(name string) (adapter.IMAdapter, bool) {
 type SessionRegistry struct {
 	sessions map[string]*sessionEntry
 	ttl      time.Duration
+	clock    clock.Clock
 	mu       sync.RWMutex
+	
+	// OnExpire, if set, is called by Cleanup for each evicted session,
+	// outside the registry lock. Set it before the registry is in use.
+	OnExpire func(session protocol.Session)
 }
 
 type sessionEntry struct {
 	session   protocol.Session
 	createdAt time.Time
 	lastSeen  time.Time
+	ask       *pendingAsk
 }
 
 // NewSessionRegistry creates a new session registry.
@@ -360,15 +843,23 @@ func NewSessionRegistry(ttl time.Duration) *SessionRegistry {
 	return &SessionRegistry{
 		sessions: make(map[string]*sessionEntry),
 		ttl:      ttl,
+		clock:    clock.System,
 	}
 }
 
+func newSessionRegistry(ttl time.Duration, onExpire func(protocol.Session), clk clock.Clock) *SessionRegistry {
+	r := NewSessionRegistry(ttl)
+	r.OnExpire = onExpire
+	r.clock = clk
+	return r
+}
+
 // Touch updates the last seen time for a session.
 func (r *SessionRegistry) Touch(id string, session protocol.Session) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	
-	now := time.Now()
+	now := r.clock.Now()
 	if entry, exists := r.sessions[id]; exists {
 		entry.lastSeen = now
 		entry.session = session
@@ -392,22 +883,28 @@ func (r *SessionRegistry) Get(id string) (protocol.Session, bool) {
 	return protocol.Session{}, false
 }
 
-// Cleanup removes expired sessions and returns the count.
+// Cleanup removes expired sessions, calls OnExpire for each and returns the count.
 func (r *SessionRegistry) Cleanup() int {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	
-	count := 0
-	cutoff := time.Now().Add(-r.ttl)
+	var expired []protocol.Session
+	cutoff := r.clock.Now().Add(-r.ttl)
 	
+	r.mu.Lock()
 	for id, entry := range r.sessions {
 		if entry.lastSeen.Before(cutoff) {
 			delete(r.sessions, id)
-			count++
+			expired = append(expired, entry.session)
+		}
+	}
+	r.mu.Unlock()
+	
+	// The hook may call back into the registry, so run it unlocked
+	if r.OnExpire != nil {
+		for _, session := range expired {
+			r.OnExpire(session)
 		}
 	}
 	
-	return count
+	return len(expired)
 }
 
 // Count returns the number of active sessions.
@@ -0,0 +1,159 @@
+package gateway
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter/memory"
+	"github.com/zlc_ai/uip-gateway/internal/clawdbot"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// clientFunc is a clawdbot.Client answering with a function.
+type clientFunc func(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error)
+
+func (f clientFunc) ProcessEvent(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+	return f(ctx, event)
+}
+
+func (clientFunc) Close() error                     { return nil }
+func (clientFunc) Health(ctx context.Context) error { return nil }
+
+// echoClient replies to each event with its text.
+var echoClient = clientFunc(func(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+	text, _ := event.Input.Payload["text"].(string)
+	return protocol.NewInteractionIntent(protocol.IntentTypeReply, text, event.Session.ExternalSessionID, event.InteractionID), nil
+})
+
+// startGateway starts a gateway with a memory adapter, stopping it when
+// the test ends.
+func startGateway(t *testing.T, cfg Config, client clawdbot.Client) (*Gateway, *memory.MemoryAdapter) {
+	t.Helper()
+	if cfg.WorkerCount == 0 {
+		cfg.WorkerCount = 4
+	}
+	if cfg.QueueSize == 0 {
+		cfg.QueueSize = 100
+	}
+	g := New(cfg, client, zap.NewNop())
+	mem := memory.New(nil)
+	if err := g.RegisterAdapter(mem); err != nil {
+		t.Fatalf("RegisterAdapter: %v", err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		g.Stop(ctx)
+	})
+	return g, mem
+}
+
+// waitReplies waits for n intents to reach mem.
+func waitReplies(t *testing.T, mem *memory.MemoryAdapter, n int) []*protocol.InteractionIntent {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	intents, err := mem.WaitFor(ctx, n)
+	if err != nil {
+		t.Fatalf("waiting for %d replies: got %d: %v", n, len(intents), err)
+	}
+	return intents
+}
+
+func TestEndToEndWithMockClient(t *testing.T) {
+	client := clawdbot.NewMockClient(zap.NewNop())
+	client.SetDelay(time.Millisecond)
+	client.SetResponse("echo: ")
+	_, mem := startGateway(t, DefaultConfig(), client)
+
+	event := mem.Message("u1", "hello")
+	if err := mem.Inject(event); err != nil {
+		t.Fatalf("Inject: %v", err)
+	}
+	waitReplies(t, mem, 1)
+
+	got := mem.Received()
+	if len(got) != 1 {
+		t.Fatalf("received %d intents, want 1", len(got))
+	}
+	intent := got[0]
+	if intent.IntentType != protocol.IntentTypeReply {
+		t.Errorf("intent type = %s, want reply", intent.IntentType)
+	}
+	if intent.Content.Text != "echo: hello" {
+		t.Errorf("text = %q, want %q", intent.Content.Text, "echo: hello")
+	}
+	if intent.TargetSessionID != "memory-u1" {
+		t.Errorf("target session = %q, want memory-u1", intent.TargetSessionID)
+	}
+	if intent.InReplyTo != event.InteractionID {
+		t.Errorf("inReplyTo = %q, want %q", intent.InReplyTo, event.InteractionID)
+	}
+}
+
+func TestEndToEndClientErrorReply(t *testing.T) {
+	failing := clientFunc(func(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+		return nil, context.DeadlineExceeded
+	})
+	cfg := DefaultConfig()
+	cfg.TimeoutReplyTemplate = "too slow for {userId}"
+	_, mem := startGateway(t, cfg, failing)
+
+	mem.Inject(mem.Message("u2", "hello"))
+	intent := waitReplies(t, mem, 1)[0]
+	if !strings.Contains(intent.Content.Text, "too slow for u2") {
+		t.Errorf("error reply = %q, want the rendered timeout template", intent.Content.Text)
+	}
+}
+
+// TestStopWhileEventsArrive sends events from several goroutines while
+// Stop runs. Late events must be rejected, never sent on the closed queue.
+func TestStopWhileEventsArrive(t *testing.T) {
+	for round := 0; round < 5; round++ {
+		slow := clientFunc(func(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+			time.Sleep(time.Millisecond)
+			return echoClient(ctx, event)
+		})
+		cfg := DefaultConfig()
+		cfg.WorkerCount = 2
+		cfg.QueueSize = 8
+		cfg.EnqueueTimeout = time.Millisecond
+		g, mem := startGateway(t, cfg, slow)
+
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		for s := 0; s < 4; s++ {
+			go func() {
+				defer func() { done <- struct{}{} }()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+						g.handleEvent(mem.Message("u1", "hi"), memory.Name)
+					}
+				}
+			}()
+		}
+
+		time.Sleep(2 * time.Millisecond)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := g.Stop(ctx); err != nil {
+			t.Fatalf("Stop: %v", err)
+		}
+		cancel()
+		// Keep sending after Stop returned, then let the senders finish
+		time.Sleep(time.Millisecond)
+		close(stop)
+		for s := 0; s < 4; s++ {
+			<-done
+		}
+	}
+}
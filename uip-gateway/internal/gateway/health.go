@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+)
+
+var componentHealthy = metrics.NewGauge("uip_component_healthy",
+	"1 if the component passed its last health check, 0 otherwise, by component (clawdbot or adapter:<name>).",
+	"component")
+
+// HealthReport is the aggregate result of Gateway.Health.
+type HealthReport struct {
+	// Healthy is true when the gateway is started and every component is healthy.
+	Healthy  bool                       `json:"healthy"`
+	Started  bool                       `json:"started"`
+	Clawdbot ComponentHealth            `json:"clawdbot"`
+	Adapters map[string]ComponentHealth `json:"adapters"`
+}
+
+// ComponentHealth is one component's health check result.
+type ComponentHealth struct {
+	Healthy bool   `json:"healthy"`
+	Error   string `json:"error,omitempty"`
+	// Stopped marks an adapter stopped with StopAdapter; it is not checked
+	// and does not make the gateway unhealthy.
+	Stopped bool `json:"stopped,omitempty"`
+}
+
+func componentHealth(err error) ComponentHealth {
+	if err != nil {
+		return ComponentHealth{Error: err.Error()}
+	}
+	return ComponentHealth{Healthy: true}
+}
+
+// Health checks the Clawdbot client and every registered adapter
+// concurrently, bounded by ctx.
+func (g *Gateway) Health(ctx context.Context) HealthReport {
+	g.mu.RLock()
+	started := g.started
+	adapters := make(map[string]func(context.Context) error, len(g.adapters))
+	var stopped []string
+	for name, a := range g.adapters {
+		if g.stopped[name] {
+			stopped = append(stopped, name)
+			continue
+		}
+		adapters[name] = a.Health
+	}
+	g.mu.RUnlock()
+
+	report := HealthReport{
+		Started:  started,
+		Adapters: make(map[string]ComponentHealth, len(adapters)+len(stopped)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	check := func(component string, health func(context.Context) error, set func(ComponentHealth)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := runHealth(ctx, health)
+			if err != nil {
+				componentHealthy.Set(0, component)
+			} else {
+				componentHealthy.Set(1, component)
+			}
+			mu.Lock()
+			set(componentHealth(err))
+			mu.Unlock()
+		}()
+	}
+
+	check("clawdbot", g.clawdbot.Health, func(h ComponentHealth) { report.Clawdbot = h })
+	for name, health := range adapters {
+		name := name
+		check("adapter:"+name, health, func(h ComponentHealth) { report.Adapters[name] = h })
+	}
+	wg.Wait()
+
+	report.Healthy = started && report.Clawdbot.Healthy
+	for _, h := range report.Adapters {
+		report.Healthy = report.Healthy && h.Healthy
+	}
+	for _, name := range stopped {
+		report.Adapters[name] = ComponentHealth{Stopped: true}
+	}
+	return report
+}
+
+// runHealth runs one check, turning a check that ignores ctx past its
+// deadline into a timeout error.
+func runHealth(ctx context.Context, health func(context.Context) error) error {
+	done := make(chan error, 1)
+	go func() { done <- health(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("health check: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,108 @@
+package gateway
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Ignore rule match modes.
+const (
+	IgnoreMatchPrefix   = "prefix"
+	IgnoreMatchContains = "contains"
+	IgnoreMatchRegex    = "regex"
+)
+
+// IgnoreRule makes the bot stay silent on messages matching Pattern, such
+// as notes to self starting with "//".
+type IgnoreRule struct {
+	// Pattern is the text to look for, or a Go regular expression with
+	// IgnoreMatchRegex.
+	Pattern string `json:"pattern" yaml:"pattern"`
+	// Match is IgnoreMatchPrefix (the default), IgnoreMatchContains or
+	// IgnoreMatchRegex. Regexes are unanchored; use ^ and $ as needed.
+	Match string `json:"match" yaml:"match"`
+	// IgnoreCase matches case-insensitively.
+	IgnoreCase bool `json:"ignore_case" yaml:"ignore_case"`
+}
+
+// IgnoreList matches message text against IgnoreRules. Unlike EventFilter
+// it looks at what a message says, not where it comes from.
+type IgnoreList struct {
+	rules []*regexp.Regexp
+}
+
+// NewIgnoreList compiles the rules. Empty patterns, invalid regexes and
+// unknown match modes are rejected.
+func NewIgnoreList(rules []IgnoreRule) (*IgnoreList, error) {
+	l := &IgnoreList{}
+	for i, r := range rules {
+		if strings.TrimSpace(r.Pattern) == "" {
+			return nil, fmt.Errorf("ignore[%d]: empty pattern", i)
+		}
+		var expr string
+		switch r.Match {
+		case "", IgnoreMatchPrefix:
+			expr = "^" + regexp.QuoteMeta(r.Pattern)
+		case IgnoreMatchContains:
+			expr = regexp.QuoteMeta(r.Pattern)
+		case IgnoreMatchRegex:
+			expr = r.Pattern
+		default:
+			return nil, fmt.Errorf("ignore[%d]: unknown match %q (want prefix, contains or regex)", i, r.Match)
+		}
+		if r.IgnoreCase {
+			expr = "(?i)" + expr
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("ignore[%d]: %w", i, err)
+		}
+		l.rules = append(l.rules, re)
+	}
+	return l, nil
+}
+
+// Match reports whether text matches a rule, and which one.
+func (l *IgnoreList) Match(text string) (int, bool) {
+	for i, re := range l.rules {
+		if re.MatchString(text) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// SetIgnoreList installs the ignore rules. A nil list ignores nothing.
+func (g *Gateway) SetIgnoreList(l *IgnoreList) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ignore = l
+}
+
+// ignored reports whether the event's text, after preprocessing, matches
+// an ignore rule. Such events end without a Clawdbot call or a reply and
+// count as uip_events_filtered_total{reason="ignore_pattern"}.
+func (g *Gateway) ignored(ctx *eventContext) bool {
+	g.mu.RLock()
+	l := g.ignore
+	g.mu.RUnlock()
+	if l == nil {
+		return false
+	}
+	text, _ := ctx.event.Input.Payload["text"].(string)
+	rule, ok := l.Match(text)
+	if !ok {
+		return false
+	}
+
+	eventsFilteredTotal.Inc(ctx.adapterName, FilterIgnorePattern)
+	g.eventLogger(ctx).Debug("Event ignored by pattern", zap.Int("rule", rule))
+	if ctx.reply != nil {
+		ctx.reply <- syncResult{intent: noopIntent(ctx.event)}
+	}
+	eventDuration.Observe(g.clock.Since(ctx.receivedAt).Seconds(), ctx.adapterName, conversationTypeLabel(ctx.event))
+	return true
+}
@@ -0,0 +1,97 @@
+package gateway
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter/memory"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+func TestIgnoreListMatch(t *testing.T) {
+	l, err := NewIgnoreList([]IgnoreRule{
+		{Pattern: "//"},
+		{Pattern: "[skip]", Match: IgnoreMatchContains},
+		{Pattern: `^ok\W*$`, Match: IgnoreMatchRegex, IgnoreCase: true},
+		{Pattern: "NOTE:", IgnoreCase: true},
+		{Pattern: "Draft", Match: IgnoreMatchContains},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		rule int
+		want bool
+	}{
+		{"// note to self", 0, true},
+		{"see https://x.io", -1, false},
+		{"deploy [skip] now", 1, true},
+		{"[skip", -1, false},
+		{"OK!", 2, true},
+		{"ok thanks", -1, false},
+		{"note: buy milk", 3, true},
+		{"a note: later", -1, false},
+		{"My Draft", 4, true},
+		{"my draft", -1, false},
+	}
+	for _, tt := range tests {
+		if rule, ok := l.Match(tt.text); rule != tt.rule || ok != tt.want {
+			t.Errorf("Match(%q) = %d %v, want %d %v", tt.text, rule, ok, tt.rule, tt.want)
+		}
+	}
+}
+
+func TestNewIgnoreListRejectsBadConfig(t *testing.T) {
+	for _, rules := range [][]IgnoreRule{
+		{{Pattern: " "}},
+		{{Pattern: "a(", Match: IgnoreMatchRegex}},
+		{{Pattern: "a", Match: "suffix"}},
+	} {
+		if _, err := NewIgnoreList(rules); err == nil {
+			t.Errorf("NewIgnoreList(%+v) succeeded, want an error", rules)
+		}
+	}
+	// Regex metacharacters are literal outside regex mode
+	if _, err := NewIgnoreList([]IgnoreRule{{Pattern: "a("}}); err != nil {
+		t.Errorf("prefix pattern %q: %v", "a(", err)
+	}
+}
+
+// TestIgnoredEventsGetNoReply checks that an ignored message never reaches
+// Clawdbot, and that ignore rules see the text after preprocessing.
+func TestIgnoredEventsGetNoReply(t *testing.T) {
+	var calls atomic.Int32
+	client := clientFunc(func(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+		calls.Add(1)
+		return echoClient(ctx, event)
+	})
+	cfg := DefaultConfig()
+	cfg.WorkerCount = 1
+	g, mem := startGateway(t, cfg, client)
+	l, err := NewIgnoreList([]IgnoreRule{{Pattern: "//"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetIgnoreList(l)
+	p, err := NewPreprocessor(PreprocessConfig{StripPrefix: true, BotNames: []string{"ai"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.SetPreprocessor(p)
+	before := eventsFilteredTotal.Value(memory.Name, FilterIgnorePattern)
+
+	mem.Inject(mem.Message("u1", "// note"))
+	mem.Inject(mem.Message("u1", "@ai // also a note"))
+	mem.Inject(mem.Message("u1", "hello"))
+	if got := texts(waitReplies(t, mem, 1)); got != "[hello]" || len(mem.Received()) != 1 {
+		t.Errorf("replies = %v, want only [hello]", got)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("Clawdbot called %d times, want 1", n)
+	}
+	if d := eventsFilteredTotal.Value(memory.Name, FilterIgnorePattern) - before; d != 2 {
+		t.Errorf("ignore_pattern count grew by %v, want 2", d)
+	}
+}
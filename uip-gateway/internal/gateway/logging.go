@@ -0,0 +1,22 @@
+package gateway
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/log"
+)
+
+// eventLogger returns the gateway logger with the event's correlation
+// fields (log.EventFields), built once per event. The adapter is the one
+// the gateway attributes the event to, which adapters need not have set
+// in Meta.AdapterName.
+func (g *Gateway) eventLogger(ec *eventContext) log.Logger {
+	if ec.logger == nil {
+		fields := log.EventFields(ec.event)
+		if ec.event.Meta.AdapterName != ec.adapterName {
+			fields = append(fields[:3:3], zap.String(log.KeyAdapter, ec.adapterName))
+		}
+		ec.logger = log.With(g.logger, fields...)
+	}
+	return ec.logger
+}
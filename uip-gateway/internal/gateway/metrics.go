@@ -0,0 +1,42 @@
+package gateway
+
+import (
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+var (
+	activeWorkersGauge = metrics.NewGauge("uip_active_workers",
+		"Number of running event workers.")
+
+	eventsTotal = metrics.NewCounter("uip_events_total",
+		"Inbound events received, by adapter and conversation type.",
+		"adapter", "conversation_type")
+
+	eventsDroppedTotal = metrics.NewCounter("uip_events_dropped_total",
+		"Inbound events dropped before processing, by adapter.",
+		"adapter")
+
+	eventDuration = metrics.NewHistogram("uip_event_duration_seconds",
+		"End-to-end event processing latency from receipt to intent delivery.",
+		nil, "adapter", "conversation_type")
+
+	sendIntentTotal = metrics.NewCounter("uip_send_intent_total",
+		"SendIntent calls, by adapter and result (success/failure).",
+		"adapter", "result")
+
+	clawdbotErrorsTotal = metrics.NewCounter("uip_clawdbot_errors_total",
+		"Failed Clawdbot calls, by adapter and OpenClaw error category (unknown when unclassified).",
+		"adapter", "category")
+
+	intentsShadowedTotal = metrics.NewCounter("uip_intents_shadowed_total",
+		"Intents recorded but not sent in dry-run mode, by adapter and intent type.",
+		"adapter", "intent_type")
+)
+
+// conversationTypeLabel maps an event to a bounded conversation_type label value.
+// protocol.ConversationType only returns known types, so a misbehaving adapter
+// cannot blow up cardinality.
+func conversationTypeLabel(event *protocol.CanonicalInteractionEvent) string {
+	return protocol.ConversationType(event)
+}
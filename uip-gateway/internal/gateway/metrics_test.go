@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter/memory"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+func TestConversationTypeLabel(t *testing.T) {
+	tests := []struct {
+		payload map[string]interface{}
+		want    string
+	}{
+		{nil, "direct"},
+		{map[string]interface{}{}, "direct"},
+		{map[string]interface{}{"conversationType": "group"}, "group"},
+		{map[string]interface{}{"conversationType": "CHANNEL"}, "channel"},
+		{map[string]interface{}{"conversationType": "thread"}, "thread"},
+		{map[string]interface{}{"conversationType": "room-42"}, "direct"},
+		{map[string]interface{}{"conversationType": "room-42", "threadId": "t1"}, "thread"},
+		{map[string]interface{}{"channelId": "c1"}, "channel"},
+		{map[string]interface{}{"conversationType": 7}, "direct"},
+	}
+	for _, tt := range tests {
+		event := &protocol.CanonicalInteractionEvent{Input: protocol.Input{Payload: tt.payload}}
+		if got := conversationTypeLabel(event); got != tt.want {
+			t.Errorf("conversationTypeLabel(%v) = %q, want %q", tt.payload, got, tt.want)
+		}
+	}
+}
+
+// memorySeries counts the series of a snapshot belonging to the memory adapter.
+func memorySeries(snapshot map[string]float64) (series int, total float64) {
+	for labels, v := range snapshot {
+		if strings.HasPrefix(labels, memory.Name+",") {
+			series++
+			total += v
+		}
+	}
+	return series, total
+}
+
+func TestEventMetricsLabelsStayBounded(t *testing.T) {
+	_, mem := startGateway(t, DefaultConfig(), echoClient)
+	_, eventsBefore := memorySeries(eventsTotal.Snapshot())
+	directBefore := eventsTotal.Value(memory.Name, "direct")
+	durationBefore := eventDuration.Count(memory.Name, "direct")
+
+	const n = 40
+	for i := 0; i < n; i++ {
+		event := mem.Message(fmt.Sprintf("u%d", i), "hi")
+		event.Input.Payload["conversationType"] = fmt.Sprintf("made-up-%d", i)
+		mem.Inject(event)
+	}
+	waitReplies(t, mem, n)
+
+	series, events := memorySeries(eventsTotal.Snapshot())
+	if events-eventsBefore != n {
+		t.Errorf("uip_events_total grew by %v, want %d", events-eventsBefore, n)
+	}
+	// direct, group, channel and thread at most, however many values arrive
+	if series > 4 {
+		t.Errorf("uip_events_total has %d memory series, want at most 4", series)
+	}
+	if got := eventsTotal.Value(memory.Name, "direct") - directBefore; got != n {
+		t.Errorf("unknown conversation types: direct grew by %v, want %d", got, n)
+	}
+	if got := eventDuration.Count(memory.Name, "direct") - durationBefore; got != n {
+		t.Errorf("uip_event_duration_seconds{conversation_type=direct} grew by %d, want %d", got, n)
+	}
+}
+
+func TestSendIntentMetrics(t *testing.T) {
+	_, mem := startGateway(t, DefaultConfig(), echoClient)
+	success := sendIntentTotal.Value(memory.Name, "success")
+	failure := sendIntentTotal.Value(memory.Name, "failure")
+
+	mem.Inject(mem.Message("u1", "ok"))
+	waitReplies(t, mem, 1)
+	if got := sendIntentTotal.Value(memory.Name, "success") - success; got != 1 {
+		t.Errorf("success grew by %v, want 1", got)
+	}
+
+	mem.SetSendError(errors.New("platform down"))
+	mem.Inject(mem.Message("u1", "fails"))
+	deadline := time.Now().Add(5 * time.Second)
+	for sendIntentTotal.Value(memory.Name, "failure")-failure < 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("failed SendIntent never counted")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := sendIntentTotal.Value(memory.Name, "success") - success; got != 1 {
+		t.Errorf("success grew by %v after a failed send, want 1", got)
+	}
+}
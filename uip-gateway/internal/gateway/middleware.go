@@ -0,0 +1,138 @@
+package gateway
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// InboundMiddleware inspects or rewrites an event before it is sent to Clawdbot.
+// Returning an error short-circuits processing and the user receives an error reply.
+type InboundMiddleware func(event *protocol.CanonicalInteractionEvent) error
+
+// OutboundMiddleware inspects or rewrites an intent before it is delivered to the adapter.
+// Returning an error replaces the intent with an error reply.
+type OutboundMiddleware func(intent *protocol.InteractionIntent) error
+
+// RegisterInboundMiddleware appends a middleware to the inbound chain.
+//
+// Inbound middlewares run in registration order, after the session is touched
+// and before the event is forwarded to Clawdbot. Each middleware sees the
+// event as modified by the ones registered before it.
+func (g *Gateway) RegisterInboundMiddleware(m InboundMiddleware) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.inbound = append(g.inbound, m)
+}
+
+// RegisterOutboundMiddleware appends a middleware to the outbound chain.
+//
+// Outbound middlewares run in registration order, after Clawdbot responds and
+// before capability-based degradation, so degradation always has the final
+// say on what the adapter receives.
+func (g *Gateway) RegisterOutboundMiddleware(m OutboundMiddleware) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.outbound = append(g.outbound, m)
+}
+
+// runInbound executes the inbound chain, stopping at the first error.
+func (g *Gateway) runInbound(event *protocol.CanonicalInteractionEvent) error {
+	g.mu.RLock()
+	chain := g.inbound
+	g.mu.RUnlock()
+
+	for _, m := range chain {
+		if err := m(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runOutbound executes the outbound chain, stopping at the first error.
+func (g *Gateway) runOutbound(intent *protocol.InteractionIntent) error {
+	g.mu.RLock()
+	chain := g.outbound
+	g.mu.RUnlock()
+
+	for _, m := range chain {
+		if err := m(intent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	mdCodeFence = regexp.MustCompile("(?m)^```[a-zA-Z0-9_-]*\\s*$")
+	mdImage     = regexp.MustCompile(`!\[([^\]]*)\]\(([^)]+)\)`)
+	mdLink      = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+	mdHeading   = regexp.MustCompile(`(?m)^#{1,6}\s+`)
+	mdInline    = regexp.MustCompile("`([^`\n]+)`")
+)
+
+// StripMarkdown is an example outbound middleware that converts markdown
+// replies to plain text, for platforms that render markdown syntax literally.
+func StripMarkdown(intent *protocol.InteractionIntent) error {
+	text := intent.Content.Text
+	text = mdCodeFence.ReplaceAllString(text, "")
+	text = mdImage.ReplaceAllString(text, "$1 ($2)")
+	text = mdLink.ReplaceAllString(text, "$1 ($2)")
+	text = mdHeading.ReplaceAllString(text, "")
+	text = stripEmphasis(text)
+	text = mdInline.ReplaceAllString(text, "$1")
+
+	intent.Content.Text = strings.TrimSpace(text)
+	intent.Content.Markdown = ""
+	return nil
+}
+
+// emphasisMarkers are the emphasis delimiters StripMarkdown removes, longest
+// first so "**" is not read as two "*".
+var emphasisMarkers = []string{"**", "__", "~~", "*", "_"}
+
+// stripEmphasis removes emphasis markers, keeping the text between them. As
+// in the format package, a span closes only on its own marker, must not start or
+// end with a space, and must sit at word boundaries, so "my_file_name.txt"
+// and "2*3*4" stay as they are.
+func stripEmphasis(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		if i == 0 || !isWordByte(s[i-1]) {
+			if inner, n := emphasis(s[i:]); n > 0 && (i+n >= len(s) || !isWordByte(s[i+n])) {
+				b.WriteString(stripEmphasis(inner))
+				i += n
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+		i++
+	}
+	return b.String()
+}
+
+// emphasis parses an emphasis span at the start of s, returning its text and
+// length, or a zero length if s does not start with one.
+func emphasis(s string) (string, int) {
+	for _, marker := range emphasisMarkers {
+		if !strings.HasPrefix(s, marker) {
+			continue
+		}
+		j := strings.Index(s[len(marker):], marker)
+		if j <= 0 {
+			return "", 0
+		}
+		inner := s[len(marker) : len(marker)+j]
+		if strings.TrimSpace(inner) != inner || strings.Contains(inner, "\n") {
+			return "", 0
+		}
+		return inner, j + 2*len(marker)
+	}
+	return "", 0
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+func TestStripMarkdown(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"**bold** and *italic*", "bold and italic"},
+		{"__bold__ _italic_ ~~gone~~", "bold italic gone"},
+		{"**bold with _nested_ italic**", "bold with nested italic"},
+		{"*a* *b*", "a b"},
+		{"(*aside*)", "(aside)"},
+		{"my_file_name.txt", "my_file_name.txt"},
+		{"see https://x.io/a_b_c", "see https://x.io/a_b_c"},
+		{"2*3*4 = 24", "2*3*4 = 24"},
+		{"*not closed_", "*not closed_"},
+		{"* list item *", "* list item *"},
+		{"# Title\nbody", "Title\nbody"},
+		{"[docs](https://x.io/a_b) and ![logo](https://x.io/l.png)", "docs (https://x.io/a_b) and logo (https://x.io/l.png)"},
+		{"run `go_test` now", "run go_test now"},
+		{"```go\nfmt.Println(1)\n```", "fmt.Println(1)"},
+	}
+	for _, tt := range tests {
+		intent := &protocol.InteractionIntent{Content: protocol.IntentContent{Text: tt.in, Markdown: tt.in}}
+		if err := StripMarkdown(intent); err != nil {
+			t.Fatalf("StripMarkdown(%q): %v", tt.in, err)
+		}
+		if intent.Content.Text != tt.want {
+			t.Errorf("StripMarkdown(%q) = %q, want %q", tt.in, intent.Content.Text, tt.want)
+		}
+		if intent.Content.Markdown != "" {
+			t.Errorf("StripMarkdown(%q) kept the markdown body", tt.in)
+		}
+	}
+}
+
+func TestMiddlewareChains(t *testing.T) {
+	g, mem := startGateway(t, DefaultConfig(), echoClient)
+	var order []string
+	g.RegisterInboundMiddleware(func(event *protocol.CanonicalInteractionEvent) error {
+		order = append(order, "in-1")
+		event.Input.Payload["text"] = event.Input.Payload["text"].(string) + "!"
+		return nil
+	})
+	g.RegisterInboundMiddleware(func(event *protocol.CanonicalInteractionEvent) error {
+		order = append(order, "in-2")
+		if event.Input.Payload["text"] == "reject!" {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+	g.RegisterOutboundMiddleware(func(intent *protocol.InteractionIntent) error {
+		order = append(order, "out")
+		intent.Content.Text = "**" + intent.Content.Text + "**"
+		return nil
+	})
+	g.RegisterOutboundMiddleware(StripMarkdown)
+
+	mem.Inject(mem.Message("u1", "hi"))
+	if got := waitReplies(t, mem, 1)[0].Content.Text; got != "hi!" {
+		t.Errorf("reply = %q, want %q", got, "hi!")
+	}
+	if fmt.Sprint(order) != "[in-1 in-2 out]" {
+		t.Errorf("middleware order = %v, want [in-1 in-2 out]", order)
+	}
+
+	mem.Reset()
+	order = nil
+	mem.Inject(mem.Message("u1", "reject"))
+	waitReplies(t, mem, 1)
+	if fmt.Sprint(order) != "[in-1 in-2]" {
+		t.Errorf("after an inbound error: middleware order = %v, want [in-1 in-2]", order)
+	}
+}
@@ -0,0 +1,126 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter/memory"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// multiClient answers every event with one reply per text.
+type multiClient []string
+
+func (c multiClient) ProcessEvent(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+	intents, err := c.ProcessEventMulti(ctx, event)
+	if err != nil || len(intents) == 0 {
+		return nil, err
+	}
+	return intents[0], nil
+}
+
+func (c multiClient) ProcessEventMulti(ctx context.Context, event *protocol.CanonicalInteractionEvent) ([]*protocol.InteractionIntent, error) {
+	var intents []*protocol.InteractionIntent
+	for _, text := range c {
+		intents = append(intents, protocol.NewInteractionIntent(protocol.IntentTypeReply, text, event.Session.ExternalSessionID, event.InteractionID))
+	}
+	return intents, nil
+}
+
+func (multiClient) Close() error                     { return nil }
+func (multiClient) Health(ctx context.Context) error { return nil }
+
+// failingAdapter is a memory adapter whose SendIntent fails for one text.
+type failingAdapter struct {
+	*memory.MemoryAdapter
+	failOn string
+}
+
+func (a *failingAdapter) SendIntent(ctx context.Context, intent *protocol.InteractionIntent) error {
+	if intent.Content.Text == a.failOn {
+		return errors.New("platform rejected " + a.failOn)
+	}
+	return a.MemoryAdapter.SendIntent(ctx, intent)
+}
+
+func texts(intents []*protocol.InteractionIntent) string {
+	var out []string
+	for _, intent := range intents {
+		out = append(out, intent.Content.Text)
+	}
+	return fmt.Sprint(out)
+}
+
+func TestMultiIntentDelivery(t *testing.T) {
+	tests := []struct {
+		name     string
+		client   multiClient
+		failOn   string
+		want     string
+		failures float64
+	}{
+		{"delivered in order", multiClient{"a", "b", "c"}, "", "[a b c]", 0},
+		{"stops at the first failure", multiClient{"a", "b", "c"}, "b", "[a]", 1},
+		{"first intent failing sends nothing", multiClient{"a", "b"}, "a", "[]", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.WorkerCount, cfg.QueueSize = 2, 10
+			g := New(cfg, tt.client, zap.NewNop())
+			mem := &failingAdapter{MemoryAdapter: memory.New(nil), failOn: tt.failOn}
+			if err := g.RegisterAdapter(mem); err != nil {
+				t.Fatal(err)
+			}
+			if err := g.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { g.Stop(context.Background()) })
+			failures := sendIntentTotal.Value(memory.Name, "failure")
+
+			mem.Inject(mem.Message("u1", "hi"))
+			deadline := time.Now().Add(5 * time.Second)
+			for g.processed.Load() == 0 {
+				if time.Now().After(deadline) {
+					t.Fatal("event never processed")
+				}
+				time.Sleep(time.Millisecond)
+			}
+			if got := texts(mem.Received()); got != tt.want {
+				t.Errorf("delivered %s, want %s", got, tt.want)
+			}
+			if got := sendIntentTotal.Value(memory.Name, "failure") - failures; got != tt.failures {
+				t.Errorf("send failures grew by %v, want %v", got, tt.failures)
+			}
+		})
+	}
+}
+
+func TestMultiIntentNoIntents(t *testing.T) {
+	_, mem := startGateway(t, DefaultConfig(), multiClient{})
+	mem.Inject(mem.Message("u1", "hi"))
+	if got := waitReplies(t, mem, 1)[0].IntentType; got != protocol.IntentTypeNoop {
+		t.Errorf("intent type = %s, want noop", got)
+	}
+}
+
+func TestMultiIntentSync(t *testing.T) {
+	g, mem := startGateway(t, DefaultConfig(), multiClient{"inline", "follow-up-1", "follow-up-2"})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	intent, err := g.ProcessSync(ctx, mem.Message("u1", "hi"))
+	if err != nil {
+		t.Fatalf("ProcessSync: %v", err)
+	}
+	if intent.Content.Text != "inline" {
+		t.Errorf("sync reply = %q, want the first intent", intent.Content.Text)
+	}
+	if got := texts(waitReplies(t, mem, 2)); got != "[follow-up-1 follow-up-2]" {
+		t.Errorf("sent through the adapter: %s, want the remaining intents", got)
+	}
+}
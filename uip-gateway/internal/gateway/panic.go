@@ -0,0 +1,41 @@
+package gateway
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+)
+
+var workerPanicsTotal = metrics.NewCounter("uip_worker_panics_total",
+	"Panics raised while processing an event, by adapter.",
+	"adapter")
+
+// processSafely runs processEvent, recovering a panic so one malformed
+// event cannot take its worker down with it: the worker moves on to the
+// next event and a sync caller gets the error reply. With CrashOnPanic
+// the panic is logged and counted, then re-raised.
+func (g *Gateway) processSafely(ec *eventContext) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		workerPanicsTotal.Inc(ec.adapterName)
+		g.eventLogger(ec).Error("Panic while processing event",
+			zap.Any("panic", r),
+			zap.Stack("stack"))
+		if g.config.CrashOnPanic {
+			panic(r)
+		}
+		if ec.reply != nil {
+			err := fmt.Errorf("event processing panicked: %v", r)
+			select {
+			case ec.reply <- syncResult{intent: g.errorIntent(ec.event, err), err: err}:
+			default: // the worker already replied before panicking
+			}
+		}
+	}()
+	g.processEvent(ec)
+}
@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter/memory"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// panickyClient panics on "boom" and echoes everything else.
+var panickyClient = clientFunc(func(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+	if text, _ := event.Input.Payload["text"].(string); text == "boom" {
+		panic("malformed event")
+	}
+	return echoClient(ctx, event)
+})
+
+// TestPanicDoesNotKillWorker panics on the only worker's event, then checks
+// that the worker still answers the events queued behind it.
+func TestPanicDoesNotKillWorker(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.WorkerCount = 1
+	_, mem := startGateway(t, cfg, panickyClient)
+	panics := workerPanicsTotal.Value(memory.Name)
+
+	mem.Inject(mem.Message("u1", "boom"))
+	mem.Inject(mem.Message("u1", "after"))
+	mem.Inject(mem.Message("u2", "boom"))
+	mem.Inject(mem.Message("u2", "still here"))
+
+	got := texts(waitReplies(t, mem, 2))
+	if got != "[after still here]" || len(mem.Received()) != 2 {
+		t.Errorf("replies = %s, want [after still here]", got)
+	}
+	if d := workerPanicsTotal.Value(memory.Name) - panics; d != 2 {
+		t.Errorf("panic count grew by %v, want 2", d)
+	}
+}
+
+func TestPanicSyncGetsErrorReply(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.WorkerCount = 1
+	g, mem := startGateway(t, cfg, panickyClient)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	intent, err := g.ProcessSync(ctx, mem.Message("u1", "boom"))
+	if err == nil || !strings.Contains(err.Error(), "panicked") {
+		t.Errorf("ProcessSync err = %v, want the panic error", err)
+	}
+	if intent == nil || intent.Content.Text == "" {
+		t.Errorf("ProcessSync intent = %+v, want an error reply", intent)
+	}
+
+	intent, err = g.ProcessSync(ctx, mem.Message("u1", "hello"))
+	if err != nil || intent.Content.Text != "hello" {
+		t.Errorf("after a panic: ProcessSync = %+v, %v, want the echo", intent, err)
+	}
+}
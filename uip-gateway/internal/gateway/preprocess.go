@@ -0,0 +1,159 @@
+package gateway
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// PreprocessConfig configures inbound text preprocessing.
+type PreprocessConfig struct {
+	// StripPrefix removes leading addresses of the bot: "<@id>" and
+	// "<@!id>" tokens, "@name", and "name:" / "name," for any of BotNames.
+	StripPrefix bool `json:"strip_prefix" yaml:"strip_prefix"`
+	// BotNames lists the user IDs and display names the bot is addressed
+	// by, matched case-insensitively. Required with StripPrefix.
+	BotNames []string `json:"bot_names" yaml:"bot_names"`
+	// Commands lists command triggers (e.g. "/ask", "!ai") removed from the
+	// start of the text. Telegram-style "/ask@botname" is also recognised.
+	Commands []string `json:"commands" yaml:"commands"`
+	// NormalizeUnicode folds full-width ASCII and Unicode spaces to their
+	// ASCII forms and removes zero-width spaces and byte order marks.
+	NormalizeUnicode bool `json:"normalize_unicode" yaml:"normalize_unicode"`
+	// Trim removes surrounding whitespace and normalizes line endings.
+	Trim bool `json:"trim" yaml:"trim"`
+}
+
+// Preprocessor cleans up inbound message text before it is sent to
+// Clawdbot, according to a PreprocessConfig.
+type Preprocessor struct {
+	mention          *regexp.Regexp // nil without StripPrefix
+	command          *regexp.Regexp // nil without Commands
+	normalizeUnicode bool
+	trim             bool
+}
+
+// mentionSep matches what separates a leading mention from the message.
+const mentionSep = `(?:[\s,，]+|[:：](?:\s+|$)|$)`
+
+// NewPreprocessor compiles the preprocessor's patterns. Empty names and
+// commands are rejected.
+func NewPreprocessor(cfg PreprocessConfig) (*Preprocessor, error) {
+	p := &Preprocessor{normalizeUnicode: cfg.NormalizeUnicode, trim: cfg.Trim}
+
+	if cfg.StripPrefix {
+		if len(cfg.BotNames) == 0 {
+			return nil, fmt.Errorf("strip_prefix: bot_names is empty")
+		}
+		var names []string
+		for _, n := range cfg.BotNames {
+			n = strings.TrimPrefix(strings.TrimSpace(n), "@")
+			if n == "" {
+				return nil, fmt.Errorf("bot_names: empty name")
+			}
+			names = append(names, regexp.QuoteMeta(n))
+		}
+		alt := strings.Join(names, "|")
+		p.mention = regexp.MustCompile(`(?i)^\s*(?:` +
+			`<@!?(?:` + alt + `)(?:\|[^>]*)?>[\s,:，：]*` +
+			`|[@＠](?:` + alt + `)` + mentionSep +
+			`|(?:` + alt + `)[,:，：]\s*)`)
+	}
+
+	if len(cfg.Commands) > 0 {
+		var cmds []string
+		for _, c := range cfg.Commands {
+			c = strings.TrimSpace(c)
+			if c == "" {
+				return nil, fmt.Errorf("commands: empty command")
+			}
+			cmds = append(cmds, regexp.QuoteMeta(c))
+		}
+		p.command = regexp.MustCompile(`(?i)^\s*(?:` + strings.Join(cmds, "|") + `)(?:@\S+)?(?:\s+|$)`)
+	}
+	return p, nil
+}
+
+// Process returns the cleaned-up text. A message that consists of nothing
+// but bot mentions and a command keeps them, so it is not sent empty.
+func (p *Preprocessor) Process(text string) string {
+	if p.normalizeUnicode {
+		text = normalizeUnicode(text)
+	}
+	if p.trim {
+		text = strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+	}
+
+	stripped := text
+	if p.mention != nil {
+		stripped = stripAll(p.mention, stripped)
+	}
+	if p.command != nil {
+		stripped = p.command.ReplaceAllString(stripped, "")
+	}
+	if strings.TrimSpace(stripped) == "" {
+		return text
+	}
+	return stripped
+}
+
+// stripAll removes repeated matches of an anchored pattern, as in
+// "@bot @bot hello".
+func stripAll(re *regexp.Regexp, text string) string {
+	for {
+		loc := re.FindStringIndex(text)
+		if loc == nil || loc[1] == 0 {
+			return text
+		}
+		text = text[loc[1]:]
+	}
+}
+
+// normalizeUnicode folds full-width ASCII (U+FF01-U+FF5E) and Unicode
+// spaces to ASCII, and drops zero-width spaces, word joiners and byte order
+// marks. Zero-width joiners are kept: emoji sequences depend on them. This
+// is a subset of NFKC that covers what IM clients commonly insert.
+func normalizeUnicode(text string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 0xFF01 && r <= 0xFF5E:
+			return r - 0xFF01 + '!'
+		case r == '\u200b' || r == '\u2060' || r == '\ufeff':
+			return -1
+		case r != '\n' && r != '\t' && r != '\r' && unicode.IsSpace(r):
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+// SetPreprocessor installs the inbound text preprocessor. A nil
+// preprocessor leaves text unchanged.
+func (g *Gateway) SetPreprocessor(p *Preprocessor) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.preprocessor = p
+}
+
+// applyPreprocess rewrites the event's text, keeping the original in
+// Meta.RawText when it changes.
+func (g *Gateway) applyPreprocess(event *protocol.CanonicalInteractionEvent) {
+	g.mu.RLock()
+	p := g.preprocessor
+	g.mu.RUnlock()
+	if p == nil || event.Input.Payload == nil {
+		return
+	}
+
+	text, ok := event.Input.Payload["text"].(string)
+	if !ok || text == "" {
+		return
+	}
+	if processed := p.Process(text); processed != text {
+		event.Meta.RawText = text
+		event.Input.Payload["text"] = processed
+	}
+}
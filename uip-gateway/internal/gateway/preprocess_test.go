@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"testing"
+)
+
+func TestPreprocessorProcess(t *testing.T) {
+	p, err := NewPreprocessor(PreprocessConfig{
+		StripPrefix: true,
+		BotNames:    []string{"ai", "@U123"},
+		Commands:    []string{"/ask"},
+		Trim:        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		in, want string
+	}{
+		{"<@U123> hello", "hello"},
+		{"<@!U123|ai> hello", "hello"},
+		{"<@u123>: hello", "hello"},
+		{"<@U999> hello", "<@U999> hello"},
+		{"@ai hello", "hello"},
+		{"@AI, hello", "hello"},
+		{"@ai @ai hello", "hello"},
+		{"ai: hello", "hello"},
+		{"ai, hello", "hello"},
+		{"＠ai hello", "hello"},
+		{"ai：hello", "hello"},
+		{"@ai： hello", "hello"},
+		{"/ask hello", "hello"},
+		{"/ask@ai_bot hello", "hello"},
+		{"@ai /ask hello", "hello"},
+		{"/asking hello", "/asking hello"},
+		{"@ai", "@ai"},
+		{"  <@U123>  ", "<@U123>"},
+		{"@ai /ask", "@ai /ask"},
+		{"@aim hello", "@aim hello"},
+		{"aim: hello", "aim: hello"},
+		{"email ai@example.com", "email ai@example.com"},
+		{"tell @ai hi", "tell @ai hi"},
+		{"  hello\r\nworld  ", "hello\nworld"},
+	}
+	for _, tt := range tests {
+		if got := p.Process(tt.in); got != tt.want {
+			t.Errorf("Process(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPreprocessorNormalizeUnicode(t *testing.T) {
+	p, err := NewPreprocessor(PreprocessConfig{NormalizeUnicode: true, StripPrefix: true, BotNames: []string{"ai"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		in, want string
+	}{
+		{"ｈｅｌｌｏ！", "hello!"},
+		{"a\u3000b\u00a0c", "a b c"},
+		{"\ufeffhel\u200blo\u2060", "hello"},
+		{"👨\u200d👩", "👨\u200d👩"},
+		{"＠ａｉ\u3000hello", "hello"},
+	}
+	for _, tt := range tests {
+		if got := p.Process(tt.in); got != tt.want {
+			t.Errorf("Process(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestNewPreprocessorRejectsBadConfig(t *testing.T) {
+	for _, cfg := range []PreprocessConfig{
+		{StripPrefix: true},
+		{StripPrefix: true, BotNames: []string{"ai", " @ "}},
+		{Commands: []string{""}},
+	} {
+		if _, err := NewPreprocessor(cfg); err == nil {
+			t.Errorf("NewPreprocessor(%+v) succeeded, want an error", cfg)
+		}
+	}
+}
+
+func TestPreprocessKeepsRawText(t *testing.T) {
+	p, err := NewPreprocessor(PreprocessConfig{StripPrefix: true, BotNames: []string{"ai"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, mem := startGateway(t, DefaultConfig(), echoClient)
+	g.SetPreprocessor(p)
+
+	event := mem.Message("u1", "@ai hello")
+	mem.Inject(event)
+	if got := waitReplies(t, mem, 1)[0].Content.Text; got != "hello" {
+		t.Errorf("reply = %q, want the mention stripped", got)
+	}
+	if event.Meta.RawText != "@ai hello" {
+		t.Errorf("RawText = %q, want the original text", event.Meta.RawText)
+	}
+}
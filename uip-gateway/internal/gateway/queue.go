@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+)
+
+// Queue-full policies decide what happens when an event arrives while the
+// event queue is at capacity.
+//
+//   - QueueDropNew (default) rejects the arriving event. Adapters never block
+//     and queued events keep their place, but a burst loses its newest
+//     messages, which are also the ones the user is most likely waiting on.
+//   - QueueDropOld evicts the oldest queued event to make room. The newest
+//     messages survive, at the cost of silently discarding stale ones that
+//     were already accepted.
+//   - QueueBlock makes the adapter wait up to EnqueueTimeout for room,
+//     pushing backpressure onto the IM side (slower HTTP responses, stalled
+//     WebSocket reads). Nothing is lost unless the timeout expires, but a
+//     stuck OpenClaw can tie up every inbound connection.
+const (
+	QueueDropNew = "drop_new"
+	QueueDropOld = "drop_old"
+	QueueBlock   = "block"
+)
+
+// DefaultEnqueueTimeout bounds the wait under QueueBlock.
+const DefaultEnqueueTimeout = 5 * time.Second
+
+var (
+	// ErrQueueFull is returned by ProcessSync when the event could not be queued.
+	ErrQueueFull = errors.New("event queue full")
+	// ErrGatewayStopped is returned by ProcessSync for events arriving
+	// after Stop has begun.
+	ErrGatewayStopped = errors.New("gateway stopped")
+	// ErrEventDisplaced is returned by ProcessSync when a queued event is
+	// evicted under QueueDropOld.
+	ErrEventDisplaced = errors.New("event displaced from full queue")
+)
+
+var queueFullTotal = metrics.NewCounter("uip_queue_full_total",
+	"Events arriving at a full queue, by policy and outcome (dropped_new/dropped_old/blocked/timeout).",
+	"policy", "outcome")
+
+// validQueueFullPolicy reports whether policy is a known queue-full policy.
+func validQueueFullPolicy(policy string) bool {
+	switch policy {
+	case QueueDropNew, QueueDropOld, QueueBlock:
+		return true
+	}
+	return false
+}
+
+// enqueue puts ec on its event queue, applying the queue-full policy. It
+// returns false if ec was not queued. ctx only bounds QueueBlock waits.
+//
+// Events arriving once Stop has begun are rejected: Stop closes the queue
+// under queueMu, so checking accepting under the read lock guarantees the
+// send below never hits a closed channel.
+func (g *Gateway) enqueue(ctx context.Context, ec *eventContext) bool {
+	g.queueMu.RLock()
+	defer g.queueMu.RUnlock()
+	if !g.accepting.Load() {
+		eventsDroppedTotal.Inc(ec.adapterName)
+		g.eventLogger(ec).Warn("Gateway stopping, rejecting event")
+		return false
+	}
+
+	g.pending.Add(1)
+	queue := g.queueFor(ec)
+	select {
+	case queue <- ec:
+		return true
+	default:
+	}
+
+	policy := g.config.QueueFullPolicy
+	switch policy {
+	case QueueDropOld:
+		// Workers may drain the queue concurrently, so retry a few times
+		for attempt := 0; attempt < 3; attempt++ {
+			select {
+			case old := <-queue:
+				g.displace(old)
+			default:
+			}
+			select {
+			case queue <- ec:
+				return true
+			default:
+			}
+		}
+
+	case QueueBlock:
+		queueFullTotal.Inc(policy, "blocked")
+		timer := time.NewTimer(g.config.EnqueueTimeout)
+		defer timer.Stop()
+		select {
+		case queue <- ec:
+			return true
+		case <-timer.C:
+			queueFullTotal.Inc(policy, "timeout")
+		case <-ctx.Done():
+			queueFullTotal.Inc(policy, "timeout")
+		case <-g.stopCh:
+		}
+		g.reject(ec, policy)
+		return false
+	}
+
+	queueFullTotal.Inc(policy, "dropped_new")
+	g.reject(ec, policy)
+	return false
+}
+
+// reject accounts for an event that was never queued.
+func (g *Gateway) reject(ec *eventContext, policy string) {
+	g.pending.Add(-1)
+	eventsDroppedTotal.Inc(ec.adapterName)
+	g.eventLogger(ec).Warn("Event queue full, dropping event",
+		zap.String("policy", policy))
+}
+
+// displace accounts for a queued event evicted under QueueDropOld.
+func (g *Gateway) displace(old *eventContext) {
+	g.pending.Add(-1)
+	eventsDroppedTotal.Inc(old.adapterName)
+	queueFullTotal.Inc(QueueDropOld, "dropped_old")
+	g.eventLogger(old).Warn("Event queue full, displacing oldest event",
+		zap.Duration("queuedFor", g.clock.Since(old.receivedAt)))
+	if old.reply != nil {
+		old.reply <- syncResult{err: ErrEventDisplaced}
+	}
+	g.replyBusy(old)
+}
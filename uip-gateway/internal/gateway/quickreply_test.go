@@ -0,0 +1,122 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter/local"
+	"github.com/zlc_ai/uip-gateway/internal/adapter/memory"
+	"github.com/zlc_ai/uip-gateway/internal/clawdbot"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// TestQuickReplyRoundTrip offers buttons written by the text convention
+// from an HTTP Clawdbot to a local adapter WebSocket client, then taps one.
+func TestQuickReplyRoundTrip(t *testing.T) {
+	requests := make(chan clawdbot.ClawdbotRequest, 2)
+	bot := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req clawdbot.ClawdbotRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		requests <- req
+		resp := clawdbot.ClawdbotResponse{Response: "Ship it?\n[[Yes|ship]] [[Not yet|wait]]"}
+		if value, ok := req.Metadata["quickReply"].(string); ok {
+			resp.Response = "Picked " + value
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer bot.Close()
+	client, err := clawdbot.NewHTTPClient(clawdbot.Config{Endpoint: bot.URL, Timeout: 5 * time.Second}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := local.NewLocalAdapter(map[string]interface{}{"logger": zap.NewNop()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter := a.(*local.LocalAdapter)
+	srv := httptest.NewServer(adapter.HTTPHandler())
+	defer srv.Close()
+	g := New(DefaultConfig(), client, zap.NewNop())
+	if err := g.RegisterAdapter(adapter); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Stop(context.Background())
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws?sessionId=s1&userId=u1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for deadline := time.Now().Add(2 * time.Second); adapter.ConnectionCount() != 1; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("WebSocket never registered")
+		}
+	}
+	exchange := func(msg map[string]interface{}) *protocol.InteractionIntent {
+		t.Helper()
+		if err := conn.WriteJSON(msg); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var intent protocol.InteractionIntent
+		if err := conn.ReadJSON(&intent); err != nil {
+			t.Fatal(err)
+		}
+		return &intent
+	}
+
+	offer := exchange(map[string]interface{}{"text": "deploy?"})
+	if offer.Content.Text != "Ship it?" {
+		t.Errorf("offer text = %q, want the buttons lifted out", offer.Content.Text)
+	}
+	if want := "[{Yes ship} {Not yet wait}]"; fmt.Sprint(offer.Content.QuickReplies) != want {
+		t.Errorf("offer buttons = %v, want %s", offer.Content.QuickReplies, want)
+	}
+	<-requests
+
+	answer := exchange(map[string]interface{}{"quickReply": "ship"})
+	if answer.Content.Text != "Picked ship" || len(answer.Content.QuickReplies) != 0 {
+		t.Errorf("answer = %q %v, want %q", answer.Content.Text, answer.Content.QuickReplies, "Picked ship")
+	}
+	tap := <-requests
+	if tap.Type != string(protocol.InputTypeQuickReply) || tap.Message != "ship" {
+		t.Errorf("tap reached Clawdbot as type %q text %q, want quick_reply ship", tap.Type, tap.Message)
+	}
+}
+
+// TestQuickRepliesListed checks the numbered list fallback for adapters
+// without buttons.
+func TestQuickRepliesListed(t *testing.T) {
+	client := clientFunc(func(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+		intent, err := echoClient(ctx, event)
+		intent.Content.QuickReplies = []protocol.QuickReply{{Label: "Yes", Value: "y"}, {Label: "No"}}
+		return intent, err
+	})
+	_, mem := startGateway(t, DefaultConfig(), client)
+	caps := *mem.Capabilities()
+	caps.SupportsQuickReplies = false
+	mem.SetConversationCapabilities(protocol.ConversationDirect, &caps)
+	before := intentsDegradedTotal.Value(memory.Name, DegradeQuickRepliesListed)
+
+	mem.Inject(mem.Message("u1", "Ship it?"))
+	got := waitReplies(t, mem, 1)[0].Content
+	if got.Text != "Ship it?\n\n1. Yes\n2. No" || len(got.QuickReplies) != 0 {
+		t.Errorf("reply = %q %v, want the choices listed in the text", got.Text, got.QuickReplies)
+	}
+	if d := intentsDegradedTotal.Value(memory.Name, DegradeQuickRepliesListed) - before; d != 1 {
+		t.Errorf("quick_replies_listed grew by %v, want 1", d)
+	}
+}
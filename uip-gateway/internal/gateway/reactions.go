@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// ReactionHandler receives reaction events (protocol.InputTypeReaction) on
+// a worker, before they would reach Clawdbot. It must not block for long.
+type ReactionHandler func(event *protocol.CanonicalInteractionEvent, reaction *protocol.Reaction)
+
+// RegisterReactionHandler appends a handler for reaction events.
+//
+// Handlers run in registration order for every reaction that passes the
+// event filter. Reactions go on to Clawdbot only with ForwardReactions;
+// without it and without handlers they are filtered out on arrival.
+func (g *Gateway) RegisterReactionHandler(h ReactionHandler) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.reactions = append(g.reactions, h)
+}
+
+// reactionsIgnored reports whether a reaction event has nowhere to go.
+func (g *Gateway) reactionsIgnored() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return !g.config.ForwardReactions && len(g.reactions) == 0
+}
+
+// handleReaction runs the reaction handlers for a reaction event and
+// reports whether processing ends there, i.e. the reaction is not
+// forwarded to Clawdbot. Other events are left alone.
+func (g *Gateway) handleReaction(ctx *eventContext) bool {
+	reaction, ok := protocol.ReactionOf(ctx.event)
+	if !ok {
+		return false
+	}
+	g.mu.RLock()
+	handlers := g.reactions
+	g.mu.RUnlock()
+	for _, h := range handlers {
+		h(ctx.event, reaction)
+	}
+	if g.config.ForwardReactions {
+		return false
+	}
+
+	if ctx.reply != nil {
+		ctx.reply <- syncResult{intent: noopIntent(ctx.event)}
+	}
+	eventDuration.Observe(g.clock.Since(ctx.receivedAt).Seconds(), ctx.adapterName, conversationTypeLabel(ctx.event))
+	return true
+}
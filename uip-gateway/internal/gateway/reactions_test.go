@@ -0,0 +1,90 @@
+package gateway
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter/memory"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// reactionEvent is a 👍 on message m1, in a group where the bot was not
+// mentioned.
+func reactionEvent(mem *memory.MemoryAdapter) *protocol.CanonicalInteractionEvent {
+	event := mem.Message("u1", "")
+	event.Input.Type = protocol.InputTypeReaction
+	event.Input.Payload["channelId"] = "c1"
+	event.Input.Payload["conversationType"] = protocol.ConversationGroup
+	event.Input.Payload[protocol.PayloadReaction] = &protocol.Reaction{Emoji: "👍", MessageID: "m1"}
+	return event
+}
+
+func TestReactionRouting(t *testing.T) {
+	tests := []struct {
+		name     string
+		forward  bool
+		handler  bool
+		calls    int32
+		replies  int
+		handled  int
+		filtered float64
+	}{
+		{"dropped by default", false, false, 0, 0, 0, 1},
+		{"handler only", false, true, 0, 0, 1, 0},
+		{"forwarded", true, false, 1, 1, 0, 0},
+		{"forwarded and handled", true, true, 1, 1, 1, 0},
+	}
+	for _, tt := range tests {
+		var calls atomic.Int32
+		var sawReaction atomic.Value
+		client := clientFunc(func(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+			calls.Add(1)
+			if r, ok := protocol.ReactionOf(event); ok {
+				sawReaction.Store(*r)
+			}
+			return protocol.NewInteractionIntent(protocol.IntentTypeReply, "noted", event.Session.ExternalSessionID, event.InteractionID), nil
+		})
+		cfg := DefaultConfig()
+		cfg.WorkerCount = 1
+		cfg.ForwardReactions = tt.forward
+		cfg.RespondOnlyWhenMentioned = true
+		g, mem := startGateway(t, cfg, client)
+		var mu sync.Mutex
+		var handled []protocol.Reaction
+		if tt.handler {
+			g.RegisterReactionHandler(func(event *protocol.CanonicalInteractionEvent, r *protocol.Reaction) {
+				mu.Lock()
+				handled = append(handled, *r)
+				mu.Unlock()
+			})
+		}
+		before := eventsFilteredTotal.Value(memory.Name, FilterReactionIgnored)
+
+		mem.Inject(reactionEvent(mem))
+		// A text message behind it on the single worker marks the reaction done
+		mention := mem.Message("u1", "ping")
+		mention.Input.Payload[protocol.PayloadMentionsBot] = true
+		mem.Inject(mention)
+		waitReplies(t, mem, tt.replies+1)
+
+		if n := calls.Load() - 1; n != tt.calls {
+			t.Errorf("%s: reaction reached Clawdbot %d times, want %d", tt.name, n, tt.calls)
+		}
+		if tt.calls > 0 && sawReaction.Load() != (protocol.Reaction{Emoji: "👍", MessageID: "m1"}) {
+			t.Errorf("%s: Clawdbot saw reaction %v", tt.name, sawReaction.Load())
+		}
+		if n := len(mem.Received()) - 1; n != tt.replies {
+			t.Errorf("%s: %d replies to the reaction, want %d", tt.name, n, tt.replies)
+		}
+		mu.Lock()
+		if len(handled) != tt.handled || tt.handled > 0 && handled[0].Emoji != "👍" {
+			t.Errorf("%s: handler saw %v, want %d reactions", tt.name, handled, tt.handled)
+		}
+		mu.Unlock()
+		if d := eventsFilteredTotal.Value(memory.Name, FilterReactionIgnored) - before; d != tt.filtered {
+			t.Errorf("%s: reaction_ignored grew by %v, want %v", tt.name, d, tt.filtered)
+		}
+	}
+}
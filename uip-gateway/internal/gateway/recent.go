@@ -0,0 +1,125 @@
+package gateway
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/clawdbot"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// RecentEvent is one processed event recorded in the recent-events buffer.
+type RecentEvent struct {
+	ReceivedAt    time.Time `json:"receivedAt"`
+	Adapter       string    `json:"adapter"`
+	InteractionID string    `json:"interactionId"`
+	TraceID       string    `json:"traceId"`
+	SessionID     string    `json:"sessionId"`
+	UserID        string    `json:"userId"`
+	InputText     string    `json:"inputText"`
+	IntentID      string    `json:"intentId,omitempty"`
+	IntentType    string    `json:"intentType,omitempty"`
+	ReplyText     string    `json:"replyText,omitempty"`
+	LatencyMs     int64     `json:"latencyMs"`
+	Error         string    `json:"error,omitempty"`
+	// ErrorCategory classifies a Clawdbot error (see clawdbot.ErrorCategory).
+	ErrorCategory string `json:"errorCategory,omitempty"`
+	// DryRun marks an event whose reply was recorded but not sent.
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// RecentBuffer is a fixed-size ring buffer of the most recently processed events.
+type RecentBuffer struct {
+	mu      sync.Mutex
+	entries []RecentEvent
+	next    int
+	full    bool
+}
+
+// NewRecentBuffer creates a ring buffer holding up to size events.
+func NewRecentBuffer(size int) *RecentBuffer {
+	return &RecentBuffer{
+		entries: make([]RecentEvent, size),
+	}
+}
+
+// Add records an event, overwriting the oldest entry when full.
+func (b *RecentBuffer) Add(e RecentEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.entries[b.next] = e
+	b.next = (b.next + 1) % len(b.entries)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// Snapshot returns the buffered events, newest first. Unless full is true,
+// message text is replaced by a length marker so user content isn't exposed.
+func (b *RecentBuffer) Snapshot(full bool) []RecentEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	count := b.next
+	if b.full {
+		count = len(b.entries)
+	}
+
+	out := make([]RecentEvent, 0, count)
+	for i := 0; i < count; i++ {
+		idx := (b.next - 1 - i + len(b.entries)) % len(b.entries)
+		e := b.entries[idx]
+		if !full {
+			e.InputText = redactText(e.InputText)
+			e.ReplyText = redactText(e.ReplyText)
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func redactText(text string) string {
+	if text == "" {
+		return ""
+	}
+	return fmt.Sprintf("[redacted %d chars]", len([]rune(text)))
+}
+
+// record adds a processed event to the buffer.
+func (b *RecentBuffer) record(ctx *eventContext, now time.Time, intent *protocol.InteractionIntent, err error) {
+	event := ctx.event
+	e := RecentEvent{
+		ReceivedAt:    ctx.receivedAt,
+		Adapter:       ctx.adapterName,
+		InteractionID: event.InteractionID,
+		TraceID:       event.Meta.TraceID,
+		SessionID:     event.Session.ExternalSessionID,
+		UserID:        event.Session.UserID,
+		LatencyMs:     now.Sub(ctx.receivedAt).Milliseconds(),
+		DryRun:        ctx.shadowed,
+	}
+	if event.Input.Payload != nil {
+		e.InputText, _ = event.Input.Payload["text"].(string)
+	}
+	if intent != nil {
+		e.IntentID = intent.IntentID
+		e.IntentType = string(intent.IntentType)
+		e.ReplyText = intent.Content.Text
+	}
+	if err != nil {
+		e.Error = err.Error()
+		e.ErrorCategory = clawdbot.ErrorCategory(err)
+	}
+	b.Add(e)
+}
+
+// RecentEvents returns the recent-events buffer contents, newest first,
+// or nil when the buffer is disabled.
+func (g *Gateway) RecentEvents(full bool) []RecentEvent {
+	if g.recent == nil {
+		return nil
+	}
+	return g.recent.Snapshot(full)
+}
@@ -0,0 +1,127 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Self-test identifiers: the synthetic event's adapter, session and user.
+const (
+	SelfTestAdapter = "selftest"
+	SelfTestSession = "uip-selftest"
+	// SelfTestText is the synthetic event's message.
+	SelfTestText = "UIP gateway self-test, please ignore."
+)
+
+// SelfTestCheck is an extra self-test stage, for components wired up
+// outside the gateway such as the outbound IM webhook.
+type SelfTestCheck struct {
+	Name  string
+	Check func(context.Context) error
+}
+
+// SelfTestStage is the result of one self-test stage.
+type SelfTestStage struct {
+	Name     string        `json:"name"`
+	Passed   bool          `json:"passed"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// SelfTestReport is the result of Gateway.SelfTest.
+type SelfTestReport struct {
+	// Passed is true when every stage passed.
+	Passed bool            `json:"passed"`
+	Stages []SelfTestStage `json:"stages"`
+}
+
+// String lists the stages one per line, for the startup log.
+func (r SelfTestReport) String() string {
+	var b strings.Builder
+	for _, s := range r.Stages {
+		status := "PASS"
+		if !s.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "%s %s (%s)", status, s.Name, s.Duration.Round(time.Millisecond))
+		if s.Error != "" {
+			b.WriteString(": " + s.Error)
+		}
+		b.WriteByte('\n')
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// SelfTest checks that a started gateway is wired correctly, one stage at
+// a time: Clawdbot's health, each running adapter's health, then a
+// synthetic event through the whole pipeline to Clawdbot and back, then
+// the extra checks. The synthetic event comes from SelfTestSession and
+// is not delivered to any adapter. Each stage is bounded by ctx.
+func (g *Gateway) SelfTest(ctx context.Context, checks ...SelfTestCheck) SelfTestReport {
+	report := SelfTestReport{Passed: true}
+	run := func(name string, check func(context.Context) error) bool {
+		start := g.clock.Now()
+		err := runHealth(ctx, check)
+		stage := SelfTestStage{Name: name, Passed: err == nil, Duration: g.clock.Since(start)}
+		if err != nil {
+			stage.Error = err.Error()
+			report.Passed = false
+		}
+		report.Stages = append(report.Stages, stage)
+		return err == nil
+	}
+
+	clawdbotOK := run("clawdbot", g.clawdbot.Health)
+
+	g.mu.RLock()
+	started := g.started
+	adapters := make(map[string]func(context.Context) error, len(g.adapters))
+	var names []string
+	for name, a := range g.adapters {
+		if !g.stopped[name] {
+			adapters[name] = a.Health
+			names = append(names, name)
+		}
+	}
+	g.mu.RUnlock()
+	sort.Strings(names)
+	for _, name := range names {
+		run("adapter:"+name, adapters[name])
+	}
+
+	run("pipeline", func(ctx context.Context) error {
+		switch {
+		case !started:
+			return errors.New("gateway not started")
+		case !clawdbotOK:
+			return errors.New("skipped, clawdbot is unhealthy")
+		}
+		_, err := g.ProcessSync(ctx, selfTestEvent())
+		return err
+	})
+
+	for _, c := range checks {
+		run(c.Name, c.Check)
+	}
+	return report
+}
+
+// selfTestEvent builds the synthetic direct message sent by SelfTest.
+func selfTestEvent() *protocol.CanonicalInteractionEvent {
+	event := protocol.NewCanonicalInteractionEvent(
+		SelfTestSession,
+		SelfTestSession,
+		protocol.InputTypeText,
+		map[string]interface{}{"text": SelfTestText},
+		protocol.SurfaceCapabilities{SupportsReply: true},
+		SelfTestAdapter,
+	)
+	event.Meta.AdapterName = SelfTestAdapter
+	return event
+}
@@ -0,0 +1,78 @@
+package gateway
+
+import (
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// sessionSerializer makes events for the same conversation run one at a time,
+// in arrival order, while different conversations stay parallel.
+//
+// A worker that finds its conversation busy parks the event behind the one
+// in flight and goes back to the queue; the worker running the conversation
+// picks parked events up in order when it finishes. Workers never block
+// waiting for each other.
+type sessionSerializer struct {
+	mu sync.Mutex
+	// parked holds, per busy conversation, the events waiting behind the one
+	// in flight. A key is present exactly while its conversation is busy.
+	parked map[string][]*eventContext
+}
+
+func newSessionSerializer() *sessionSerializer {
+	return &sessionSerializer{parked: make(map[string][]*eventContext)}
+}
+
+// acquire reports whether the caller should process ec now. If the
+// conversation is busy, ec is parked and acquire returns false.
+func (s *sessionSerializer) acquire(key string, ec *eventContext) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if queue, busy := s.parked[key]; busy {
+		s.parked[key] = append(queue, ec)
+		return false
+	}
+	s.parked[key] = nil
+	return true
+}
+
+// release returns the next parked event for key, or nil once the
+// conversation is idle.
+func (s *sessionSerializer) release(key string) *eventContext {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.parked[key]
+	if len(queue) == 0 {
+		delete(s.parked, key)
+		return nil
+	}
+	next := queue[0]
+	queue[0] = nil
+	s.parked[key] = queue[1:]
+	return next
+}
+
+// dispatch processes ec, serialized per conversation when SerializePerSession
+// is enabled, and accounts for every event it completes.
+func (g *Gateway) dispatch(ec *eventContext) {
+	if g.serializer == nil {
+		g.processSafely(ec)
+		g.processed.Add(1)
+		g.pending.Add(-1)
+		return
+	}
+
+	key := g.sessionKey(ec.event)
+	if !g.serializer.acquire(key, ec) {
+		g.eventLogger(ec).Debug("Conversation busy, event parked",
+			zap.String("conversationKey", key))
+		return
+	}
+	for ec != nil {
+		g.processSafely(ec)
+		g.processed.Add(1)
+		g.pending.Add(-1)
+		ec = g.serializer.release(key)
+	}
+}
@@ -0,0 +1,57 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// slowClient echoes events, taking 100ms over texts starting with "slow".
+var slowClient = clientFunc(func(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+	if text, _ := event.Input.Payload["text"].(string); strings.HasPrefix(text, "slow") {
+		time.Sleep(100 * time.Millisecond)
+	}
+	return echoClient(ctx, event)
+})
+
+// checkConversationOrder sends rapid messages in one conversation, the first
+// one slow, plus one in another conversation. The conversation's replies
+// must come back in order, and the other conversation must not wait for it.
+func checkConversationOrder(t *testing.T, cfg Config) {
+	t.Helper()
+	_, mem := startGateway(t, cfg, slowClient)
+
+	texts := []string{"slow-1", "2", "3", "slow-4", "5"}
+	for _, text := range texts {
+		mem.Inject(mem.Message("u1", text))
+	}
+	mem.Inject(mem.Message("u2", "other"))
+	replies := waitReplies(t, mem, len(texts)+1)
+
+	var got []string
+	otherAt := -1
+	for i, intent := range replies {
+		switch intent.TargetSessionID {
+		case "memory-u1":
+			got = append(got, intent.Content.Text)
+		case "memory-u2":
+			otherAt = i
+		}
+	}
+	if fmt.Sprint(got) != fmt.Sprint(texts) {
+		t.Errorf("replies = %v, want %v", got, texts)
+	}
+	if otherAt != 0 {
+		t.Errorf("other conversation's reply came %d-th, want it first", otherAt+1)
+	}
+}
+
+func TestSerializePerSessionOrdering(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SerializePerSession = true
+	checkConversationOrder(t, cfg)
+}
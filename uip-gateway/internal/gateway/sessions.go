@@ -0,0 +1,93 @@
+package gateway
+
+import (
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// SessionStats is an aggregate snapshot of the session registry.
+type SessionStats struct {
+	Count int `json:"count"`
+	// Users is the number of distinct users with at least one session.
+	Users int `json:"users"`
+	// OldestAgeSeconds is how long ago the oldest session was created (0 when empty).
+	OldestAgeSeconds float64 `json:"oldestAgeSeconds"`
+	// BusiestUser holds the most sessions (ties go to the smallest ID).
+	BusiestUser         string `json:"busiestUser,omitempty"`
+	BusiestUserSessions int    `json:"busiestUserSessions"`
+}
+
+// EvictByUser removes every session belonging to userID, calls OnExpire
+// for each and returns the count.
+func (r *SessionRegistry) EvictByUser(userID string) int {
+	return r.evict(func(entry *sessionEntry) bool {
+		return entry.session.UserID == userID
+	})
+}
+
+// EvictOlderThan removes every session not seen within age, calls OnExpire
+// for each and returns the count. Unlike Cleanup it ignores the TTL.
+func (r *SessionRegistry) EvictOlderThan(age time.Duration) int {
+	cutoff := r.clock.Now().Add(-age)
+	return r.evict(func(entry *sessionEntry) bool {
+		return entry.lastSeen.Before(cutoff)
+	})
+}
+
+// evict removes the sessions match selects in one locked pass, so a
+// concurrent Touch lands either before (and is evicted) or after (and
+// starts a fresh session).
+func (r *SessionRegistry) evict(match func(*sessionEntry) bool) int {
+	var evicted []protocol.Session
+
+	r.mu.Lock()
+	for id, entry := range r.sessions {
+		if match(entry) {
+			delete(r.sessions, id)
+			evicted = append(evicted, entry.session)
+		}
+	}
+	r.mu.Unlock()
+
+	if r.OnExpire != nil {
+		for _, session := range evicted {
+			r.OnExpire(session)
+		}
+	}
+	return len(evicted)
+}
+
+// Stats returns an aggregate snapshot taken under a single read lock.
+func (r *SessionRegistry) Stats() SessionStats {
+	now := r.clock.Now()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := SessionStats{Count: len(r.sessions)}
+	perUser := make(map[string]int)
+	var oldest time.Time
+	for _, entry := range r.sessions {
+		if oldest.IsZero() || entry.createdAt.Before(oldest) {
+			oldest = entry.createdAt
+		}
+		perUser[entry.session.UserID]++
+	}
+	if !oldest.IsZero() {
+		stats.OldestAgeSeconds = now.Sub(oldest).Seconds()
+	}
+	stats.Users = len(perUser)
+	for user, n := range perUser {
+		if n > stats.BusiestUserSessions || (n == stats.BusiestUserSessions && user < stats.BusiestUser) {
+			stats.BusiestUser = user
+			stats.BusiestUserSessions = n
+		}
+	}
+	return stats
+}
+
+// Sessions returns the gateway's session registry, for admin tooling.
+func (g *Gateway) Sessions() *SessionRegistry {
+	return g.sessions
+}
@@ -0,0 +1,174 @@
+package gateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// DefaultSourcePattern matches "[source](url)" and "[source: Title](url)"
+// style references, in English or Chinese.
+const DefaultSourcePattern = `(?i)\[(?:sources?|来源)(?:\s*[:：]\s*(?P<title>[^\]]*))?\]\((?P<url>(?:[^()\s]|\([^()\s]*\))+)\)`
+
+// SourceExtractorConfig configures a SourceExtractor.
+type SourceExtractorConfig struct {
+	// Patterns are regular expressions matching one source reference each.
+	// The named group "url" is required; "title" is optional. Matches are
+	// removed from the text. Empty uses DefaultSourcePattern.
+	Patterns []string
+	// JSONBlock also lifts a trailing JSON block of the form
+	// {"sources": [{"title": "...", "url": "..."}]}, fenced or bare.
+	JSONBlock bool
+}
+
+// SourceExtractor lifts source references embedded in an AI reply into
+// IntentContent.Sources, so adapters can render them natively.
+type SourceExtractor struct {
+	patterns  []*regexp.Regexp
+	jsonBlock bool
+}
+
+// NewSourceExtractor compiles the extractor's patterns.
+func NewSourceExtractor(cfg SourceExtractorConfig) (*SourceExtractor, error) {
+	patterns := cfg.Patterns
+	if len(patterns) == 0 {
+		patterns = []string{DefaultSourcePattern}
+	}
+	x := &SourceExtractor{jsonBlock: cfg.JSONBlock}
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("source pattern %q: %w", p, err)
+		}
+		if re.SubexpIndex("url") < 0 {
+			return nil, fmt.Errorf("source pattern %q: missing (?P<url>...) group", p)
+		}
+		x.patterns = append(x.patterns, re)
+	}
+	return x, nil
+}
+
+// trailingJSON matches a JSON object, optionally in a ```json fence, at the
+// very end of the text.
+var trailingJSON = regexp.MustCompile("(?s)(?:```(?:json)?\\s*(\\{.*\\})\\s*```|(\\{\\s*\"sources\"\\s*:.*\\}))\\s*$")
+
+// Extract returns text with the recognised references removed, and the
+// sources they named. Text without references is returned unchanged.
+func (x *SourceExtractor) Extract(text string) (string, []protocol.Source) {
+	var sources []protocol.Source
+	seen := make(map[string]bool)
+	add := func(s protocol.Source) {
+		if s.URL == "" || seen[s.URL] {
+			return
+		}
+		seen[s.URL] = true
+		sources = append(sources, s)
+	}
+
+	rest := text
+	if x.jsonBlock {
+		if m := trailingJSON.FindStringSubmatchIndex(rest); m != nil {
+			var raw string
+			if m[2] >= 0 {
+				raw = rest[m[2]:m[3]] // fenced
+			} else {
+				raw = rest[m[4]:m[5]]
+			}
+			var block struct {
+				Sources []protocol.Source `json:"sources"`
+			}
+			if json.Unmarshal([]byte(raw), &block) == nil && len(block.Sources) > 0 {
+				for _, s := range block.Sources {
+					add(s)
+				}
+				rest = rest[:m[0]]
+			}
+		}
+	}
+
+	for _, re := range x.patterns {
+		urlIdx, titleIdx := re.SubexpIndex("url"), re.SubexpIndex("title")
+		rest = re.ReplaceAllStringFunc(rest, func(match string) string {
+			sub := re.FindStringSubmatch(match)
+			s := protocol.Source{URL: sub[urlIdx]}
+			if titleIdx >= 0 {
+				s.Title = strings.TrimSpace(sub[titleIdx])
+			}
+			add(s)
+			return removed
+		})
+	}
+
+	if len(sources) == 0 {
+		return text, nil
+	}
+	return tidy(removedGap.ReplaceAllString(rest, "")), sources
+}
+
+// removed marks where a reference was cut, so the space before it can go too
+// ("see [source](u)." becomes "see.").
+const removed = "\x00"
+
+var removedGap = regexp.MustCompile("[ \t]*\x00+")
+
+// tidy drops the empty list items and trailing "Sources:" heading that
+// removing references leaves behind.
+func tidy(s string) string {
+	lines := strings.Split(s, "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		if t := strings.TrimSpace(line); t == "-" || t == "*" || t == "•" {
+			continue
+		}
+		out = append(out, line)
+	}
+	for len(out) > 0 {
+		last := strings.ToLower(strings.Trim(out[len(out)-1], " *#:："))
+		if last != "" && !sourceHeadings[last] {
+			break
+		}
+		out = out[:len(out)-1]
+	}
+	s = strings.Join(out, "\n")
+	for strings.Contains(s, "\n\n\n") {
+		s = strings.ReplaceAll(s, "\n\n\n", "\n\n")
+	}
+	return strings.TrimSpace(s)
+}
+
+var sourceHeadings = map[string]bool{
+	"source": true, "sources": true, "references": true, "来源": true, "参考": true, "参考资料": true,
+}
+
+// SetSourceExtractor enables source extraction for adapters whose
+// capabilities include SupportsSources. Other adapters receive the reply
+// text unchanged. A nil extractor disables extraction.
+func (g *Gateway) SetSourceExtractor(x *SourceExtractor) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sources = x
+}
+
+// applySources lifts sources out of the intent when the platform can render them.
+func (g *Gateway) applySources(event *protocol.CanonicalInteractionEvent, intent *protocol.InteractionIntent) {
+	g.mu.RLock()
+	x := g.sources
+	g.mu.RUnlock()
+	if x == nil || !event.Capabilities.SupportsSources {
+		return
+	}
+
+	text, sources := x.Extract(intent.Content.Text)
+	if len(sources) == 0 {
+		return
+	}
+	intent.Content.Text = text
+	if intent.Content.Markdown != "" {
+		intent.Content.Markdown, _ = x.Extract(intent.Content.Markdown)
+	}
+	intent.Content.Sources = append(intent.Content.Sources, sources...)
+}
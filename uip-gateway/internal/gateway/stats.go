@@ -0,0 +1,135 @@
+package gateway
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stats is a JSON-friendly snapshot of gateway activity, for deployments
+// without Prometheus.
+type Stats struct {
+	// EventsTotal counts all inbound events since startup.
+	EventsTotal float64 `json:"eventsTotal"`
+	// EventsByAdapter breaks EventsTotal down by adapter.
+	EventsByAdapter map[string]float64 `json:"eventsByAdapter"`
+	// EventsDropped counts events rejected because the queue was full.
+	EventsDropped  float64 `json:"eventsDropped"`
+	ActiveSessions int     `json:"activeSessions"`
+	QueueDepth     int     `json:"queueDepth"`
+	QueueCapacity  int     `json:"queueCapacity"`
+	Workers        int     `json:"workers"`
+	// Degraded counts intents modified to fit adapter capabilities, by
+	// adapter and degradation type (see applyDegradation).
+	Degraded map[string]map[string]float64 `json:"degraded"`
+	// Interval covers activity since the last reset (or startup).
+	Interval IntervalStats `json:"interval"`
+}
+
+// IntervalStats counts activity since Since.
+type IntervalStats struct {
+	Since            time.Time        `json:"since"`
+	Seconds          float64          `json:"seconds"`
+	Events           int64            `json:"events"`
+	EventsByAdapter  map[string]int64 `json:"eventsByAdapter"`
+	ClawdbotRequests int64            `json:"clawdbotRequests"`
+	ClawdbotErrors   int64            `json:"clawdbotErrors"`
+	// ClawdbotErrorRate is ClawdbotErrors / ClawdbotRequests (0 with no requests).
+	ClawdbotErrorRate float64 `json:"clawdbotErrorRate"`
+}
+
+// intervalCounters accumulates IntervalStats. The zero value is ready to use.
+type intervalCounters struct {
+	mu               sync.Mutex
+	since            time.Time
+	events           int64
+	eventsByAdapter  map[string]int64
+	clawdbotRequests int64
+	clawdbotErrors   int64
+}
+
+func (c *intervalCounters) recordEvent(adapterName string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.eventsByAdapter == nil {
+		c.eventsByAdapter = make(map[string]int64)
+	}
+	c.events++
+	c.eventsByAdapter[adapterName]++
+}
+
+func (c *intervalCounters) recordClawdbot(failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clawdbotRequests++
+	if failed {
+		c.clawdbotErrors++
+	}
+}
+
+// snapshot returns the counters, optionally starting a new interval.
+func (c *intervalCounters) snapshot(start, now time.Time, reset bool) IntervalStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	since := c.since
+	if since.IsZero() {
+		since = start
+	}
+	s := IntervalStats{
+		Since:            since,
+		Seconds:          now.Sub(since).Seconds(),
+		Events:           c.events,
+		EventsByAdapter:  make(map[string]int64, len(c.eventsByAdapter)),
+		ClawdbotRequests: c.clawdbotRequests,
+		ClawdbotErrors:   c.clawdbotErrors,
+	}
+	for name, n := range c.eventsByAdapter {
+		s.EventsByAdapter[name] = n
+	}
+	if s.ClawdbotRequests > 0 {
+		s.ClawdbotErrorRate = float64(s.ClawdbotErrors) / float64(s.ClawdbotRequests)
+	}
+
+	if reset {
+		c.since = now
+		c.events = 0
+		c.eventsByAdapter = nil
+		c.clawdbotRequests = 0
+		c.clawdbotErrors = 0
+	}
+	return s
+}
+
+// Stats returns a snapshot of gateway activity. Totals come from the
+// Prometheus counters and are never reset; with reset set, the interval
+// counters start over after being read.
+func (g *Gateway) Stats(reset bool) Stats {
+	s := Stats{
+		EventsByAdapter: make(map[string]float64),
+		Degraded:        make(map[string]map[string]float64),
+		ActiveSessions:  g.sessions.Count(),
+		QueueDepth:      g.queueDepth(),
+		QueueCapacity:   g.queueCapacity(),
+		Workers:         g.WorkerCount(),
+		Interval:        g.stats.snapshot(g.startedAt, g.clock.Now(), reset),
+	}
+	// eventsTotal is labelled "adapter,conversation_type"
+	for key, n := range eventsTotal.Snapshot() {
+		name, _, _ := strings.Cut(key, ",")
+		s.EventsByAdapter[name] += n
+		s.EventsTotal += n
+	}
+	for _, n := range eventsDroppedTotal.Snapshot() {
+		s.EventsDropped += n
+	}
+	// intentsDegradedTotal is labelled "adapter,type"
+	for key, n := range intentsDegradedTotal.Snapshot() {
+		name, kind, _ := strings.Cut(key, ",")
+		if s.Degraded[name] == nil {
+			s.Degraded[name] = make(map[string]float64)
+		}
+		s.Degraded[name][kind] += n
+	}
+	return s
+}
@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Gateway modes.
+const (
+	// ModeAsync routes every reply through the adapter's SendIntent (the default).
+	ModeAsync = "async"
+	// ModeSync lets adapters that implement adapter.SyncAdapter block the
+	// inbound request until the reply is ready and return it directly.
+	ModeSync = "sync"
+)
+
+// syncResult is what a worker hands back to a ProcessSync caller.
+type syncResult struct {
+	intent *protocol.InteractionIntent
+	err    error
+}
+
+// ProcessSync runs an event through the worker pool and returns the resulting
+// intent instead of delivering it via SendIntent; the caller is responsible
+// for delivering it. The event is attributed to event.Meta.AdapterName.
+//
+// If processing fails, the returned intent is the error reply and err
+// describes the failure. ctx bounds both the wait for a worker and processing.
+// Events dropped by the gateway filter return a noop intent without reaching
+// Clawdbot.
+func (g *Gateway) ProcessSync(ctx context.Context, event *protocol.CanonicalInteractionEvent) (*protocol.InteractionIntent, error) {
+	ec := &eventContext{
+		event:       event,
+		adapterName: event.Meta.AdapterName,
+		receivedAt:  g.clock.Now(),
+		callerCtx:   ctx,
+		reply:       make(chan syncResult, 1),
+	}
+
+	eventsTotal.Inc(ec.adapterName, conversationTypeLabel(event))
+	g.stats.recordEvent(ec.adapterName)
+
+	if g.filtered(ec) {
+		return noopIntent(event), nil
+	}
+	g.linkEdit(ec)
+
+	if !g.enqueue(ctx, ec) {
+		if !g.accepting.Load() {
+			return nil, ErrGatewayStopped
+		}
+		return nil, ErrQueueFull
+	}
+
+	select {
+	case res := <-ec.reply:
+		return res.intent, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// attachSync wires sync-capable adapters to ProcessSync when running in sync mode.
+func (g *Gateway) attachSync(a adapter.IMAdapter) {
+	if g.config.Mode != ModeSync {
+		return
+	}
+	if s, ok := a.(adapter.SyncAdapter); ok {
+		s.SetSyncProcessor(g.ProcessSync)
+		g.logger.Info("Adapter running in sync mode", zap.String("adapter", a.Name()))
+	}
+}
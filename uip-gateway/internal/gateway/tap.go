@@ -0,0 +1,224 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/clawdbot"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// TapConfig configures the debug tap, which copies a sample of processed
+// events and their intents to a side channel for offline analysis.
+type TapConfig struct {
+	// SampleRate is the fraction of events tapped, from 0 (none) to 1 (all).
+	SampleRate float64
+	// URL receives each tapped record as a JSON POST.
+	URL string
+	// File receives each tapped record as a JSON line. Used when URL is empty.
+	File string
+	// QueueSize bounds the records waiting to be written; when full, new
+	// records are dropped (default 1024).
+	QueueSize int
+	// Timeout bounds each POST to URL (default 5s).
+	Timeout time.Duration
+}
+
+// TapRecord is what the tap receives for each sampled event.
+type TapRecord struct {
+	TappedAt   time.Time                           `json:"tappedAt"`
+	ReceivedAt time.Time                           `json:"receivedAt"`
+	Adapter    string                              `json:"adapter"`
+	Event      *protocol.CanonicalInteractionEvent `json:"event"`
+	Intents    []*protocol.InteractionIntent       `json:"intents"`
+	LatencyMs  int64                               `json:"latencyMs"`
+	Error      string                              `json:"error,omitempty"`
+	// ErrorCategory classifies a Clawdbot error (see clawdbot.ErrorCategory).
+	ErrorCategory string `json:"errorCategory,omitempty"`
+}
+
+// Tap outcomes, used as the uip_tap_records_total result label.
+const (
+	TapWritten = "written"
+	TapFailed  = "failed"
+	TapDropped = "dropped"
+)
+
+var tapRecordsTotal = metrics.NewCounter("uip_tap_records_total",
+	"Debug tap records by result (written/failed/dropped).",
+	"result")
+
+// EventTap writes sampled records in the background, so a slow or failing
+// side channel never holds up event processing.
+type EventTap struct {
+	config     TapConfig
+	records    chan []byte
+	httpClient *http.Client
+	file       *os.File
+	logger     log.Logger
+	done       chan struct{}
+
+	mu     sync.RWMutex // guards closing records against offer
+	closed bool
+}
+
+// NewEventTap opens the tap's side channel and starts its writer. Exactly
+// one of URL and File is used; a tap with neither is rejected.
+func NewEventTap(cfg TapConfig, logger log.Logger) (*EventTap, error) {
+	if logger == nil {
+		logger = log.Default()
+	}
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return nil, fmt.Errorf("sample rate %v out of range [0, 1]", cfg.SampleRate)
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+
+	t := &EventTap{
+		config:  cfg,
+		records: make(chan []byte, cfg.QueueSize),
+		logger:  logger,
+		done:    make(chan struct{}),
+	}
+	switch {
+	case cfg.URL != "":
+		t.httpClient = &http.Client{Timeout: cfg.Timeout}
+	case cfg.File != "":
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("open tap file: %w", err)
+		}
+		t.file = f
+	default:
+		return nil, errors.New("tap needs a URL or a file")
+	}
+
+	go t.run()
+	return t, nil
+}
+
+// sampled reports whether the next event should be tapped.
+func (t *EventTap) sampled() bool {
+	return t.config.SampleRate >= 1 || rand.Float64() < t.config.SampleRate
+}
+
+// offer encodes rec and queues it for writing, dropping it if the queue is
+// full. Encoding happens here so the record cannot change underneath the
+// writer once processing carries on.
+func (t *EventTap) offer(rec *TapRecord) {
+	body, err := json.Marshal(rec)
+	if err != nil {
+		tapRecordsTotal.Inc(TapFailed)
+		t.logger.Warn("Failed to encode tap record",
+			zap.String("interactionId", rec.Event.InteractionID),
+			zap.Error(err))
+		return
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.records <- body:
+	default:
+		tapRecordsTotal.Inc(TapDropped)
+	}
+}
+
+func (t *EventTap) run() {
+	defer close(t.done)
+	for body := range t.records {
+		if err := t.write(body); err != nil {
+			tapRecordsTotal.Inc(TapFailed)
+			t.logger.Warn("Failed to write tap record", zap.Error(err))
+			continue
+		}
+		tapRecordsTotal.Inc(TapWritten)
+	}
+}
+
+func (t *EventTap) write(body []byte) error {
+	if t.file != nil {
+		_, err := t.file.Write(append(body, '\n'))
+		return err
+	}
+	resp, err := t.httpClient.Post(t.config.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("tap URL returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close stops accepting records and waits until ctx expires for the queued
+// ones to be written. Records still queued after that are lost.
+func (t *EventTap) Close(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.records)
+	}
+	t.mu.Unlock()
+	var err error
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if t.file != nil {
+		if cerr := t.file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// SetEventTap installs the debug tap. A nil tap turns tapping off.
+func (g *Gateway) SetEventTap(t *EventTap) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.tap = t
+}
+
+// tapEvent hands a sample of processed events to the debug tap.
+func (g *Gateway) tapEvent(ctx *eventContext, intents []*protocol.InteractionIntent, err error) {
+	g.mu.RLock()
+	t := g.tap
+	g.mu.RUnlock()
+	if t == nil || !t.sampled() {
+		return
+	}
+	rec := &TapRecord{
+		TappedAt:   g.clock.Now(),
+		ReceivedAt: ctx.receivedAt,
+		Adapter:    ctx.adapterName,
+		Event:      ctx.event,
+		Intents:    intents,
+		LatencyMs:  g.clock.Since(ctx.receivedAt).Milliseconds(),
+	}
+	if err != nil {
+		rec.Error = err.Error()
+		rec.ErrorCategory = clawdbot.ErrorCategory(err)
+	}
+	t.offer(rec)
+}
@@ -0,0 +1,67 @@
+package gateway
+
+import "time"
+
+// ttlMap maps keys to values stamped with the time they were stored, and
+// holds at most capacity entries. It is not safe for concurrent use;
+// callers guard it with their own mutex.
+type ttlMap[V any] struct {
+	entries  map[string]ttlEntry[V]
+	capacity int
+	// onEvict, if set, is called with each value put drops to make room
+	onEvict func(V)
+}
+
+type ttlEntry[V any] struct {
+	value V
+	at    time.Time
+}
+
+func newTTLMap[V any](capacity int) *ttlMap[V] {
+	return &ttlMap[V]{entries: make(map[string]ttlEntry[V]), capacity: capacity}
+}
+
+// get returns the value stored under key and when it was stored.
+func (m *ttlMap[V]) get(key string) (value V, at time.Time, ok bool) {
+	e, ok := m.entries[key]
+	return e.value, e.at, ok
+}
+
+// put stores value under key as of now. When the map is full it first drops
+// entries older than ttl, then arbitrary ones, rather than grow without
+// bound.
+func (m *ttlMap[V]) put(key string, value V, now time.Time, ttl time.Duration) {
+	if _, exists := m.entries[key]; !exists && len(m.entries) >= m.capacity {
+		m.makeRoom(now, ttl)
+	}
+	m.entries[key] = ttlEntry[V]{value: value, at: now}
+}
+
+func (m *ttlMap[V]) delete(key string) {
+	delete(m.entries, key)
+}
+
+func (m *ttlMap[V]) len() int {
+	return len(m.entries)
+}
+
+func (m *ttlMap[V]) makeRoom(now time.Time, ttl time.Duration) {
+	for k, e := range m.entries {
+		if now.Sub(e.at) > ttl {
+			m.evict(k, e.value)
+		}
+	}
+	for k, e := range m.entries {
+		if len(m.entries) < m.capacity {
+			break
+		}
+		m.evict(k, e.value)
+	}
+}
+
+func (m *ttlMap[V]) evict(key string, value V) {
+	delete(m.entries, key)
+	if m.onEvict != nil {
+		m.onEvict(value)
+	}
+}
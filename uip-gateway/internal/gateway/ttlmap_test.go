@@ -0,0 +1,105 @@
+package gateway
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+)
+
+func TestTTLMapBounded(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	tests := []struct {
+		name     string
+		ages     []time.Duration // age of each existing entry at put time
+		wantKept []string
+		wantLen  int
+	}{
+		{"room to spare", []time.Duration{time.Second}, []string{"k0"}, 2},
+		{"expired dropped first", []time.Duration{2 * time.Minute, time.Second, time.Second}, []string{"k1", "k2"}, 3},
+		{"still full drops arbitrary", []time.Duration{time.Second, time.Second, time.Second}, nil, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTTLMap[int](3)
+			var evicted []int
+			m.onEvict = func(v int) { evicted = append(evicted, v) }
+			now := start.Add(time.Hour)
+			for i, age := range tt.ages {
+				m.put(fmt.Sprintf("k%d", i), i, now.Add(-age), time.Minute)
+			}
+			m.put("new", 99, now, time.Minute)
+
+			if m.len() != tt.wantLen {
+				t.Errorf("len = %d, want %d", m.len(), tt.wantLen)
+			}
+			if v, at, ok := m.get("new"); !ok || v != 99 || !at.Equal(now) {
+				t.Errorf("get(new) = %d, %v, %v", v, at, ok)
+			}
+			for _, k := range tt.wantKept {
+				if _, _, ok := m.get(k); !ok {
+					t.Errorf("%s evicted, want kept", k)
+				}
+			}
+			if got, want := len(evicted), len(tt.ages)+1-tt.wantLen; got != want {
+				t.Errorf("evicted %d entries, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestTTLMapOverwriteDoesNotEvict(t *testing.T) {
+	m := newTTLMap[string](2)
+	now := time.Unix(1700000000, 0)
+	m.put("a", "1", now, time.Minute)
+	m.put("b", "1", now, time.Minute)
+	m.put("a", "2", now.Add(time.Second), time.Minute)
+	if m.len() != 2 {
+		t.Fatalf("len = %d, want 2", m.len())
+	}
+	if v, _, _ := m.get("a"); v != "2" {
+		t.Errorf("a = %q, want 2", v)
+	}
+	if _, _, ok := m.get("b"); !ok {
+		t.Error("b evicted by overwriting a")
+	}
+}
+
+func TestDedupWindowPerAdapter(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	g := &Gateway{
+		config: Config{
+			DedupWindow:  time.Minute,
+			DedupWindows: map[string]time.Duration{"slack": 5 * time.Minute},
+		},
+		dedup: newDedupGuard(clk),
+	}
+	for _, name := range []string{"slack", "local"} {
+		if g.dedup.duplicate(name+"\x00evt", g.dedupWindow(name)) {
+			t.Fatalf("%s: first delivery reported duplicate", name)
+		}
+	}
+
+	clk.Advance(2 * time.Minute)
+	if !g.dedup.duplicate("slack\x00evt", g.dedupWindow("slack")) {
+		t.Error("slack: redelivery inside its 5m window not detected")
+	}
+	if g.dedup.duplicate("local\x00evt", g.dedupWindow("local")) {
+		t.Error("local: redelivery after its 1m window reported duplicate")
+	}
+}
+
+func TestEditTrackerEvictionForgetsInteractions(t *testing.T) {
+	clk := clock.NewFake(time.Unix(1700000000, 0))
+	tr := newEditTracker(clk)
+	for i := 0; i < editCapacity+10; i++ {
+		tr.track("local", fmt.Sprintf("m%d", i), fmt.Sprintf("i%d", i))
+	}
+	if tr.byMessage.len() != editCapacity {
+		t.Errorf("messages = %d, want %d", tr.byMessage.len(), editCapacity)
+	}
+	if len(tr.byInteraction) != editCapacity {
+		t.Errorf("interactions = %d, want %d", len(tr.byInteraction), editCapacity)
+	}
+}
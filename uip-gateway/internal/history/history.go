@@ -0,0 +1,127 @@
+// Package history keeps per-conversation message history for backends that
+// are stateless between requests, such as Chat Completions.
+//
+// A History pairs a Store, which holds the messages, with a Pruner, which
+// bounds them. Messages are keyed by the conversation's session key, so the
+// session key strategy decides which events share a history.
+package history
+
+import (
+	"context"
+	"sync"
+)
+
+// Message roles.
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message is one turn of a conversation.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Store holds conversation messages. Implementations must make Update
+// atomic per key, so concurrent appends to one conversation are not lost.
+type Store interface {
+	// Get returns the conversation's messages, oldest first.
+	Get(ctx context.Context, key string) ([]Message, error)
+	// Update replaces the conversation's messages with fn(current).
+	Update(ctx context.Context, key string, fn func([]Message) []Message) error
+	// Delete removes the conversation.
+	Delete(ctx context.Context, key string) error
+}
+
+// Config configures a History.
+type Config struct {
+	// Store holds the messages (default: a new MemoryStore).
+	Store Store
+	// Pruner bounds each conversation after every append (default: none).
+	Pruner Pruner
+}
+
+// History is a pruned, per-conversation message log.
+type History struct {
+	store  Store
+	pruner Pruner
+}
+
+// New creates a History.
+func New(cfg Config) *History {
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryStore()
+	}
+	return &History{
+		store:  cfg.Store,
+		pruner: cfg.Pruner,
+	}
+}
+
+// Append adds messages to the conversation and prunes it.
+func (h *History) Append(ctx context.Context, key string, msgs ...Message) error {
+	return h.store.Update(ctx, key, func(current []Message) []Message {
+		current = append(current, msgs...)
+		if h.pruner != nil {
+			current = h.pruner.Prune(current)
+		}
+		return current
+	})
+}
+
+// Get returns the conversation, oldest message first.
+func (h *History) Get(ctx context.Context, key string) ([]Message, error) {
+	return h.store.Get(ctx, key)
+}
+
+// Clear forgets the conversation.
+func (h *History) Clear(ctx context.Context, key string) error {
+	return h.store.Delete(ctx, key)
+}
+
+// MemoryStore is an in-process Store. Its contents are lost on restart.
+type MemoryStore struct {
+	mu    sync.Mutex
+	convs map[string][]Message
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{convs: make(map[string][]Message)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.convs[key]...), nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, key string, fn func([]Message) []Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// fn gets its own copy so it may append freely
+	msgs := fn(append([]Message(nil), s.convs[key]...))
+	if len(msgs) == 0 {
+		delete(s.convs, key)
+	} else {
+		s.convs[key] = msgs
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.convs, key)
+	return nil
+}
+
+// Len returns the number of stored conversations.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.convs)
+}
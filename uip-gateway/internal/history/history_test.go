@@ -0,0 +1,98 @@
+package history
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestHistoryAppendPrunes(t *testing.T) {
+	ctx := context.Background()
+	h := New(Config{Pruner: SlidingWindow{Size: 2}})
+	h.Append(ctx, "c1", conv("s:sys")...)
+	for i := 1; i <= 3; i++ {
+		h.Append(ctx, "c1", conv(fmt.Sprintf("u:%d", i), fmt.Sprintf("a:%d", i))...)
+	}
+	got, _ := h.Get(ctx, "c1")
+	if want := conv("s:sys", "u:3", "a:3"); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Get = %v, want %v", got, want)
+	}
+
+	// Callers get a copy
+	got[0].Content = "changed"
+	if again, _ := h.Get(ctx, "c1"); again[0].Content != "sys" {
+		t.Error("modifying Get's result changed the stored history")
+	}
+
+	h.Clear(ctx, "c1")
+	if got, _ := h.Get(ctx, "c1"); len(got) != 0 {
+		t.Errorf("Get after Clear = %v, want empty", got)
+	}
+}
+
+// TestHistoryConcurrentAppends appends to a few conversations from many
+// goroutines. Run with -race: no message may be lost, and each sender's
+// messages keep their order.
+func TestHistoryConcurrentAppends(t *testing.T) {
+	const senders, perSender, convs = 8, 50, 3
+	ctx := context.Background()
+	store := NewMemoryStore()
+	h := New(Config{Store: store})
+
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			for i := 0; i < perSender; i++ {
+				key := fmt.Sprintf("c%d", s%convs)
+				if err := h.Append(ctx, key, Message{Role: RoleUser, Content: fmt.Sprintf("%d-%d", s, i)}); err != nil {
+					t.Errorf("Append: %v", err)
+				}
+				h.Get(ctx, key)
+			}
+		}(s)
+	}
+	wg.Wait()
+
+	if store.Len() != convs {
+		t.Errorf("store has %d conversations, want %d", store.Len(), convs)
+	}
+	total := 0
+	for c := 0; c < convs; c++ {
+		msgs, _ := h.Get(ctx, fmt.Sprintf("c%d", c))
+		total += len(msgs)
+		next := make(map[int]int)
+		for _, m := range msgs {
+			var s, i int
+			fmt.Sscanf(m.Content, "%d-%d", &s, &i)
+			if i != next[s] {
+				t.Fatalf("c%d: sender %d message %d out of order, want %d", c, s, i, next[s])
+			}
+			next[s]++
+		}
+	}
+	if total != senders*perSender {
+		t.Errorf("stored %d messages, want %d", total, senders*perSender)
+	}
+}
+
+func TestHistoryConcurrentAppendsPruned(t *testing.T) {
+	ctx := context.Background()
+	h := New(Config{Pruner: TurnLimit{MaxTurns: 5}})
+	var wg sync.WaitGroup
+	for s := 0; s < 8; s++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				h.Append(ctx, "c1", conv("u:q", "a:r")...)
+			}
+		}()
+	}
+	wg.Wait()
+	if got, _ := h.Get(ctx, "c1"); len(got) != 10 {
+		t.Errorf("kept %d messages, want 5 turns of 2", len(got))
+	}
+}
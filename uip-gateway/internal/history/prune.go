@@ -0,0 +1,109 @@
+package history
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Pruning strategy names, as configured in session.history.strategy.
+const (
+	StrategyTurns  = "turns"
+	StrategyTokens = "tokens"
+	StrategyWindow = "window"
+)
+
+// Pruner drops old messages from a conversation. Prune may reuse msgs'
+// backing array.
+type Pruner interface {
+	Prune(msgs []Message) []Message
+}
+
+// PrunerFunc adapts a function to the Pruner interface.
+type PrunerFunc func(msgs []Message) []Message
+
+func (f PrunerFunc) Prune(msgs []Message) []Message { return f(msgs) }
+
+// TurnLimit keeps the last MaxTurns turns, a turn being a user message and
+// the replies that follow it.
+type TurnLimit struct {
+	MaxTurns int
+}
+
+func (p TurnLimit) Prune(msgs []Message) []Message {
+	turns := 0
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].Role != RoleUser {
+			continue
+		}
+		turns++
+		if turns == p.MaxTurns {
+			return msgs[i:]
+		}
+	}
+	return msgs
+}
+
+// TokenBudget drops the oldest messages until the estimated token count is
+// within MaxTokens. The newest message is always kept.
+type TokenBudget struct {
+	MaxTokens int
+	// Estimate returns a message's token count (default: EstimateTokens).
+	Estimate func(Message) int
+}
+
+func (p TokenBudget) Prune(msgs []Message) []Message {
+	estimate := p.Estimate
+	if estimate == nil {
+		estimate = EstimateTokens
+	}
+	total := 0
+	for i := len(msgs) - 1; i >= 0; i-- {
+		total += estimate(msgs[i])
+		if total > p.MaxTokens && i < len(msgs)-1 {
+			return msgs[i+1:]
+		}
+	}
+	return msgs
+}
+
+// EstimateTokens approximates a message's token count as one token per four
+// characters plus a fixed per-message overhead, which is close enough for
+// English and errs long for CJK text.
+func EstimateTokens(m Message) int {
+	return (utf8.RuneCountInString(m.Content)+3)/4 + 4
+}
+
+// SlidingWindow keeps the last Size messages. Leading system messages are
+// pinned: they are kept and do not count towards Size.
+type SlidingWindow struct {
+	Size int
+}
+
+func (p SlidingWindow) Prune(msgs []Message) []Message {
+	pinned := 0
+	for pinned < len(msgs) && msgs[pinned].Role == RoleSystem {
+		pinned++
+	}
+	if len(msgs)-pinned <= p.Size {
+		return msgs
+	}
+	return append(msgs[:pinned:pinned], msgs[len(msgs)-p.Size:]...)
+}
+
+// NewPruner returns the pruner for a strategy name. limit is the strategy's
+// bound: turns for "turns", tokens for "tokens", messages for "window".
+func NewPruner(strategy string, limit int) (Pruner, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("history %s limit must be positive", strategy)
+	}
+	switch strategy {
+	case StrategyTurns:
+		return TurnLimit{MaxTurns: limit}, nil
+	case StrategyTokens:
+		return TokenBudget{MaxTokens: limit}, nil
+	case StrategyWindow:
+		return SlidingWindow{Size: limit}, nil
+	default:
+		return nil, fmt.Errorf("unknown history strategy %q (want turns, tokens or window)", strategy)
+	}
+}
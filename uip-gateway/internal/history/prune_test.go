@@ -0,0 +1,108 @@
+package history
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// conv builds a conversation from "role:content" items, roles abbreviated
+// as s, u and a.
+func conv(items ...string) []Message {
+	roles := map[string]string{"s": RoleSystem, "u": RoleUser, "a": RoleAssistant}
+	msgs := make([]Message, len(items))
+	for i, item := range items {
+		role, content, _ := strings.Cut(item, ":")
+		msgs[i] = Message{Role: roles[role], Content: content}
+	}
+	return msgs
+}
+
+// lengthTokens counts one token per byte, so budgets are easy to follow.
+func lengthTokens(m Message) int { return len(m.Content) }
+
+func TestPruners(t *testing.T) {
+	tests := []struct {
+		name   string
+		pruner Pruner
+		in     []Message
+		want   []Message
+	}{
+		{"turns within limit", TurnLimit{MaxTurns: 2},
+			conv("u:1", "a:1"), conv("u:1", "a:1")},
+		{"turns keep replies with their turn", TurnLimit{MaxTurns: 2},
+			conv("u:1", "a:1", "u:2", "a:2a", "a:2b", "u:3", "a:3"), conv("u:2", "a:2a", "a:2b", "u:3", "a:3")},
+		{"turns drop a leading reply", TurnLimit{MaxTurns: 1},
+			conv("a:hello", "u:1", "a:1"), conv("u:1", "a:1")},
+		{"turns count the pending user message", TurnLimit{MaxTurns: 1},
+			conv("u:1", "a:1", "u:2"), conv("u:2")},
+		{"tokens within budget", TokenBudget{MaxTokens: 10, Estimate: lengthTokens},
+			conv("u:aaaa", "a:bbbb"), conv("u:aaaa", "a:bbbb")},
+		{"tokens drop the oldest", TokenBudget{MaxTokens: 10, Estimate: lengthTokens},
+			conv("u:aaaa", "a:bbbb", "u:cccc"), conv("a:bbbb", "u:cccc")},
+		{"tokens exact budget kept", TokenBudget{MaxTokens: 8, Estimate: lengthTokens},
+			conv("u:aaaa", "a:bbbb"), conv("u:aaaa", "a:bbbb")},
+		{"tokens keep the newest even over budget", TokenBudget{MaxTokens: 2, Estimate: lengthTokens},
+			conv("u:aaaa", "a:bbbbbbbbbb"), conv("a:bbbbbbbbbb")},
+		{"window within size", SlidingWindow{Size: 3},
+			conv("s:sys", "u:1", "a:1"), conv("s:sys", "u:1", "a:1")},
+		{"window pins the system prompt", SlidingWindow{Size: 2},
+			conv("s:sys", "u:1", "a:1", "u:2", "a:2"), conv("s:sys", "u:2", "a:2")},
+		{"window pins every leading system message", SlidingWindow{Size: 1},
+			conv("s:a", "s:b", "u:1", "u:2"), conv("s:a", "s:b", "u:2")},
+		{"window does not pin later system messages", SlidingWindow{Size: 2},
+			conv("u:1", "s:note", "u:2", "a:2"), conv("u:2", "a:2")},
+		{"window without system prompt", SlidingWindow{Size: 1},
+			conv("u:1", "a:1"), conv("a:1")},
+	}
+	for _, tt := range tests {
+		got := tt.pruner.Prune(append([]Message(nil), tt.in...))
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: Prune = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		content string
+		want    int
+	}{
+		{"", 4},
+		{"abcd", 5},
+		{"abcde", 6},
+		{"你好世界", 5}, // runes, not bytes
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(Message{Content: tt.content}); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestNewPruner(t *testing.T) {
+	tests := []struct {
+		strategy string
+		limit    int
+		want     Pruner
+	}{
+		{StrategyTurns, 3, TurnLimit{MaxTurns: 3}},
+		{StrategyTokens, 100, TokenBudget{MaxTokens: 100}},
+		{StrategyWindow, 5, SlidingWindow{Size: 5}},
+	}
+	for _, tt := range tests {
+		p, err := NewPruner(tt.strategy, tt.limit)
+		if err != nil {
+			t.Fatalf("NewPruner(%q, %d): %v", tt.strategy, tt.limit, err)
+		}
+		if fmt.Sprintf("%#v", p) != fmt.Sprintf("%#v", tt.want) {
+			t.Errorf("NewPruner(%q, %d) = %#v, want %#v", tt.strategy, tt.limit, p, tt.want)
+		}
+	}
+	if _, err := NewPruner(StrategyTurns, 0); err == nil {
+		t.Error("NewPruner accepted a zero limit")
+	}
+	if _, err := NewPruner("lru", 5); err == nil {
+		t.Error("NewPruner accepted an unknown strategy")
+	}
+}
@@ -0,0 +1,71 @@
+// Package httperr writes the gateway's HTTP error responses.
+//
+// Every error response carries a protocol.UIPError JSON body, with the HTTP
+// status derived from the error code, so clients can parse failures
+// uniformly:
+//
+//	httperr.WriteUIPError(w, protocol.ErrCodeNotFound, "unknown messageId", "")
+package httperr
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Status returns the HTTP status for a UIPError code. Unknown codes map to 500.
+func Status(code string) int {
+	switch code {
+	case protocol.ErrCodeProtocolError:
+		return http.StatusBadRequest
+	case protocol.ErrCodeUnauthorized:
+		return http.StatusUnauthorized
+	case protocol.ErrCodeForbidden:
+		return http.StatusForbidden
+	case protocol.ErrCodeNotFound:
+		return http.StatusNotFound
+	case protocol.ErrCodeMethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case protocol.ErrCodePayloadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case protocol.ErrCodeGatewayError:
+		return http.StatusBadGateway
+	case protocol.ErrCodeUnavailable:
+		return http.StatusServiceUnavailable
+	case protocol.ErrCodeTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// NewUIPError builds a UIPError, generating a trace ID when traceID is empty
+// so the failure can be matched to the gateway's logs.
+func NewUIPError(code, message, traceID string) *protocol.UIPError {
+	if traceID == "" {
+		traceID = uuid.New().String()
+	}
+	return protocol.NewUIPError(code, message, traceID)
+}
+
+// WriteUIPError writes a UIPError body with the status mapped from code.
+func WriteUIPError(w http.ResponseWriter, code, message, traceID string) {
+	Write(w, NewUIPError(code, message, traceID))
+}
+
+// Write writes e with the status mapped from its code.
+func Write(w http.ResponseWriter, e *protocol.UIPError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(Status(e.Code))
+	json.NewEncoder(w).Encode(e)
+}
+
+// MethodNotAllowed writes a METHOD_NOT_ALLOWED error naming the allowed method.
+func MethodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	WriteUIPError(w, protocol.ErrCodeMethodNotAllowed, "method not allowed", "")
+}
@@ -0,0 +1,65 @@
+// Package httplimit bounds request bodies and handler run time for the
+// gateway's HTTP endpoints.
+//
+// Limit wraps a handler so its request body is capped with http.MaxBytesReader
+// and, optionally, its execution time with http.TimeoutHandler. Handlers that
+// read the body check TooLarge on the read error and reply with
+// WriteTooLarge, so oversized requests get a 413 with a UIPError body:
+//
+//	if limit, ok := httplimit.TooLarge(err); ok {
+//		httplimit.WriteTooLarge(w, limit)
+//		return
+//	}
+package httplimit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/httperr"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// DefaultMaxBodySize is the body limit used when none is configured (1 MiB).
+const DefaultMaxBodySize int64 = 1 << 20
+
+// Limit caps the request body at maxBytes (DefaultMaxBodySize if <= 0) and,
+// when timeout is positive, fails the request with 503 once it has run that
+// long. Do not set a timeout on WebSocket or long-poll endpoints:
+// http.TimeoutHandler does not support connection hijacking.
+func Limit(maxBytes int64, timeout time.Duration, next http.Handler) http.Handler {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBodySize
+	}
+
+	var h http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > maxBytes {
+			WriteTooLarge(w, maxBytes)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+		next.ServeHTTP(w, r)
+	})
+
+	if timeout > 0 {
+		h = http.TimeoutHandler(h, timeout, `{"code":"TIMEOUT","message":"request timed out"}`)
+	}
+	return h
+}
+
+// TooLarge reports whether err came from reading past the body limit, and the limit.
+func TooLarge(err error) (int64, bool) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return maxErr.Limit, true
+	}
+	return 0, false
+}
+
+// WriteTooLarge writes a 413 response with a UIPError body.
+func WriteTooLarge(w http.ResponseWriter, maxBytes int64) {
+	httperr.WriteUIPError(w, protocol.ErrCodePayloadTooLarge,
+		fmt.Sprintf("request body exceeds %d bytes", maxBytes), "")
+}
@@ -0,0 +1,209 @@
+// Package i18n provides locale-aware lookup of system-generated messages.
+//
+// System messages (error replies, rate-limit notices, the webhook pending
+// placeholder) are looked up by key and locale from a Catalog. Lookups fall
+// back from the exact locale ("zh-cn") to its base language ("zh"), then to
+// the catalog's default locale, so a partial translation never yields an
+// empty reply.
+package i18n
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Message keys for system-generated messages.
+const (
+	KeyErrorReply   = "error_reply"
+	KeyTimeoutReply = "timeout_reply"
+	KeyRateLimited  = "rate_limited"
+	KeyPendingReply = "pending_reply"
+	// KeyResponseTruncated is appended to AI replies cut off by the token limit.
+	KeyResponseTruncated = "response_truncated"
+	// KeyHistoryReset confirms the /reset command.
+	KeyHistoryReset = "history_reset"
+	// KeyAttachmentTooLarge is the error reply for an attachment over its size limit.
+	KeyAttachmentTooLarge = "attachment_too_large"
+	// KeyReplyBlocked replaces an AI reply blocked by the content filter.
+	KeyReplyBlocked = "reply_blocked"
+	// KeyAskInvalidAnswer precedes the question again after an answer that does not fit it.
+	KeyAskInvalidAnswer = "ask_invalid_answer"
+	// KeyBusyReply tells a user their message was dropped because the gateway is overloaded.
+	KeyBusyReply = "busy_reply"
+	// Error replies by OpenClaw error category, used instead of KeyErrorReply.
+	KeyErrorAuth             = "error_auth"
+	KeyErrorRateLimit        = "error_rate_limit"
+	KeyErrorModelUnavailable = "error_model_unavailable"
+	KeyErrorContentFiltered  = "error_content_filtered"
+)
+
+// DefaultLocale is used when no locale is configured.
+const DefaultLocale = "en"
+
+// builtin holds the messages shipped with the gateway.
+var builtin = map[string]map[string]string{
+	"en": {
+		KeyErrorReply:         "Sorry, I encountered an error processing your request. Please try again.",
+		KeyRateLimited:        "You're sending messages too quickly. Please wait a moment and try again.",
+		KeyPendingReply:       "Message sent to OpenClaw, waiting for the AI to respond...",
+		KeyResponseTruncated:  "(response truncated)",
+		KeyHistoryReset:       "Conversation history cleared.",
+		KeyAttachmentTooLarge: "Sorry, that attachment is too large for me to process.",
+		KeyReplyBlocked:       "Sorry, I can't share that response.",
+		KeyAskInvalidAnswer:   "Sorry, I didn't understand that answer.",
+		KeyBusyReply:          "I'm receiving too many messages right now and couldn't handle yours. Please send it again in a moment.",
+
+		KeyErrorAuth:             "Sorry, I can't reach my AI service right now. The administrator has been notified.",
+		KeyErrorRateLimit:        "I'm temporarily overloaded. Please try again in a moment.",
+		KeyErrorModelUnavailable: "The AI model is unavailable right now. Please try again later.",
+		KeyErrorContentFiltered:  "Sorry, that request was blocked by the content policy.",
+	},
+	"zh": {
+		KeyErrorReply:         "抱歉，处理您的请求时出错，请稍后重试。",
+		KeyRateLimited:        "您发送消息过于频繁，请稍后再试。",
+		KeyPendingReply:       "消息已发送到 OpenClaw，等待 AI 响应...",
+		KeyResponseTruncated:  "（回复已截断）",
+		KeyHistoryReset:       "对话历史已清除。",
+		KeyAttachmentTooLarge: "抱歉，附件过大，无法处理。",
+		KeyReplyBlocked:       "抱歉，该回复无法显示。",
+		KeyAskInvalidAnswer:   "抱歉，无法识别这个回答。",
+		KeyBusyReply:          "当前消息过多，您的消息未能处理，请稍后再发送。",
+
+		KeyErrorAuth:             "抱歉，暂时无法连接 AI 服务，已通知管理员。",
+		KeyErrorRateLimit:        "当前请求过多，请稍后再试。",
+		KeyErrorModelUnavailable: "AI 模型暂时不可用，请稍后再试。",
+		KeyErrorContentFiltered:  "抱歉，该请求被内容策略拦截。",
+	},
+}
+
+// Catalog is a thread-safe set of messages keyed by locale and message key.
+type Catalog struct {
+	mu            sync.RWMutex
+	defaultLocale string
+	messages      map[string]map[string]string
+}
+
+// NewCatalog creates a catalog preloaded with the built-in messages.
+func NewCatalog(defaultLocale string) *Catalog {
+	if defaultLocale == "" {
+		defaultLocale = DefaultLocale
+	}
+
+	c := &Catalog{
+		defaultLocale: Normalize(defaultLocale),
+		messages:      make(map[string]map[string]string),
+	}
+	for locale, msgs := range builtin {
+		c.Register(locale, msgs)
+	}
+	return c
+}
+
+// DefaultLocale returns the catalog's fallback locale.
+func (c *Catalog) DefaultLocale() string {
+	return c.defaultLocale
+}
+
+// Register merges messages into the given locale, overriding existing keys.
+func (c *Catalog) Register(locale string, messages map[string]string) {
+	locale = Normalize(locale)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.messages[locale] == nil {
+		c.messages[locale] = make(map[string]string)
+	}
+	for key, msg := range messages {
+		c.messages[locale][key] = msg
+	}
+}
+
+// LoadFile loads a catalog file and registers every locale in it.
+// The file maps locales to key/message pairs and may be JSON or YAML
+// (chosen by extension):
+//
+//	en:
+//	  error_reply: "Sorry, something went wrong."
+//	ja:
+//	  error_reply: "申し訳ありません。エラーが発生しました。"
+func (c *Catalog) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read catalog: %w", err)
+	}
+
+	var locales map[string]map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(data, &locales)
+	default:
+		err = yaml.Unmarshal(data, &locales)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse catalog: %w", err)
+	}
+
+	for locale, msgs := range locales {
+		c.Register(locale, msgs)
+	}
+	return nil
+}
+
+// Lookup returns the message for key in locale, falling back to the base
+// language and then the default locale. The boolean is false if no locale
+// in the chain defines the key.
+func (c *Catalog) Lookup(locale, key string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, candidate := range c.chain(Normalize(locale)) {
+		if msg, ok := c.messages[candidate][key]; ok && msg != "" {
+			return msg, true
+		}
+	}
+	return "", false
+}
+
+// chain returns the fallback order for a locale.
+func (c *Catalog) chain(locale string) []string {
+	chain := make([]string, 0, 4)
+	if locale != "" {
+		chain = append(chain, locale)
+		if base, _, found := strings.Cut(locale, "-"); found {
+			chain = append(chain, base)
+		}
+	}
+	chain = append(chain, c.defaultLocale)
+	if base, _, found := strings.Cut(c.defaultLocale, "-"); found {
+		chain = append(chain, base)
+	}
+	return chain
+}
+
+// Normalize lowercases a locale tag and uses "-" as the separator ("zh_CN" -> "zh-cn").
+func Normalize(locale string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(locale), "_", "-"))
+}
+
+// LocaleOf returns the locale hint carried by an event: Meta.Locale first,
+// then a "locale" field in the input payload. Empty means "use the default".
+func LocaleOf(event *protocol.CanonicalInteractionEvent) string {
+	if event.Meta.Locale != "" {
+		return event.Meta.Locale
+	}
+	if event.Input.Payload != nil {
+		if locale, ok := event.Input.Payload["locale"].(string); ok {
+			return locale
+		}
+	}
+	return ""
+}
@@ -5,14 +5,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 
+	"github.com/zlc_ai/uip-gateway/internal/backoff"
 	"github.com/zlc_ai/uip-gateway/internal/clawdbot"
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
 )
 
 // Config holds the IM webhook notifier configuration.
@@ -23,15 +30,35 @@ type Config struct {
 	AuthHeader string
 	// Timeout is the request timeout
 	Timeout time.Duration
+	// DeliveryTimeout bounds a whole direct delivery, retries included
+	// (default Timeout). Queued deliveries are bounded by the queue's MaxAge.
+	DeliveryTimeout time.Duration
 	// RetryCount is the number of retry attempts
 	RetryCount int
+	// MaxInterval caps the delay between retries, including delays requested
+	// by a Retry-After header (default 5s)
+	MaxInterval time.Duration
+	// TrackedDeliveries is how many recent messages are kept for delivery status correlation
+	TrackedDeliveries int
+	// Clock stamps messages and deliveries (clock.System if nil)
+	Clock clock.Clock
 }
 
 // Notifier sends AI responses to external IM systems via webhook.
 type Notifier struct {
 	config     Config
 	httpClient *http.Client
-	logger     *zap.Logger
+	logger     log.Logger
+	deliveries *deliveryTracker
+	queue      *Queue
+	sentHook   func(messageID string)
+
+	// Background deliveries started by Callback, cancelled by Stop
+	mu       sync.Mutex
+	stopped  bool
+	inflight sync.WaitGroup
+	stopCtx  context.Context
+	cancel   context.CancelFunc
 }
 
 // OutboundMessage is the message format sent to external IM webhook.
@@ -45,11 +72,18 @@ type OutboundMessage struct {
 	// Text is the AI response text
 	Text string `json:"text"`
 	// MediaUrl is optional media attachment URL
+	// Deprecated: use Attachments; kept as the first attachment's URL for older receivers.
 	MediaUrl string `json:"mediaUrl,omitempty"`
+	// Attachments is the list of media/files on the AI response
+	Attachments []clawdbot.OutboundAttachment `json:"attachments,omitempty"`
 	// ReplyToId is the original message ID being replied to
 	ReplyToId string `json:"replyToId,omitempty"`
 	// ThreadId is the thread ID for threaded conversations
 	ThreadId string `json:"threadId,omitempty"`
+	// Mentions lists users the reply should @-mention, rendered natively by the IM
+	Mentions []protocol.Mention `json:"mentions,omitempty"`
+	// QuickReplies are suggested answers the IM should offer as buttons
+	QuickReplies []protocol.QuickReply `json:"quickReplies,omitempty"`
 	// Routing contains information for routing to specific IM channel/user
 	Routing RoutingInfo `json:"routing"`
 }
@@ -65,9 +99,9 @@ type RoutingInfo struct {
 }
 
 // NewNotifier creates a new IM webhook notifier.
-func NewNotifier(config Config, logger *zap.Logger) *Notifier {
+func NewNotifier(config Config, logger log.Logger) *Notifier {
 	if logger == nil {
-		logger, _ = zap.NewProduction()
+		logger = log.Default()
 	}
 
 	if config.Timeout == 0 {
@@ -76,30 +110,53 @@ func NewNotifier(config Config, logger *zap.Logger) *Notifier {
 	if config.RetryCount == 0 {
 		config.RetryCount = 3
 	}
+	if config.MaxInterval == 0 {
+		config.MaxInterval = 5 * time.Second
+	}
+	if config.DeliveryTimeout == 0 {
+		config.DeliveryTimeout = config.Timeout
+	}
+	config.Clock = clock.Or(config.Clock)
 
+	stopCtx, cancel := context.WithCancel(context.Background())
 	return &Notifier{
 		config: config,
 		httpClient: &http.Client{
 			Timeout: config.Timeout,
 		},
-		logger: logger,
+		logger:     logger,
+		deliveries: newDeliveryTracker(config.TrackedDeliveries),
+		stopCtx:    stopCtx,
+		cancel:     cancel,
 	}
 }
 
-// Notify sends the AI response to the external IM system.
+// SetSentHook registers fn to receive the messageId of every outbound
+// message, before its first delivery attempt. The gateway uses it to drop
+// the message if the IM echoes it back. Call before Notify.
+func (n *Notifier) SetSentHook(fn func(messageID string)) {
+	n.sentHook = fn
+}
+
+// Notify sends the AI response to the external IM system, giving up after
+// DeliveryTimeout. With a queue set, the message is persisted and delivered
+// in the background instead, and Notify returns once it is queued.
 func (n *Notifier) Notify(ctx context.Context, response *clawdbot.OutboundResponse) error {
 	if n.config.URL == "" {
 		return fmt.Errorf("IM webhook URL not configured")
 	}
 
 	msg := OutboundMessage{
-		MessageID: fmt.Sprintf("ai-resp-%d", time.Now().UnixMilli()),
-		Timestamp: time.Now().UnixMilli(),
-		To:        response.To,
-		Text:      response.Text,
-		MediaUrl:  response.MediaUrl,
-		ReplyToId: response.ReplyToId,
-		ThreadId:  response.ThreadId,
+		MessageID:    "ai-resp-" + uuid.New().String(),
+		Timestamp:    n.config.Clock.Now().UnixMilli(),
+		To:           response.To,
+		Text:         response.Text,
+		MediaUrl:     response.MediaUrl,
+		Attachments:  response.Attachments, // MediaUrl already folded in by HandleCallback
+		ReplyToId:    response.ReplyToId,
+		ThreadId:     response.ThreadId,
+		Mentions:     response.Mentions,
+		QuickReplies: response.QuickReplies,
 		Routing: RoutingInfo{
 			ChannelID: response.ChannelID,
 			UserID:    response.UserID,
@@ -107,21 +164,42 @@ func (n *Notifier) Notify(ctx context.Context, response *clawdbot.OutboundRespon
 		},
 	}
 
+	if msg.MediaUrl == "" && len(msg.Attachments) > 0 {
+		msg.MediaUrl = msg.Attachments[0].URL
+	}
+	if n.sentHook != nil {
+		n.sentHook(msg.MessageID)
+	}
+
+	if n.queue != nil {
+		if err := n.queue.push(msg); err != nil {
+			return fmt.Errorf("failed to queue message: %w", err)
+		}
+		n.logger.Debug("AI response queued for IM webhook",
+			zap.String("messageId", msg.MessageID),
+			zap.Int("queueDepth", n.queue.Len()))
+		return nil
+	}
+
 	body, err := json.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
+	ctx, cancel := context.WithTimeout(ctx, n.config.DeliveryTimeout)
+	defer cancel()
+
 	// Retry logic
 	var lastErr error
 	for attempt := 0; attempt <= n.config.RetryCount; attempt++ {
 		if attempt > 0 {
-			// Exponential backoff
-			backoff := time.Duration(1<<uint(attempt-1)) * 100 * time.Millisecond
+			// Exponential backoff, or the webhook's Retry-After hint
 			select {
-			case <-time.After(backoff):
+			case <-time.After(backoff.Delay(attempt, retryAfter(lastErr), n.config.MaxInterval)):
 			case <-ctx.Done():
-				return ctx.Err()
+			}
+			if ctx.Err() != nil {
+				break
 			}
 			n.logger.Debug("Retrying IM webhook",
 				zap.Int("attempt", attempt+1),
@@ -130,7 +208,9 @@ func (n *Notifier) Notify(ctx context.Context, response *clawdbot.OutboundRespon
 
 		err := n.doNotify(ctx, body)
 		if err == nil {
+			n.track(msg, StatusSent, "")
 			n.logger.Info("AI response sent to IM webhook",
+				zap.String("messageId", msg.MessageID),
 				zap.String("channelId", response.ChannelID),
 				zap.String("userId", response.UserID),
 				zap.Int("textLen", len(response.Text)))
@@ -139,9 +219,112 @@ func (n *Notifier) Notify(ctx context.Context, response *clawdbot.OutboundRespon
 		lastErr = err
 	}
 
+	n.track(msg, StatusFailed, lastErr.Error())
+	if ctx.Err() != nil {
+		return fmt.Errorf("delivery abandoned: %w (last error: %v)", ctx.Err(), lastErr)
+	}
 	return fmt.Errorf("all retries exhausted: %w", lastErr)
 }
 
+// track records a delivery so a later status report can be correlated with it.
+func (n *Notifier) track(msg OutboundMessage, status, errMsg string) {
+	now := n.config.Clock.Now()
+	n.deliveries.add(Delivery{
+		MessageID: msg.MessageID,
+		To:        msg.To,
+		ChannelID: msg.Routing.ChannelID,
+		Status:    status,
+		Error:     errMsg,
+		SentAt:    now,
+		UpdatedAt: now,
+	})
+	deliveryTotal.Inc(status)
+}
+
+// Callback returns an OutboundCallback that forwards each AI response to the
+// external IM system in the background, so slow webhooks never hold up the
+// OpenClaw outbound request. Failures are logged. Deliveries end with ctx,
+// after DeliveryTimeout, or when Stop gives up on them.
+func (n *Notifier) Callback(ctx context.Context) clawdbot.OutboundCallback {
+	return func(response *clawdbot.OutboundResponse) {
+		n.mu.Lock()
+		if n.stopped {
+			n.mu.Unlock()
+			n.logger.Warn("IM webhook notifier stopped, dropping AI response",
+				zap.String("to", response.To),
+				zap.String("channelId", response.ChannelID))
+			return
+		}
+		n.inflight.Add(1)
+		n.mu.Unlock()
+
+		go func() {
+			defer n.inflight.Done()
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			defer context.AfterFunc(n.stopCtx, cancel)()
+
+			if err := n.Notify(ctx, response); err != nil {
+				n.logger.Error("Failed to notify IM webhook",
+					zap.Error(err),
+					zap.String("to", response.To),
+					zap.String("channelId", response.ChannelID))
+			}
+		}()
+	}
+}
+
+// Stop refuses further Callback deliveries and waits for those in flight
+// until ctx expires, then cancels the rest. Queued messages stay on disk
+// for the next start.
+func (n *Notifier) Stop(ctx context.Context) error {
+	n.mu.Lock()
+	n.stopped = true
+	n.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		n.inflight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		n.cancel()
+		return nil
+	case <-ctx.Done():
+		n.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Probe checks that the webhook is reachable and accepts the configured
+// credentials, without delivering a message: it sends a HEAD request and
+// fails on a network error or a 401/403 answer. Other statuses pass, since
+// a webhook may only accept POST.
+func (n *Notifier) Probe(ctx context.Context) error {
+	if n.config.URL == "" {
+		return fmt.Errorf("IM webhook URL not configured")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, n.config.URL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if n.config.AuthHeader != "" {
+		req.Header.Set("Authorization", n.config.AuthHeader)
+	}
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return &statusError{StatusCode: resp.StatusCode, Body: "credentials rejected"}
+	}
+	return nil
+}
+
 func (n *Notifier) doNotify(ctx context.Context, body []byte) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.config.URL, bytes.NewReader(body))
 	if err != nil {
@@ -165,8 +348,33 @@ func (n *Notifier) doNotify(ctx context.Context, body []byte) error {
 	}
 
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("IM webhook error: %d - %s", resp.StatusCode, string(respBody))
+		serr := &statusError{StatusCode: resp.StatusCode, Body: string(respBody)}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			serr.RetryAfter = backoff.ParseRetryAfter(resp.Header.Get("Retry-After"), n.config.Clock.Now())
+		}
+		return serr
 	}
 
 	return nil
 }
+
+// statusError is an error response from the IM webhook.
+type statusError struct {
+	StatusCode int
+	Body       string
+	// RetryAfter is the webhook's Retry-After hint on a 429/503 response.
+	RetryAfter time.Duration
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("IM webhook error: %d - %s", e.StatusCode, e.Body)
+}
+
+// retryAfter returns the Retry-After hint carried by err, or 0.
+func retryAfter(err error) time.Duration {
+	var serr *statusError
+	if errors.As(err, &serr) {
+		return serr.RetryAfter
+	}
+	return 0
+}
@@ -0,0 +1,371 @@
+package imwebhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+	"github.com/zlc_ai/uip-gateway/internal/httperr"
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+)
+
+// Queue defaults.
+const (
+	DefaultQueueMaxAge     = 24 * time.Hour
+	DefaultQueueMaxBackoff = 5 * time.Minute
+
+	queueBaseBackoff = time.Second
+	queueFileSuffix  = ".json"
+)
+
+var queueDepth = metrics.NewGauge("uip_im_queue_depth",
+	"Outbound IM messages waiting in the durable queue.")
+
+// QueueConfig configures the durable outbound queue.
+type QueueConfig struct {
+	// Dir holds one JSON file per pending message.
+	Dir string
+	// MaxAge is how long a message is retried before it is dropped as failed.
+	MaxAge time.Duration
+	// MaxBackoff caps the delay between delivery attempts.
+	MaxBackoff time.Duration
+	// Clock schedules attempts and ages messages (clock.System if nil).
+	Clock clock.Clock
+}
+
+// queuedMessage is a pending message and its delivery state, as persisted.
+type queuedMessage struct {
+	Message     OutboundMessage `json:"message"`
+	EnqueuedAt  time.Time       `json:"enqueuedAt"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+	LastError   string          `json:"lastError,omitempty"`
+}
+
+// Queue is a file-backed queue of outbound messages. Messages survive
+// restarts until they are delivered or exceed MaxAge.
+type Queue struct {
+	config QueueConfig
+
+	mu      sync.Mutex
+	pending map[string]*queuedMessage // by MessageID
+	wake    chan struct{}
+}
+
+// OpenQueue opens the queue directory, creating it if needed, and loads the
+// messages left there by a previous run.
+func OpenQueue(config QueueConfig) (*Queue, error) {
+	if config.Dir == "" {
+		return nil, fmt.Errorf("queue dir is required")
+	}
+	if config.MaxAge <= 0 {
+		config.MaxAge = DefaultQueueMaxAge
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultQueueMaxBackoff
+	}
+	config.Clock = clock.Or(config.Clock)
+	if err := os.MkdirAll(config.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create queue dir: %w", err)
+	}
+
+	q := &Queue{
+		config:  config,
+		pending: make(map[string]*queuedMessage),
+		wake:    make(chan struct{}, 1),
+	}
+
+	files, err := filepath.Glob(filepath.Join(config.Dir, "*"+queueFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read queued message: %w", err)
+		}
+		var qm queuedMessage
+		if err := json.Unmarshal(data, &qm); err != nil || qm.Message.MessageID == "" {
+			return nil, fmt.Errorf("corrupt queued message %s", filepath.Base(file))
+		}
+		q.pending[qm.Message.MessageID] = &qm
+	}
+	queueDepth.Set(float64(len(q.pending)))
+	return q, nil
+}
+
+// Len returns the number of pending messages.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// push persists msg and schedules it for immediate delivery.
+func (q *Queue) push(msg OutboundMessage) error {
+	now := q.config.Clock.Now()
+	qm := &queuedMessage{Message: msg, EnqueuedAt: now, NextAttempt: now}
+	if err := q.save(qm); err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	q.pending[msg.MessageID] = qm
+	queueDepth.Set(float64(len(q.pending)))
+	q.mu.Unlock()
+
+	q.notify()
+	return nil
+}
+
+// due returns copies of the messages whose next attempt has come, oldest
+// first, and the time until the earliest remaining one.
+func (q *Queue) due(now time.Time) ([]queuedMessage, time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var ready []queuedMessage
+	wait := q.config.MaxBackoff
+	for _, qm := range q.pending {
+		if !qm.NextAttempt.After(now) {
+			ready = append(ready, *qm)
+		} else if d := qm.NextAttempt.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool {
+		return ready[i].EnqueuedAt.Before(ready[j].EnqueuedAt)
+	})
+	return ready, wait
+}
+
+// retry records a failed attempt and reschedules the message with backoff.
+func (q *Queue) retry(qm queuedMessage, err error) error {
+	qm.Attempts++
+	qm.LastError = err.Error()
+	delay := q.config.MaxBackoff
+	if hint := retryAfter(err); hint > 0 {
+		if hint < delay {
+			delay = hint
+		}
+	} else if qm.Attempts < 32 {
+		if d := queueBaseBackoff << uint(qm.Attempts-1); d < delay {
+			delay = d
+		}
+	}
+	qm.NextAttempt = q.config.Clock.Now().Add(delay)
+
+	q.mu.Lock()
+	if _, exists := q.pending[qm.Message.MessageID]; !exists {
+		q.mu.Unlock()
+		return nil
+	}
+	q.pending[qm.Message.MessageID] = &qm
+	q.mu.Unlock()
+	return q.save(&qm)
+}
+
+// remove drops a delivered or expired message.
+func (q *Queue) remove(id string) error {
+	q.mu.Lock()
+	delete(q.pending, id)
+	queueDepth.Set(float64(len(q.pending)))
+	q.mu.Unlock()
+
+	if err := os.Remove(q.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Flush makes every pending message due now and wakes the worker. It returns
+// the number of messages scheduled.
+func (q *Queue) Flush() int {
+	q.mu.Lock()
+	now := q.config.Clock.Now()
+	for _, qm := range q.pending {
+		qm.NextAttempt = now
+	}
+	n := len(q.pending)
+	q.mu.Unlock()
+
+	q.notify()
+	return n
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Queue) path(id string) string {
+	return filepath.Join(q.config.Dir, id+queueFileSuffix)
+}
+
+// save writes qm atomically, so a crash never leaves a truncated file.
+func (q *Queue) save(qm *queuedMessage) error {
+	if strings.ContainsAny(qm.Message.MessageID, `/\`) {
+		return fmt.Errorf("invalid message id %q", qm.Message.MessageID)
+	}
+	data, err := json.Marshal(qm)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(q.config.Dir, ".pending-*")
+	if err != nil {
+		return fmt.Errorf("persist queued message: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("persist queued message: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("persist queued message: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("persist queued message: %w", err)
+	}
+	return os.Rename(tmp.Name(), q.path(qm.Message.MessageID))
+}
+
+// SetQueue routes Notify through a durable queue: messages are persisted
+// and delivered by the worker started with Start, retrying with backoff
+// until they succeed or exceed the queue's MaxAge. Call before Start.
+func (n *Notifier) SetQueue(q *Queue) {
+	n.queue = q
+}
+
+// QueueDepth returns the number of queued messages, or 0 without a queue.
+func (n *Notifier) QueueDepth() int {
+	if n.queue == nil {
+		return 0
+	}
+	return n.queue.Len()
+}
+
+// Start runs the queue worker until ctx is cancelled. It is a no-op
+// without a queue.
+func (n *Notifier) Start(ctx context.Context) {
+	if n.queue == nil {
+		return
+	}
+	go n.runQueue(ctx)
+}
+
+func (n *Notifier) runQueue(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		case <-n.queue.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		}
+		timer.Reset(n.drainQueue(ctx))
+	}
+}
+
+// drainQueue attempts every due message once and returns how long to wait
+// before the next one is due.
+func (n *Notifier) drainQueue(ctx context.Context) time.Duration {
+	ready, _ := n.queue.due(n.queue.config.Clock.Now())
+	for _, qm := range ready {
+		if ctx.Err() != nil {
+			return 0
+		}
+		n.deliverQueued(ctx, qm)
+	}
+	_, wait := n.queue.due(n.queue.config.Clock.Now())
+	return wait
+}
+
+func (n *Notifier) deliverQueued(ctx context.Context, qm queuedMessage) {
+	msg := qm.Message
+	if n.queue.config.Clock.Since(qm.EnqueuedAt) > n.queue.config.MaxAge {
+		n.dequeue(msg.MessageID)
+		n.track(msg, StatusFailed, "expired: "+qm.LastError)
+		n.logger.Error("Dropping expired IM webhook message",
+			zap.String("messageId", msg.MessageID),
+			zap.Int("attempts", qm.Attempts),
+			zap.String("lastError", qm.LastError))
+		return
+	}
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		n.dequeue(msg.MessageID)
+		n.track(msg, StatusFailed, err.Error())
+		return
+	}
+
+	if err := n.doNotify(ctx, body); err != nil {
+		if ctx.Err() != nil {
+			return
+		}
+		n.logger.Warn("Queued IM webhook delivery failed",
+			zap.String("messageId", msg.MessageID),
+			zap.Int("attempt", qm.Attempts+1),
+			zap.Error(err))
+		if err := n.queue.retry(qm, err); err != nil {
+			n.logger.Error("Failed to persist queued message", zap.Error(err))
+		}
+		return
+	}
+
+	n.dequeue(msg.MessageID)
+	n.track(msg, StatusSent, "")
+	n.logger.Info("Queued AI response sent to IM webhook",
+		zap.String("messageId", msg.MessageID),
+		zap.String("channelId", msg.Routing.ChannelID),
+		zap.Int("attempts", qm.Attempts+1))
+}
+
+func (n *Notifier) dequeue(id string) {
+	if err := n.queue.remove(id); err != nil {
+		n.logger.Error("Failed to remove queued message",
+			zap.String("messageId", id),
+			zap.Error(err))
+	}
+}
+
+// FlushHandler returns an http.Handler that retries every queued message
+// immediately, ignoring backoff.
+func (n *Notifier) FlushHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			httperr.MethodNotAllowed(w, http.MethodPost)
+			return
+		}
+		scheduled := 0
+		if n.queue != nil {
+			scheduled = n.queue.Flush()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"ok":        true,
+			"scheduled": scheduled,
+		})
+	})
+}
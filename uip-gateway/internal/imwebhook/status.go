@@ -0,0 +1,185 @@
+package imwebhook
+
+import (
+	"container/list"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/httperr"
+	"github.com/zlc_ai/uip-gateway/internal/metrics"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Delivery states. A message is "sent" once the external IM accepted the
+// webhook POST, and "delivered" or "failed" once it reports back.
+const (
+	StatusSent      = "sent"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// DefaultTrackedDeliveries is the number of deliveries remembered for correlation.
+const DefaultTrackedDeliveries = 1000
+
+var (
+	deliveryTotal = metrics.NewCounter("uip_im_delivery_total",
+		"IM webhook deliveries, by status (sent/delivered/failed/unknown).",
+		"status")
+
+	deliveryLatency = metrics.NewHistogram("uip_im_delivery_seconds",
+		"Time from the webhook POST to the external IM's delivery receipt.",
+		nil, "status")
+)
+
+// Delivery is the tracked state of one outbound message.
+type Delivery struct {
+	MessageID string    `json:"messageId"`
+	To        string    `json:"to"`
+	ChannelID string    `json:"channelId,omitempty"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	SentAt    time.Time `json:"sentAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// StatusReport is the body the external IM POSTs to the status endpoint.
+type StatusReport struct {
+	// MessageID is the messageId from the OutboundMessage.
+	MessageID string `json:"messageId"`
+	// Status is "delivered" or "failed".
+	Status string `json:"status"`
+	// Error describes a failed delivery.
+	Error string `json:"error,omitempty"`
+}
+
+// deliveryTracker remembers the most recent deliveries, evicting the oldest.
+type deliveryTracker struct {
+	capacity int
+
+	mu    sync.Mutex
+	byID  map[string]*list.Element
+	order *list.List // oldest first
+}
+
+func newDeliveryTracker(capacity int) *deliveryTracker {
+	if capacity <= 0 {
+		capacity = DefaultTrackedDeliveries
+	}
+	return &deliveryTracker{
+		capacity: capacity,
+		byID:     make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (t *deliveryTracker) add(d Delivery) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for t.order.Len() >= t.capacity {
+		oldest := t.order.Front()
+		delete(t.byID, oldest.Value.(*Delivery).MessageID)
+		t.order.Remove(oldest)
+	}
+	t.byID[d.MessageID] = t.order.PushBack(&d)
+}
+
+// update applies a status report and returns the updated delivery.
+func (t *deliveryTracker) update(report StatusReport, now time.Time) (Delivery, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	e, exists := t.byID[report.MessageID]
+	if !exists {
+		return Delivery{}, false
+	}
+	d := e.Value.(*Delivery)
+	d.Status = report.Status
+	d.Error = report.Error
+	d.UpdatedAt = now
+	return *d, true
+}
+
+// snapshot returns all tracked deliveries, newest first.
+func (t *deliveryTracker) snapshot() []Delivery {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := make([]Delivery, 0, t.order.Len())
+	for e := t.order.Back(); e != nil; e = e.Prev() {
+		out = append(out, *e.Value.(*Delivery))
+	}
+	return out
+}
+
+// Deliveries returns the tracked deliveries, newest first.
+func (n *Notifier) Deliveries() []Delivery {
+	return n.deliveries.snapshot()
+}
+
+// StatusHandler returns an http.Handler accepting StatusReport POSTs from
+// the external IM. When an AuthHeader is configured, the external IM must
+// send the same Authorization header back.
+func (n *Notifier) StatusHandler() http.Handler {
+	return http.HandlerFunc(n.handleStatus)
+}
+
+func (n *Notifier) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httperr.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	if n.config.AuthHeader != "" &&
+		subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(n.config.AuthHeader)) != 1 {
+		httperr.WriteUIPError(w, protocol.ErrCodeUnauthorized, "unauthorized", "")
+		return
+	}
+
+	var report StatusReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		httperr.WriteUIPError(w, protocol.ErrCodeProtocolError, "invalid JSON", "")
+		return
+	}
+	if report.MessageID == "" {
+		httperr.WriteUIPError(w, protocol.ErrCodeProtocolError, "messageId is required", "")
+		return
+	}
+	if report.Status != StatusDelivered && report.Status != StatusFailed {
+		httperr.WriteUIPError(w, protocol.ErrCodeProtocolError, `status must be "delivered" or "failed"`, "")
+		return
+	}
+
+	delivery, exists := n.deliveries.update(report, n.config.Clock.Now())
+	if !exists {
+		deliveryTotal.Inc("unknown")
+		n.logger.Warn("Delivery status for unknown message",
+			zap.String("messageId", report.MessageID),
+			zap.String("status", report.Status))
+		httperr.WriteUIPError(w, protocol.ErrCodeNotFound, "unknown messageId", "")
+		return
+	}
+
+	deliveryTotal.Inc(report.Status)
+	deliveryLatency.Observe(delivery.UpdatedAt.Sub(delivery.SentAt).Seconds(), report.Status)
+
+	if report.Status == StatusFailed {
+		n.logger.Warn("External IM reported delivery failure",
+			zap.String("messageId", report.MessageID),
+			zap.String("channelId", delivery.ChannelID),
+			zap.String("error", report.Error))
+	} else {
+		n.logger.Debug("External IM confirmed delivery",
+			zap.String("messageId", report.MessageID))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok": true,
+	})
+}
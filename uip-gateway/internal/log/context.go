@@ -0,0 +1,58 @@
+package log
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// With returns a logger that adds fields to every entry. *zap.Logger uses
+// its own With; other loggers are wrapped.
+func With(logger Logger, fields ...Field) Logger {
+	if len(fields) == 0 {
+		return logger
+	}
+	switch l := logger.(type) {
+	case *zap.Logger:
+		return l.With(fields...)
+	case *fieldLogger:
+		return &fieldLogger{
+			base:   l.base,
+			fields: append(append([]Field(nil), l.fields...), fields...),
+		}
+	}
+	return &fieldLogger{base: logger, fields: fields}
+}
+
+// fieldLogger prepends fixed fields to the fields of every entry.
+type fieldLogger struct {
+	base   Logger
+	fields []Field
+}
+
+func (l *fieldLogger) with(fields []Field) []Field {
+	return append(append(make([]Field, 0, len(l.fields)+len(fields)), l.fields...), fields...)
+}
+
+func (l *fieldLogger) Debug(msg string, fields ...Field) { l.base.Debug(msg, l.with(fields)...) }
+func (l *fieldLogger) Info(msg string, fields ...Field)  { l.base.Info(msg, l.with(fields)...) }
+func (l *fieldLogger) Warn(msg string, fields ...Field)  { l.base.Warn(msg, l.with(fields)...) }
+func (l *fieldLogger) Error(msg string, fields ...Field) { l.base.Error(msg, l.with(fields)...) }
+
+func (l *fieldLogger) DebugEnabled() bool { return DebugEnabled(l.base) }
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying logger, so code further down
+// the call chain logs with the caller's correlation fields.
+func NewContext(ctx context.Context, logger Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or fallback if none.
+func FromContext(ctx context.Context, fallback Logger) Logger {
+	if logger, ok := ctx.Value(contextKey{}).(Logger); ok {
+		return logger
+	}
+	return fallback
+}
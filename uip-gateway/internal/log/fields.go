@@ -0,0 +1,64 @@
+package log
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// Correlation field keys. Every log line about an event carries the same
+// keys, so one traceId can be followed from the adapter through Clawdbot
+// and back.
+const (
+	KeyTraceID       = "traceId"
+	KeyInteractionID = "interactionId"
+	KeySessionID     = "sessionId"
+	KeyAdapter       = "adapter"
+	KeyIntentID      = "intentId"
+)
+
+// EventFields returns the correlation fields of an event: its trace ID,
+// interaction ID, external session ID and, when set, the adapter name.
+func EventFields(event *protocol.CanonicalInteractionEvent) []Field {
+	fields := []Field{
+		zap.String(KeyTraceID, event.Meta.TraceID),
+		zap.String(KeyInteractionID, event.InteractionID),
+		zap.String(KeySessionID, event.Session.ExternalSessionID),
+	}
+	if event.Meta.AdapterName != "" {
+		fields = append(fields, zap.String(KeyAdapter, event.Meta.AdapterName))
+	}
+	return fields
+}
+
+// IntentFields returns the fields identifying an intent: its intent ID
+// and the session and interaction it answers. Intents carry no trace ID;
+// log them with the event's logger to keep it.
+func IntentFields(intent *protocol.InteractionIntent) []Field {
+	return []Field{
+		zap.String(KeyIntentID, intent.IntentID),
+		zap.String(KeySessionID, intent.TargetSessionID),
+		zap.String(KeyInteractionID, intent.InReplyTo),
+	}
+}
+
+// ForEvent returns the logger carried by ctx, which the gateway sets up
+// with the event's correlation fields while processing it, or else
+// fallback with EventFields added.
+func ForEvent(ctx context.Context, fallback Logger, event *protocol.CanonicalInteractionEvent) Logger {
+	if logger, ok := ctx.Value(contextKey{}).(Logger); ok {
+		return logger
+	}
+	return With(fallback, EventFields(event)...)
+}
+
+// ForIntent returns the logger for delivering intent: the logger carried
+// by ctx with the intent ID added, or else fallback with IntentFields.
+func ForIntent(ctx context.Context, fallback Logger, intent *protocol.InteractionIntent) Logger {
+	if logger, ok := ctx.Value(contextKey{}).(Logger); ok {
+		return With(logger, zap.String(KeyIntentID, intent.IntentID))
+	}
+	return With(fallback, IntentFields(intent)...)
+}
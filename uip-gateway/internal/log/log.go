@@ -0,0 +1,64 @@
+// Package log defines the minimal logging interface used throughout the gateway.
+//
+// Packages accept a Logger rather than a concrete *zap.Logger, so an embedder
+// can route gateway logs to its own logging library. The package still
+// depends on zap: Field is zap's field type, callers build fields with
+// zap.String, zap.Error and friends, and a *zap.Logger satisfies Logger
+// as-is. A Logger for another backend receives zap fields and can render
+// them with FieldMap.
+package log
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Field is a structured log field. It is zap's field type, so importing
+// this package still pulls in zap.
+type Field = zapcore.Field
+
+// Logger is the logging interface accepted by gateway constructors.
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+}
+
+// DebugEnabler is optionally implemented by loggers that can report whether
+// debug output is enabled, so callers can skip expensive debug-only work.
+type DebugEnabler interface {
+	DebugEnabled() bool
+}
+
+// Default returns the logger used when a constructor is given nil: a zap
+// production logger, or a no-op logger if that cannot be built.
+func Default() Logger {
+	logger, err := zap.NewProduction()
+	if err != nil {
+		return zap.NewNop()
+	}
+	return logger
+}
+
+// DebugEnabled reports whether logger emits debug output. Loggers that are
+// neither zap loggers nor DebugEnablers are assumed not to.
+func DebugEnabled(logger Logger) bool {
+	switch l := logger.(type) {
+	case *zap.Logger:
+		return l.Core().Enabled(zapcore.DebugLevel)
+	case DebugEnabler:
+		return l.DebugEnabled()
+	default:
+		return false
+	}
+}
+
+// FieldMap renders fields as a map, for adapting Logger to non-zap backends.
+func FieldMap(fields []Field) map[string]interface{} {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return enc.Fields
+}
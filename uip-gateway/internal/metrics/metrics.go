@@ -0,0 +1,410 @@
+// Package metrics provides lightweight, dependency-free counters, gauges and
+// histograms exposed in the Prometheus text exposition format.
+//
+// Metrics are registered once at package init time (typically as package-level
+// variables) and updated concurrently from the hot path. Label values must come
+// from small, bounded sets (adapter names, conversation types, outcomes) — never
+// from user or session identifiers.
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registry holds a set of metrics.
+type Registry struct {
+	mu      sync.RWMutex
+	metrics map[string]metric
+
+	scrapeMu sync.Mutex
+	scraped  chan struct{} // closed and replaced after each scrape
+}
+
+type metric interface {
+	name() string
+	write(w io.Writer)
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		metrics: make(map[string]metric),
+		scraped: make(chan struct{}),
+	}
+}
+
+// Default is the process-wide registry used by the package-level constructors.
+var Default = NewRegistry()
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.metrics[m.name()]; exists {
+		panic(fmt.Sprintf("metrics: %s already registered", m.name()))
+	}
+	r.metrics[m.name()] = m
+}
+
+// Write writes all metrics in the Prometheus text format, sorted by name.
+func (r *Registry) Write(w io.Writer) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ms := make([]metric, 0, len(names))
+	for _, name := range names {
+		ms = append(ms, r.metrics[name])
+	}
+	r.mu.RUnlock()
+
+	for _, m := range ms {
+		m.write(w)
+	}
+}
+
+// Handler returns an http.Handler that serves the registry.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// Swap before writing, so waiters released by this scrape see
+		// values from after they started waiting
+		r.scrapeMu.Lock()
+		scraped := r.scraped
+		r.scraped = make(chan struct{})
+		r.scrapeMu.Unlock()
+		defer close(scraped)
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		r.Write(w)
+	})
+}
+
+// WaitForScrape blocks until the registry's Handler has served a scrape
+// that started after the call, or ctx is done. At shutdown it lets the
+// final values reach Prometheus before the metrics server goes away.
+func (r *Registry) WaitForScrape(ctx context.Context) error {
+	r.scrapeMu.Lock()
+	scraped := r.scraped
+	r.scrapeMu.Unlock()
+	select {
+	case <-scraped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Handler returns an http.Handler that serves the default registry.
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+// WaitForScrape waits for a scrape of the default registry.
+func WaitForScrape(ctx context.Context) error {
+	return Default.WaitForScrape(ctx)
+}
+
+// vec stores one float value per label-value combination.
+type vec struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+
+	mu     sync.RWMutex
+	values map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+}
+
+func newVec(name, help, kind string, labels []string) *vec {
+	return &vec{
+		metricName: name,
+		help:       help,
+		kind:       kind,
+		labels:     labels,
+		values:     make(map[string]*series),
+	}
+}
+
+func (v *vec) name() string { return v.metricName }
+
+func (v *vec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d",
+			v.metricName, len(v.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (v *vec) add(delta float64, labelValues []string) {
+	k := v.key(labelValues)
+	v.mu.Lock()
+	s, exists := v.values[k]
+	if !exists {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		v.values[k] = s
+	}
+	s.value += delta
+	v.mu.Unlock()
+}
+
+func (v *vec) set(value float64, labelValues []string) {
+	k := v.key(labelValues)
+	v.mu.Lock()
+	s, exists := v.values[k]
+	if !exists {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		v.values[k] = s
+	}
+	s.value = value
+	v.mu.Unlock()
+}
+
+func (v *vec) get(labelValues []string) float64 {
+	k := v.key(labelValues)
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	if s, exists := v.values[k]; exists {
+		return s.value
+	}
+	return 0
+}
+
+// snapshot returns a copy of every series keyed by its joined label values.
+func (v *vec) snapshot() map[string]float64 {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	out := make(map[string]float64, len(v.values))
+	for _, s := range v.values {
+		out[strings.Join(s.labelValues, ",")] = s.value
+	}
+	return out
+}
+
+func (v *vec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.metricName, v.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.metricName, v.kind)
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := v.values[k]
+		fmt.Fprintf(w, "%s%s %s\n", v.metricName, formatLabels(v.labels, s.labelValues, "", ""), formatValue(s.value))
+	}
+}
+
+// Counter is a monotonically increasing value, optionally partitioned by labels.
+type Counter struct{ v *vec }
+
+// NewCounter registers a counter in the default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.NewCounter(name, help, labels...)
+}
+
+// NewCounter registers a counter in the registry.
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{v: newVec(name, help, "counter", labels)}
+	r.register(c.v)
+	return c
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc(labelValues ...string) { c.v.add(1, labelValues) }
+
+// Add increments the counter by delta, which must not be negative.
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.add(delta, labelValues)
+}
+
+// Value returns the current value for the given label values.
+func (c *Counter) Value(labelValues ...string) float64 { return c.v.get(labelValues) }
+
+// Snapshot returns all series keyed by comma-joined label values.
+func (c *Counter) Snapshot() map[string]float64 { return c.v.snapshot() }
+
+// Gauge is a value that can go up and down, optionally partitioned by labels.
+type Gauge struct{ v *vec }
+
+// NewGauge registers a gauge in the default registry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.NewGauge(name, help, labels...)
+}
+
+// NewGauge registers a gauge in the registry.
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	g := &Gauge{v: newVec(name, help, "gauge", labels)}
+	r.register(g.v)
+	return g
+}
+
+// Set sets the gauge to value.
+func (g *Gauge) Set(value float64, labelValues ...string) { g.v.set(value, labelValues) }
+
+// Add adds delta (which may be negative) to the gauge.
+func (g *Gauge) Add(delta float64, labelValues ...string) { g.v.add(delta, labelValues) }
+
+// Inc increments the gauge by one.
+func (g *Gauge) Inc(labelValues ...string) { g.v.add(1, labelValues) }
+
+// Dec decrements the gauge by one.
+func (g *Gauge) Dec(labelValues ...string) { g.v.add(-1, labelValues) }
+
+// Value returns the current value for the given label values.
+func (g *Gauge) Value(labelValues ...string) float64 { return g.v.get(labelValues) }
+
+// Snapshot returns all series keyed by comma-joined label values.
+func (g *Gauge) Snapshot() map[string]float64 { return g.v.snapshot() }
+
+// DefaultBuckets are latency buckets in seconds suited to chat round trips.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Histogram samples observations into cumulative buckets.
+type Histogram struct {
+	metricName string
+	help       string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histSeries
+}
+
+type histSeries struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// NewHistogram registers a histogram in the default registry.
+// A nil buckets slice uses DefaultBuckets.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.NewHistogram(name, help, buckets, labels...)
+}
+
+// NewHistogram registers a histogram in the registry.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	h := &Histogram{
+		metricName: name,
+		help:       help,
+		labels:     labels,
+		buckets:    buckets,
+		series:     make(map[string]*histSeries),
+	}
+	r.register(h)
+	return h
+}
+
+func (h *Histogram) name() string { return h.metricName }
+
+// Observe records a single observation.
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	if len(labelValues) != len(h.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d",
+			h.metricName, len(h.labels), len(labelValues)))
+	}
+	k := strings.Join(labelValues, "\xff")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, exists := h.series[k]
+	if !exists {
+		s = &histSeries{
+			labelValues: append([]string(nil), labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[k] = s
+	}
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// Count returns the number of observations for the given label values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, exists := h.series[strings.Join(labelValues, "\xff")]; exists {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", h.metricName, h.help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", h.metricName)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.series[k]
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName,
+				formatLabels(h.labels, s.labelValues, "le", formatValue(upper)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metricName,
+			formatLabels(h.labels, s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metricName, formatLabels(h.labels, s.labelValues, "", ""), formatValue(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metricName, formatLabels(h.labels, s.labelValues, "", ""), s.count)
+	}
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	parts := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%q", name, values[i]))
+	}
+	if extraName != "" {
+		parts = append(parts, fmt.Sprintf("%s=%q", extraName, extraValue))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return fmt.Sprintf("%g", v)
+}
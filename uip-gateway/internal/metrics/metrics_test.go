@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// blockingWriter holds a scrape in flight until release is closed.
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	started chan struct{}
+	release chan struct{}
+	once    bool
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	if !w.once {
+		w.once = true
+		close(w.started)
+		<-w.release
+	}
+	return w.ResponseRecorder.Write(p)
+}
+
+func scrape(r *Registry) {
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.Handler().ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func waitAsync(r *Registry, ctx context.Context) <-chan error {
+	done := make(chan error, 1)
+	go func() { done <- r.WaitForScrape(ctx) }()
+	return done
+}
+
+func TestWaitForScrapeIgnoresScrapeInFlight(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_total", "Test counter.").Inc()
+
+	w := &blockingWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		started:          make(chan struct{}),
+		release:          make(chan struct{}),
+	}
+	inFlight := make(chan struct{})
+	go func() {
+		defer close(inFlight)
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		r.Handler().ServeHTTP(w, req)
+	}()
+	<-w.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// The in-flight scrape swapped the channel before writing, so the
+	// waiter must only be released by the next one
+	done := waitAsync(r, ctx)
+	time.Sleep(20 * time.Millisecond)
+
+	close(w.release)
+	<-inFlight
+	select {
+	case err := <-done:
+		t.Fatalf("waiter released by scrape that started before it: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	scrape(r)
+	if err := <-done; err != nil {
+		t.Fatalf("WaitForScrape: %v", err)
+	}
+}
+
+func TestWaitForScrapeReleasedByLaterScrape(t *testing.T) {
+	r := NewRegistry()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	done := waitAsync(r, ctx)
+	time.Sleep(20 * time.Millisecond)
+
+	scrape(r)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("WaitForScrape: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter not released by scrape that started after it")
+	}
+}
+
+func TestWaitForScrapeHonoursContext(t *testing.T) {
+	r := NewRegistry()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := r.WaitForScrape(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("WaitForScrape = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
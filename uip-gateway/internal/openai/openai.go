@@ -0,0 +1,309 @@
+// Package openai serves an OpenAI-compatible Chat Completions API, so tools
+// that only speak that API can use the gateway as a drop-in backend.
+package openai
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/adapter"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
+)
+
+// AdapterName is the adapter name events from this API are attributed to.
+const AdapterName = "openai"
+
+// DefaultModel is the model name reported when Config.Model is empty.
+const DefaultModel = "uip-gateway"
+
+// Config holds the OpenAI-compatible API configuration.
+type Config struct {
+	// APIKeys are the accepted bearer keys. Each key gets its own session,
+	// split further by the request's user field when set.
+	APIKeys []string
+	// Model is the model name listed by /v1/models and echoed in responses
+	// (default DefaultModel).
+	Model string
+	// ForwardModel passes the request's model to OpenClaw as a per-event
+	// override instead of using the configured model.
+	ForwardModel bool
+}
+
+// Handler serves /v1/chat/completions and /v1/models.
+type Handler struct {
+	config  Config
+	process adapter.SyncProcessor
+	logger  *zap.Logger
+}
+
+// NewHandler creates a handler that answers requests through process,
+// usually Gateway.ProcessSync.
+func NewHandler(config Config, process adapter.SyncProcessor, logger *zap.Logger) *Handler {
+	if config.Model == "" {
+		config.Model = DefaultModel
+	}
+	return &Handler{
+		config:  config,
+		process: process,
+		logger:  logger,
+	}
+}
+
+// chatRequest is the subset of the Chat Completions request the gateway uses.
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	Stream      bool          `json:"stream"`
+	Temperature *float64      `json:"temperature"`
+	MaxTokens   *int          `json:"max_tokens"`
+	TopP        *float64      `json:"top_p"`
+	User        string        `json:"user"`
+}
+
+// chatMessage accepts content as a string or as an array of content parts.
+type chatMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the message text, joining the text parts of array content.
+func (m chatMessage) text() string {
+	var s string
+	if json.Unmarshal(m.Content, &s) == nil {
+		return s
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(m.Content, &parts) != nil {
+		return ""
+	}
+	var texts []string
+	for _, p := range parts {
+		if p.Type == "text" && p.Text != "" {
+			texts = append(texts, p.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+type completionMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type completionChoice struct {
+	Index        int                `json:"index"`
+	Message      *completionMessage `json:"message,omitempty"`
+	Delta        *completionMessage `json:"delta,omitempty"`
+	FinishReason *string            `json:"finish_reason"`
+}
+
+type completion struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []completionChoice `json:"choices"`
+}
+
+// ChatCompletions serves POST /v1/chat/completions.
+func (h *Handler) ChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return
+	}
+	keyID, ok := h.authenticate(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid_request_error", "invalid API key")
+		return
+	}
+
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "invalid request body: "+err.Error())
+		return
+	}
+	text := lastUserMessage(req.Messages)
+	if text == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "messages must include a user message with text")
+		return
+	}
+	generation := protocol.GenerationParams{Temperature: req.Temperature, MaxTokens: req.MaxTokens, TopP: req.TopP}
+	if err := generation.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	event := h.newEvent(keyID, req, text)
+	if generation != (protocol.GenerationParams{}) {
+		event.Meta.Generation = &generation
+	}
+	logger := log.With(h.logger, log.EventFields(event)...)
+	logger.Debug("Received chat completion request", zap.Bool("stream", req.Stream))
+
+	intent, err := h.process(r.Context(), event)
+	if intent == nil {
+		logger.Warn("Chat completion failed", zap.Error(err))
+		status := http.StatusServiceUnavailable
+		if errors.Is(err, context.DeadlineExceeded) {
+			status = http.StatusGatewayTimeout
+		}
+		writeError(w, status, "server_error", err.Error())
+		return
+	}
+	if err != nil {
+		// intent is the user-facing error reply
+		logger.Warn("Chat completion failed", zap.Error(err))
+		writeError(w, http.StatusBadGateway, "server_error", intent.Content.Text)
+		return
+	}
+
+	model := h.config.Model
+	if h.config.ForwardModel && req.Model != "" {
+		model = req.Model
+	}
+	resp := completion{
+		ID:      "chatcmpl-" + intent.IntentID,
+		Created: time.Now().Unix(),
+		Model:   model,
+	}
+	if req.Stream {
+		h.stream(w, resp, intent.Content.Text)
+		return
+	}
+	finish := "stop"
+	resp.Object = "chat.completion"
+	resp.Choices = []completionChoice{{
+		Message:      &completionMessage{Role: "assistant", Content: intent.Content.Text},
+		FinishReason: &finish,
+	}}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// stream writes the reply as server-sent chunks. The gateway produces the
+// whole reply at once, so the content arrives in a single delta.
+func (h *Handler) stream(w http.ResponseWriter, resp completion, text string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+
+	finish := "stop"
+	resp.Object = "chat.completion.chunk"
+	for _, choice := range []completionChoice{
+		{Delta: &completionMessage{Role: "assistant"}},
+		{Delta: &completionMessage{Content: text}},
+		{Delta: &completionMessage{}, FinishReason: &finish},
+	} {
+		resp.Choices = []completionChoice{choice}
+		data, _ := json.Marshal(resp)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// Models serves GET /v1/models, listing the single configured model.
+func (h *Handler) Models(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return
+	}
+	if _, ok := h.authenticate(r); !ok {
+		writeError(w, http.StatusUnauthorized, "invalid_request_error", "invalid API key")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"object": "list",
+		"data": []map[string]interface{}{{
+			"id":       h.config.Model,
+			"object":   "model",
+			"owned_by": "uip-gateway",
+		}},
+	})
+}
+
+// authenticate checks the bearer key and returns a stable, non-secret
+// identifier for it.
+func (h *Handler) authenticate(r *http.Request) (string, bool) {
+	key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || key == "" {
+		return "", false
+	}
+	for _, k := range h.config.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			sum := sha256.Sum256([]byte(key))
+			return hex.EncodeToString(sum[:6]), true
+		}
+	}
+	return "", false
+}
+
+// newEvent builds the CIE for a request: one session per API key, or per
+// key and user when the request names a user.
+func (h *Handler) newEvent(keyID string, req chatRequest, text string) *protocol.CanonicalInteractionEvent {
+	sessionID := "openai:" + keyID
+	userID := sessionID
+	if req.User != "" {
+		sessionID += ":" + req.User
+		userID = req.User
+	}
+	event := protocol.NewCanonicalInteractionEvent(
+		sessionID,
+		userID,
+		protocol.InputTypeText,
+		map[string]interface{}{"text": text},
+		protocol.SurfaceCapabilities{SupportsReply: true, SupportsMarkdown: true},
+		"openai-api",
+	)
+	event.Meta.AdapterName = AdapterName
+	if h.config.ForwardModel {
+		event.Meta.Model = req.Model
+	}
+	return event
+}
+
+// lastUserMessage returns the text of the last user message. Earlier turns
+// are ignored; the gateway keeps its own per-session history.
+func lastUserMessage(messages []chatMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return strings.TrimSpace(messages[i].text())
+		}
+	}
+	return ""
+}
+
+// writeError writes an OpenAI-shaped error, which OpenAI clients surface
+// better than the UIP error format.
+func writeError(w http.ResponseWriter, status int, errType, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    errType,
+		},
+	})
+}
@@ -0,0 +1,71 @@
+package protocol
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// AskSpec describes the answer an ask intent expects. While a session
+// awaits an answer, the gateway checks the user's next message against it
+// and prompts again instead of forwarding an answer that does not fit.
+type AskSpec struct {
+	// Prompt is the question, used when the intent has no text of its own.
+	Prompt string `json:"prompt,omitempty"`
+	// Choices lists the accepted answers, matched case-insensitively. They
+	// are offered as quick replies when the intent has none.
+	Choices []string `json:"choices,omitempty"`
+	// Pattern is a regular expression the whole answer must match. With
+	// Choices as well, an answer matching either is accepted.
+	Pattern string `json:"pattern,omitempty"`
+	// RetryPrompt is sent after an invalid answer. Empty means a generic
+	// notice followed by the question.
+	RetryPrompt string `json:"retryPrompt,omitempty"`
+	// MaxAttempts is how many invalid answers are re-prompted before the
+	// next one is forwarded as is (0 = no limit).
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+	// TimeoutSec is how long the answer is awaited; after that the next
+	// message is forwarded unchecked (0 = the gateway's ask timeout).
+	TimeoutSec int `json:"timeoutSec,omitempty"`
+}
+
+// Compile checks the spec and compiles its pattern, returning nil when
+// it has none. A spec without choices or a pattern accepts anything and
+// is rejected.
+func (s *AskSpec) Compile() (*regexp.Regexp, error) {
+	if len(s.Choices) == 0 && s.Pattern == "" {
+		return nil, fmt.Errorf("ask needs choices or a pattern")
+	}
+	if s.Pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile("^(?:" + s.Pattern + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid ask pattern: %w", err)
+	}
+	return re, nil
+}
+
+// Match checks answer against the spec, with re as returned by Compile.
+// A matching choice is returned in its listed spelling.
+func (s *AskSpec) Match(answer string, re *regexp.Regexp) (string, bool) {
+	answer = strings.TrimSpace(answer)
+	for _, c := range s.Choices {
+		if strings.EqualFold(answer, strings.TrimSpace(c)) {
+			return c, true
+		}
+	}
+	if re != nil && re.MatchString(answer) {
+		return answer, true
+	}
+	return "", false
+}
+
+// ChoiceReplies returns the choices as quick replies.
+func (s *AskSpec) ChoiceReplies() []QuickReply {
+	qrs := make([]QuickReply, len(s.Choices))
+	for i, c := range s.Choices {
+		qrs[i] = QuickReply{Label: c}
+	}
+	return NormalizeQuickReplies(qrs)
+}
@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"mime"
+	"path"
+	"strings"
+)
+
+// Attachment kinds.
+const (
+	AttachmentKindImage    = "image"
+	AttachmentKindAudio    = "audio"
+	AttachmentKindVideo    = "video"
+	AttachmentKindDocument = "document"
+)
+
+// kindByExtension covers media extensions missing from Go's built-in MIME
+// table, which knows images but few audio or video types.
+var kindByExtension = map[string]string{
+	".heic": AttachmentKindImage,
+	".heif": AttachmentKindImage,
+	".bmp":  AttachmentKindImage,
+	".tif":  AttachmentKindImage,
+	".tiff": AttachmentKindImage,
+	".mp3":  AttachmentKindAudio,
+	".m4a":  AttachmentKindAudio,
+	".aac":  AttachmentKindAudio,
+	".ogg":  AttachmentKindAudio,
+	".oga":  AttachmentKindAudio,
+	".opus": AttachmentKindAudio,
+	".wav":  AttachmentKindAudio,
+	".flac": AttachmentKindAudio,
+	".amr":  AttachmentKindAudio,
+	".mp4":  AttachmentKindVideo,
+	".m4v":  AttachmentKindVideo,
+	".mov":  AttachmentKindVideo,
+	".webm": AttachmentKindVideo,
+	".mkv":  AttachmentKindVideo,
+	".avi":  AttachmentKindVideo,
+	".3gp":  AttachmentKindVideo,
+}
+
+// InferAttachmentKind derives an attachment kind from its MIME type,
+// falling back to the file name's extension when the type is missing or
+// generic (application/octet-stream, as many IMs send for any upload).
+// Anything not recognisably image, audio or video is a document.
+func InferAttachmentKind(contentType, fileName string) string {
+	if kind, ok := kindOfMediaType(contentType); ok {
+		return kind
+	}
+	if !isGenericMediaType(contentType) {
+		return AttachmentKindDocument
+	}
+	ext := strings.ToLower(path.Ext(fileName))
+	if kind, ok := kindByExtension[ext]; ok {
+		return kind
+	}
+	if kind, ok := kindOfMediaType(mime.TypeByExtension(ext)); ok {
+		return kind
+	}
+	return AttachmentKindDocument
+}
+
+// kindOfMediaType reports the kind of an image/*, audio/* or video/* type.
+func kindOfMediaType(contentType string) (string, bool) {
+	major, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(contentType)), "/")
+	switch major {
+	case AttachmentKindImage, AttachmentKindAudio, AttachmentKindVideo:
+		return major, true
+	}
+	return "", false
+}
+
+// isGenericMediaType reports whether contentType says nothing about the
+// content, so the file name is the better hint.
+func isGenericMediaType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(contentType)), ";")
+	switch strings.TrimSpace(mediaType) {
+	case "", "application/octet-stream", "binary/octet-stream", "application/unknown":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package protocol
+
+import "testing"
+
+func TestInferAttachmentKind(t *testing.T) {
+	tests := []struct {
+		contentType, fileName, want string
+	}{
+		// The MIME type decides when it names a media kind
+		{"image/png", "", AttachmentKindImage},
+		{"IMAGE/JPEG", "x.pdf", AttachmentKindImage},
+		{"audio/ogg; codecs=opus", "", AttachmentKindAudio},
+		{" video/mp4 ", "", AttachmentKindVideo},
+		{"application/pdf", "", AttachmentKindDocument},
+		{"text/plain", "notes.txt", AttachmentKindDocument},
+		// A specific non-media type wins over the file name
+		{"application/pdf", "photo.jpg", AttachmentKindDocument},
+		// Missing or generic types fall back to the extension
+		{"", "photo.JPG", AttachmentKindImage},
+		{"", "scan.heic", AttachmentKindImage},
+		{"application/octet-stream", "voice.opus", AttachmentKindAudio},
+		{"Application/Octet-Stream; name=a.m4a", "a.m4a", AttachmentKindAudio},
+		{"binary/octet-stream", "clip.mov", AttachmentKindVideo},
+		{"application/unknown", "movie.mkv", AttachmentKindVideo},
+		{"application/octet-stream", "archive.tar.gz", AttachmentKindDocument},
+		{"application/octet-stream", "report.pdf", AttachmentKindDocument},
+		// Nothing to go on
+		{"", "", AttachmentKindDocument},
+		{"", "README", AttachmentKindDocument},
+		{"application/octet-stream", ".png.", AttachmentKindDocument},
+	}
+	for _, tt := range tests {
+		if got := InferAttachmentKind(tt.contentType, tt.fileName); got != tt.want {
+			t.Errorf("InferAttachmentKind(%q, %q) = %q, want %q", tt.contentType, tt.fileName, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package protocol
+
+import "fmt"
+
+// CapabilityOverride changes individual SurfaceCapabilities fields; a nil
+// field keeps the capability as it is.
+type CapabilityOverride struct {
+	SupportsReply        *bool `json:"supportsReply,omitempty" yaml:"supports_reply"`
+	SupportsEdit         *bool `json:"supportsEdit,omitempty" yaml:"supports_edit"`
+	SupportsReaction     *bool `json:"supportsReaction,omitempty" yaml:"supports_reaction"`
+	SupportsThread       *bool `json:"supportsThread,omitempty" yaml:"supports_thread"`
+	SupportsAttachment   *bool `json:"supportsAttachment,omitempty" yaml:"supports_attachment"`
+	SupportsMarkdown     *bool `json:"supportsMarkdown,omitempty" yaml:"supports_markdown"`
+	SupportsSources      *bool `json:"supportsSources,omitempty" yaml:"supports_sources"`
+	SupportsEphemeral    *bool `json:"supportsEphemeral,omitempty" yaml:"supports_ephemeral"`
+	SupportsLocation     *bool `json:"supportsLocation,omitempty" yaml:"supports_location"`
+	SupportsQuickReplies *bool `json:"supportsQuickReplies,omitempty" yaml:"supports_quick_replies"`
+}
+
+// Apply sets the capabilities the override specifies.
+func (o CapabilityOverride) Apply(caps *SurfaceCapabilities) {
+	set := func(dst *bool, v *bool) {
+		if v != nil {
+			*dst = *v
+		}
+	}
+	set(&caps.SupportsReply, o.SupportsReply)
+	set(&caps.SupportsEdit, o.SupportsEdit)
+	set(&caps.SupportsReaction, o.SupportsReaction)
+	set(&caps.SupportsThread, o.SupportsThread)
+	set(&caps.SupportsAttachment, o.SupportsAttachment)
+	set(&caps.SupportsMarkdown, o.SupportsMarkdown)
+	set(&caps.SupportsSources, o.SupportsSources)
+	set(&caps.SupportsEphemeral, o.SupportsEphemeral)
+	set(&caps.SupportsLocation, o.SupportsLocation)
+	set(&caps.SupportsQuickReplies, o.SupportsQuickReplies)
+}
+
+// ConversationCapabilities maps conversation types (the Conversation*
+// constants) to the capability overrides for conversations of that type.
+type ConversationCapabilities map[string]CapabilityOverride
+
+// Validate rejects unknown conversation types.
+func (c ConversationCapabilities) Validate() error {
+	for convType := range c {
+		switch convType {
+		case ConversationDirect, ConversationGroup, ConversationChannel, ConversationThread:
+		default:
+			return fmt.Errorf("unknown conversation type %q (want direct, group, channel or thread)", convType)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package protocol
+
+import "strings"
+
+// Conversation types, as carried in the "conversationType" payload field.
+const (
+	ConversationDirect  = "direct"
+	ConversationGroup   = "group"
+	ConversationChannel = "channel"
+	ConversationThread  = "thread"
+)
+
+// ConversationType returns the event's conversation type, always one of the
+// Conversation* constants.
+//
+// A recognised "conversationType" payload value set by the adapter wins.
+// Otherwise the type is inferred: a "threadId" means a thread, a
+// "channelId" means a channel, and anything else is a direct conversation.
+func ConversationType(e *CanonicalInteractionEvent) string {
+	switch ct := strings.ToLower(payloadString(e, "conversationType")); ct {
+	case ConversationDirect, ConversationGroup, ConversationChannel, ConversationThread:
+		return ct
+	}
+	if payloadString(e, "threadId") != "" {
+		return ConversationThread
+	}
+	if payloadString(e, "channelId") != "" {
+		return ConversationChannel
+	}
+	return ConversationDirect
+}
+
+// ThreadID returns the thread the event was posted in, from the "threadId"
+// payload field, or "".
+func ThreadID(e *CanonicalInteractionEvent) string {
+	return payloadString(e, "threadId")
+}
@@ -0,0 +1,7 @@
+package protocol
+
+// PayloadDedupKey is the payload field bridged events use for the source
+// platform's idempotency key, such as a Slack event_id or a Telegram
+// update_id, when it differs from the messageId. Redeliveries of an event
+// carry the same key.
+const PayloadDedupKey = "dedupKey"
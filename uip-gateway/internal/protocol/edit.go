@@ -0,0 +1,14 @@
+package protocol
+
+// PayloadEditedMessageID is the payload field edit events (EventMeta.IsEdit)
+// use for the IM-native ID of the message that was edited.
+const PayloadEditedMessageID = "editedMessageId"
+
+// EditedMessageID returns the IM-native ID of the message an edit event
+// changes, or "" for events that are not edits.
+func EditedMessageID(e *CanonicalInteractionEvent) string {
+	if !e.Meta.IsEdit {
+		return ""
+	}
+	return payloadString(e, PayloadEditedMessageID)
+}
@@ -0,0 +1,51 @@
+package protocol
+
+import "fmt"
+
+// GenerationParams tunes AI text generation. Nil fields are left to the
+// next level down: an event's params override the configured defaults,
+// which override the backend's own.
+type GenerationParams struct {
+	// Temperature is the sampling temperature, 0 to 2.
+	Temperature *float64 `json:"temperature,omitempty" yaml:"temperature"`
+	// MaxTokens caps the reply length in tokens.
+	MaxTokens *int `json:"maxTokens,omitempty" yaml:"max_tokens"`
+	// TopP is the nucleus sampling probability mass, 0 to 1.
+	TopP *float64 `json:"topP,omitempty" yaml:"top_p"`
+}
+
+// Validate checks that the set fields are in range.
+func (p GenerationParams) Validate() error {
+	if p.Temperature != nil && (*p.Temperature < 0 || *p.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2, got %v", *p.Temperature)
+	}
+	if p.MaxTokens != nil && *p.MaxTokens <= 0 {
+		return fmt.Errorf("max_tokens must be positive, got %d", *p.MaxTokens)
+	}
+	if p.TopP != nil && (*p.TopP < 0 || *p.TopP > 1) {
+		return fmt.Errorf("top_p must be between 0 and 1, got %v", *p.TopP)
+	}
+	return nil
+}
+
+// Override returns p with the fields set in o replacing its own.
+func (p GenerationParams) Override(o *GenerationParams) GenerationParams {
+	if o == nil {
+		return p
+	}
+	if o.Temperature != nil {
+		p.Temperature = o.Temperature
+	}
+	if o.MaxTokens != nil {
+		p.MaxTokens = o.MaxTokens
+	}
+	if o.TopP != nil {
+		p.TopP = o.TopP
+	}
+	return p
+}
+
+// IsZero reports whether no field is set.
+func (p GenerationParams) IsZero() bool {
+	return p.Temperature == nil && p.MaxTokens == nil && p.TopP == nil
+}
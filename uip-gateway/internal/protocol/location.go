@@ -0,0 +1,98 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PayloadLocation is the payload field adapters set for an inbound
+// location pin, holding a Location (or its JSON object form). Such events
+// use InputTypeLocation.
+const PayloadLocation = "location"
+
+// Location is a geographic point shared as a map pin.
+type Location struct {
+	// Latitude in decimal degrees, -90 to 90.
+	Latitude float64 `json:"latitude"`
+	// Longitude in decimal degrees, -180 to 180.
+	Longitude float64 `json:"longitude"`
+	// Name is the place name, if the platform provides one.
+	Name string `json:"name,omitempty"`
+	// Address is the street address, if the platform provides one.
+	Address string `json:"address,omitempty"`
+}
+
+// Validate rejects coordinates out of range.
+func (l *Location) Validate() error {
+	if l.Latitude < -90 || l.Latitude > 90 {
+		return fmt.Errorf("latitude %v out of range", l.Latitude)
+	}
+	if l.Longitude < -180 || l.Longitude > 180 {
+		return fmt.Errorf("longitude %v out of range", l.Longitude)
+	}
+	return nil
+}
+
+// MapURL links to the location on OpenStreetMap.
+func (l *Location) MapURL() string {
+	lat, lng := formatCoord(l.Latitude), formatCoord(l.Longitude)
+	return "https://www.openstreetmap.org/?mlat=" + lat + "&mlon=" + lng + "#map=16/" + lat + "/" + lng
+}
+
+// GeoURI is the RFC 5870 "geo:" URI for the location.
+func (l *Location) GeoURI() string {
+	return "geo:" + formatCoord(l.Latitude) + "," + formatCoord(l.Longitude)
+}
+
+// Label is the name and address, or the coordinates when both are empty.
+func (l *Location) Label() string {
+	var parts []string
+	for _, s := range []string{l.Name, l.Address} {
+		if s = strings.TrimSpace(s); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	if len(parts) == 0 {
+		return formatCoord(l.Latitude) + ", " + formatCoord(l.Longitude)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Text renders the location as plain text with a map link, for platforms
+// and runtimes without native location support.
+func (l *Location) Text() string {
+	return "📍 " + l.Label() + "\n" + l.MapURL()
+}
+
+func formatCoord(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// LocationOf returns the event's location pin, from the "location" payload
+// field. Malformed or out-of-range locations are ignored.
+func LocationOf(e *CanonicalInteractionEvent) (*Location, bool) {
+	if e.Input.Payload == nil {
+		return nil, false
+	}
+	var loc *Location
+	switch v := e.Input.Payload[PayloadLocation].(type) {
+	case *Location:
+		loc = v
+	case Location:
+		loc = &v
+	case map[string]interface{}:
+		lat, latOK := v["latitude"].(float64)
+		lng, lngOK := v["longitude"].(float64)
+		if !latOK || !lngOK {
+			return nil, false
+		}
+		loc = &Location{Latitude: lat, Longitude: lng}
+		loc.Name, _ = v["name"].(string)
+		loc.Address, _ = v["address"].(string)
+	}
+	if loc == nil || loc.Validate() != nil {
+		return nil, false
+	}
+	return loc, true
+}
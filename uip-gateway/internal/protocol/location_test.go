@@ -0,0 +1,51 @@
+package protocol
+
+import "testing"
+
+func TestLocationText(t *testing.T) {
+	tests := []struct {
+		loc  Location
+		want string
+	}{
+		{Location{Latitude: 52.52, Longitude: 13.405, Name: "Alexanderplatz", Address: " Berlin "},
+			"📍 Alexanderplatz, Berlin\nhttps://www.openstreetmap.org/?mlat=52.52&mlon=13.405#map=16/52.52/13.405"},
+		{Location{Latitude: -33.8568, Longitude: 151.2153},
+			"📍 -33.8568, 151.2153\nhttps://www.openstreetmap.org/?mlat=-33.8568&mlon=151.2153#map=16/-33.8568/151.2153"},
+	}
+	for _, tt := range tests {
+		if got := tt.loc.Text(); got != tt.want {
+			t.Errorf("Text() = %q, want %q", got, tt.want)
+		}
+	}
+	if got := (&Location{Latitude: 0, Longitude: -0.5}).GeoURI(); got != "geo:0,-0.5" {
+		t.Errorf("GeoURI() = %q, want geo:0,-0.5", got)
+	}
+}
+
+func TestLocationOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload interface{}
+		want    *Location
+	}{
+		{"struct pointer", &Location{Latitude: 1, Longitude: 2}, &Location{Latitude: 1, Longitude: 2}},
+		{"struct value", Location{Latitude: 1, Longitude: 2, Name: "x"}, &Location{Latitude: 1, Longitude: 2, Name: "x"}},
+		{"JSON object", map[string]interface{}{"latitude": 1.5, "longitude": -2.5, "address": "Main St"},
+			&Location{Latitude: 1.5, Longitude: -2.5, Address: "Main St"}},
+		{"missing longitude", map[string]interface{}{"latitude": 1.0}, nil},
+		{"string coordinates", map[string]interface{}{"latitude": "1", "longitude": "2"}, nil},
+		{"out of range", &Location{Latitude: 91, Longitude: 0}, nil},
+		{"wrong type", "52.52,13.405", nil},
+		{"absent", nil, nil},
+	}
+	for _, tt := range tests {
+		e := NewCanonicalInteractionEvent("s1", "u1", InputTypeLocation, map[string]interface{}{}, SurfaceCapabilities{}, "test")
+		if tt.payload != nil {
+			e.Input.Payload[PayloadLocation] = tt.payload
+		}
+		got, ok := LocationOf(e)
+		if ok != (tt.want != nil) || ok && *got != *tt.want {
+			t.Errorf("%s: LocationOf = %+v %v, want %+v", tt.name, got, ok, tt.want)
+		}
+	}
+}
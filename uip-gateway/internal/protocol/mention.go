@@ -0,0 +1,69 @@
+package protocol
+
+import "regexp"
+
+// Mention is a user @-mentioned in an outbound reply. Adapters render it as
+// a native mention (Slack "<@U123>", a Telegram user link, ...).
+type Mention struct {
+	// UserID is the IM-native user identifier.
+	UserID string `json:"userId"`
+	// Name is the display name, for platforms that mention by name.
+	Name string `json:"name,omitempty"`
+}
+
+// Payload fields adapters set for inbound mentions.
+const (
+	// PayloadMentions lists the IM-native user IDs the message mentions.
+	PayloadMentions = "mentions"
+	// PayloadMentionsBot is true when the message mentions the bot itself.
+	PayloadMentionsBot = "mentionsBot"
+)
+
+// Mentions returns the user IDs the event mentions, from the "mentions"
+// payload field.
+func Mentions(e *CanonicalInteractionEvent) []string {
+	if e.Input.Payload == nil {
+		return nil
+	}
+	switch v := e.Input.Payload[PayloadMentions].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		// Events decoded from JSON
+		ids := make([]string, 0, len(v))
+		for _, id := range v {
+			if s, ok := id.(string); ok && s != "" {
+				ids = append(ids, s)
+			}
+		}
+		return ids
+	}
+	return nil
+}
+
+// MentionsBot reports whether the event mentions the bot.
+func MentionsBot(e *CanonicalInteractionEvent) bool {
+	if e.Input.Payload == nil {
+		return false
+	}
+	b, _ := e.Input.Payload[PayloadMentionsBot].(bool)
+	return b
+}
+
+// mentionToken matches "<@U123>" and "<@!123>" style mention tokens, as
+// used by Slack, Discord and Mattermost-style bridges.
+var mentionToken = regexp.MustCompile(`<@!?([A-Za-z0-9._-]+)(?:\|[^>]*)?>`)
+
+// ParseMentions returns the user IDs of the "<@id>" mention tokens in text,
+// in order and without duplicates.
+func ParseMentions(text string) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, m := range mentionToken.FindAllStringSubmatch(text, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			ids = append(ids, m[1])
+		}
+	}
+	return ids
+}
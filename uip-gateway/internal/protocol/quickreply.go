@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PayloadQuickReply is the payload field adapters set when a user taps a
+// quick-reply button, holding the button's value. Such events use
+// InputTypeQuickReply and carry the value as their text too.
+const PayloadQuickReply = "quickReply"
+
+// QuickReply is a suggested answer offered with a reply, shown as a button
+// where the platform has them.
+type QuickReply struct {
+	// Label is the button text.
+	Label string `json:"label"`
+	// Value is sent back when the button is tapped. Empty means Label.
+	Value string `json:"value,omitempty"`
+}
+
+// ReplyValue is the value a tap sends back.
+func (q QuickReply) ReplyValue() string {
+	if q.Value != "" {
+		return q.Value
+	}
+	return q.Label
+}
+
+// NormalizeQuickReplies trims labels and values and drops entries without
+// a label.
+func NormalizeQuickReplies(qrs []QuickReply) []QuickReply {
+	var out []QuickReply
+	for _, q := range qrs {
+		q.Label, q.Value = strings.TrimSpace(q.Label), strings.TrimSpace(q.Value)
+		if q.Label != "" {
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+// QuickRepliesText renders quick replies as a numbered list, for platforms
+// without buttons.
+func QuickRepliesText(qrs []QuickReply) string {
+	lines := make([]string, len(qrs))
+	for i, q := range qrs {
+		lines[i] = strconv.Itoa(i+1) + ". " + q.Label
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ExtractQuickReplies lifts quick replies written by the convention
+// "[[Label]]" or "[[Label|value]]" out of the trailing lines of text, for
+// runtimes that can only answer with text. It returns the text without
+// those lines. Buttons elsewhere in the text are left alone.
+func ExtractQuickReplies(text string) (string, []QuickReply) {
+	lines := strings.Split(strings.TrimRight(text, " \t\n"), "\n")
+	end := len(lines)
+	var qrs []QuickReply
+	for end > 0 {
+		line := strings.TrimSpace(lines[end-1])
+		found, ok := parseButtonLine(line)
+		if !ok {
+			break
+		}
+		qrs = append(found, qrs...)
+		end--
+	}
+	if len(qrs) == 0 {
+		return text, nil
+	}
+	return strings.TrimRight(strings.Join(lines[:end], "\n"), " \t\n"), NormalizeQuickReplies(qrs)
+}
+
+// parseButtonLine parses a line made only of "[[...]]" buttons.
+func parseButtonLine(line string) ([]QuickReply, bool) {
+	var qrs []QuickReply
+	for line != "" {
+		if !strings.HasPrefix(line, "[[") {
+			return nil, false
+		}
+		inner, rest, ok := strings.Cut(line[2:], "]]")
+		if !ok || strings.TrimSpace(inner) == "" {
+			return nil, false
+		}
+		label, value, _ := strings.Cut(inner, "|")
+		qrs = append(qrs, QuickReply{Label: label, Value: value})
+		line = strings.TrimSpace(rest)
+	}
+	return qrs, len(qrs) > 0
+}
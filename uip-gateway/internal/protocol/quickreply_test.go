@@ -0,0 +1,45 @@
+package protocol
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestExtractQuickReplies(t *testing.T) {
+	tests := []struct {
+		name, in, text string
+		want           []QuickReply
+	}{
+		{"no buttons", "Pick a day", "Pick a day", nil},
+		{"label and value", "Ship it?\n[[Yes|yes]] [[No|no]]", "Ship it?",
+			[]QuickReply{{"Yes", "yes"}, {"No", "no"}}},
+		{"label only", "Size?\n[[Small]]\n[[Large]]\n", "Size?",
+			[]QuickReply{{"Small", ""}, {"Large", ""}}},
+		{"trimmed", "Ok?\n  [[ Sure | y ]]  [[Nope]]  ", "Ok?",
+			[]QuickReply{{"Sure", "y"}, {"Nope", ""}}},
+		{"value with a pipe", "Pick\n[[A|x|y]]", "Pick", []QuickReply{{"A", "x|y"}}},
+		{"buttons only", "[[Retry]]", "", []QuickReply{{"Retry", ""}}},
+		{"mid-text buttons stay", "Say [[Yes]] or no\nthanks", "Say [[Yes]] or no\nthanks", nil},
+		{"only trailing lines count", "[[A]]\nmore text\n[[B]]", "[[A]]\nmore text", []QuickReply{{"B", ""}}},
+		{"text after a button", "Pick\n[[A]] or else", "Pick\n[[A]] or else", nil},
+		{"unclosed", "Pick\n[[A", "Pick\n[[A", nil},
+		{"empty button", "Pick\n[[ ]]", "Pick\n[[ ]]", nil},
+		{"empty label dropped", "Pick\n[[|v]] [[B]]", "Pick", []QuickReply{{"B", ""}}},
+	}
+	for _, tt := range tests {
+		text, qrs := ExtractQuickReplies(tt.in)
+		if text != tt.text || fmt.Sprint(qrs) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: ExtractQuickReplies(%q) = %q %v, want %q %v", tt.name, tt.in, text, qrs, tt.text, tt.want)
+		}
+	}
+}
+
+func TestQuickRepliesText(t *testing.T) {
+	qrs := []QuickReply{{Label: "Yes", Value: "y"}, {Label: "No"}}
+	if got := QuickRepliesText(qrs); got != "1. Yes\n2. No" {
+		t.Errorf("QuickRepliesText = %q", got)
+	}
+	if qrs[0].ReplyValue() != "y" || qrs[1].ReplyValue() != "No" {
+		t.Errorf("ReplyValue = %q, %q, want y and No", qrs[0].ReplyValue(), qrs[1].ReplyValue())
+	}
+}
@@ -0,0 +1,50 @@
+package protocol
+
+// PayloadReaction is the payload field adapters set when a user adds or
+// removes a reaction, holding a Reaction (or its JSON object form). Such
+// events use InputTypeReaction and carry no text. Only adapters for
+// platforms with reactions (SupportsReaction) emit them.
+const PayloadReaction = "reaction"
+
+// Reaction is an emoji reaction to an earlier message.
+type Reaction struct {
+	// Emoji is the reaction, as the platform reports it: a Unicode emoji
+	// ("👍") or a platform shortcode ("thumbsup").
+	Emoji string `json:"emoji"`
+	// MessageID is the IM-native ID of the message reacted to.
+	MessageID string `json:"messageId"`
+	// Removed marks a reaction taken back rather than added.
+	Removed bool `json:"removed,omitempty"`
+}
+
+// Text describes the reaction, for runtimes that only read text.
+func (r *Reaction) Text() string {
+	if r.Removed {
+		return "(removed reaction " + r.Emoji + ")"
+	}
+	return "(reacted " + r.Emoji + ")"
+}
+
+// ReactionOf returns the event's reaction, from the "reaction" payload
+// field. Reactions without an emoji or a target message are ignored.
+func ReactionOf(e *CanonicalInteractionEvent) (*Reaction, bool) {
+	if e.Input.Type != InputTypeReaction || e.Input.Payload == nil {
+		return nil, false
+	}
+	var r *Reaction
+	switch v := e.Input.Payload[PayloadReaction].(type) {
+	case *Reaction:
+		r = v
+	case Reaction:
+		r = &v
+	case map[string]interface{}:
+		r = &Reaction{}
+		r.Emoji, _ = v["emoji"].(string)
+		r.MessageID, _ = v["messageId"].(string)
+		r.Removed, _ = v["removed"].(bool)
+	}
+	if r == nil || r.Emoji == "" || r.MessageID == "" {
+		return nil, false
+	}
+	return r, true
+}
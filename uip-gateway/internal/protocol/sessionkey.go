@@ -0,0 +1,80 @@
+package protocol
+
+import "fmt"
+
+// SessionKeyFunc derives the conversation-context key for an event.
+// Events with the same key share one AI conversation context.
+type SessionKeyFunc func(event *CanonicalInteractionEvent) string
+
+// SessionKeyStrategy names a built-in SessionKeyFunc preset.
+type SessionKeyStrategy string
+
+const (
+	// SessionKeySession keys by ExternalSessionID as sent by the adapter (the default).
+	SessionKeySession SessionKeyStrategy = "per-session"
+	// SessionKeyUser gives each user one context across all channels.
+	SessionKeyUser SessionKeyStrategy = "per-user"
+	// SessionKeyChannel gives each channel one context shared by all its members.
+	SessionKeyChannel SessionKeyStrategy = "per-channel"
+	// SessionKeyUserChannel gives each user a separate context in each channel.
+	SessionKeyUserChannel SessionKeyStrategy = "per-user-per-channel"
+	// SessionKeyThread gives each thread its own context, falling back to the channel.
+	SessionKeyThread SessionKeyStrategy = "per-thread"
+)
+
+// SessionKeyFuncFor returns the preset for a strategy name.
+// An empty name selects SessionKeySession.
+func SessionKeyFuncFor(strategy SessionKeyStrategy) (SessionKeyFunc, error) {
+	switch strategy {
+	case "", SessionKeySession:
+		return func(e *CanonicalInteractionEvent) string {
+			return e.Session.ExternalSessionID
+		}, nil
+	case SessionKeyUser:
+		return func(e *CanonicalInteractionEvent) string {
+			return "user:" + e.Session.UserID
+		}, nil
+	case SessionKeyChannel:
+		return func(e *CanonicalInteractionEvent) string {
+			return "channel:" + channelOf(e)
+		}, nil
+	case SessionKeyUserChannel:
+		return func(e *CanonicalInteractionEvent) string {
+			return "channel:" + channelOf(e) + ":user:" + e.Session.UserID
+		}, nil
+	case SessionKeyThread:
+		return func(e *CanonicalInteractionEvent) string {
+			key := "channel:" + channelOf(e)
+			if thread := payloadString(e, "threadId"); thread != "" {
+				key += ":thread:" + thread
+			}
+			return key
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown session key strategy: %q", strategy)
+	}
+}
+
+// RoutingKey returns the derived session key, or ExternalSessionID if none was derived.
+func (s Session) RoutingKey() string {
+	if s.Key != "" {
+		return s.Key
+	}
+	return s.ExternalSessionID
+}
+
+// channelOf returns the event's channel ID, falling back to the external session ID.
+func channelOf(e *CanonicalInteractionEvent) string {
+	if channel := payloadString(e, "channelId"); channel != "" {
+		return channel
+	}
+	return e.Session.ExternalSessionID
+}
+
+func payloadString(e *CanonicalInteractionEvent, field string) string {
+	if e.Input.Payload == nil {
+		return ""
+	}
+	s, _ := e.Input.Payload[field].(string)
+	return s
+}
@@ -0,0 +1,35 @@
+package protocol
+
+import "encoding/json"
+
+// StructuredOutput asks the AI for JSON instead of prose. The fields are
+// passed through unchanged to the OpenAI-compatible Chat Completions API
+// as response_format, tools and tool_choice; see its documentation for the
+// schemas.
+type StructuredOutput struct {
+	// ResponseFormat, e.g. {"type": "json_object"} or
+	// {"type": "json_schema", "json_schema": {...}}.
+	ResponseFormat json.RawMessage `json:"responseFormat,omitempty"`
+	// Tools is a list of function tools:
+	// [{"type": "function", "function": {"name": ..., "parameters": {...}}}].
+	Tools json.RawMessage `json:"tools,omitempty"`
+	// ToolChoice, e.g. "auto", "required" or {"type": "function", ...}.
+	ToolChoice json.RawMessage `json:"toolChoice,omitempty"`
+}
+
+// IsZero reports whether no field is set.
+func (s *StructuredOutput) IsZero() bool {
+	return s == nil || len(s.ResponseFormat) == 0 && len(s.Tools) == 0 && len(s.ToolChoice) == 0
+}
+
+// Intent metadata keys for structured replies.
+const (
+	// MetaStructured holds the decoded JSON reply to a ResponseFormat request.
+	MetaStructured = "structured"
+	// MetaToolCalls lists the tool calls the AI made, as
+	// {"id", "name", "arguments"} objects with decoded arguments.
+	MetaToolCalls = "toolCalls"
+	// MetaStructuredError explains why a structured reply was delivered as
+	// plain text instead.
+	MetaStructuredError = "structuredError"
+)
@@ -15,6 +15,12 @@ const (
 	InputTypeText    InputType = "text"
 	InputTypeEvent   InputType = "event"
 	InputTypeCommand InputType = "command"
+	// InputTypeLocation is a shared map pin; see PayloadLocation.
+	InputTypeLocation InputType = "location"
+	// InputTypeQuickReply is a tapped quick-reply button; see PayloadQuickReply.
+	InputTypeQuickReply InputType = "quick_reply"
+	// InputTypeReaction is an emoji reaction to a message; see PayloadReaction.
+	InputTypeReaction InputType = "reaction"
 )
 
 // ParticipantType represents the type of participant in an interaction.
@@ -39,12 +45,43 @@ const (
 type Session struct {
 	// ExternalSessionID is the stable session identifier from the IM platform.
 	ExternalSessionID string `json:"externalSessionId"`
+	// Key is the conversation-context key derived by the gateway's session key strategy.
+	Key string `json:"key,omitempty"`
 	// UserID is the IM-native user identifier.
 	UserID string `json:"userId"`
+	// UserName is the user's display name, if the IM platform provides one.
+	UserName string `json:"userName,omitempty"`
+	// Roles are the user's IM-native roles or groups (e.g. "admin", "moderator").
+	Roles []string `json:"roles,omitempty"`
+	// IsAdmin indicates the user administers the workspace/channel on the IM platform.
+	IsAdmin bool `json:"isAdmin,omitempty"`
 	// ParticipantType indicates if this is a human or system participant.
 	ParticipantType ParticipantType `json:"participantType"`
 }
 
+// HasRole reports whether the session's user has the given role.
+func (s Session) HasRole(role string) bool {
+	for _, r := range s.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// DisplayName returns UserName, falling back to UserID.
+func (s Session) DisplayName() string {
+	if s.UserName != "" {
+		return s.UserName
+	}
+	return s.UserID
+}
+
+// IsBot reports whether the sender is a bot (a system participant).
+func (s Session) IsBot() bool {
+	return s.ParticipantType == ParticipantTypeSystem
+}
+
 // Input represents the input payload in a Canonical Interaction Event.
 type Input struct {
 	// Type is the input type (text, event, command).
@@ -72,6 +109,17 @@ type SurfaceCapabilities struct {
 	SupportsAttachment bool `json:"supportsAttachment"`
 	// SupportsMarkdown indicates if the platform supports markdown formatting.
 	SupportsMarkdown bool `json:"supportsMarkdown"`
+	// SupportsSources indicates if the platform renders IntentContent.Sources.
+	SupportsSources bool `json:"supportsSources"`
+	// SupportsEphemeral indicates if the platform can show a reply to the
+	// invoking user only (e.g. Slack chat.postEphemeral).
+	SupportsEphemeral bool `json:"supportsEphemeral"`
+	// SupportsLocation indicates if the platform renders IntentContent.Location
+	// as a native map pin.
+	SupportsLocation bool `json:"supportsLocation"`
+	// SupportsQuickReplies indicates if the platform renders
+	// IntentContent.QuickReplies as buttons and reports taps.
+	SupportsQuickReplies bool `json:"supportsQuickReplies"`
 }
 
 // EventMeta contains metadata about an interaction event.
@@ -84,6 +132,23 @@ type EventMeta struct {
 	Source string `json:"source"`
 	// AdapterName is the name of the IM adapter that received this event.
 	AdapterName string `json:"adapterName,omitempty"`
+	// Locale is the user's locale hint (e.g. "en", "zh-CN") for system messages.
+	Locale string `json:"locale,omitempty"`
+	// Model optionally names the AI model to use instead of the configured default.
+	Model string `json:"model,omitempty"`
+	// Generation optionally overrides the configured generation parameters.
+	Generation *GenerationParams `json:"generation,omitempty"`
+	// Structured optionally asks for a JSON or tool-call reply instead of prose.
+	Structured *StructuredOutput `json:"structured,omitempty"`
+	// IsEdit marks an event for a message the user edited; adapters put the
+	// edited message's IM-native ID in the PayloadEditedMessageID field.
+	IsEdit bool `json:"isEdit,omitempty"`
+	// EditOf is the interaction ID of the edited message's original event,
+	// filled in by the gateway when it still knows it.
+	EditOf string `json:"editOf,omitempty"`
+	// RawText is the message text as received, set by the gateway when
+	// preprocessing changed the payload's "text" field.
+	RawText string `json:"rawText,omitempty"`
 }
 
 // CanonicalInteractionEvent (CIE) is the standard format for all inbound interactions.
@@ -137,6 +202,27 @@ type IntentContent struct {
 	Markdown string `json:"markdown,omitempty"`
 	// Attachments contains file attachments (if supported).
 	Attachments []Attachment `json:"attachments,omitempty"`
+	// Native holds platform-specific payload built by an adapter formatter (e.g. Slack "blocks").
+	Native map[string]interface{} `json:"native,omitempty"`
+	// Sources lists references the AI cited, lifted out of the text.
+	Sources []Source `json:"sources,omitempty"`
+	// Mentions lists users the reply @-mentions.
+	Mentions []Mention `json:"mentions,omitempty"`
+	// Location is a map pin to share. The gateway turns it into a map link
+	// in Text for platforms without SupportsLocation.
+	Location *Location `json:"location,omitempty"`
+	// QuickReplies are suggested answers shown as buttons. The gateway
+	// turns them into a numbered list in Text for platforms without
+	// SupportsQuickReplies.
+	QuickReplies []QuickReply `json:"quickReplies,omitempty"`
+}
+
+// Source is a reference cited in an AI reply.
+type Source struct {
+	// Title is the display name (may be empty).
+	Title string `json:"title,omitempty"`
+	// URL is the link to the source.
+	URL string `json:"url"`
 }
 
 // Attachment represents a file attachment in an intent.
@@ -149,6 +235,8 @@ type Attachment struct {
 	Data string `json:"data,omitempty"`
 	// Name is the filename.
 	Name string `json:"name,omitempty"`
+	// Size is the size in bytes, when known.
+	Size int64 `json:"size,omitempty"`
 }
 
 // IntentConstraints defines constraints on how the intent should be executed.
@@ -157,12 +245,26 @@ type IntentConstraints struct {
 	RequiresAck bool `json:"requiresAck"`
 	// Confidence is the confidence score of the intent (0.0 - 1.0).
 	Confidence float64 `json:"confidence"`
-	// Priority indicates the intent priority (higher = more urgent).
+	// Priority indicates the intent priority (higher = more urgent); see
+	// PriorityNormal and PriorityHigh.
 	Priority int `json:"priority,omitempty"`
 	// ExpiresAt is the Unix timestamp when this intent expires.
 	ExpiresAt int64 `json:"expiresAt,omitempty"`
 }
 
+// Intent priorities. Replies are PriorityNormal; intents at or above
+// PriorityHigh (alerts, urgent notifications) are sent ahead of queued
+// normal ones by adapters that queue outbound messages.
+const (
+	PriorityNormal = 0
+	PriorityHigh   = 10
+)
+
+// IsHighPriority reports whether the intent should jump ahead of normal ones.
+func (c IntentConstraints) IsHighPriority() bool {
+	return c.Priority >= PriorityHigh
+}
+
 // InteractionIntent is the response from Clawdbot runtime.
 // The UIP Gateway translates these into IM-native actions.
 type InteractionIntent struct {
@@ -178,6 +280,23 @@ type InteractionIntent struct {
 	TargetSessionID string `json:"targetSessionId"`
 	// InReplyTo is the interaction ID this is responding to.
 	InReplyTo string `json:"inReplyTo,omitempty"`
+	// Ephemeral asks for the reply to be shown to the invoking user only.
+	// The gateway clears it for platforms without SupportsEphemeral, which
+	// then post it publicly.
+	Ephemeral bool `json:"ephemeral,omitempty"`
+	// Replaces is the intent ID of an earlier reply this one updates in
+	// place (a reply to an edited message). The gateway clears it for
+	// platforms without SupportsEdit, which then post it as a new reply.
+	Replaces string `json:"replaces,omitempty"`
+	// ThreadID is the thread to post into, defaulting to the inbound
+	// event's thread. The gateway clears it for platforms without
+	// SupportsThread, which then reply in the channel root.
+	ThreadID string `json:"threadId,omitempty"`
+	// Ask, on an ask intent, describes the expected answer; the gateway
+	// re-prompts until the user's reply fits it.
+	Ask *AskSpec `json:"ask,omitempty"`
+	// Metadata carries runtime details such as the model's finishReason.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
 
 // NewInteractionIntent creates a new interaction intent.
@@ -214,13 +333,18 @@ type UIPError struct {
 	TraceID string `json:"traceId,omitempty"`
 }
 
-// Error codes
+// Error codes. Over HTTP each maps to a status (see httperr.Status).
 const (
-	ErrCodeProtocolError = "PROTOCOL_ERROR"
-	ErrCodeGatewayError  = "GATEWAY_ERROR"
-	ErrCodeRuntimeError  = "RUNTIME_ERROR"
-	ErrCodeTimeout       = "TIMEOUT"
-	ErrCodeNotFound      = "NOT_FOUND"
+	ErrCodeProtocolError    = "PROTOCOL_ERROR"     // 400
+	ErrCodeGatewayError     = "GATEWAY_ERROR"      // 502
+	ErrCodeRuntimeError     = "RUNTIME_ERROR"      // 500
+	ErrCodeTimeout          = "TIMEOUT"            // 504
+	ErrCodeNotFound         = "NOT_FOUND"          // 404
+	ErrCodePayloadTooLarge  = "PAYLOAD_TOO_LARGE"  // 413
+	ErrCodeUnauthorized     = "UNAUTHORIZED"       // 401
+	ErrCodeForbidden        = "FORBIDDEN"          // 403
+	ErrCodeMethodNotAllowed = "METHOD_NOT_ALLOWED" // 405
+	ErrCodeUnavailable      = "UNAVAILABLE"        // 503
 )
 
 // NewUIPError creates a new UIP error.
@@ -0,0 +1,141 @@
+// Package security provides request verification helpers shared by adapters
+// and webhook endpoints.
+//
+// ReplayGuard complements HMAC signature verification: a signature proves a
+// request is authentic, but a captured request stays authentic forever. The
+// guard rejects requests whose timestamp falls outside a tolerance window and
+// requests whose nonce was already seen within that window.
+package security
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+)
+
+// Defaults for ReplayConfig.
+const (
+	DefaultReplayWindow    = 5 * time.Minute
+	DefaultReplayCacheSize = 100000
+)
+
+var (
+	// ErrStaleRequest is returned when the request timestamp is outside the window.
+	ErrStaleRequest = errors.New("request timestamp outside replay window")
+	// ErrReplayedRequest is returned when the nonce was already seen.
+	ErrReplayedRequest = errors.New("request nonce already used")
+	// ErrMissingNonce is returned when the request carries no nonce.
+	ErrMissingNonce = errors.New("request nonce missing")
+)
+
+// ReplayConfig holds replay protection settings.
+type ReplayConfig struct {
+	// Window is the maximum accepted clock skew; nonces are remembered this long.
+	Window time.Duration
+	// CacheSize bounds the number of remembered nonces. When full, the oldest
+	// nonce is forgotten early, so size it above peak requests per Window.
+	CacheSize int
+	// Clock checks timestamps and expires nonces (clock.System if nil).
+	Clock clock.Clock
+}
+
+// ReplayGuard tracks recently seen nonces. It is safe for concurrent use.
+type ReplayGuard struct {
+	window    time.Duration
+	cacheSize int
+	clock     clock.Clock
+
+	mu    sync.Mutex
+	seen  map[string]*list.Element
+	order *list.List // insertion order, oldest first
+}
+
+type nonceEntry struct {
+	nonce     string
+	expiresAt time.Time
+}
+
+// NewReplayGuard creates a guard, applying defaults for zero values.
+func NewReplayGuard(config ReplayConfig) *ReplayGuard {
+	if config.Window <= 0 {
+		config.Window = DefaultReplayWindow
+	}
+	if config.CacheSize <= 0 {
+		config.CacheSize = DefaultReplayCacheSize
+	}
+	return &ReplayGuard{
+		window:    config.Window,
+		cacheSize: config.CacheSize,
+		clock:     clock.Or(config.Clock),
+		seen:      make(map[string]*list.Element),
+		order:     list.New(),
+	}
+}
+
+// Check verifies the timestamp is within the window and records the nonce,
+// failing if it was already recorded. Call it only after the request's
+// signature has been verified, so forged requests cannot fill the cache.
+func (g *ReplayGuard) Check(nonce string, timestamp time.Time) error {
+	if nonce == "" {
+		return ErrMissingNonce
+	}
+
+	now := g.clock.Now()
+	skew := now.Sub(timestamp)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > g.window {
+		return fmt.Errorf("%w (%s)", ErrStaleRequest, skew.Round(time.Second))
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.expireLocked(now)
+	if _, exists := g.seen[nonce]; exists {
+		return ErrReplayedRequest
+	}
+
+	for g.order.Len() >= g.cacheSize {
+		g.removeLocked(g.order.Front())
+	}
+	// Remember the nonce for as long as its timestamp stays acceptable
+	last := now
+	if timestamp.After(now) {
+		last = timestamp
+	}
+	g.seen[nonce] = g.order.PushBack(&nonceEntry{
+		nonce:     nonce,
+		expiresAt: last.Add(g.window),
+	})
+	return nil
+}
+
+// Len returns the number of remembered nonces.
+func (g *ReplayGuard) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.order.Len()
+}
+
+// expireLocked drops nonces whose window has passed, stopping at the first
+// live one. Entries are appended in arrival order; a future-dated entry can
+// only delay the expiry of those behind it, never shorten it.
+func (g *ReplayGuard) expireLocked(now time.Time) {
+	for e := g.order.Front(); e != nil; e = g.order.Front() {
+		if e.Value.(*nonceEntry).expiresAt.After(now) {
+			return
+		}
+		g.removeLocked(e)
+	}
+}
+
+func (g *ReplayGuard) removeLocked(e *list.Element) {
+	delete(g.seen, e.Value.(*nonceEntry).nonce)
+	g.order.Remove(e)
+}
@@ -0,0 +1,147 @@
+package transport
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// Codec serializes transport payloads: *Message, []*Message and
+// *PollResponse, and their pointer forms for Unmarshal. Implementations may
+// reject other types.
+type Codec interface {
+	// Name identifies the codec in the X-Transport-Codec header and, with
+	// SubprotocolPrefix, the WebSocket subprotocol.
+	Name() string
+	// ContentType is the media type of polling request and response bodies.
+	ContentType() string
+	// Binary reports whether WebSocket frames are binary rather than text.
+	Binary() bool
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// HeaderTransportCodec names the codec a client wants, as an alternative to
+// a WebSocket subprotocol or a polling Content-Type/Accept header.
+const HeaderTransportCodec = "X-Transport-Codec"
+
+// SubprotocolPrefix prefixes codec names in WebSocket subprotocols
+// ("uip.json", "uip.msgpack", "uip.protobuf").
+const SubprotocolPrefix = "uip."
+
+// JSONCodec is the default codec, used whenever a client negotiates nothing.
+var JSONCodec Codec = jsonCodec{}
+
+// DefaultCodecs are offered when a server is given none: JSON, msgpack and
+// protobuf.
+var DefaultCodecs = []Codec{JSONCodec, MsgpackCodec, ProtobufCodec}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                               { return "json" }
+func (jsonCodec) ContentType() string                        { return "application/json" }
+func (jsonCodec) Binary() bool                               { return false }
+func (jsonCodec) Marshal(v interface{}) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// codecSet is the codecs a server accepts. JSON is always accepted, so
+// existing clients keep working whatever is configured.
+type codecSet []Codec
+
+func newCodecSet(codecs []Codec) codecSet {
+	if len(codecs) == 0 {
+		codecs = DefaultCodecs
+	}
+	set := codecSet{JSONCodec}
+	for _, c := range codecs {
+		if c != nil && set.byName(c.Name()) == nil {
+			set = append(set, c)
+		}
+	}
+	return set
+}
+
+// byName returns the codec called name, or nil.
+func (s codecSet) byName(name string) Codec {
+	for _, c := range s {
+		if strings.EqualFold(c.Name(), name) {
+			return c
+		}
+	}
+	return nil
+}
+
+// byContentType returns the codec for a Content-Type or Accept value, or nil.
+func (s codecSet) byContentType(value string) Codec {
+	for _, part := range strings.Split(value, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		for _, c := range s {
+			if c.ContentType() == mediaType {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// subprotocols lists the WebSocket subprotocols for the set, preferring
+// non-JSON codecs so clients offering several get the compact one.
+func (s codecSet) subprotocols() []string {
+	protocols := make([]string, 0, len(s))
+	for _, c := range s[1:] {
+		protocols = append(protocols, SubprotocolPrefix+c.Name())
+	}
+	return append(protocols, SubprotocolPrefix+JSONCodec.Name())
+}
+
+// forUpgrade picks the codec for a WebSocket connection from the negotiated
+// subprotocol, falling back to the X-Transport-Codec header and then JSON.
+func (s codecSet) forUpgrade(r *http.Request, conn *websocket.Conn) Codec {
+	if name, ok := strings.CutPrefix(conn.Subprotocol(), SubprotocolPrefix); ok {
+		if c := s.byName(name); c != nil {
+			return c
+		}
+	}
+	if c := s.byName(r.Header.Get(HeaderTransportCodec)); c != nil {
+		return c
+	}
+	return JSONCodec
+}
+
+// forRequest picks the codec for a polling request body from its
+// Content-Type, falling back to the X-Transport-Codec header and then JSON.
+func (s codecSet) forRequest(r *http.Request) Codec {
+	if c := s.byContentType(r.Header.Get("Content-Type")); c != nil {
+		return c
+	}
+	if c := s.byName(r.Header.Get(HeaderTransportCodec)); c != nil {
+		return c
+	}
+	return JSONCodec
+}
+
+// forResponse picks the codec for a poll response from the X-Transport-Codec
+// header, falling back to the Accept header and then JSON.
+func (s codecSet) forResponse(r *http.Request) Codec {
+	if c := s.byName(r.Header.Get(HeaderTransportCodec)); c != nil {
+		return c
+	}
+	if c := s.byContentType(r.Header.Get("Accept")); c != nil {
+		return c
+	}
+	return JSONCodec
+}
+
+// frameType is the WebSocket message type for frames encoded with c.
+func frameType(c Codec) int {
+	if c.Binary() {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
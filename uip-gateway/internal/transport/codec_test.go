@@ -0,0 +1,357 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math/rand"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// binaryCodecs are the non-JSON codecs, each checked against JSON.
+var binaryCodecs = []Codec{MsgpackCodec, ProtobufCodec}
+
+func sampleMessage() *Message {
+	return &Message{
+		ID:        "msg-1",
+		Timestamp: 1700000000123,
+		Sender:    Sender{ID: "u1", Name: "Alice", Username: "alice", IsBot: true},
+		Conversation: Conversation{
+			Type:     "group",
+			ID:       "g1",
+			Name:     "General",
+			ThreadID: "t1",
+		},
+		Text: "hello, 世界 " + strings.Repeat("x", 300),
+		Attachments: []Attachment{
+			{Kind: "image", URL: "https://example.com/a.png", ContentType: "image/png", FileName: "a.png", Size: 70000},
+			{Kind: "file"},
+		},
+		Meta: map[string]interface{}{
+			"source":  "slack",
+			"retries": 3,
+			"score":   -1.5,
+			"big":     int64(1) << 40,
+			"flag":    false,
+			"missing": nil,
+			"tags":    []interface{}{"a", "b", 7},
+			"nested":  map[string]interface{}{"deep": map[string]interface{}{"ok": true}},
+		},
+	}
+}
+
+// viaJSON is what a JSON client would decode v into.
+func viaJSON(t testing.TB, v, out interface{}) {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("json.Marshal: %v", err)
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		t.Fatalf("json.Unmarshal: %v", err)
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		out  func() interface{}
+	}{
+		{"message", sampleMessage(), func() interface{} { return &Message{} }},
+		{"minimal message", &Message{ID: "m", Sender: Sender{ID: "u"}, Conversation: Conversation{Type: "direct", ID: "u"}}, func() interface{} { return &Message{} }},
+		{"message list", []*Message{sampleMessage(), {ID: "m2"}}, func() interface{} { return &[]*Message{} }},
+		{"empty list", []*Message{}, func() interface{} { return &[]*Message{} }},
+		{"poll response", &PollResponse{Messages: []*Message{sampleMessage()}, NextSince: 1700000000999, HasMore: true}, func() interface{} { return &PollResponse{} }},
+		{"empty poll response", &PollResponse{Messages: []*Message{}}, func() interface{} { return &PollResponse{} }},
+	}
+	for _, c := range binaryCodecs {
+		for _, tt := range tests {
+			t.Run(c.Name()+"/"+tt.name, func(t *testing.T) {
+				data, err := c.Marshal(tt.in)
+				if err != nil {
+					t.Fatalf("Marshal: %v", err)
+				}
+				got := tt.out()
+				if err := c.Unmarshal(data, got); err != nil {
+					t.Fatalf("Unmarshal: %v", err)
+				}
+				want := tt.out()
+				viaJSON(t, tt.in, want)
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("round trip differs from JSON\n got: %+v\nwant: %+v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestCodecRejectsUnsupportedTypes(t *testing.T) {
+	for _, c := range binaryCodecs {
+		if _, err := c.Marshal(map[string]string{"a": "b"}); err == nil {
+			t.Errorf("%s: Marshal(map) succeeded", c.Name())
+		}
+		if _, err := c.Marshal(&Message{Meta: map[string]interface{}{"ch": make(chan int)}}); err == nil {
+			t.Errorf("%s: Marshal with a channel in meta succeeded", c.Name())
+		}
+		if err := c.Unmarshal([]byte{0}, &struct{}{}); err == nil {
+			t.Errorf("%s: Unmarshal into struct{} succeeded", c.Name())
+		}
+	}
+}
+
+// TestCodecTruncatedInput checks that no prefix of an encoding decodes to
+// the whole value. msgpack values are self-delimiting, so every prefix must
+// fail; a protobuf prefix ending between fields is a valid, shorter message.
+func TestCodecTruncatedInput(t *testing.T) {
+	full := &PollResponse{Messages: []*Message{sampleMessage()}, NextSince: 42, HasMore: true}
+	for _, c := range binaryCodecs {
+		data, err := c.Marshal(full)
+		if err != nil {
+			t.Fatalf("%s: Marshal: %v", c.Name(), err)
+		}
+		var want PollResponse
+		if err := c.Unmarshal(data, &want); err != nil {
+			t.Fatalf("%s: Unmarshal: %v", c.Name(), err)
+		}
+		for n := 0; n < len(data); n++ {
+			var r PollResponse
+			err := c.Unmarshal(data[:n], &r)
+			if err == nil && (c == MsgpackCodec || reflect.DeepEqual(r, want)) {
+				t.Fatalf("%s: Unmarshal of %d/%d bytes succeeded", c.Name(), n, len(data))
+			}
+		}
+	}
+}
+
+func TestCodecCorruptedInput(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, c := range binaryCodecs {
+		data, err := c.Marshal(sampleMessage())
+		if err != nil {
+			t.Fatalf("%s: Marshal: %v", c.Name(), err)
+		}
+		for i := 0; i < 5000; i++ {
+			corrupt := append([]byte(nil), data...)
+			for j := rng.Intn(4) + 1; j > 0; j-- {
+				corrupt[rng.Intn(len(corrupt))] = byte(rng.Intn(256))
+			}
+			decodeAny(t, c, corrupt)
+		}
+	}
+}
+
+// decodeAny decodes data as each transport type; errors are fine, panics
+// are not, and whatever decodes must encode again.
+func decodeAny(t *testing.T, c Codec, data []byte) {
+	t.Helper()
+	var m Message
+	if c.Unmarshal(data, &m) == nil {
+		if _, err := c.Marshal(&m); err != nil {
+			t.Fatalf("%s: re-Marshal of decoded message: %v", c.Name(), err)
+		}
+	}
+	var msgs []*Message
+	c.Unmarshal(data, &msgs)
+	var r PollResponse
+	c.Unmarshal(data, &r)
+}
+
+func TestMsgpackDepthLimit(t *testing.T) {
+	// meta: 40 nested single-element arrays
+	data := []byte{0x81, 0xa4, 'm', 'e', 't', 'a', 0x81, 0xa1, 'k'}
+	for i := 0; i < 40; i++ {
+		data = append(data, 0x91)
+	}
+	data = append(data, 0xc0)
+	var m Message
+	if err := MsgpackCodec.Unmarshal(data, &m); err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+		t.Errorf("Unmarshal = %v, want nesting error", err)
+	}
+}
+
+func TestMsgpackHugeLengthRejected(t *testing.T) {
+	// array32 claiming 2^32-1 messages in a 5-byte input
+	var msgs []*Message
+	if err := MsgpackCodec.Unmarshal([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, &msgs); err == nil {
+		t.Error("Unmarshal succeeded, want truncation error")
+	}
+}
+
+// pbField encodes a length-delimited protobuf field.
+func pbField(field int, b []byte) []byte {
+	out := binary.AppendUvarint(nil, uint64(field)<<3|pbBytes)
+	out = binary.AppendUvarint(out, uint64(len(b)))
+	return append(out, b...)
+}
+
+func TestProtobufDepthLimit(t *testing.T) {
+	// meta {"k": 40 nested single-element lists}
+	v := []byte{0x08, 0x00}
+	for i := 0; i < 40; i++ {
+		v = pbField(6, pbField(1, v))
+	}
+	entry := append(pbField(1, []byte("k")), pbField(2, v)...)
+	data := pbField(7, pbField(1, entry))
+	var m Message
+	if err := ProtobufCodec.Unmarshal(data, &m); err == nil || !strings.Contains(err.Error(), "nested too deeply") {
+		t.Errorf("Unmarshal = %v, want nesting error", err)
+	}
+}
+
+func TestProtobufHugeLengthRejected(t *testing.T) {
+	// text field claiming 2^40 bytes
+	data := binary.AppendUvarint([]byte{5<<3 | pbBytes}, 1<<40)
+	var m Message
+	if err := ProtobufCodec.Unmarshal(data, &m); err == nil {
+		t.Error("Unmarshal succeeded, want truncation error")
+	}
+}
+
+func TestProtobufSkipsUnknownFields(t *testing.T) {
+	data, err := ProtobufCodec.Marshal(&Message{ID: "m1", Text: "hi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// field 13 varint, field 14 fixed32, field 15 bytes
+	data = append(data, 13<<3|pbVarint, 0x96, 0x01, 14<<3|pbFixed32, 1, 2, 3, 4)
+	data = append(data, pbField(15, []byte("future"))...)
+	var m Message
+	if err := ProtobufCodec.Unmarshal(data, &m); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if m.ID != "m1" || m.Text != "hi" {
+		t.Errorf("decoded %+v", m)
+	}
+}
+
+func FuzzProtobufUnmarshal(f *testing.F) {
+	for _, v := range []interface{}{sampleMessage(), []*Message{sampleMessage(), nil}, &PollResponse{HasMore: true}} {
+		data, err := ProtobufCodec.Marshal(v)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decodeAny(t, ProtobufCodec, data)
+	})
+}
+
+func FuzzMsgpackUnmarshal(f *testing.F) {
+	for _, v := range []interface{}{sampleMessage(), []*Message{sampleMessage(), nil}, &PollResponse{HasMore: true}} {
+		data, err := MsgpackCodec.Marshal(v)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decodeAny(t, MsgpackCodec, data)
+	})
+}
+
+func TestCodecNegotiation(t *testing.T) {
+	set := newCodecSet(nil)
+	tests := []struct {
+		name    string
+		headers map[string]string
+		request string
+		respond string
+	}{
+		{"none", nil, "json", "json"},
+		{"content type", map[string]string{"Content-Type": "application/msgpack"}, "msgpack", "json"},
+		{"accept", map[string]string{"Accept": "text/html, application/msgpack"}, "json", "msgpack"},
+		{"header", map[string]string{HeaderTransportCodec: "MsgPack"}, "msgpack", "msgpack"},
+		{"protobuf", map[string]string{"Content-Type": "application/x-protobuf", "Accept": "application/x-protobuf"}, "protobuf", "protobuf"},
+		{"unknown header", map[string]string{HeaderTransportCodec: "xml"}, "json", "json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got := set.forRequest(r).Name(); got != tt.request {
+				t.Errorf("forRequest = %s, want %s", got, tt.request)
+			}
+			if got := set.forResponse(r).Name(); got != tt.respond {
+				t.Errorf("forResponse = %s, want %s", got, tt.respond)
+			}
+		})
+	}
+}
+
+func TestPollingServerCodecs(t *testing.T) {
+	for _, c := range binaryCodecs {
+		t.Run(c.Name(), func(t *testing.T) {
+			ps := NewPollingServer(zap.NewNop())
+			var got *Message
+			ps.SetHandler(func(msg *Message) error {
+				got = msg
+				return nil
+			})
+
+			body, err := c.Marshal(sampleMessage())
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := httptest.NewRequest("POST", "/inbound", bytes.NewReader(body))
+			r.Header.Set("Content-Type", c.ContentType())
+			w := httptest.NewRecorder()
+			ps.InboundHandler().ServeHTTP(w, r)
+			if w.Code != 200 || got == nil || got.ID != "msg-1" {
+				t.Fatalf("inbound: status %d, message %+v", w.Code, got)
+			}
+
+			ps.Send(&Message{ID: "out-1", Text: "reply"})
+			r = httptest.NewRequest("GET", "/poll?since=0", nil)
+			r.Header.Set("Accept", c.ContentType())
+			w = httptest.NewRecorder()
+			ps.HTTPHandler().ServeHTTP(w, r)
+			if ct := w.Header().Get("Content-Type"); ct != c.ContentType() {
+				t.Fatalf("poll Content-Type = %q, want %q", ct, c.ContentType())
+			}
+			var resp PollResponse
+			if err := c.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode poll response: %v", err)
+			}
+			if len(resp.Messages) != 1 || resp.Messages[0].Text != "reply" {
+				t.Errorf("poll response = %+v", resp)
+			}
+		})
+	}
+}
+
+func BenchmarkCodecs(b *testing.B) {
+	msg := sampleMessage()
+	for _, c := range append([]Codec{JSONCodec}, binaryCodecs...) {
+		data, err := c.Marshal(msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(c.Name()+"/marshal", func(b *testing.B) {
+			b.ReportAllocs()
+			b.ReportMetric(float64(len(data)), "bytes/msg")
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Marshal(msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(c.Name()+"/unmarshal", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var m Message
+				if err := c.Unmarshal(data, &m); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// markdownReply is a typical 3.5KB assistant reply: prose, lists, a table
+// and code.
+const markdownReply = `## Deploying the gateway behind a reverse proxy
+
+Running the gateway behind **nginx** or **Caddy** works well, but a few
+settings matter more than they first appear. The proxy has to forward the
+WebSocket upgrade headers, keep idle connections open for longer than the
+gateway's ping interval, and pass the original client address so that rate
+limiting and audit logs see the real user rather than the proxy.
+
+### Checklist
+
+1. Forward ` + "`Upgrade`" + ` and ` + "`Connection`" + ` on the ` + "`/ws`" + ` location.
+2. Raise ` + "`proxy_read_timeout`" + ` above 60 seconds; the default closes quiet sockets.
+3. Set ` + "`X-Forwarded-For`" + ` and list the proxy under ` + "`trusted_proxies`" + `.
+4. Terminate TLS at the proxy *or* at the gateway, never both with mismatched certificates.
+5. Disable response buffering for the polling endpoint, otherwise long polls stall.
+
+| Setting             | nginx                     | Caddy                 |
+|---------------------|---------------------------|-----------------------|
+| Upgrade headers     | manual ` + "`proxy_set_header`" + `  | automatic             |
+| Idle timeout        | ` + "`proxy_read_timeout 300s`" + `| ` + "`transport http`" + ` block |
+| Client address      | ` + "`real_ip_header`" + `          | ` + "`trusted_proxies`" + `     |
+| Buffering           | ` + "`proxy_buffering off`" + `     | ` + "`flush_interval -1`" + `   |
+
+A minimal nginx location block looks like this:
+
+` + "```nginx" + `
+location /ws {
+    proxy_pass http://127.0.0.1:8080;
+    proxy_http_version 1.1;
+    proxy_set_header Upgrade $http_upgrade;
+    proxy_set_header Connection "upgrade";
+    proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+    proxy_read_timeout 300s;
+}
+` + "```" + `
+
+> **Note:** if clients connect through a corporate proxy that strips
+> extensions, permessage-deflate silently falls back to uncompressed frames.
+> Nothing breaks, but bandwidth estimates based on compressed sizes will be
+> wrong, so measure on the real path before sizing links.
+
+### Troubleshooting
+
+- *Connections drop every minute:* the proxy idle timeout is shorter than the
+  ping interval. Either raise the timeout or lower ` + "`ping_interval`" + `.
+- *HTTP 400 on upgrade:* the ` + "`Connection`" + ` header was rewritten to ` + "`close`" + `;
+  check for a global ` + "`proxy_set_header Connection \"\"`" + ` inherited from the
+  server block.
+- *Every request appears to come from 127.0.0.1:* the forwarded header is set
+  but the proxy address is missing from the trusted list, so the gateway
+  ignores it on purpose.
+- *Replies arrive in bursts:* buffering is still on somewhere between the
+  gateway and the client. Look for a CDN or load balancer in front of the proxy.
+
+If the problem persists, enable debug logging with ` + "`log.level: debug`" + ` and
+compare the upgrade request the gateway receives with the one the client sent;
+differences in headers usually point straight at the misconfigured hop. For
+multi-region setups, also confirm that sticky sessions are enabled, since the
+polling transport keeps per-connection cursors in memory and a client bounced
+between instances would otherwise replay or skip messages.
+
+### Health checks
+
+Point the load balancer at ` + "`/healthz`" + ` rather than at the WebSocket path.
+The health endpoint answers in microseconds and never upgrades, whereas probing
+` + "`/ws`" + ` opens a connection per check, inflates the connection gauge and can
+trip per-IP limits meant for real clients. A check every ten seconds with two
+failures before removal is usually enough; shorter intervals mostly add noise
+during deploys, when a draining instance briefly reports unhealthy by design.
+
+Let me know which proxy you are using and I can tailor the configuration.
+`
+
+// countingConn counts the bytes read from the wire.
+type countingConn struct {
+	net.Conn
+	n *atomic.Int64
+}
+
+func (c countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// BenchmarkWebSocketCompression sends each payload server to client with
+// permessage-deflate off and on, reporting wire bytes per message and the
+// compression ratio alongside allocations.
+func BenchmarkWebSocketCompression(b *testing.B) {
+	// gorilla/websocket v1.5.1 logs a spurious close error for every
+	// compressed message it reads
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	payloads := []struct {
+		name string
+		data string
+	}{
+		{"markdown", markdownReply},
+		{"repetitive", strings.Repeat("| ok | 200 | 1ms |\n", len(markdownReply)/19)},
+	}
+	for _, p := range payloads {
+		var plain float64
+		for _, compress := range []bool{false, true} {
+			name := p.name + "/off"
+			if compress {
+				name = p.name + "/on"
+			}
+			b.Run(name, func(b *testing.B) {
+				wire := benchmarkWebSocketSend(b, []byte(p.data), compress)
+				b.ReportMetric(wire, "wire-B/msg")
+				if !compress {
+					plain = wire
+				} else if plain > 0 {
+					b.ReportMetric(plain/wire, "ratio")
+				}
+			})
+		}
+	}
+}
+
+func benchmarkWebSocketSend(b *testing.B, data []byte, compress bool) float64 {
+	b.Helper()
+	upgrader := WebSocketConfig{EnableCompression: compress}.Upgrader()
+	start := make(chan int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for n := range start {
+			for i := 0; i < n; i++ {
+				if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+					return
+				}
+			}
+		}
+	}))
+	defer srv.Close()
+	defer close(start)
+
+	var read atomic.Int64
+	dialer := websocket.Dialer{
+		EnableCompression: compress,
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return countingConn{Conn: conn, n: &read}, nil
+		},
+	}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		b.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	read.Store(0)
+	b.ResetTimer()
+	start <- b.N
+	for i := 0; i < b.N; i++ {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			b.Fatalf("read: %v", err)
+		}
+	}
+	b.StopTimer()
+	return float64(read.Load()) / float64(b.N)
+}
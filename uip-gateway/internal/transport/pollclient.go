@@ -0,0 +1,294 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/backoff"
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+)
+
+// Polling client defaults, see PollingClientConfig.
+const (
+	DefaultPollInterval = 5 * time.Second
+	DefaultPollClientID = "uip-gateway"
+)
+
+// maxPollBackoff caps the delay between polls after consecutive failures.
+const maxPollBackoff = time.Minute
+
+// PollingClientConfig configures a PollingClient.
+type PollingClientConfig struct {
+	// URL is polled with GET ?since=<ms>, and sent messages are POSTed to it.
+	URL string
+	// Interval is the delay between polls that returned no further pages.
+	Interval time.Duration
+	// AuthToken, when set, is presented as "Authorization: Bearer <token>".
+	AuthToken string
+	// ClientID identifies the gateway to the server (X-Client-ID), so a
+	// server that tracks cursors can resume after a restart.
+	ClientID string
+	// Clock stamps received messages and evaluates Retry-After dates
+	// (clock.System if nil).
+	Clock clock.Clock
+}
+
+// PollingClient is a Transport for deployments where OpenClaw serves
+// messages for polling, the counterpart of PollingServer. It GETs URL
+// every Interval, advancing a since cursor from the response's nextSince,
+// and fetches further pages at once while hasMore is set.
+type PollingClient struct {
+	logger     log.Logger
+	config     PollingClientConfig
+	httpClient *http.Client
+	handler    MessageHandler
+	since      atomic.Int64
+
+	// Message queue for outgoing messages
+	outQueue chan *Message
+
+	// Shutdown
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// PollResponse is the body returned by a poll, as written by PollingServer.
+type PollResponse struct {
+	Messages  []*Message `json:"messages"`
+	NextSince int64      `json:"nextSince"`
+	HasMore   bool       `json:"hasMore"`
+}
+
+// NewPollingClient creates a new polling client transport.
+func NewPollingClient(config PollingClientConfig, logger log.Logger) *PollingClient {
+	if logger == nil {
+		logger = log.Default()
+	}
+	if config.Interval <= 0 {
+		config.Interval = DefaultPollInterval
+	}
+	if config.ClientID == "" {
+		config.ClientID = DefaultPollClientID
+	}
+	config.Clock = clock.Or(config.Clock)
+	return &PollingClient{
+		logger:     logger,
+		config:     config,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		outQueue:   make(chan *Message, 100),
+		done:       make(chan struct{}),
+	}
+}
+
+// Start begins polling in the background.
+func (c *PollingClient) Start(ctx context.Context) error {
+	if c.config.URL == "" {
+		return fmt.Errorf("polling client: url is required")
+	}
+	if _, err := url.Parse(c.config.URL); err != nil {
+		return fmt.Errorf("polling client: %w", err)
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	go c.run(runCtx)
+	c.logger.Info("Polling client started",
+		zap.String("url", c.config.URL),
+		zap.Duration("interval", c.config.Interval))
+	return nil
+}
+
+// Stop stops polling. Queued messages that were not sent are dropped.
+func (c *PollingClient) Stop(ctx context.Context) error {
+	if c.cancel == nil {
+		return nil
+	}
+	c.cancel()
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.logger.Info("Polling client stopped")
+	return nil
+}
+
+// Send queues a message to be POSTed to the server before the next poll.
+func (c *PollingClient) Send(msg *Message) error {
+	select {
+	case c.outQueue <- msg:
+		return nil
+	default:
+		return fmt.Errorf("message queue full")
+	}
+}
+
+// SetHandler sets the handler for incoming messages. Call it before Start.
+func (c *PollingClient) SetHandler(handler MessageHandler) {
+	c.handler = handler
+}
+
+// Since returns the poll cursor: the timestamp of the newest message
+// received, or 0 before the first one.
+func (c *PollingClient) Since() int64 {
+	return c.since.Load()
+}
+
+func (c *PollingClient) run(ctx context.Context) {
+	defer close(c.done)
+
+	attempt := 0
+	for ctx.Err() == nil {
+		c.flush(ctx)
+
+		hasMore, err := c.poll(ctx)
+		delay := c.config.Interval
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return
+			}
+			attempt++
+			var retryAfter time.Duration
+			if perr, ok := err.(*pollError); ok {
+				retryAfter = perr.retryAfter
+			}
+			if d := backoff.Delay(attempt, retryAfter, maxPollBackoff); d > delay {
+				delay = d
+			}
+			c.logger.Warn("Poll failed",
+				zap.Int("attempt", attempt),
+				zap.Duration("retryIn", delay),
+				zap.Error(err))
+		case hasMore:
+			attempt = 0
+			continue
+		default:
+			attempt = 0
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pollError is a poll or send rejected by the server.
+type pollError struct {
+	status     int
+	retryAfter time.Duration
+}
+
+func (e *pollError) Error() string {
+	return fmt.Sprintf("polling server returned HTTP %d", e.status)
+}
+
+// poll fetches one page and hands its messages to the handler.
+func (c *PollingClient) poll(ctx context.Context) (hasMore bool, err error) {
+	u, _ := url.Parse(c.config.URL)
+	query := u.Query()
+	query.Set("clientId", c.config.ClientID)
+	// Without a cursor, let the server resume from the one it tracks for us
+	if since := c.since.Load(); since > 0 {
+		query.Set("since", strconv.FormatInt(since, 10))
+	}
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return false, err
+	}
+	var page PollResponse
+	if err := c.do(req, &page); err != nil {
+		return false, err
+	}
+
+	for _, msg := range page.Messages {
+		if msg == nil {
+			continue
+		}
+		normalizeInbound(msg, c.config.Clock.Now())
+		if c.handler != nil {
+			if err := c.handler(msg); err != nil {
+				c.logger.Error("Message handler error",
+					zap.String("messageId", msg.ID),
+					zap.Error(err))
+			}
+		}
+	}
+	if page.NextSince > c.since.Load() {
+		c.since.Store(page.NextSince)
+	}
+	return page.HasMore && len(page.Messages) > 0, nil
+}
+
+// flush POSTs queued messages, stopping at the first failure; the failed
+// message is dropped, the rest stay queued.
+func (c *PollingClient) flush(ctx context.Context) {
+	for {
+		var msg *Message
+		select {
+		case msg = <-c.outQueue:
+		default:
+			return
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			c.logger.Error("Failed to marshal message", zap.Error(err))
+			continue
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.config.URL, bytes.NewReader(data))
+		if err != nil {
+			c.logger.Error("Failed to build send request", zap.Error(err))
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if err := c.do(req, nil); err != nil {
+			c.logger.Warn("Failed to send message",
+				zap.String("messageId", msg.ID),
+				zap.Error(err))
+			return
+		}
+	}
+}
+
+// do sends req with the client's credentials and decodes a JSON response
+// into out, if non-nil.
+func (c *PollingClient) do(req *http.Request, out interface{}) error {
+	req.Header.Set("X-Client-ID", c.config.ClientID)
+	if c.config.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.config.AuthToken)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return &pollError{
+			status:     resp.StatusCode,
+			retryAfter: backoff.ParseRetryAfter(resp.Header.Get("Retry-After"), c.config.Clock.Now()),
+		}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode poll response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,644 @@
+package transport
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// ProtobufCodec encodes transport payloads in the protobuf wire format of
+// the messages in transport.proto; a []*Message is a MessageList.
+//
+// Like MsgpackCodec it is hand-written for the transport types, so the
+// gateway needs no protobuf runtime. Meta is a google.protobuf.Struct, which
+// holds the same values as JSON: numbers decode as float64 and []byte values
+// are sent as base64 strings. Nil entries of a []*Message decode as empty
+// messages, and a decoded list is never nil.
+var ProtobufCodec Codec = protobufCodec{}
+
+// maxProtobufDepth bounds nesting of Meta values.
+const maxProtobufDepth = 32
+
+var errProtobufTruncated = errors.New("protobuf: unexpected end of data")
+
+// Wire types.
+const (
+	pbVarint  = 0
+	pbFixed64 = 1
+	pbBytes   = 2
+	pbFixed32 = 5
+)
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string        { return "protobuf" }
+func (protobufCodec) ContentType() string { return "application/x-protobuf" }
+func (protobufCodec) Binary() bool        { return true }
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+	e := &pbEncoder{buf: make([]byte, 0, 256)}
+	var err error
+	switch v := v.(type) {
+	case *Message:
+		if v != nil {
+			err = e.message(v)
+		}
+	case []*Message:
+		err = e.messages(1, v)
+	case *PollResponse:
+		err = e.pollResponse(v)
+	case PollResponse:
+		err = e.pollResponse(&v)
+	default:
+		return nil, fmt.Errorf("protobuf: unsupported type %T", v)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+	d := &pbDecoder{data: data}
+	switch v := v.(type) {
+	case *Message:
+		return d.message(v)
+	case *[]*Message:
+		msgs := []*Message{}
+		err := d.fields(func(field, wire int) (bool, error) {
+			if field != 1 {
+				return false, nil
+			}
+			m, err := d.embeddedMessage(wire)
+			msgs = append(msgs, m)
+			return true, err
+		})
+		if err != nil {
+			return err
+		}
+		*v = msgs
+		return nil
+	case *PollResponse:
+		return d.pollResponse(v)
+	default:
+		return fmt.Errorf("protobuf: unsupported type %T", v)
+	}
+}
+
+// pbEncoder appends protobuf to buf.
+type pbEncoder struct {
+	buf []byte
+}
+
+func (e *pbEncoder) varint(v uint64) { e.buf = binary.AppendUvarint(e.buf, v) }
+
+func (e *pbEncoder) tag(field, wire int) { e.varint(uint64(field)<<3 | uint64(wire)) }
+
+func (e *pbEncoder) str(field int, s string) {
+	e.tag(field, pbBytes)
+	e.varint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+// strField writes a string field unless it is empty, as proto3 does.
+func (e *pbEncoder) strField(field int, s string) {
+	if s != "" {
+		e.str(field, s)
+	}
+}
+
+func (e *pbEncoder) intField(field int, v int64) {
+	if v != 0 {
+		e.tag(field, pbVarint)
+		e.varint(uint64(v))
+	}
+}
+
+func (e *pbEncoder) boolField(field int, b bool) {
+	if b {
+		e.tag(field, pbVarint)
+		e.varint(1)
+	}
+}
+
+// embedded writes a length-delimited field whose content fn appends. The
+// length is only known afterwards, so the content is shifted to make room.
+func (e *pbEncoder) embedded(field int, fn func() error) error {
+	e.tag(field, pbBytes)
+	start := len(e.buf)
+	if err := fn(); err != nil {
+		return err
+	}
+	n := len(e.buf) - start
+	var prefix [binary.MaxVarintLen64]byte
+	l := binary.PutUvarint(prefix[:], uint64(n))
+	e.buf = append(e.buf, prefix[:l]...)
+	copy(e.buf[start+l:], e.buf[start:start+n])
+	copy(e.buf[start:], prefix[:l])
+	return nil
+}
+
+func (e *pbEncoder) message(m *Message) error {
+	e.strField(1, m.ID)
+	e.intField(2, m.Timestamp)
+	if m.Sender != (Sender{}) {
+		e.embedded(3, func() error {
+			e.strField(1, m.Sender.ID)
+			e.strField(2, m.Sender.Name)
+			e.strField(3, m.Sender.Username)
+			e.boolField(4, m.Sender.IsBot)
+			return nil
+		})
+	}
+	if m.Conversation != (Conversation{}) {
+		e.embedded(4, func() error {
+			e.strField(1, m.Conversation.Type)
+			e.strField(2, m.Conversation.ID)
+			e.strField(3, m.Conversation.Name)
+			e.strField(4, m.Conversation.ThreadID)
+			return nil
+		})
+	}
+	e.strField(5, m.Text)
+	for i := range m.Attachments {
+		a := &m.Attachments[i]
+		e.embedded(6, func() error {
+			e.strField(1, a.Kind)
+			e.strField(2, a.URL)
+			e.strField(3, a.ContentType)
+			e.strField(4, a.FileName)
+			e.intField(5, a.Size)
+			return nil
+		})
+	}
+	if len(m.Meta) > 0 {
+		return e.embedded(7, func() error { return e.structValue(m.Meta, 0) })
+	}
+	return nil
+}
+
+// messages writes msgs as a repeated field.
+func (e *pbEncoder) messages(field int, msgs []*Message) error {
+	for _, m := range msgs {
+		err := e.embedded(field, func() error {
+			if m == nil {
+				return nil
+			}
+			return e.message(m)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *pbEncoder) pollResponse(r *PollResponse) error {
+	if err := e.messages(1, r.Messages); err != nil {
+		return err
+	}
+	e.intField(2, r.NextSince)
+	e.boolField(3, r.HasMore)
+	return nil
+}
+
+// structValue writes the fields of a google.protobuf.Struct.
+func (e *pbEncoder) structValue(m map[string]interface{}, depth int) error {
+	for k, v := range m {
+		err := e.embedded(1, func() error {
+			e.strField(1, k)
+			return e.embedded(2, func() error { return e.value(v, depth+1) })
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value writes the fields of a google.protobuf.Value. Its kind is a oneof,
+// so zero values are written too.
+func (e *pbEncoder) value(v interface{}, depth int) error {
+	if depth > maxProtobufDepth {
+		return errors.New("protobuf: meta nested too deeply")
+	}
+	switch v := v.(type) {
+	case nil:
+		e.tag(1, pbVarint)
+		e.varint(0)
+	case bool:
+		e.tag(4, pbVarint)
+		if v {
+			e.varint(1)
+		} else {
+			e.varint(0)
+		}
+	case string:
+		e.str(3, v)
+	case []byte:
+		e.str(3, base64.StdEncoding.EncodeToString(v))
+	case float64:
+		e.number(v)
+	case float32:
+		e.number(float64(v))
+	case int:
+		e.number(float64(v))
+	case int8:
+		e.number(float64(v))
+	case int16:
+		e.number(float64(v))
+	case int32:
+		e.number(float64(v))
+	case int64:
+		e.number(float64(v))
+	case uint:
+		e.number(float64(v))
+	case uint8:
+		e.number(float64(v))
+	case uint16:
+		e.number(float64(v))
+	case uint32:
+		e.number(float64(v))
+	case uint64:
+		e.number(float64(v))
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return fmt.Errorf("protobuf: invalid number %q", v)
+		}
+		e.number(f)
+	case []string:
+		return e.embedded(6, func() error {
+			for _, s := range v {
+				e.embedded(1, func() error {
+					e.str(3, s)
+					return nil
+				})
+			}
+			return nil
+		})
+	case []interface{}:
+		return e.embedded(6, func() error {
+			for _, item := range v {
+				if err := e.embedded(1, func() error { return e.value(item, depth+1) }); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case map[string]string:
+		return e.embedded(5, func() error {
+			for k, s := range v {
+				e.embedded(1, func() error {
+					e.strField(1, k)
+					return e.embedded(2, func() error {
+						e.str(3, s)
+						return nil
+					})
+				})
+			}
+			return nil
+		})
+	case map[string]interface{}:
+		return e.embedded(5, func() error { return e.structValue(v, depth) })
+	default:
+		return fmt.Errorf("protobuf: unsupported meta value of type %T", v)
+	}
+	return nil
+}
+
+func (e *pbEncoder) number(f float64) {
+	e.tag(2, pbFixed64)
+	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(f))
+}
+
+// pbDecoder reads protobuf from data.
+type pbDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *pbDecoder) varint() (uint64, error) {
+	v, n := binary.Uvarint(d.data[d.pos:])
+	if n == 0 {
+		return 0, errProtobufTruncated
+	}
+	if n < 0 {
+		return 0, errors.New("protobuf: varint overflows 64 bits")
+	}
+	d.pos += n
+	return v, nil
+}
+
+func (d *pbDecoder) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errProtobufTruncated
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// fields reads tags until the end of data, calling set to decode the value
+// of each field; values of fields set does not know (it returns false) are
+// skipped.
+func (d *pbDecoder) fields(set func(field, wire int) (bool, error)) error {
+	for d.pos < len(d.data) {
+		tag, err := d.varint()
+		if err != nil {
+			return err
+		}
+		field, wire := tag>>3, int(tag&7)
+		if field == 0 || field > math.MaxInt32 {
+			return fmt.Errorf("protobuf: invalid field number %d", field)
+		}
+		known, err := set(int(field), wire)
+		if err == nil && !known {
+			err = d.skip(wire)
+		}
+		if err != nil {
+			return fmt.Errorf("protobuf: field %d: %w", field, err)
+		}
+	}
+	return nil
+}
+
+func (d *pbDecoder) skip(wire int) error {
+	var err error
+	switch wire {
+	case pbVarint:
+		_, err = d.varint()
+	case pbFixed64:
+		_, err = d.bytes(8)
+	case pbBytes:
+		_, err = d.lengthDelimited(pbBytes)
+	case pbFixed32:
+		_, err = d.bytes(4)
+	default:
+		err = fmt.Errorf("unsupported wire type %d", wire)
+	}
+	return err
+}
+
+func wireError(want, got int) error {
+	return fmt.Errorf("wire type %d, want %d", got, want)
+}
+
+func (d *pbDecoder) lengthDelimited(wire int) ([]byte, error) {
+	if wire != pbBytes {
+		return nil, wireError(pbBytes, wire)
+	}
+	n, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	return d.bytes(n)
+}
+
+// sub returns a decoder for a length-delimited field.
+func (d *pbDecoder) sub(wire int) (*pbDecoder, error) {
+	b, err := d.lengthDelimited(wire)
+	if err != nil {
+		return nil, err
+	}
+	return &pbDecoder{data: b}, nil
+}
+
+func (d *pbDecoder) str(wire int) (string, error) {
+	b, err := d.lengthDelimited(wire)
+	return string(b), err
+}
+
+func (d *pbDecoder) int(wire int) (int64, error) {
+	if wire != pbVarint {
+		return 0, wireError(pbVarint, wire)
+	}
+	v, err := d.varint()
+	return int64(v), err
+}
+
+func (d *pbDecoder) bool(wire int) (bool, error) {
+	v, err := d.int(wire)
+	return v != 0, err
+}
+
+func (d *pbDecoder) double(wire int) (float64, error) {
+	if wire != pbFixed64 {
+		return 0, wireError(pbFixed64, wire)
+	}
+	b, err := d.bytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+}
+
+func (d *pbDecoder) message(m *Message) error {
+	return d.fields(func(field, wire int) (bool, error) {
+		var err error
+		switch field {
+		case 1:
+			m.ID, err = d.str(wire)
+		case 2:
+			m.Timestamp, err = d.int(wire)
+		case 3:
+			err = d.embedded(wire, func(sub *pbDecoder) error { return sub.sender(&m.Sender) })
+		case 4:
+			err = d.embedded(wire, func(sub *pbDecoder) error { return sub.conversation(&m.Conversation) })
+		case 5:
+			m.Text, err = d.str(wire)
+		case 6:
+			var a Attachment
+			err = d.embedded(wire, func(sub *pbDecoder) error { return sub.attachment(&a) })
+			m.Attachments = append(m.Attachments, a)
+		case 7:
+			if m.Meta == nil {
+				m.Meta = make(map[string]interface{})
+			}
+			err = d.embedded(wire, func(sub *pbDecoder) error { return sub.structValue(m.Meta, 0) })
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+}
+
+// embedded decodes a length-delimited field with fn.
+func (d *pbDecoder) embedded(wire int, fn func(sub *pbDecoder) error) error {
+	sub, err := d.sub(wire)
+	if err != nil {
+		return err
+	}
+	return fn(sub)
+}
+
+func (d *pbDecoder) embeddedMessage(wire int) (*Message, error) {
+	m := &Message{}
+	return m, d.embedded(wire, func(sub *pbDecoder) error { return sub.message(m) })
+}
+
+func (d *pbDecoder) pollResponse(r *PollResponse) error {
+	if r.Messages == nil {
+		r.Messages = []*Message{}
+	}
+	return d.fields(func(field, wire int) (bool, error) {
+		var err error
+		switch field {
+		case 1:
+			var m *Message
+			m, err = d.embeddedMessage(wire)
+			r.Messages = append(r.Messages, m)
+		case 2:
+			r.NextSince, err = d.int(wire)
+		case 3:
+			r.HasMore, err = d.bool(wire)
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+}
+
+func (d *pbDecoder) sender(s *Sender) error {
+	return d.fields(func(field, wire int) (bool, error) {
+		var err error
+		switch field {
+		case 1:
+			s.ID, err = d.str(wire)
+		case 2:
+			s.Name, err = d.str(wire)
+		case 3:
+			s.Username, err = d.str(wire)
+		case 4:
+			s.IsBot, err = d.bool(wire)
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+}
+
+func (d *pbDecoder) conversation(c *Conversation) error {
+	return d.fields(func(field, wire int) (bool, error) {
+		var err error
+		switch field {
+		case 1:
+			c.Type, err = d.str(wire)
+		case 2:
+			c.ID, err = d.str(wire)
+		case 3:
+			c.Name, err = d.str(wire)
+		case 4:
+			c.ThreadID, err = d.str(wire)
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+}
+
+func (d *pbDecoder) attachment(a *Attachment) error {
+	return d.fields(func(field, wire int) (bool, error) {
+		var err error
+		switch field {
+		case 1:
+			a.Kind, err = d.str(wire)
+		case 2:
+			a.URL, err = d.str(wire)
+		case 3:
+			a.ContentType, err = d.str(wire)
+		case 4:
+			a.FileName, err = d.str(wire)
+		case 5:
+			a.Size, err = d.int(wire)
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+}
+
+// structValue reads the fields of a google.protobuf.Struct into m.
+func (d *pbDecoder) structValue(m map[string]interface{}, depth int) error {
+	if depth > maxProtobufDepth {
+		return errors.New("protobuf: value nested too deeply")
+	}
+	return d.fields(func(field, wire int) (bool, error) {
+		if field != 1 {
+			return false, nil
+		}
+		var key string
+		var value interface{}
+		err := d.embedded(wire, func(entry *pbDecoder) error {
+			return entry.fields(func(field, wire int) (bool, error) {
+				var err error
+				switch field {
+				case 1:
+					key, err = entry.str(wire)
+				case 2:
+					value, err = entry.embeddedValue(wire, depth+1)
+				default:
+					return false, nil
+				}
+				return true, err
+			})
+		})
+		m[key] = value
+		return true, err
+	})
+}
+
+func (d *pbDecoder) embeddedValue(wire int, depth int) (value interface{}, err error) {
+	err = d.embedded(wire, func(sub *pbDecoder) error {
+		value, err = sub.value(depth)
+		return err
+	})
+	return value, err
+}
+
+// value reads the fields of a google.protobuf.Value as the generic types
+// encoding/json produces.
+func (d *pbDecoder) value(depth int) (interface{}, error) {
+	if depth > maxProtobufDepth {
+		return nil, errors.New("protobuf: value nested too deeply")
+	}
+	var value interface{}
+	err := d.fields(func(field, wire int) (bool, error) {
+		var err error
+		switch field {
+		case 1:
+			_, err = d.int(wire)
+			value = nil
+		case 2:
+			value, err = d.double(wire)
+		case 3:
+			value, err = d.str(wire)
+		case 4:
+			value, err = d.bool(wire)
+		case 5:
+			m := make(map[string]interface{})
+			err = d.embedded(wire, func(sub *pbDecoder) error { return sub.structValue(m, depth) })
+			value = m
+		case 6:
+			items := []interface{}{}
+			err = d.embedded(wire, func(list *pbDecoder) error {
+				return list.fields(func(field, wire int) (bool, error) {
+					if field != 1 {
+						return false, nil
+					}
+					item, err := list.embeddedValue(wire, depth+1)
+					items = append(items, item)
+					return true, err
+				})
+			})
+			value = items
+		default:
+			return false, nil
+		}
+		return true, err
+	})
+	return value, err
+}
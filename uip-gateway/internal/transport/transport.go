@@ -2,19 +2,28 @@
 // between UIP Gateway and OpenClaw Universal IM.
 //
 // When OpenClaw is configured to use WebSocket or Polling transport, this package
-// provides the server-side implementations that OpenClaw connects to.
+// provides the server-side implementations that OpenClaw connects to, and
+// WebSocket and polling clients for deployments where OpenClaw runs the server.
 package transport
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+	"github.com/zlc_ai/uip-gateway/internal/httperr"
+	"github.com/zlc_ai/uip-gateway/internal/httplimit"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+	"github.com/zlc_ai/uip-gateway/internal/protocol"
 )
 
 // Message represents a message in the transport layer.
@@ -50,11 +59,34 @@ type Attachment struct {
 	URL         string `json:"url,omitempty"`
 	ContentType string `json:"contentType,omitempty"`
 	FileName    string `json:"fileName,omitempty"`
+	Size        int64  `json:"size,omitempty"`
 }
 
 // MessageHandler is called when a message is received through any transport.
 type MessageHandler func(msg *Message) error
 
+// HeaderTransportToken carries the shared transport secret, as an alternative
+// to "Authorization: Bearer <token>" and the "token" query parameter.
+const HeaderTransportToken = "X-Transport-Token"
+
+// authorized reports whether r presents token. An empty token disables the check.
+func authorized(r *http.Request, token string) bool {
+	if token == "" {
+		return true
+	}
+	got := r.Header.Get(HeaderTransportToken)
+	if got == "" {
+		if auth := r.Header.Get("Authorization"); len(auth) > 7 && auth[:7] == "Bearer " {
+			got = auth[7:]
+		}
+	}
+	if got == "" {
+		// WebSocket clients in browsers cannot set headers
+		got = r.URL.Query().Get("token")
+	}
+	return subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
 // Transport defines the interface for transport implementations.
 type Transport interface {
 	// Start starts the transport.
@@ -67,15 +99,71 @@ type Transport interface {
 	SetHandler(handler MessageHandler)
 }
 
+// DefaultWebSocketBufferSize is the read and write buffer size used when a
+// WebSocketConfig leaves them unset.
+const DefaultWebSocketBufferSize = 1024
+
+// WebSocketConfig tunes the WebSocket upgrader.
+//
+// Read and write buffers are allocated per connection for its lifetime, so
+// memory grows with (ReadBufferSize+WriteBufferSize) x connections. Messages
+// larger than WriteBufferSize are sent as several frames.
+//
+// EnableCompression negotiates permessage-deflate (RFC 7692) with clients
+// that offer it. In BenchmarkWebSocketCompression it halves the bytes on the
+// wire for a 3.5KB Markdown reply (about 70x for highly repetitive text), for
+// under 1KB of extra allocation but roughly 10x the CPU per message; flate
+// state is pooled, not held per connection. Disable it for CPU-bound
+// gateways on fast local links.
+//
+// CheckOrigin vets the Origin of browser clients; nil accepts all origins.
+//
+// Codecs are the message encodings a WebSocketServer offers (DefaultCodecs
+// when empty; JSON is always accepted); the Upgrader ignores them.
+type WebSocketConfig struct {
+	ReadBufferSize    int
+	WriteBufferSize   int
+	EnableCompression bool
+	CheckOrigin       func(r *http.Request) bool
+	Codecs            []Codec
+}
+
+// Upgrader returns a websocket.Upgrader configured from c.
+func (c WebSocketConfig) Upgrader() websocket.Upgrader {
+	readSize, writeSize := c.ReadBufferSize, c.WriteBufferSize
+	if readSize <= 0 {
+		readSize = DefaultWebSocketBufferSize
+	}
+	if writeSize <= 0 {
+		writeSize = DefaultWebSocketBufferSize
+	}
+	checkOrigin := c.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = func(r *http.Request) bool { return true }
+	}
+	return websocket.Upgrader{
+		CheckOrigin:       checkOrigin,
+		ReadBufferSize:    readSize,
+		WriteBufferSize:   writeSize,
+		EnableCompression: c.EnableCompression,
+	}
+}
+
 // WebSocketServer implements a WebSocket server for OpenClaw to connect to.
+//
+// Each connection negotiates its codec with a "uip.<codec>" subprotocol or
+// the X-Transport-Codec header on the upgrade request, defaulting to JSON.
+// Binary codecs use binary frames.
 type WebSocketServer struct {
-	logger   *zap.Logger
-	upgrader websocket.Upgrader
-	handler  MessageHandler
+	logger    log.Logger
+	upgrader  websocket.Upgrader
+	codecs    codecSet
+	handler   MessageHandler
+	authToken string // shared secret required to connect; empty allows all
 
 	// Active connections
 	connMu sync.RWMutex
-	conns  map[*websocket.Conn]bool
+	conns  map[*wsClient]struct{}
 
 	// Message queue for outgoing messages
 	outQueue chan *Message
@@ -85,18 +173,32 @@ type WebSocketServer struct {
 	wg     sync.WaitGroup
 }
 
+// wsClient is a connected client. gorilla/websocket allows one concurrent
+// writer per connection, so all writes go through sendCh and writeLoop.
+type wsClient struct {
+	conn   *websocket.Conn
+	codec  Codec
+	sendCh chan []byte
+	done   chan struct{} // closed when readLoop exits
+}
+
+// wsSendBuffer is the number of messages queued per client before new
+// broadcasts to it are dropped.
+const wsSendBuffer = 256
+
 // NewWebSocketServer creates a new WebSocket server.
-func NewWebSocketServer(logger *zap.Logger) *WebSocketServer {
+func NewWebSocketServer(config WebSocketConfig, logger log.Logger) *WebSocketServer {
+	if logger == nil {
+		logger = log.Default()
+	}
+	codecs := newCodecSet(config.Codecs)
+	upgrader := config.Upgrader()
+	upgrader.Subprotocols = codecs.subprotocols()
 	return &WebSocketServer{
-		logger: logger,
-		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all origins for now
-			},
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-		},
-		conns:    make(map[*websocket.Conn]bool),
+		logger:   logger,
+		upgrader: upgrader,
+		codecs:   codecs,
+		conns:    make(map[*wsClient]struct{}),
 		outQueue: make(chan *Message, 100),
 		stopCh:   make(chan struct{}),
 	}
@@ -116,8 +218,8 @@ func (ws *WebSocketServer) Stop(ctx context.Context) error {
 
 	// Close all connections
 	ws.connMu.Lock()
-	for conn := range ws.conns {
-		conn.Close()
+	for client := range ws.conns {
+		client.conn.Close()
 	}
 	ws.connMu.Unlock()
 
@@ -141,35 +243,65 @@ func (ws *WebSocketServer) SetHandler(handler MessageHandler) {
 	ws.handler = handler
 }
 
+// SetAuthToken requires clients to present token (X-Transport-Token header,
+// Bearer authorization or "token" query parameter) to connect.
+// Call it before serving requests.
+func (ws *WebSocketServer) SetAuthToken(token string) {
+	ws.authToken = token
+}
+
 // HTTPHandler returns an http.Handler for WebSocket upgrade.
 func (ws *WebSocketServer) HTTPHandler() http.Handler {
 	return http.HandlerFunc(ws.handleConnection)
 }
 
 func (ws *WebSocketServer) handleConnection(w http.ResponseWriter, r *http.Request) {
-	conn, err := ws.upgrader.Upgrade(w, r, nil)
+	if !authorized(r, ws.authToken) {
+		ws.logger.Warn("Rejected unauthenticated WebSocket client",
+			zap.String("remoteAddr", r.RemoteAddr))
+		httperr.WriteUIPError(w, protocol.ErrCodeUnauthorized, "unauthorized", "")
+		return
+	}
+
+	// Confirm a header-negotiated codec; subprotocols confirm themselves
+	var header http.Header
+	if c := ws.codecs.byName(r.Header.Get(HeaderTransportCodec)); c != nil {
+		header = http.Header{HeaderTransportCodec: {c.Name()}}
+	}
+	conn, err := ws.upgrader.Upgrade(w, r, header)
 	if err != nil {
 		ws.logger.Error("WebSocket upgrade failed", zap.Error(err))
 		return
 	}
 
+	client := &wsClient{
+		conn:   conn,
+		codec:  ws.codecs.forUpgrade(r, conn),
+		sendCh: make(chan []byte, wsSendBuffer),
+		done:   make(chan struct{}),
+	}
+
 	ws.connMu.Lock()
-	ws.conns[conn] = true
+	ws.conns[client] = struct{}{}
 	ws.connMu.Unlock()
 
 	ws.logger.Info("WebSocket client connected",
-		zap.String("remoteAddr", r.RemoteAddr))
+		zap.String("remoteAddr", r.RemoteAddr),
+		zap.String("codec", client.codec.Name()))
 
-	ws.wg.Add(1)
-	go ws.readLoop(conn)
+	ws.wg.Add(2)
+	go ws.readLoop(client)
+	go ws.writeLoop(client)
 }
 
-func (ws *WebSocketServer) readLoop(conn *websocket.Conn) {
+func (ws *WebSocketServer) readLoop(client *wsClient) {
+	conn := client.conn
 	defer ws.wg.Done()
 	defer func() {
 		ws.connMu.Lock()
-		delete(ws.conns, conn)
+		delete(ws.conns, client)
 		ws.connMu.Unlock()
+		close(client.done)
 		conn.Close()
 		ws.logger.Info("WebSocket client disconnected")
 	}()
@@ -191,7 +323,7 @@ func (ws *WebSocketServer) readLoop(conn *websocket.Conn) {
 
 		// Parse message
 		var msg Message
-		if err := json.Unmarshal(data, &msg); err != nil {
+		if err := client.codec.Unmarshal(data, &msg); err != nil {
 			ws.logger.Warn("Failed to parse WebSocket message", zap.Error(err))
 			continue
 		}
@@ -205,6 +337,36 @@ func (ws *WebSocketServer) readLoop(conn *websocket.Conn) {
 	}
 }
 
+// writeLoop is the connection's only writer: it sends queued messages and
+// keepalive pings until the connection closes.
+func (ws *WebSocketServer) writeLoop(client *wsClient) {
+	defer ws.wg.Done()
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case data := <-client.sendCh:
+			client.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := client.conn.WriteMessage(frameType(client.codec), data); err != nil {
+				ws.logger.Warn("Failed to send message", zap.Error(err))
+				client.conn.Close() // unblocks readLoop, which cleans up
+				return
+			}
+
+		case <-ticker.C:
+			client.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				client.conn.Close()
+				return
+			}
+
+		case <-client.done:
+			return
+		}
+	}
+}
+
 func (ws *WebSocketServer) broadcastLoop() {
 	defer ws.wg.Done()
 
@@ -219,18 +381,35 @@ func (ws *WebSocketServer) broadcastLoop() {
 }
 
 func (ws *WebSocketServer) broadcast(msg *Message) {
-	data, err := json.Marshal(msg)
-	if err != nil {
-		ws.logger.Error("Failed to marshal message", zap.Error(err))
-		return
-	}
-
 	ws.connMu.RLock()
 	defer ws.connMu.RUnlock()
 
-	for conn := range ws.conns {
-		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
-			ws.logger.Warn("Failed to send message", zap.Error(err))
+	// Encode once per codec in use rather than once per client
+	encoded := make(map[string][]byte, 1)
+	for client := range ws.conns {
+		name := client.codec.Name()
+		if _, ok := encoded[name]; !ok {
+			data, err := client.codec.Marshal(msg)
+			if err != nil {
+				ws.logger.Error("Failed to marshal message",
+					zap.String("codec", name),
+					zap.Error(err))
+			}
+			encoded[name] = data
+		}
+	}
+
+	// Queue per client, so one slow client neither blocks nor reorders the others
+	for client := range ws.conns {
+		data := encoded[client.codec.Name()]
+		if data == nil {
+			continue
+		}
+		select {
+		case client.sendCh <- data:
+		default:
+			ws.logger.Warn("WebSocket send buffer full, dropping message",
+				zap.String("messageId", msg.ID))
 		}
 	}
 }
@@ -242,26 +421,92 @@ func (ws *WebSocketServer) ConnectionCount() int {
 	return len(ws.conns)
 }
 
+// Poll page size defaults, see SetLimits.
+const (
+	DefaultPollLimit = 100
+	MaxPollLimit     = 500
+)
+
+// pollClientTTL is how long an idle client's cursor is remembered.
+const pollClientTTL = 10 * time.Minute
+
 // PollingServer implements an HTTP polling endpoint for OpenClaw.
+//
+// GET ?since=<ms>&limit=<n> returns at most limit messages newer than since,
+// plus a nextSince cursor and hasMore flag for paging. Clients that identify
+// themselves (clientId query parameter or X-Client-ID header) may omit since
+// to resume from their last cursor.
+//
+// Inbound bodies are decoded by their Content-Type and polls answered in the
+// codec named by the X-Transport-Codec or Accept header, defaulting to JSON.
+// Acknowledgements and errors are always JSON.
 type PollingServer struct {
-	logger  *zap.Logger
-	handler MessageHandler
+	logger    log.Logger
+	handler   MessageHandler
+	authToken string // shared secret required on every request; empty allows all
+	codecs    codecSet
 
 	// Message queue for messages to be polled
 	queueMu sync.RWMutex
 	queue   []*Message
+	lastTS  int64 // timestamp of the newest queued message
 
-	// Track last poll time per client
+	// Page size for polls without a limit, and the largest allowed
+	defaultLimit int
+	maxLimit     int
+
+	// Track cursor and last poll time per client
 	clientsMu sync.RWMutex
-	clients   map[string]int64 // clientID -> lastPollTime
+	clients   map[string]*pollClient
+
+	clock clock.Clock
+}
+
+// pollClient is a polling client's position in the queue.
+type pollClient struct {
+	cursor   int64 // nextSince returned by the last poll
+	lastPoll int64 // unix millis
 }
 
 // NewPollingServer creates a new polling server.
-func NewPollingServer(logger *zap.Logger) *PollingServer {
+func NewPollingServer(logger log.Logger) *PollingServer {
+	if logger == nil {
+		logger = log.Default()
+	}
 	return &PollingServer{
-		logger:  logger,
-		queue:   make([]*Message, 0),
-		clients: make(map[string]int64),
+		logger:       logger,
+		queue:        make([]*Message, 0),
+		defaultLimit: DefaultPollLimit,
+		maxLimit:     MaxPollLimit,
+		clients:      make(map[string]*pollClient),
+		clock:        clock.System,
+		codecs:       newCodecSet(nil),
+	}
+}
+
+// SetCodecs sets the codecs the server accepts besides JSON (DefaultCodecs
+// when none are given). Call it before serving requests.
+func (ps *PollingServer) SetCodecs(codecs ...Codec) {
+	ps.codecs = newCodecSet(codecs)
+}
+
+// SetClock sets the clock that stamps queued and inbound messages and ages
+// idle clients. Set it before the server is in use.
+func (ps *PollingServer) SetClock(c clock.Clock) {
+	ps.clock = clock.Or(c)
+}
+
+// SetLimits sets the page size used when a poll has no limit and the largest
+// limit a client may ask for. Non-positive values keep the current setting.
+func (ps *PollingServer) SetLimits(defaultLimit, maxLimit int) {
+	if maxLimit > 0 {
+		ps.maxLimit = maxLimit
+	}
+	if defaultLimit > 0 {
+		ps.defaultLimit = defaultLimit
+	}
+	if ps.defaultLimit > ps.maxLimit {
+		ps.defaultLimit = ps.maxLimit
 	}
 }
 
@@ -278,12 +523,20 @@ func (ps *PollingServer) Stop(ctx context.Context) error {
 }
 
 // Send queues a message to be polled by OpenClaw.
+//
+// Queued timestamps are made strictly increasing so they can serve as the
+// poll cursor: a message that would tie with or precede the newest one is
+// moved 1ms after it.
 func (ps *PollingServer) Send(msg *Message) error {
 	if msg.Timestamp == 0 {
-		msg.Timestamp = time.Now().UnixMilli()
+		msg.Timestamp = ps.clock.Now().UnixMilli()
 	}
 
 	ps.queueMu.Lock()
+	if msg.Timestamp <= ps.lastTS {
+		msg.Timestamp = ps.lastTS + 1
+	}
+	ps.lastTS = msg.Timestamp
 	ps.queue = append(ps.queue, msg)
 	// Keep only last 1000 messages
 	if len(ps.queue) > 1000 {
@@ -299,72 +552,168 @@ func (ps *PollingServer) SetHandler(handler MessageHandler) {
 	ps.handler = handler
 }
 
+// SetAuthToken requires the token (see WebSocketServer.SetAuthToken) on the
+// poll and inbound endpoints. Call it before serving requests.
+func (ps *PollingServer) SetAuthToken(token string) {
+	ps.authToken = token
+}
+
 // HTTPHandler returns an http.Handler for polling endpoint.
 func (ps *PollingServer) HTTPHandler() http.Handler {
-	return http.HandlerFunc(ps.handlePoll)
+	return ps.requireAuth(ps.handlePoll)
 }
 
 // InboundHandler returns an http.Handler for receiving messages from external IM.
 func (ps *PollingServer) InboundHandler() http.Handler {
-	return http.HandlerFunc(ps.handleInbound)
+	return ps.requireAuth(ps.handleInbound)
+}
+
+// BatchInboundHandler returns an http.Handler for receiving many messages in one request.
+func (ps *PollingServer) BatchInboundHandler() http.Handler {
+	return ps.requireAuth(ps.handleBatchInbound)
+}
+
+// requireAuth rejects requests that do not present the auth token.
+func (ps *PollingServer) requireAuth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !authorized(r, ps.authToken) {
+			ps.logger.Warn("Rejected unauthenticated polling request",
+				zap.String("path", r.URL.Path),
+				zap.String("remoteAddr", r.RemoteAddr))
+			httperr.WriteUIPError(w, protocol.ErrCodeUnauthorized, "unauthorized", "")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// BatchResult is the per-message outcome of a batch inbound request.
+type BatchResult struct {
+	MessageID string `json:"messageId"`
+	OK        bool   `json:"ok"`
+	Error     string `json:"error,omitempty"`
 }
 
 func (ps *PollingServer) handlePoll(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httperr.MethodNotAllowed(w, http.MethodGet)
 		return
 	}
 
-	// Get since parameter
-	sinceStr := r.URL.Query().Get("since")
+	query := r.URL.Query()
+	clientID := query.Get("clientId")
+	if clientID == "" {
+		clientID = r.Header.Get("X-Client-ID")
+	}
+
+	// Get since parameter, falling back to the client's last cursor
+	sinceStr := query.Get("since")
 	var since int64
 	if sinceStr != "" {
 		fmt.Sscanf(sinceStr, "%d", &since)
+	} else if clientID != "" {
+		ps.clientsMu.RLock()
+		if client, ok := ps.clients[clientID]; ok {
+			since = client.cursor
+		}
+		ps.clientsMu.RUnlock()
+	}
+
+	limit := ps.defaultLimit
+	if limitStr := query.Get("limit"); limitStr != "" {
+		if _, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || limit <= 0 {
+			httperr.WriteUIPError(w, protocol.ErrCodeProtocolError, "invalid limit", "")
+			return
+		}
+	}
+	if limit > ps.maxLimit {
+		limit = ps.maxLimit
 	}
 
-	// Get messages since the given timestamp
+	// Get up to limit messages since the given timestamp
 	ps.queueMu.RLock()
-	var messages []*Message
+	messages := make([]*Message, 0)
+	hasMore := false
 	for _, msg := range ps.queue {
-		if msg.Timestamp > since {
-			messages = append(messages, msg)
+		if msg.Timestamp <= since {
+			continue
 		}
+		if len(messages) == limit {
+			hasMore = true
+			break
+		}
+		messages = append(messages, msg)
 	}
 	ps.queueMu.RUnlock()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"messages": messages,
+	nextSince := since
+	if len(messages) > 0 {
+		nextSince = messages[len(messages)-1].Timestamp
+	}
+	if clientID != "" {
+		ps.trackClient(clientID, nextSince)
+	}
+
+	codec := ps.codecs.forResponse(r)
+	data, err := codec.Marshal(&PollResponse{
+		Messages:  messages,
+		NextSince: nextSince,
+		HasMore:   hasMore,
 	})
+	if err != nil {
+		ps.logger.Error("Failed to marshal poll response",
+			zap.String("codec", codec.Name()),
+			zap.Error(err))
+		httperr.WriteUIPError(w, protocol.ErrCodeRuntimeError, "internal error", "")
+		return
+	}
+	w.Header().Set("Content-Type", codec.ContentType())
+	w.Write(data)
+}
+
+// trackClient records a client's cursor and forgets clients idle past pollClientTTL.
+func (ps *PollingServer) trackClient(clientID string, cursor int64) {
+	now := ps.clock.Now().UnixMilli()
+
+	ps.clientsMu.Lock()
+	defer ps.clientsMu.Unlock()
+
+	if _, ok := ps.clients[clientID]; !ok {
+		cutoff := now - pollClientTTL.Milliseconds()
+		for id, client := range ps.clients {
+			if client.lastPoll < cutoff {
+				delete(ps.clients, id)
+			}
+		}
+	}
+	ps.clients[clientID] = &pollClient{cursor: cursor, lastPoll: now}
+}
+
+// ClientCount returns the number of polling clients with a tracked cursor.
+func (ps *PollingServer) ClientCount() int {
+	ps.clientsMu.RLock()
+	defer ps.clientsMu.RUnlock()
+	return len(ps.clients)
 }
 
 func (ps *PollingServer) handleInbound(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		httperr.MethodNotAllowed(w, http.MethodPost)
 		return
 	}
 
 	var msg Message
-	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if !ps.decodeBody(w, r, &msg) {
 		return
 	}
 
-	// Set timestamp if not provided
-	if msg.Timestamp == 0 {
-		msg.Timestamp = time.Now().UnixMilli()
-	}
-
-	// Generate ID if not provided
-	if msg.ID == "" {
-		msg.ID = fmt.Sprintf("msg-%d", time.Now().UnixNano())
-	}
+	normalizeInbound(&msg, ps.clock.Now())
 
 	// Call handler
 	if ps.handler != nil {
 		if err := ps.handler(&msg); err != nil {
 			ps.logger.Error("Message handler error", zap.Error(err))
-			http.Error(w, "Internal error", http.StatusInternalServerError)
+			httperr.WriteUIPError(w, protocol.ErrCodeRuntimeError, "internal error", "")
 			return
 		}
 	}
@@ -376,6 +725,106 @@ func (ps *PollingServer) handleInbound(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleBatchInbound accepts a JSON array of messages. Each message is passed to
+// the handler independently; failures are reported per item with a 207 status
+// instead of failing the whole batch.
+func (ps *PollingServer) handleBatchInbound(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		httperr.MethodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var msgs []*Message
+	if !ps.decodeBody(w, r, &msgs) {
+		return
+	}
+
+	results := make([]BatchResult, 0, len(msgs))
+	failed := 0
+	for i, msg := range msgs {
+		if msg == nil {
+			results = append(results, BatchResult{OK: false, Error: "null message"})
+			failed++
+			continue
+		}
+		// Suffix generated IDs with the index so items in one batch never collide
+		if msg.ID == "" {
+			msg.ID = fmt.Sprintf("msg-%d-%d", time.Now().UnixNano(), i)
+		}
+		normalizeInbound(msg, ps.clock.Now())
+
+		result := BatchResult{MessageID: msg.ID, OK: true}
+		if ps.handler != nil {
+			if err := ps.handler(msg); err != nil {
+				ps.logger.Error("Message handler error",
+					zap.String("messageId", msg.ID),
+					zap.Error(err))
+				result.OK = false
+				result.Error = err.Error()
+				failed++
+			}
+		}
+		results = append(results, result)
+	}
+
+	status := http.StatusOK
+	if failed > 0 {
+		status = http.StatusMultiStatus
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":       failed == 0,
+		"accepted": len(msgs) - failed,
+		"failed":   failed,
+		"results":  results,
+	})
+}
+
+// decodeBody decodes the request body with the codec its Content-Type
+// names, writing the error response and returning false on failure.
+func (ps *PollingServer) decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	codec := ps.codecs.forRequest(r)
+	var err error
+	if codec == JSONCodec {
+		err = json.NewDecoder(r.Body).Decode(v)
+	} else {
+		var data []byte
+		if data, err = io.ReadAll(r.Body); err == nil {
+			err = codec.Unmarshal(data, v)
+		}
+	}
+	if err == nil {
+		return true
+	}
+	if limit, ok := httplimit.TooLarge(err); ok {
+		httplimit.WriteTooLarge(w, limit)
+		return false
+	}
+	message := "invalid JSON"
+	if codec != JSONCodec {
+		message = "invalid " + codec.Name() + " body"
+	}
+	httperr.WriteUIPError(w, protocol.ErrCodeProtocolError, message, "")
+	return false
+}
+
+// normalizeInbound fills in the timestamp (now) and ID of an inbound
+// message when missing. IDs come from the system clock, which unlike a
+// fake one never repeats.
+func normalizeInbound(msg *Message, now time.Time) {
+	// Set timestamp if not provided
+	if msg.Timestamp == 0 {
+		msg.Timestamp = now.UnixMilli()
+	}
+
+	// Generate ID if not provided
+	if msg.ID == "" {
+		msg.ID = fmt.Sprintf("msg-%d", time.Now().UnixNano())
+	}
+}
+
 // QueueSize returns the number of messages in the queue.
 func (ps *PollingServer) QueueSize() int {
 	ps.queueMu.RLock()
@@ -0,0 +1,146 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+func startWebSocketServer(t *testing.T) (*WebSocketServer, *websocket.Conn) {
+	t.Helper()
+	ws := NewWebSocketServer(WebSocketConfig{}, zap.NewNop())
+	ws.Start(context.Background())
+	srv := httptest.NewServer(ws.HTTPHandler())
+	t.Cleanup(func() {
+		ws.Stop(context.Background())
+		srv.Close()
+	})
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	deadline := time.Now().Add(2 * time.Second)
+	for ws.ConnectionCount() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("client never registered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return ws, conn
+}
+
+// TestWebSocketConcurrentBroadcast broadcasts to one connection from many
+// goroutines. Run with -race: writes must all go through the client's
+// writeLoop, and each sender's messages must arrive intact and in order.
+func TestWebSocketConcurrentBroadcast(t *testing.T) {
+	const senders, perSender = 8, 25
+	ws, conn := startWebSocketServer(t)
+
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			for i := 0; i < perSender; i++ {
+				msg := &Message{ID: fmt.Sprintf("%d-%d", s, i), Text: strings.Repeat("x", 512)}
+				if s%2 == 0 {
+					ws.broadcast(msg)
+				} else {
+					for ws.Send(msg) != nil {
+						time.Sleep(time.Millisecond)
+					}
+				}
+			}
+		}(s)
+	}
+
+	next := make([]int, senders)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for n := 0; n < senders*perSender; n++ {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("read %d: %v", n, err)
+		}
+		var msg Message
+		if err := JSONCodec.Unmarshal(data, &msg); err != nil {
+			t.Fatalf("read %d: corrupt frame: %v", n, err)
+		}
+		var s, i int
+		if _, err := fmt.Sscanf(msg.ID, "%d-%d", &s, &i); err != nil || s < 0 || s >= senders {
+			t.Fatalf("unexpected message ID %q", msg.ID)
+		}
+		if i != next[s] {
+			t.Fatalf("sender %d: got message %d, want %d", s, i, next[s])
+		}
+		next[s]++
+	}
+	wg.Wait()
+}
+
+func poll(t *testing.T, ps *PollingServer, query string) PollResponse {
+	t.Helper()
+	w := httptest.NewRecorder()
+	ps.HTTPHandler().ServeHTTP(w, httptest.NewRequest("GET", "/poll?"+query, nil))
+	if w.Code != 200 {
+		t.Fatalf("poll %q: status %d: %s", query, w.Code, w.Body)
+	}
+	var resp PollResponse
+	if err := JSONCodec.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("poll %q: %v", query, err)
+	}
+	return resp
+}
+
+func TestPollingPagination(t *testing.T) {
+	ps := NewPollingServer(zap.NewNop())
+	ps.SetLimits(2, 3)
+	for i := 1; i <= 7; i++ {
+		// Send moves tied timestamps 1ms apart: m1 is 1000, m7 is 1006
+		ps.Send(&Message{ID: fmt.Sprintf("m%d", i), Timestamp: 1000})
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    []string
+		hasMore bool
+	}{
+		{"default limit", "clientId=c1", []string{"m1", "m2"}, true},
+		{"resumes from client cursor", "clientId=c1&limit=2", []string{"m3", "m4"}, true},
+		{"limit capped at max", "clientId=c1&limit=50", []string{"m5", "m6", "m7"}, false},
+		{"caught up", "clientId=c1", nil, false},
+		{"explicit since wins", "clientId=c1&since=1003&limit=1", []string{"m5"}, true},
+		{"other client starts at zero", "clientId=c2&limit=3", []string{"m1", "m2", "m3"}, true},
+	}
+	for _, tt := range tests {
+		resp := poll(t, ps, tt.query)
+		var ids []string
+		for _, m := range resp.Messages {
+			ids = append(ids, m.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(tt.want) || resp.HasMore != tt.hasMore {
+			t.Errorf("%s: got %v hasMore=%v, want %v hasMore=%v", tt.name, ids, resp.HasMore, tt.want, tt.hasMore)
+		}
+		if len(resp.Messages) > 0 && resp.NextSince != resp.Messages[len(resp.Messages)-1].Timestamp {
+			t.Errorf("%s: nextSince = %d, want the last message's timestamp", tt.name, resp.NextSince)
+		}
+	}
+	if ps.ClientCount() != 2 {
+		t.Errorf("ClientCount = %d, want 2", ps.ClientCount())
+	}
+
+	w := httptest.NewRecorder()
+	ps.HTTPHandler().ServeHTTP(w, httptest.NewRequest("GET", "/poll?limit=0", nil))
+	if w.Code != 400 {
+		t.Errorf("limit=0: status %d, want 400", w.Code)
+	}
+}
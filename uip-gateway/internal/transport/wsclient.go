@@ -0,0 +1,282 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+
+	"github.com/zlc_ai/uip-gateway/internal/backoff"
+	"github.com/zlc_ai/uip-gateway/internal/clock"
+	"github.com/zlc_ai/uip-gateway/internal/log"
+)
+
+// DefaultReconnectInterval caps the reconnect delay of a WebSocketClient
+// whose config leaves it unset.
+const DefaultReconnectInterval = 5 * time.Second
+
+// WebSocket client keepalive: a ping every wsPingInterval, and the
+// connection is considered dead when nothing arrives for wsPongWait.
+const (
+	wsPingInterval = 30 * time.Second
+	wsPongWait     = 60 * time.Second
+	wsWriteWait    = 10 * time.Second
+)
+
+// WebSocketClientConfig configures a WebSocketClient.
+type WebSocketClientConfig struct {
+	// URL is the ws:// or wss:// endpoint to dial.
+	URL string
+	// ReconnectInterval caps the delay between reconnect attempts, which
+	// starts at backoff.Base and doubles on each failure.
+	ReconnectInterval time.Duration
+	// AuthToken, when set, is presented as "Authorization: Bearer <token>".
+	AuthToken string
+	// EnableCompression offers permessage-deflate to the server.
+	EnableCompression bool
+	// Clock stamps received messages (clock.System if nil).
+	Clock clock.Clock
+}
+
+// WebSocketClient is a Transport for deployments where OpenClaw runs the
+// WebSocket server and the gateway connects to it. It keeps one connection
+// open, reconnecting after failures, and delivers received frames to the
+// handler. Messages sent while disconnected wait in the queue.
+type WebSocketClient struct {
+	logger    log.Logger
+	config    WebSocketClientConfig
+	dialer    websocket.Dialer
+	handler   MessageHandler
+	connected atomic.Bool
+
+	// Message queue for outgoing messages
+	outQueue chan *Message
+
+	// Shutdown
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewWebSocketClient creates a new WebSocket client transport.
+func NewWebSocketClient(config WebSocketClientConfig, logger log.Logger) *WebSocketClient {
+	if logger == nil {
+		logger = log.Default()
+	}
+	if config.ReconnectInterval <= 0 {
+		config.ReconnectInterval = DefaultReconnectInterval
+	}
+	config.Clock = clock.Or(config.Clock)
+	return &WebSocketClient{
+		logger: logger,
+		config: config,
+		dialer: websocket.Dialer{
+			Proxy:             http.ProxyFromEnvironment,
+			HandshakeTimeout:  wsWriteWait,
+			EnableCompression: config.EnableCompression,
+		},
+		outQueue: make(chan *Message, 100),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start connects in the background; it does not wait for the first
+// connection to succeed.
+func (c *WebSocketClient) Start(ctx context.Context) error {
+	if c.config.URL == "" {
+		return fmt.Errorf("websocket client: url is required")
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	go c.run(runCtx)
+	c.logger.Info("WebSocket client started", zap.String("url", c.config.URL))
+	return nil
+}
+
+// Stop closes the connection and stops reconnecting. Queued messages that
+// were not sent are dropped.
+func (c *WebSocketClient) Stop(ctx context.Context) error {
+	if c.cancel == nil {
+		return nil
+	}
+	c.cancel()
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	c.logger.Info("WebSocket client stopped")
+	return nil
+}
+
+// Send queues a message to be sent to the server.
+func (c *WebSocketClient) Send(msg *Message) error {
+	select {
+	case c.outQueue <- msg:
+		return nil
+	default:
+		return fmt.Errorf("message queue full")
+	}
+}
+
+// SetHandler sets the handler for incoming messages. Call it before Start.
+func (c *WebSocketClient) SetHandler(handler MessageHandler) {
+	c.handler = handler
+}
+
+// Connected reports whether the client currently has an open connection.
+func (c *WebSocketClient) Connected() bool {
+	return c.connected.Load()
+}
+
+// run dials and serves connections until ctx is cancelled.
+func (c *WebSocketClient) run(ctx context.Context) {
+	defer close(c.done)
+
+	header := http.Header{}
+	if c.config.AuthToken != "" {
+		header.Set("Authorization", "Bearer "+c.config.AuthToken)
+	}
+
+	attempt := 0
+	var pending *Message // write that failed on the last connection
+	for ctx.Err() == nil {
+		conn, resp, err := c.dialer.DialContext(ctx, c.config.URL, header)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			attempt++
+			delay := backoff.Delay(attempt, 0, c.config.ReconnectInterval)
+			fields := []zap.Field{
+				zap.Int("attempt", attempt),
+				zap.Duration("retryIn", delay),
+				zap.Error(err),
+			}
+			if resp != nil {
+				fields = append(fields, zap.Int("status", resp.StatusCode))
+			}
+			c.logger.Warn("WebSocket client connect failed", fields...)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		attempt = 0
+		c.connected.Store(true)
+		c.logger.Info("WebSocket client connected", zap.String("url", c.config.URL))
+		pending = c.serve(ctx, conn, pending)
+		c.connected.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+
+		// Reconnect after the shortest backoff delay, so a server that
+		// accepts and immediately drops connections is not hammered
+		c.logger.Warn("WebSocket client disconnected, reconnecting")
+		select {
+		case <-time.After(backoff.Delay(1, 0, c.config.ReconnectInterval)):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// serve writes queued messages to conn, starting with pending, and reads
+// from it until the connection fails or ctx is cancelled. It returns the
+// message whose write failed, to be retried on the next connection.
+func (c *WebSocketClient) serve(ctx context.Context, conn *websocket.Conn, pending *Message) *Message {
+	readDone := make(chan struct{})
+	go c.readLoop(conn, readDone)
+	defer func() {
+		conn.Close() // unblocks readLoop
+		<-readDone
+	}()
+
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+
+	// gorilla/websocket allows one concurrent writer: all writes happen here
+	write := func(msg *Message) error {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			c.logger.Error("Failed to marshal message", zap.Error(err))
+			return nil
+		}
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		return conn.WriteMessage(websocket.TextMessage, data)
+	}
+
+	if pending != nil {
+		if err := write(pending); err != nil {
+			c.logger.Warn("Failed to send message", zap.Error(err))
+			return pending
+		}
+	}
+	for {
+		select {
+		case msg := <-c.outQueue:
+			if err := write(msg); err != nil {
+				c.logger.Warn("Failed to send message", zap.Error(err))
+				return msg
+			}
+
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return nil
+			}
+
+		case <-readDone:
+			return nil
+
+		case <-ctx.Done():
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""),
+				time.Now().Add(time.Second))
+			return nil
+		}
+	}
+}
+
+func (c *WebSocketClient) readLoop(conn *websocket.Conn, done chan struct{}) {
+	defer close(done)
+
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				c.logger.Warn("WebSocket read error", zap.Error(err))
+			}
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(wsPongWait))
+
+		// Parse message
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.logger.Warn("Failed to parse WebSocket message", zap.Error(err))
+			continue
+		}
+		normalizeInbound(&msg, c.config.Clock.Now())
+
+		// Call handler
+		if c.handler != nil {
+			if err := c.handler(&msg); err != nil {
+				c.logger.Error("Message handler error", zap.Error(err))
+			}
+		}
+	}
+}